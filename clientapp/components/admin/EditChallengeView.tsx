@@ -37,6 +37,8 @@ import { toast } from 'react-toastify/unstyled';
 import { useNavigate } from "react-router";
 import { UploadFileDialog } from "components/dialogs/UploadFileDialog";
 import { Switch } from "components/ui/switch";
+import { FlagInjectionFields, flagInjectionFromForm, flagInjectionSchema, flagInjectionToForm } from "./game/FlagInjectionForm";
+import { SandboxFields, sandboxFromForm, sandboxSchema, sandboxToForm } from "./game/SandboxForm";
 import { useTheme } from "next-themes";
 import ThemedEditor from "components/modules/ThemedEditor";
 
@@ -81,7 +83,7 @@ function ContainerForm({ control, index, removeContainer }: ContainerFormProps)
                     删除容器
                 </Button>
             </div>
-            <div className="grid grid-cols-2 gap-4">
+            <div className="grid grid-cols-3 gap-4">
                 <FormField
                     control={control}
                     name={`container_config.${index}.name`}
@@ -114,6 +116,25 @@ function ContainerForm({ control, index, removeContainer }: ContainerFormProps)
                         </FormItem>
                     )}
                 />
+                <FormField
+                    control={control}
+                    name={`container_config.${index}.component`}
+                    render={({ field }) => (
+                        <FormItem>
+                            <div className="flex items-center h-[20px]">
+                                <FormLabel>组件</FormLabel>
+                                <div className="flex-1" />
+                                <FormMessage className="text-[14px]" />
+                            </div>
+                            <FormControl>
+                                <Input {...field} value={field.value ?? ""} placeholder="main" />
+                            </FormControl>
+                            <FormDescription>
+                                同一组件的容器共享网络, 其他组件可以通过组件名访问
+                            </FormDescription>
+                        </FormItem>
+                    )}
+                />
             </div>
             <FormField
                 control={control}
@@ -236,6 +257,8 @@ function ContainerForm({ control, index, removeContainer }: ContainerFormProps)
                     )}
                 />
             </div>
+            <FlagInjectionFields control={control} index={index} />
+            <SandboxFields control={control} index={index} />
             <div className="mt-4">
                 <div className="flex items-center mb-3">
                     <span className="text-md font-semibold">端口暴露</span>
@@ -244,13 +267,13 @@ function ContainerForm({ control, index, removeContainer }: ContainerFormProps)
                         type="button"
                         variant={"outline"}
                         className="[&_svg]:size-5"
-                        onClick={() => appendPort({ name: "", port: 0 })}
+                        onClick={() => appendPort({ name: "", port: 0, http: false, internal: false, protocol: "TCP" })}
                     >
                         <PlusCircle />
                         添加端口
                     </Button>
                 </div>
-                <span className="text-sm text-foreground/50">端口名称是你需要映射出来的端口的名称, 这会显示给选手, 端口号是容器内服务的端口, A1CTF会自动映射随机端口到宿主机上, 注意！一道题的不同容器不能同时暴露相同的端口! 比如: 容器1和容器2同时要求暴露80端口, 这会导致映射出问题! 请你在制作docker的时候选择不同的监听端口</span>
+                <span className="text-sm text-foreground/50">端口名称是你需要映射出来的端口的名称, 这会显示给选手, 端口号是容器内服务的端口, A1CTF会自动映射随机端口到宿主机上, 注意！一道题的不同容器不能同时暴露相同的端口! 比如: 容器1和容器2同时要求暴露80端口, 这会导致映射出问题! 请你在制作docker的时候选择不同的监听端口。开启 HTTP 的端口在平台配置了题目域名后会以网址的形式显示给选手, 仅内部的端口不会暴露给选手, 只能被同一实例的其他组件通过 组件名:端口 访问。UDP 端口不能开启 HTTP, 也不会经过平台代理</span>
                 <div className="h-4" />
                 {portFields.map((port, portIndex) => (
                     <div key={port.id} className="flex gap-2 items-end mb-2">
@@ -286,6 +309,66 @@ function ContainerForm({ control, index, removeContainer }: ContainerFormProps)
                                 </FormItem>
                             )}
                         />
+                        <FormField
+                            control={control}
+                            name={`container_config.${index}.expose_ports.${portIndex}.protocol`}
+                            render={({ field }) => (
+                                <FormItem className="w-[100px]">
+                                    <div className="flex items-center w- h-[20px]">
+                                        <FormLabel>协议</FormLabel>
+                                    </div>
+                                    <Select onValueChange={field.onChange} value={field.value || "TCP"}>
+                                        <FormControl>
+                                            <SelectTrigger>
+                                                <SelectValue />
+                                            </SelectTrigger>
+                                        </FormControl>
+                                        <SelectContent>
+                                            <SelectItem value="TCP">TCP</SelectItem>
+                                            <SelectItem value="UDP">UDP</SelectItem>
+                                        </SelectContent>
+                                    </Select>
+                                </FormItem>
+                            )}
+                        />
+                        <FormField
+                            control={control}
+                            name={`container_config.${index}.expose_ports.${portIndex}.http`}
+                            render={({ field }) => (
+                                <FormItem className="flex flex-col items-center">
+                                    <div className="flex items-center w- h-[20px]">
+                                        <FormLabel>HTTP</FormLabel>
+                                    </div>
+                                    <FormControl>
+                                        <div className="h-9 flex items-center">
+                                            <Switch
+                                                checked={field.value ?? false}
+                                                onCheckedChange={field.onChange}
+                                            />
+                                        </div>
+                                    </FormControl>
+                                </FormItem>
+                            )}
+                        />
+                        <FormField
+                            control={control}
+                            name={`container_config.${index}.expose_ports.${portIndex}.internal`}
+                            render={({ field }) => (
+                                <FormItem className="flex flex-col items-center">
+                                    <div className="flex items-center w- h-[20px]">
+                                        <FormLabel>仅内部</FormLabel>
+                                    </div>
+                                    <FormControl>
+                                        <div className="h-9 flex items-center">
+                                            <Switch
+                                                checked={field.value ?? false}
+                                                onCheckedChange={field.onChange}
+                                            />
+                                        </div>
+                                    </FormControl>
+                                </FormItem>
+                            )}
+                        />
                         <Button variant="destructive" type="button" onClick={() => removePort(portIndex)}>
                             删除端口
                         </Button>
@@ -493,6 +576,7 @@ export function EditChallengeView({ challenge_info }: { challenge_info: AdminCha
             z.object({
                 name: z.string().min(1, { message: "请输入容器名称" }),
                 image: z.string().min(1, { message: "请输入镜像地址" }),
+                component: z.string().regex(/^([a-z0-9]([-a-z0-9]{0,18}[a-z0-9])?)?$/, { message: "组件名需要是小写字母、数字和 -" }).optional(),
                 command: z.array(z.string()).nullable(),
                 env: z.string().nullable(),
                 expose_ports: z.array(
@@ -500,12 +584,17 @@ export function EditChallengeView({ challenge_info }: { challenge_info: AdminCha
                         name: z.string().min(1, { message: "请输入端口名称" }),
                         port: z.coerce.number({ invalid_type_error: "请输入数字" })
                             .min(1, { message: "端口号不能小于 1" })
-                            .max(65535, { message: "端口号不能大于 65535" })
+                            .max(65535, { message: "端口号不能大于 65535" }),
+                        http: z.boolean().optional(),
+                        internal: z.boolean().optional(),
+                        protocol: z.enum(["TCP", "UDP"]).optional()
                     })
                 ),
                 cpu_limit: z.coerce.number({ invalid_type_error: "请输入 CPU 限制" }),
                 memory_limit: z.coerce.number({ invalid_type_error: "请输入内存限制" }),
-                storage_limit: z.coerce.number({ invalid_type_error: "请输入存储空间限制" })
+                storage_limit: z.coerce.number({ invalid_type_error: "请输入存储空间限制" }),
+                flag_injection: flagInjectionSchema.optional(),
+                sandbox: sandboxSchema.optional()
             })
         ),
         attachments: z.array(
@@ -560,17 +649,23 @@ export function EditChallengeView({ challenge_info }: { challenge_info: AdminCha
             container_config: challenge_info.container_config.map((e) => ({
                 name: e.name,
                 image: e.image,
+                component: e.component ?? "",
                 command: e.command ?? [],
                 env: e.env ? env_to_string(e.env) : "",
                 expose_ports: e.expose_ports.map((e2) => (
                     {
                         name: e2.name,
                         port: e2.port,
+                        http: e2.http ?? false,
+                        internal: e2.internal ?? false,
+                        protocol: e2.protocol == "UDP" ? "UDP" as const : "TCP" as const,
                     }
                 )),
                 cpu_limit: e.cpu_limit,
                 memory_limit: e.memory_limit,
-                storage_limit: e.storage_limit
+                storage_limit: e.storage_limit,
+                flag_injection: flagInjectionToForm(e.flag_injection),
+                sandbox: sandboxToForm(e)
             })) || [],
             attachments: challenge_info.attachments?.map((e) => ({
                 attach_hash: e.attach_hash || "",
@@ -613,12 +708,15 @@ export function EditChallengeView({ challenge_info }: { challenge_info: AdminCha
             container_config: values.container_config.map((e) => ({
                 name: e.name,
                 image: e.image,
+                component: e.component || undefined,
                 command: e.command ? e.command : [],
                 env: (e.env && e.env != "") ? string_to_env(e.env || "") : [],
                 expose_ports: e.expose_ports,
                 cpu_limit: e.cpu_limit,
                 memory_limit: e.memory_limit,
-                storage_limit: e.storage_limit
+                storage_limit: e.storage_limit,
+                flag_injection: flagInjectionFromForm(e.flag_injection),
+                ...sandboxFromForm(e.sandbox)
             })),
             create_time: challenge_info.create_time,
             description: values.description,
@@ -940,12 +1038,15 @@ export function EditChallengeView({ challenge_info }: { challenge_info: AdminCha
                                         appendContainer({
                                             name: "",
                                             image: "",
+                                            component: "",
                                             command: null,
                                             env: null,
                                             expose_ports: [],
                                             cpu_limit: 100,
                                             memory_limit: 64,
-                                            storage_limit: 128
+                                            storage_limit: 128,
+                                            flag_injection: flagInjectionToForm(),
+                                            sandbox: sandboxToForm()
                                         })
                                     }
                                 >
@@ -67,6 +67,7 @@ export function EditGameView({ game_info }: { game_info: AdminFullGameInfo }) {
             game_icon_light: game_info.game_icon_light || "",
             game_icon_dark: game_info.game_icon_dark || "",
             wp_expire_time: game_info.wp_expire_time ? dayjs(game_info.wp_expire_time).toDate() : new Date(),
+            freeze_time: game_info.freeze_time ? dayjs(game_info.freeze_time).toDate() : null,
             visible: game_info.visible,
             first_blood_reward: game_info.first_blood_reward,
             second_blood_reward: game_info.second_blood_reward,
@@ -76,6 +77,8 @@ export function EditGameView({ game_info }: { game_info: AdminFullGameInfo }) {
                 stage_name: stage.stage_name,
                 start_time: dayjs(stage.start_time).toDate(),
                 end_time: dayjs(stage.end_time).toDate(),
+                score_multiplier: stage.score_multiplier || 1,
+                promote_top_n: stage.promote_top_n || 0,
             })) : [],
             challenges: game_info.challenges?.map((challenge) => ({
                 challenge_id: challenge.challenge_id,
@@ -87,9 +90,11 @@ export function EditGameView({ game_info }: { game_info: AdminFullGameInfo }) {
                 minimal_score: challenge.minimal_score,
                 solve_count: challenge.solve_count || 0,
                 hints: challenge.hints?.map((hint) => ({
+                    hint_id: hint.hint_id,
                     content: hint.content,
                     create_time: dayjs(hint.create_time).toDate(),
-                    visible: hint.visible
+                    visible: hint.visible,
+                    cost: hint.cost || 0,
                 })),
                 visible: challenge.visible || false,
                 belong_stage: challenge.belong_stage!,
@@ -137,6 +142,7 @@ export function EditGameView({ game_info }: { game_info: AdminFullGameInfo }) {
             container_number_limit: values.container_number_limit,
             require_wp: values.require_wp,
             wp_expire_time: format_date(values.wp_expire_time ?? new Date()),
+            freeze_time: values.freeze_time ? format_date(values.freeze_time) : null,
             stages: values.stages,
             visible: values.visible,
             team_policy: values.team_policy,
@@ -22,6 +22,8 @@ interface TimePoint {
     name: string;
     startTime: Date;
     endTime: Date;
+    scoreMultiplier: number;
+    promoteTopN: number;
 }
 
 interface ChallengeBlock {
@@ -74,6 +76,8 @@ export function GameTimelineEditor({
             stage_name: tp.name,
             start_time: tp.startTime,
             end_time: tp.endTime,
+            score_multiplier: tp.scoreMultiplier ?? 1,
+            promote_top_n: tp.promoteTopN ?? 0,
         }));
 
         form.setValue("stages", stages);
@@ -125,6 +129,8 @@ export function GameTimelineEditor({
         name: stage.stage_name,
         startTime: stage.start_time,
         endTime: stage.end_time,
+        scoreMultiplier: stage.score_multiplier ?? 1,
+        promoteTopN: stage.promote_top_n ?? 0,
     }));
 
     const challenges = (watchedChallenges || []).map(challenge => {
@@ -176,6 +182,8 @@ export function GameTimelineEditor({
             now.setHours(17, 0, 0, 0);
             return now;
         })(),
+        scoreMultiplier: 1,
+        promoteTopN: 0,
     });
 
     const timelineRef = useRef<HTMLDivElement>(null);
@@ -251,6 +259,8 @@ export function GameTimelineEditor({
             name: newTimePoint.name,
             startTime: newTimePoint.startTime,
             endTime: newTimePoint.endTime,
+            scoreMultiplier: 1,
+            promoteTopN: 0,
         };
         handleTimePointsChange([...timePoints, newPoint]);
 
@@ -279,6 +289,8 @@ export function GameTimelineEditor({
                 name: timePoint.name,
                 startTime: timePoint.startTime,
                 endTime: timePoint.endTime,
+                scoreMultiplier: timePoint.scoreMultiplier,
+                promoteTopN: timePoint.promoteTopN,
             });
             setIsEditingTimePoint(id);
         }
@@ -295,6 +307,8 @@ export function GameTimelineEditor({
                     name: editingTimePoint.name,
                     startTime: editingTimePoint.startTime,
                     endTime: editingTimePoint.endTime,
+                    scoreMultiplier: editingTimePoint.scoreMultiplier,
+                    promoteTopN: editingTimePoint.promoteTopN,
                 }
                 : tp
         );
@@ -520,6 +534,34 @@ export function GameTimelineEditor({
                                 />
                             </div>
                         </div>
+                        <div className="grid grid-cols-2 gap-4">
+                            <div>
+                                <div className='h-[30px] flex items-center'>
+                                    <Label htmlFor="editStageMultiplier">{t("timeline.score_multiplier")}</Label>
+                                </div>
+                                <Input
+                                    id="editStageMultiplier"
+                                    type="number"
+                                    min={0}
+                                    step={0.1}
+                                    value={editingTimePoint.scoreMultiplier}
+                                    onChange={(e) => setEditingTimePoint(prev => ({ ...prev, scoreMultiplier: Number(e.target.value) }))}
+                                />
+                            </div>
+                            <div>
+                                <div className='h-[30px] flex items-center'>
+                                    <Label htmlFor="editStagePromoteTopN">{t("timeline.promote_top_n")}</Label>
+                                </div>
+                                <Input
+                                    id="editStagePromoteTopN"
+                                    type="number"
+                                    min={0}
+                                    step={1}
+                                    value={editingTimePoint.promoteTopN}
+                                    onChange={(e) => setEditingTimePoint(prev => ({ ...prev, promoteTopN: Number(e.target.value) }))}
+                                />
+                            </div>
+                        </div>
                         <div className="flex justify-end gap-2">
                             <Button variant="outline" onClick={() => setIsEditingTimePoint(null)}>
                                 {commonT("cancel")}
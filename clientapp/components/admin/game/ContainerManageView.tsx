@@ -389,8 +389,9 @@ export function ContainerManageView({
 
                 let ports: string[] = []
                 if (row.original.container_ports && row.original.container_ports.length > 0) {
-                    ports = row.original.container_ports.map(port =>
-                        `${port.ip}:${port.port} (${port.port_name})`
+                    ports = row.original.container_ports.map(port => port.url
+                        ? `${port.url} (${port.port_name})`
+                        : `${port.ip}:${port.port} (${port.port_name}${port.protocol == "UDP" ? "/udp" : ""})`
                     );
                 }
 
@@ -1,6 +1,7 @@
-import React from 'react';
+import React, { useState } from 'react';
 
 import { Input } from 'components/ui/input';
+import { Button } from 'components/ui/button';
 import {
     FormField,
     FormItem,
@@ -44,6 +45,17 @@ export function DetailedSettingsModule({
 
     const { t } = useTranslation("game_edit")
 
+    const [unfreezeTime, setUnfreezeTime] = useState(game_info.unfreeze_time)
+
+    // 解除封榜，公布最终排行榜
+    const handleUnfreeze = () => {
+        api.admin.unfreezeScoreboard(game_info.game_id).then((res) => {
+            game_info.unfreeze_time = res.data.data.unfreeze_time
+            setUnfreezeTime(res.data.data.unfreeze_time)
+            toast.success(t("detail.freeze_time.unfreeze_success"))
+        })
+    }
+
     // 监听 poster 字段变化，用于实时预览
     const watchedPoster = useWatch({ control: form.control, name: 'poster' });
 
@@ -159,6 +171,37 @@ export function DetailedSettingsModule({
                         )}
                     />
 
+                    {/* 封榜时间 */}
+                    <FormField
+                        control={form.control}
+                        name={`freeze_time`}
+                        render={({ field }) => (
+                            <FormItem className="flex flex-col">
+                                <FormLabel>{t("detail.freeze_time.title")}</FormLabel>
+                                <div className="flex items-center gap-2">
+                                    <DateTimePicker24h
+                                        date={field.value ?? undefined}
+                                        setDate={field.onChange}
+                                    />
+                                    <Button type="button" variant="outline" onClick={() => field.onChange(null)}>
+                                        {t("detail.freeze_time.clear")}
+                                    </Button>
+                                    {game_info.freeze_time && !unfreezeTime && new Date() >= new Date(game_info.end_time) && (
+                                        <Button type="button" variant="destructive" onClick={handleUnfreeze}>
+                                            {t("detail.freeze_time.unfreeze")}
+                                        </Button>
+                                    )}
+                                </div>
+                                <FormDescription>
+                                    {unfreezeTime
+                                        ? t("detail.freeze_time.unfrozen", { time: new Date(unfreezeTime).toLocaleString() })
+                                        : t("detail.freeze_time.description")}
+                                </FormDescription>
+                                <FormMessage />
+                            </FormItem>
+                        )}
+                    />
+
                     {/* 队伍人数限制 */}
                     <FormField
                         control={form.control}
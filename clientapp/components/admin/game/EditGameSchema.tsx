@@ -35,11 +35,15 @@ export const GameChallengeSchema = z.object({
     difficulty: z.coerce.number().min(1, '请输入一个有效的数字'),
     minimal_score: z.coerce.number().min(0, '请输入一个有效的数字'),
     enable_blood_reward: z.boolean(),
+    warm_pool_size: z.coerce.number().min(0, '请输入一个有效的数字').max(100, '预热池最多 100 个实例').optional(),
     hints: z.array(
         z.object({
+            // 解锁记录通过 hint_id 关联提示，保存时需要原样带回去
+            hint_id: z.string().optional(),
             content: z.string().optional(),
             create_time: z.string(),
             visible: z.boolean(),
+            cost: z.coerce.number().min(0, '请输入一个有效的数字'),
         })
     ),
     visible: z.boolean(),
@@ -69,6 +73,7 @@ export const EditGameFormSchema = z.object({
     container_number_limit: z.coerce.number().min(1),
     require_wp: z.boolean(),
     wp_expire_time: z.date().optional(),
+    freeze_time: z.date().optional().nullable(),
     first_blood_reward: z.coerce.number(),
     second_blood_reward: z.coerce.number(),
     third_blood_reward: z.coerce.number(),
@@ -78,6 +83,8 @@ export const EditGameFormSchema = z.object({
             stage_name: z.string().nonempty(),
             start_time: z.date(),
             end_time: z.date(),
+            score_multiplier: z.coerce.number().min(0).optional(),
+            promote_top_n: z.coerce.number().int().min(0).optional(),
         })
     ).optional(),
     visible: z.boolean(),
@@ -95,9 +102,11 @@ export const EditGameFormSchema = z.object({
             enable_blood_reward: z.boolean(),
             hints: z.array(
                 z.object({
+                    hint_id: z.string().optional(),
                     content: z.string(),
                     create_time: z.date(),
                     visible: z.boolean(),
+                    cost: z.coerce.number().min(0, '请输入一个有效的数字'),
                 })
             ),
             visible: z.boolean(),
@@ -0,0 +1,223 @@
+import {
+    FormControl,
+    FormDescription,
+    FormField,
+    FormItem,
+    FormLabel,
+    FormMessage,
+} from "components/ui/form"
+
+import { Input } from "components/ui/input";
+import { Switch } from "components/ui/switch";
+import { z } from "zod"
+import { FlagInjection } from "utils/A1API";
+
+export const flagInjectionSchema = z.object({
+    env_name: z.string().regex(/^([A-Za-z_][A-Za-z0-9_]*)?$/, { message: "环境变量名不合法" }),
+    disable_env: z.boolean(),
+    file_path: z.string().regex(/^(\/[^/]+)*$/, { message: "需要是绝对路径" }),
+    file_mode: z.string().regex(/^[0-7]{0,4}$/, { message: "请输入八进制权限, 例如 0444" }),
+    file_uid: z.string().regex(/^\d*$/, { message: "请输入数字" }),
+    file_gid: z.string().regex(/^\d*$/, { message: "请输入数字" }),
+    template_command: z.boolean(),
+    exec_command: z.string(),
+})
+
+export type FlagInjectionFormValues = z.infer<typeof flagInjectionSchema>
+
+export function flagInjectionToForm(injection?: FlagInjection | null): FlagInjectionFormValues {
+    return {
+        env_name: injection?.env_name ?? "",
+        disable_env: injection?.disable_env ?? false,
+        file_path: injection?.file_path ?? "",
+        file_mode: injection?.file_mode != null ? "0" + injection.file_mode.toString(8) : "",
+        file_uid: injection?.file_uid != null ? String(injection.file_uid) : "",
+        file_gid: injection?.file_gid != null ? String(injection.file_gid) : "",
+        template_command: injection?.template_command ?? false,
+        exec_command: execCommandToForm(injection?.exec_command),
+    }
+}
+
+// 表单里只填写 shell 命令, 提交的时候通过 sh -c 执行
+function execCommandToForm(command?: string[]): string {
+    if (!command?.length) return ""
+    if (command.length == 3 && command[0] == "sh" && command[1] == "-c") return command[2]
+    return command.join(" ")
+}
+
+// 全部是默认值的时候不提交, 后端按照默认方式注入 A1CTF_FLAG
+export function flagInjectionFromForm(values?: FlagInjectionFormValues): FlagInjection | undefined {
+    if (!values) return undefined
+
+    const injection: FlagInjection = {
+        env_name: values.env_name,
+        disable_env: values.disable_env,
+        file_path: values.file_path,
+        file_mode: values.file_mode ? parseInt(values.file_mode, 8) : undefined,
+        file_uid: values.file_uid ? parseInt(values.file_uid) : undefined,
+        file_gid: values.file_gid ? parseInt(values.file_gid) : undefined,
+        template_command: values.template_command,
+        exec_command: values.exec_command ? ["sh", "-c", values.exec_command] : undefined,
+    }
+
+    if (!injection.env_name && !injection.disable_env && !injection.file_path && !injection.template_command && !injection.exec_command) {
+        return undefined
+    }
+
+    return injection
+}
+
+export function FlagInjectionFields({ control, index }: { control: any, index: number }) {
+    return (
+        <div className="mt-4">
+            <span className="text-md font-semibold">Flag 注入</span>
+            <div className="grid grid-cols-3 gap-4 mt-3">
+                <FormField
+                    control={control}
+                    name={`container_config.${index}.flag_injection.env_name`}
+                    render={({ field }) => (
+                        <FormItem>
+                            <div className="flex items-center h-[20px]">
+                                <FormLabel>环境变量名</FormLabel>
+                                <div className="flex-1" />
+                                <FormMessage className="text-[14px]" />
+                            </div>
+                            <FormControl>
+                                <Input {...field} value={field.value ?? ""} placeholder="A1CTF_FLAG" />
+                            </FormControl>
+                        </FormItem>
+                    )}
+                />
+                <FormField
+                    control={control}
+                    name={`container_config.${index}.flag_injection.disable_env`}
+                    render={({ field }) => (
+                        <FormItem>
+                            <div className="flex items-center h-[20px]">
+                                <FormLabel>不注入环境变量</FormLabel>
+                            </div>
+                            <FormControl>
+                                <div className="h-9 flex items-center">
+                                    <Switch
+                                        checked={field.value ?? false}
+                                        onCheckedChange={field.onChange}
+                                    />
+                                </div>
+                            </FormControl>
+                        </FormItem>
+                    )}
+                />
+                <FormField
+                    control={control}
+                    name={`container_config.${index}.flag_injection.template_command`}
+                    render={({ field }) => (
+                        <FormItem>
+                            <div className="flex items-center h-[20px]">
+                                <FormLabel>替换启动命令</FormLabel>
+                            </div>
+                            <FormControl>
+                                <div className="h-9 flex items-center">
+                                    <Switch
+                                        checked={field.value ?? false}
+                                        onCheckedChange={field.onChange}
+                                    />
+                                </div>
+                            </FormControl>
+                            <FormDescription>
+                                {"启动命令里的 {{flag}} 会被替换成 flag"}
+                            </FormDescription>
+                        </FormItem>
+                    )}
+                />
+                <FormField
+                    control={control}
+                    name={`container_config.${index}.flag_injection.file_path`}
+                    render={({ field }) => (
+                        <FormItem>
+                            <div className="flex items-center h-[20px]">
+                                <FormLabel>Flag 文件路径</FormLabel>
+                                <div className="flex-1" />
+                                <FormMessage className="text-[14px]" />
+                            </div>
+                            <FormControl>
+                                <Input {...field} value={field.value ?? ""} placeholder="/flag" />
+                            </FormControl>
+                            <FormDescription>
+                                留空不写入文件, 文件所在目录需要在镜像中存在
+                            </FormDescription>
+                        </FormItem>
+                    )}
+                />
+                <FormField
+                    control={control}
+                    name={`container_config.${index}.flag_injection.file_mode`}
+                    render={({ field }) => (
+                        <FormItem>
+                            <div className="flex items-center h-[20px]">
+                                <FormLabel>文件权限</FormLabel>
+                                <div className="flex-1" />
+                                <FormMessage className="text-[14px]" />
+                            </div>
+                            <FormControl>
+                                <Input {...field} value={field.value ?? ""} placeholder="0444" />
+                            </FormControl>
+                        </FormItem>
+                    )}
+                />
+                <div className="grid grid-cols-2 gap-2">
+                    <FormField
+                        control={control}
+                        name={`container_config.${index}.flag_injection.file_uid`}
+                        render={({ field }) => (
+                            <FormItem>
+                                <div className="flex items-center h-[20px]">
+                                    <FormLabel>UID</FormLabel>
+                                    <div className="flex-1" />
+                                    <FormMessage className="text-[14px]" />
+                                </div>
+                                <FormControl>
+                                    <Input {...field} value={field.value ?? ""} placeholder="0" />
+                                </FormControl>
+                            </FormItem>
+                        )}
+                    />
+                    <FormField
+                        control={control}
+                        name={`container_config.${index}.flag_injection.file_gid`}
+                        render={({ field }) => (
+                            <FormItem>
+                                <div className="flex items-center h-[20px]">
+                                    <FormLabel>GID</FormLabel>
+                                    <div className="flex-1" />
+                                    <FormMessage className="text-[14px]" />
+                                </div>
+                                <FormControl>
+                                    <Input {...field} value={field.value ?? ""} placeholder="0" />
+                                </FormControl>
+                            </FormItem>
+                        )}
+                    />
+                </div>
+                <FormField
+                    control={control}
+                    name={`container_config.${index}.flag_injection.exec_command`}
+                    render={({ field }) => (
+                        <FormItem className="col-span-3">
+                            <div className="flex items-center h-[20px]">
+                                <FormLabel>注入命令</FormLabel>
+                                <div className="flex-1" />
+                                <FormMessage className="text-[14px]" />
+                            </div>
+                            <FormControl>
+                                <Input {...field} value={field.value ?? ""} placeholder="echo {{flag}} > /flag" />
+                            </FormControl>
+                            <FormDescription>
+                                {"实例运行之后通过 sh -c 执行, {{flag}} 会被替换成 flag, 预热池的实例领取之后也会执行"}
+                            </FormDescription>
+                        </FormItem>
+                    )}
+                />
+            </div>
+        </div>
+    )
+}
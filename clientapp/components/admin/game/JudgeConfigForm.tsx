@@ -115,6 +115,24 @@ export function JudgeConfigForm({ control, form }: JudgeConfigFormProps) {
                 )}
             />
 
+            <FormField
+                control={form.control}
+                name={`warm_pool_size`}
+                render={({ field }) => (
+                    <FormItem className="select-none">
+                        <div className="flex items-center h-[20px]">
+                            <FormLabel>预热池大小</FormLabel>
+                            <div className="flex-1" />
+                            <FormMessage className="text-[14px]" />
+                        </div>
+                        <FormControl>
+                            <Input type="number" {...field} value={field.value ?? 0} />
+                        </FormControl>
+                        <FormDescription>比赛开始前提前创建的空闲靶机数量, 选手启动时直接领取, 需要关闭环境变量注入 flag</FormDescription>
+                    </FormItem>
+                )}
+            />
+
             {/* 根据评测模式渲染不同输入 */}
             {attachType === 'SCRIPT' ? (
                 <FormField
@@ -281,7 +299,8 @@ export function JudgeConfigForm({ control, form }: JudgeConfigFormProps) {
                         appendHint({
                             content: "",
                             create_time: new Date().toISOString(),
-                            visible: false
+                            visible: false,
+                            cost: 0
                         })
 
                     }}
@@ -331,6 +350,18 @@ export function JudgeConfigForm({ control, form }: JudgeConfigFormProps) {
                                         </FormItem>
                                     )}
                                 />
+                                <FormField
+                                    control={control}
+                                    name={`hints.${hintIndex}.cost`}
+                                    render={({ field }) => (
+                                        <FormItem className="flex items-center gap-2 space-y-0">
+                                            <span className="text-sm whitespace-nowrap">解锁扣分</span>
+                                            <FormControl>
+                                                <Input type="number" min={0} className="w-[100px] h-8" {...field} value={field.value ?? 0} />
+                                            </FormControl>
+                                        </FormItem>
+                                    )}
+                                />
                                 <FormField
                                     control={control}
                                     name={`hints.${hintIndex}.content`}
@@ -0,0 +1,322 @@
+import {
+    FormControl,
+    FormDescription,
+    FormField,
+    FormItem,
+    FormLabel,
+    FormMessage,
+} from "components/ui/form"
+
+import {
+    Select,
+    SelectContent,
+    SelectItem,
+    SelectTrigger,
+    SelectValue,
+} from "components/ui/select"
+
+import { Input } from "components/ui/input";
+import { Switch } from "components/ui/switch";
+import { Textarea } from "components/ui/textarea";
+import { z } from "zod"
+import { Container, ContainerSecurity, Toleration } from "utils/A1API";
+
+export const sandboxSchema = z.object({
+    runtime_class_name: z.string(),
+    node_selector: z.string(),
+    tolerations: z.string(),
+    run_as_user: z.string().regex(/^\d*$/, { message: "请输入数字" }),
+    run_as_group: z.string().regex(/^\d*$/, { message: "请输入数字" }),
+    read_only_root_filesystem: z.boolean(),
+    no_new_privileges: z.boolean(),
+    capabilities_add: z.string(),
+    capabilities_drop: z.string(),
+    seccomp_profile: z.string(),
+    seccomp_localhost_profile: z.string(),
+})
+
+export type SandboxFormValues = z.infer<typeof sandboxSchema>
+
+const splitList = (value: string) => value.split(/[\s,]+/).map((e) => e.trim()).filter((e) => e != "")
+
+// 每行一个, 格式为 key=value:Effect 或者 key:Effect
+function tolerationsToString(tolerations?: Toleration[]) {
+    return (tolerations ?? []).map((e) => {
+        const key = e.operator == "Equal" || e.value ? `${e.key}=${e.value ?? ""}` : (e.key ?? "")
+        return e.effect ? `${key}:${e.effect}` : key
+    }).join("\n")
+}
+
+function stringToTolerations(value: string): Toleration[] {
+    return value.split("\n").map((e) => e.trim()).filter((e) => e != "").map((line) => {
+        const [keyValue, effect] = line.split(":")
+        const [key, val] = keyValue.split("=")
+        return {
+            key: key,
+            operator: val !== undefined ? "Equal" : "Exists",
+            value: val,
+            effect: effect || undefined,
+        }
+    })
+}
+
+export function sandboxToForm(container?: Container): SandboxFormValues {
+    const security = container?.security
+    return {
+        runtime_class_name: container?.runtime_class_name ?? "",
+        node_selector: Object.entries(container?.node_selector ?? {}).map(([k, v]) => `${k}=${v}`).join("\n"),
+        tolerations: tolerationsToString(container?.tolerations),
+        run_as_user: security?.run_as_user != null ? String(security.run_as_user) : "",
+        run_as_group: security?.run_as_group != null ? String(security.run_as_group) : "",
+        read_only_root_filesystem: security?.read_only_root_filesystem ?? false,
+        no_new_privileges: security?.allow_privilege_escalation === false,
+        capabilities_add: (security?.capabilities_add ?? []).join(", "),
+        capabilities_drop: (security?.capabilities_drop ?? []).join(", "),
+        seccomp_profile: security?.seccomp_profile ?? "",
+        seccomp_localhost_profile: security?.seccomp_localhost_profile ?? "",
+    }
+}
+
+// 返回需要合并到容器配置里的字段
+export function sandboxFromForm(values?: SandboxFormValues): Pick<Container, "runtime_class_name" | "node_selector" | "tolerations" | "security"> {
+    if (!values) return {}
+
+    const nodeSelector: Record<string, string> = {}
+    values.node_selector.split("\n").map((e) => e.trim()).filter((e) => e != "").forEach((line) => {
+        const [key, val] = line.split("=")
+        nodeSelector[key.trim()] = (val ?? "").trim()
+    })
+
+    const security: ContainerSecurity = {
+        run_as_user: values.run_as_user ? parseInt(values.run_as_user) : undefined,
+        run_as_group: values.run_as_group ? parseInt(values.run_as_group) : undefined,
+        read_only_root_filesystem: values.read_only_root_filesystem,
+        allow_privilege_escalation: values.no_new_privileges ? false : undefined,
+        capabilities_add: splitList(values.capabilities_add),
+        capabilities_drop: splitList(values.capabilities_drop),
+        seccomp_profile: values.seccomp_profile || undefined,
+        seccomp_localhost_profile: values.seccomp_profile == "Localhost" ? values.seccomp_localhost_profile : undefined,
+    }
+
+    const hasSecurity = security.run_as_user !== undefined || security.run_as_group !== undefined ||
+        security.read_only_root_filesystem || security.allow_privilege_escalation !== undefined ||
+        security.capabilities_add?.length || security.capabilities_drop?.length || security.seccomp_profile
+
+    return {
+        runtime_class_name: values.runtime_class_name.trim() || undefined,
+        node_selector: Object.keys(nodeSelector).length ? nodeSelector : undefined,
+        tolerations: values.tolerations.trim() ? stringToTolerations(values.tolerations) : undefined,
+        security: hasSecurity ? security : undefined,
+    }
+}
+
+export function SandboxFields({ control, index }: { control: any, index: number }) {
+    return (
+        <div className="mt-4">
+            <span className="text-md font-semibold">运行环境与安全</span>
+            <div className="grid grid-cols-3 gap-4 mt-3">
+                <FormField
+                    control={control}
+                    name={`container_config.${index}.sandbox.runtime_class_name`}
+                    render={({ field }) => (
+                        <FormItem>
+                            <div className="flex items-center h-[20px]">
+                                <FormLabel>RuntimeClass</FormLabel>
+                                <div className="flex-1" />
+                                <FormMessage className="text-[14px]" />
+                            </div>
+                            <FormControl>
+                                <Input {...field} value={field.value ?? ""} placeholder="gvisor" />
+                            </FormControl>
+                            <FormDescription>
+                                一道题的所有容器需要使用同一个运行时
+                            </FormDescription>
+                        </FormItem>
+                    )}
+                />
+                <FormField
+                    control={control}
+                    name={`container_config.${index}.sandbox.node_selector`}
+                    render={({ field }) => (
+                        <FormItem>
+                            <div className="flex items-center h-[20px]">
+                                <FormLabel>节点选择</FormLabel>
+                                <div className="flex-1" />
+                                <FormMessage className="text-[14px]" />
+                            </div>
+                            <FormControl>
+                                <Textarea {...field} value={field.value ?? ""} placeholder="a1ctf/pool=pwn" />
+                            </FormControl>
+                            <FormDescription>
+                                每行一个 key=value
+                            </FormDescription>
+                        </FormItem>
+                    )}
+                />
+                <FormField
+                    control={control}
+                    name={`container_config.${index}.sandbox.tolerations`}
+                    render={({ field }) => (
+                        <FormItem>
+                            <div className="flex items-center h-[20px]">
+                                <FormLabel>容忍</FormLabel>
+                                <div className="flex-1" />
+                                <FormMessage className="text-[14px]" />
+                            </div>
+                            <FormControl>
+                                <Textarea {...field} value={field.value ?? ""} placeholder="a1ctf/pool=pwn:NoSchedule" />
+                            </FormControl>
+                            <FormDescription>
+                                每行一个 key=value:Effect, 只写 key 表示 Exists
+                            </FormDescription>
+                        </FormItem>
+                    )}
+                />
+                <FormField
+                    control={control}
+                    name={`container_config.${index}.sandbox.run_as_user`}
+                    render={({ field }) => (
+                        <FormItem>
+                            <div className="flex items-center h-[20px]">
+                                <FormLabel>运行用户 UID</FormLabel>
+                                <div className="flex-1" />
+                                <FormMessage className="text-[14px]" />
+                            </div>
+                            <FormControl>
+                                <Input {...field} value={field.value ?? ""} placeholder="镜像默认" />
+                            </FormControl>
+                        </FormItem>
+                    )}
+                />
+                <FormField
+                    control={control}
+                    name={`container_config.${index}.sandbox.run_as_group`}
+                    render={({ field }) => (
+                        <FormItem>
+                            <div className="flex items-center h-[20px]">
+                                <FormLabel>运行用户组 GID</FormLabel>
+                                <div className="flex-1" />
+                                <FormMessage className="text-[14px]" />
+                            </div>
+                            <FormControl>
+                                <Input {...field} value={field.value ?? ""} placeholder="镜像默认" />
+                            </FormControl>
+                        </FormItem>
+                    )}
+                />
+                <div className="grid grid-cols-2 gap-2">
+                    <FormField
+                        control={control}
+                        name={`container_config.${index}.sandbox.read_only_root_filesystem`}
+                        render={({ field }) => (
+                            <FormItem>
+                                <div className="flex items-center h-[20px]">
+                                    <FormLabel>只读根目录</FormLabel>
+                                </div>
+                                <FormControl>
+                                    <div className="h-9 flex items-center">
+                                        <Switch
+                                            checked={field.value ?? false}
+                                            onCheckedChange={field.onChange}
+                                        />
+                                    </div>
+                                </FormControl>
+                            </FormItem>
+                        )}
+                    />
+                    <FormField
+                        control={control}
+                        name={`container_config.${index}.sandbox.no_new_privileges`}
+                        render={({ field }) => (
+                            <FormItem>
+                                <div className="flex items-center h-[20px]">
+                                    <FormLabel>禁止提权</FormLabel>
+                                </div>
+                                <FormControl>
+                                    <div className="h-9 flex items-center">
+                                        <Switch
+                                            checked={field.value ?? false}
+                                            onCheckedChange={field.onChange}
+                                        />
+                                    </div>
+                                </FormControl>
+                            </FormItem>
+                        )}
+                    />
+                </div>
+                <FormField
+                    control={control}
+                    name={`container_config.${index}.sandbox.capabilities_add`}
+                    render={({ field }) => (
+                        <FormItem>
+                            <div className="flex items-center h-[20px]">
+                                <FormLabel>添加 Capabilities</FormLabel>
+                                <div className="flex-1" />
+                                <FormMessage className="text-[14px]" />
+                            </div>
+                            <FormControl>
+                                <Input {...field} value={field.value ?? ""} placeholder="NET_BIND_SERVICE" />
+                            </FormControl>
+                        </FormItem>
+                    )}
+                />
+                <FormField
+                    control={control}
+                    name={`container_config.${index}.sandbox.capabilities_drop`}
+                    render={({ field }) => (
+                        <FormItem>
+                            <div className="flex items-center h-[20px]">
+                                <FormLabel>移除 Capabilities</FormLabel>
+                                <div className="flex-1" />
+                                <FormMessage className="text-[14px]" />
+                            </div>
+                            <FormControl>
+                                <Input {...field} value={field.value ?? ""} placeholder="ALL" />
+                            </FormControl>
+                        </FormItem>
+                    )}
+                />
+                <div className="grid grid-cols-2 gap-2">
+                    <FormField
+                        control={control}
+                        name={`container_config.${index}.sandbox.seccomp_profile`}
+                        render={({ field }) => (
+                            <FormItem>
+                                <div className="flex items-center h-[20px]">
+                                    <FormLabel>Seccomp</FormLabel>
+                                </div>
+                                <Select onValueChange={(value) => field.onChange(value == "default" ? "" : value)} value={field.value || "default"}>
+                                    <FormControl>
+                                        <SelectTrigger>
+                                            <SelectValue />
+                                        </SelectTrigger>
+                                    </FormControl>
+                                    <SelectContent>
+                                        <SelectItem value="default">默认</SelectItem>
+                                        <SelectItem value="RuntimeDefault">RuntimeDefault</SelectItem>
+                                        <SelectItem value="Unconfined">Unconfined</SelectItem>
+                                        <SelectItem value="Localhost">Localhost</SelectItem>
+                                    </SelectContent>
+                                </Select>
+                            </FormItem>
+                        )}
+                    />
+                    <FormField
+                        control={control}
+                        name={`container_config.${index}.sandbox.seccomp_localhost_profile`}
+                        render={({ field }) => (
+                            <FormItem>
+                                <div className="flex items-center h-[20px]">
+                                    <FormLabel>Profile</FormLabel>
+                                </div>
+                                <FormControl>
+                                    <Input {...field} value={field.value ?? ""} placeholder="profiles/pwn.json" />
+                                </FormControl>
+                            </FormItem>
+                        )}
+                    />
+                </div>
+            </div>
+        </div>
+    )
+}
@@ -1,13 +1,25 @@
 import { Mdx } from "components/MdxCompoents";
 import dayjs from "dayjs";
-import { BringToFront, CalendarClock } from "lucide-react";
+import { BringToFront, CalendarClock, Coins, LockKeyhole } from "lucide-react";
 import { useTheme } from "next-themes";
+import { useTranslation } from "react-i18next";
+import { Button } from "components/ui/button";
+import AlertConformer from "components/modules/AlertConformer";
 
 export default function ChallengeHintCard(
-    { hint, index, publish_time } : { hint: string, index: number, publish_time: dayjs.Dayjs }
+    { hint, index, publish_time, cost = 0, locked = false, unlocking = false, onUnlock } : {
+        hint: string,
+        index: number,
+        publish_time: dayjs.Dayjs,
+        cost?: number,
+        locked?: boolean,
+        unlocking?: boolean,
+        onUnlock?: () => void
+    }
 ) {
 
     const { theme } = useTheme()
+    const { t } = useTranslation("challenge_view")
 
     return (
         <div className={
@@ -29,11 +41,36 @@ export default function ChallengeHintCard(
                         <CalendarClock className="" />
                         <span>发布时间 { publish_time.format("YYYY-MM-DD HH:mm:ss") }</span>
                     </div>
+                    {cost > 0 && (
+                        <div className="flex gap-2 items-center text-xs sm:text-sm text-yellow-600 mt-1 sm:mt-0">
+                            <Coins />
+                            <span>{t("hint_cost", { cost })}</span>
+                        </div>
+                    )}
                 </div>
                 <div className="border-t border-dashed border-foreground/10" />
-                <div className="prose prose-sm sm:prose-base max-w-none text-foreground/90 dark:text-foreground/80">
-                    <Mdx source={hint} />
-                </div>
+                {locked ? (
+                    <div className="flex flex-col sm:flex-row sm:items-center gap-4 py-2">
+                        <div className="flex gap-2 items-center text-foreground/60">
+                            <LockKeyhole className="flex-none" />
+                            <span>{t("hint_locked", { cost })}</span>
+                        </div>
+                        <div className="flex-1" />
+                        <AlertConformer
+                            title={t("unlock_hint_title")}
+                            description={t("unlock_hint_confirm", { cost })}
+                            onConfirm={onUnlock}
+                        >
+                            <Button variant="default" disabled={unlocking}>
+                                {t("unlock_hint")}
+                            </Button>
+                        </AlertConformer>
+                    </div>
+                ) : (
+                    <div className="prose prose-sm sm:prose-base max-w-none text-foreground/90 dark:text-foreground/80">
+                        <Mdx source={hint} />
+                    </div>
+                )}
             </div>
         </div>
     )
@@ -4,7 +4,10 @@ import { useTheme } from "next-themes";
 import SafeComponent from "components/SafeComponent";
 import dayjs from "dayjs";
 import { UserDetailGameChallenge } from "utils/A1API";
-import { Dispatch, SetStateAction } from "react";
+import { Dispatch, SetStateAction, useState } from "react";
+import { api } from "utils/ApiHelper";
+import { toast } from 'react-toastify/unstyled';
+import { useTranslation } from "react-i18next";
 import { Button } from "components/ui/button";
 import { X } from "lucide-react";
 import {
@@ -14,17 +17,41 @@ import {
 
 export default function ChallengeHintPage(
     {
+        gameID,
         curChallenge,
+        setCurChallenge,
         visible,
         setVisible
     }: {
+        gameID: number,
         curChallenge: UserDetailGameChallenge | undefined,
+        setCurChallenge: Dispatch<SetStateAction<UserDetailGameChallenge | undefined>>,
         visible: boolean,
         setVisible: Dispatch<SetStateAction<boolean>>
     }
 ) {
 
     const { theme } = useTheme()
+    const { t } = useTranslation("challenge_view")
+    const [unlockingHintID, setUnlockingHintID] = useState<string>("")
+
+    // 解锁成功之后用返回的提示内容替换当前题目里的提示
+    const handleUnlockHint = (challengeID: number, hintID: string) => {
+        setUnlockingHintID(hintID)
+        api.user.userUnlockHint(gameID, challengeID, hintID).then((res) => {
+            const unlockedHint = res.data.data
+            setCurChallenge((prev) => {
+                if (!prev || prev.challenge_id != challengeID) return prev
+                return {
+                    ...prev,
+                    hints: prev.hints?.map((hint) => hint.hint_id == unlockedHint.hint_id ? unlockedHint : hint)
+                }
+            })
+            toast.success(t("unlock_hint_success"))
+        }).finally(() => {
+            setUnlockingHintID("")
+        })
+    }
 
     const transitions = useTransition(visible, {
         from: {
@@ -84,10 +111,14 @@ export default function ChallengeHintPage(
                                 {curChallenge?.hints?.length ? (
                                     <div className="flex flex-col w-full h-full gap-8 px-10 pb-8">
                                         {curChallenge?.hints?.map((hint, index) => (
-                                            <ChallengeHintCard key={index}
+                                            <ChallengeHintCard key={hint.hint_id || index}
                                                 hint={hint.content}
                                                 index={index + 1}
                                                 publish_time={dayjs(hint.create_time)}
+                                                cost={hint.cost}
+                                                locked={hint.locked}
+                                                unlocking={unlockingHintID == hint.hint_id}
+                                                onUnlock={() => handleUnlockHint(curChallenge?.challenge_id ?? 0, hint.hint_id)}
                                             />
                                         ))}
                                     </div>
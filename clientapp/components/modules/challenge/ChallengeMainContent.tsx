@@ -1,8 +1,8 @@
 import { Button } from "components/ui/button"
-import { AlarmClock, CheckCheck, CirclePower, CircleX, ClockArrowUp, Flag, Loader2, Network, Package, Paperclip } from "lucide-react"
+import { AlarmClock, CheckCheck, CirclePower, CircleX, ClockArrowUp, Flag, Loader2, Network, Package, Paperclip, RotateCcw } from "lucide-react"
 import { MacScrollbar } from "mac-scrollbar"
 import TimerDisplay from "../TimerDisplay"
-import { ContainerStatus, ExposePortInfo, UserDetailGameChallenge, UserRole, UserSimpleGameChallenge } from "utils/A1API"
+import { ChallengeContainerType, ContainerStatus, ExposePortInfo, UserDetailGameChallenge, UserRole, UserSimpleGameChallenge } from "utils/A1API"
 import { ChallengeSolveStatus } from "components/user/game/ChallengesView"
 import { Dispatch, SetStateAction, useEffect, useMemo, useState } from "react"
 import { api, createSkipGlobalErrorConfig, ErrorMessage } from "utils/ApiHelper"
@@ -88,6 +88,24 @@ export default function ChallengeMainContent(
         api.user.userExtendContainerLifeForAChallenge(gameID, curChallenge?.challenge_id ?? 0)
     }
 
+    const handleResetContainer = () => {
+
+        api.user.userResetContainerForAChallenge(gameID, curChallenge?.challenge_id ?? 0).then(() => {
+            setContainerRunningTrigger(false)
+            setContainerLaunching(true)
+
+            const newContainers = containerInfo
+
+            for (let i = 0; i < newContainers.length; i++) {
+                newContainers[i].container_ports = []
+            }
+
+            setContainerInfo(newContainers)
+            // 重新轮询, 实例重新创建完成后会显示新的端口
+            setRefreshContainerTrigger(true)
+        })
+    }
+
     const handleDestoryContainer = () => {
 
         api.user.userDeleteContainerForAChallenge(gameID, curChallenge?.challenge_id ?? 0).then(() => {
@@ -246,7 +264,7 @@ export default function ChallengeMainContent(
                                 <Package />
                                 <span className="font-bold text-lg">{t("containers")}</span>
                                 <div className="flex-1" />
-                                {!containerRunningTrigger ? (
+                                {curChallenge?.container_type == ChallengeContainerType.STATIC_CONTAINER ? null : !containerRunningTrigger ? (
                                     <div className="flex gap-2 items-center">
                                         <Button className="h-[34px] rounded-[10px] p-0 border-2 px-2 border-foreground bg-background hover:bg-foreground/20 [&_svg]:size-[24px] text-foreground"
                                             onClick={handleLaunchContainer}
@@ -277,6 +295,12 @@ export default function ChallengeMainContent(
                                             <ClockArrowUp />
                                             <span className="font-bold text-[1.125em]">{t("container_extend")}</span>
                                         </Button>
+                                        <Button className="h-[34px] rounded-[10px] p-0 border-2 px-2 border-yellow-500 text-yellow-500 bg-background dark:hover:bg-yellow-200/20 hover:bg-yellow-200/60 [&_svg]:size-[24px]"
+                                            onClick={handleResetContainer}
+                                        >
+                                            <RotateCcw />
+                                            <span className="font-bold text-[1.125em]">{t("container_reset")}</span>
+                                        </Button>
                                         <Button className="h-[34px] rounded-[10px] p-0 border-2 px-2 border-red-400 text-red-400 bg-background dark:hover:bg-red-200/20 hover:bg-red-200/60 [&_svg]:size-[24px]"
                                             onClick={handleDestoryContainer}
                                         >
@@ -295,9 +319,20 @@ export default function ChallengeMainContent(
                                             <Network />
                                             {container.container_ports?.length ? (
                                                 <div className="flex gap-2">
-                                                    {container.container_ports.map((port, j) => (
+                                                    {container.container_ports.map((port, j) => port.url ? (
                                                         <div key={j} className="flex gap-2 items-center">
                                                             <span className="text-sm font-bold">{port.port_name}:</span>
+                                                            <a className="border-2 border-foreground px-2 rounded-md flex items-center justify-center hover:bg-foreground/30 transition-colors duration-300"
+                                                                href={port.url}
+                                                                target="_blank"
+                                                                rel="noreferrer"
+                                                            >
+                                                                <span className="font-bold text-sm">{port.url}</span>
+                                                            </a>
+                                                        </div>
+                                                    ) : (
+                                                        <div key={j} className="flex gap-2 items-center">
+                                                            <span className="text-sm font-bold">{port.port_name}{port.protocol == "UDP" ? " (UDP)" : ""}:</span>
                                                             <div className="border-2 border-foreground px-2 rounded-md flex items-center justify-center hover:bg-foreground/30 transition-colors duration-300"
                                                                 onClick={() => {
                                                                     const status = copy(`${port.ip}:${port.port}`)
@@ -310,6 +345,20 @@ export default function ChallengeMainContent(
                                                             >
                                                                 <span className="font-bold text-sm">{port.ip}:{port.port}</span>
                                                             </div>
+                                                            {port.token && (
+                                                                <div className="border-2 border-foreground px-2 rounded-md flex items-center justify-center hover:bg-foreground/30 transition-colors duration-300"
+                                                                    onClick={() => {
+                                                                        const status = copy(port.token ?? "")
+                                                                        if (status) {
+                                                                            toast.success(t("copied"))
+                                                                        } else {
+                                                                            toast.success(t("fail_copy"))
+                                                                        }
+                                                                    }}
+                                                                >
+                                                                    <span className="font-bold text-sm">{t("copy_proxy_token")}</span>
+                                                                </div>
+                                                            )}
                                                         </div>
                                                     ))}
                                                 </div>
@@ -124,7 +124,7 @@ const FileDownloader = (
             };
 
             if (attach.attach_type == AttachmentType.STATICFILE) {
-                fetchFile(`/api/file/download/${attach.attach_hash}`)
+                fetchFile(attach.attach_url ?? `/api/file/download/${attach.attach_hash}`)
             } else {
                 fetchFile(attach.attach_url ?? "");
             }
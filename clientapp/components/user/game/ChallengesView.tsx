@@ -2,6 +2,7 @@ import { SidebarProvider } from "components/ui/sidebar"
 import { CategorySidebar } from "components/user/game/CategorySideBar";
 
 import { toastNewNotice, toastNewHint } from "utils/ToastUtil";
+import { toast } from 'react-toastify/unstyled';
 
 import { Mdx } from "components/MdxCompoents";
 import { useEffect, useMemo, useRef, useState } from "react";
@@ -299,6 +300,11 @@ export function ChallengesView({
                                     }
                                 }
                             }
+
+                            // 管理员解除了封榜，最终排行榜已经公布
+                            if (data.type === 'ScoreboardUnfrozen') {
+                                toast.info(noticesViewT("scoreboard_unfrozen"))
+                            }
                         } catch (error) {
                             console.error('Error parsing WebSocket message:', error)
                         }
@@ -396,7 +402,7 @@ export function ChallengesView({
             <SubmitFlagView curChallenge={curChallenge} gameID={gameID} setChallengeSolved={setChallengeSolved} challengeSolveStatusList={challengeSolveStatusList} visible={submitFlagWindowVisible} setVisible={setSubmitFlagWindowVisible} />
 
             {/* Hint 列表 */}
-            <ChallengeHintPage curChallenge={curChallenge} visible={showHintsWindowVisible} setVisible={setShowHintsWindowVisible} />
+            <ChallengeHintPage gameID={gameID} curChallenge={curChallenge} setCurChallenge={setCurChallenge} visible={showHintsWindowVisible} setVisible={setShowHintsWindowVisible} />
 
             {/* 比赛各种状态页 */}
             <GameStatusMask gameID={gameID} />
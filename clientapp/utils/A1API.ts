@@ -194,6 +194,47 @@ export interface Attachment {
 export interface ExposePort {
   name: string;
   port: number;
+  /** 标记为 Web 端口，开启 container-ingress 后通过域名访问 */
+  http?: boolean;
+  /** 只在实例内部使用的端口 */
+  internal?: boolean;
+  /** TCP 或 UDP，为空的时候是 TCP */
+  protocol?: string;
+}
+
+export interface FlagInjection {
+  /** 环境变量名，为空的时候使用 A1CTF_FLAG */
+  env_name?: string;
+  disable_env?: boolean;
+  /** flag 文件的绝对路径 */
+  file_path?: string;
+  file_mode?: number;
+  file_uid?: number;
+  file_gid?: number;
+  /** 把 command 里的 {{flag}} 替换成 flag */
+  template_command?: boolean;
+  /** 实例运行之后在容器里执行的命令，{{flag}} 会被替换成 flag */
+  exec_command?: string[];
+}
+
+export interface Toleration {
+  key?: string;
+  operator?: string;
+  value?: string;
+  effect?: string;
+  toleration_seconds?: number;
+}
+
+export interface ContainerSecurity {
+  run_as_user?: number;
+  run_as_group?: number;
+  read_only_root_filesystem?: boolean;
+  allow_privilege_escalation?: boolean;
+  capabilities_add?: string[];
+  capabilities_drop?: string[];
+  /** RuntimeDefault / Unconfined / Localhost */
+  seccomp_profile?: string;
+  seccomp_localhost_profile?: string;
 }
 
 export interface Container {
@@ -202,6 +243,13 @@ export interface Container {
   expose_ports: ExposePort[];
   image: string;
   name: string;
+  /** 容器所属的组件，为空的时候属于 main */
+  component?: string;
+  flag_injection?: FlagInjection | null;
+  runtime_class_name?: string;
+  node_selector?: Record<string, string>;
+  tolerations?: Toleration[];
+  security?: ContainerSecurity | null;
   cpu_limit?: number;
   memory_limit?: number;
   storage_limit?: number;
@@ -253,6 +301,43 @@ export interface GameStage {
   start_time: string;
   /** @format date-time */
   end_time: string;
+  /** 得分倍率，0 表示不加权 */
+  score_multiplier?: number;
+  /** 晋级到下一阶段的队伍数量，0 表示所有队伍 */
+  promote_top_n?: number;
+}
+
+export interface ScoreboardStageInfo {
+  stage_name: string;
+  /** @format date-time */
+  start_time: string;
+  /** @format date-time */
+  end_time: string;
+  score_multiplier: number;
+  promote_top_n: number;
+  /** 晋级到这个阶段的队伍数量，0 表示所有队伍都能参加 */
+  qualified_team_count: number;
+}
+
+export interface AdminStageTeamsInfo {
+  stage_name: string;
+  /** @format date-time */
+  start_time: string;
+  /** @format date-time */
+  end_time: string;
+  score_multiplier: number;
+  promote_top_n: number;
+  /** 有晋级名单，只有名单里的队伍能参加 */
+  restricted: boolean;
+  teams: {
+    team_id: number;
+    team_name: string;
+    from_stage?: string | null;
+    from_rank?: number | null;
+    promoted_by?: string | null;
+    /** @format date-time */
+    created_at: string;
+  }[];
 }
 
 export interface AdminDetailGameChallenge {
@@ -263,10 +348,16 @@ export interface AdminDetailGameChallenge {
   /** @format double */
   cur_score?: number;
   hints?: {
+    hint_id?: string;
     content: string;
     /** @format date-time */
     create_time: string;
     visible: boolean;
+    /**
+     * 解锁提示需要扣除的分数，0 表示免费提示
+     * @format double
+     */
+    cost?: number;
   }[];
   belong_stage?: string;
   solve_count?: number;
@@ -277,6 +368,8 @@ export interface AdminDetailGameChallenge {
   /** @format double */
   difficulty?: number;
   enable_blood_reward?: boolean;
+  /** 预热池大小，0 表示不预热 */
+  warm_pool_size?: number;
 }
 
 export interface AddGameChallengePayload {
@@ -305,6 +398,13 @@ export interface AdminFullGameInfo {
   require_wp: boolean;
   /** @format date-time */
   wp_expire_time: string;
+  /**
+   * 封榜时间，之后选手看到的是封榜时的排行榜
+   * @format date-time
+   */
+  freeze_time?: string | null;
+  /** @format date-time */
+  unfreeze_time?: string | null;
   visible: boolean;
   stages: GameStage[];
   first_blood_reward?: number;
@@ -388,6 +488,18 @@ export interface UserAttachmentConfig {
   download_hash?: string | null;
 }
 
+export interface UserHintInfo {
+  hint_id: string;
+  /** 未解锁的付费提示内容为空 */
+  content: string;
+  /** @format date-time */
+  create_time: string;
+  visible: boolean;
+  /** @format double */
+  cost: number;
+  locked: boolean;
+}
+
 export interface UserDetailGameChallenge {
   challenge_id: number;
   challenge_name: string;
@@ -396,12 +508,7 @@ export interface UserDetailGameChallenge {
   total_score: number;
   /** @format double */
   cur_score: number;
-  hints?: {
-    content: string;
-    /** @format date-time */
-    create_time: string;
-    visible: boolean;
-  }[];
+  hints?: UserHintInfo[];
   belong_stage?: string;
   solve_count?: number;
   category?: ChallengeCategory;
@@ -478,6 +585,8 @@ export interface UserFullGameInfo {
   require_wp: boolean;
   /** @format date-time */
   wp_expire_time: string;
+  /** @format date-time */
+  freeze_time?: string | null;
   visible: boolean;
   game_icon_light?: string | null;
   game_icon_dark?: string | null;
@@ -518,6 +627,11 @@ export interface ExposePortInfo {
     port_name: string;
     port: number;
     ip: string;
+    token?: string;
+    proxy_url?: string;
+    url?: string;
+    /** TCP 或 UDP */
+    protocol?: string;
   }[];
 }
 
@@ -540,6 +654,60 @@ export interface GameScoreboardData {
   groups?: GameGroupSimple[];
   current_group?: GameGroupSimple;
   pagination?: PaginationInfo;
+  /** 当前看到的是封榜时的排行榜 */
+  frozen?: boolean;
+  /** @format date-time */
+  freeze_time?: string | null;
+  stages?: ScoreboardStageInfo[];
+  /** 当前查看的阶段，为空时是整场比赛的排行榜 */
+  current_stage?: string | null;
+}
+
+export interface ScoreboardReplayRankItem {
+  rank: number;
+  team_id: number;
+  team_name: string;
+  group_id?: number | null;
+  group_name: string;
+  score: number;
+  solved_count: number;
+  /** 达到当前分数的时间（毫秒时间戳） */
+  last_score_time?: number | null;
+}
+
+export interface ScoreboardReplayData {
+  game_id: number;
+  /** 回放的时间点（毫秒时间戳） */
+  record_time: number;
+  frozen: boolean;
+  rankings: ScoreboardReplayRankItem[];
+}
+
+export interface ScoreboardReplayResponse {
+  code: number;
+  data: ScoreboardReplayData;
+}
+
+export interface ScoreboardRankChangeEvent {
+  /** 毫秒时间戳 */
+  record_time: number;
+  team_id: number;
+  team_name: string;
+  group_name: string;
+  old_rank: number;
+  new_rank: number;
+  old_score: number;
+  new_score: number;
+}
+
+export interface ScoreboardRankChangeEventsResponse {
+  code: number;
+  data: {
+    game_id: number;
+    frozen: boolean;
+    events: ScoreboardRankChangeEvent[];
+    pagination: PaginationInfo;
+  };
 }
 
 export interface TeamScore {
@@ -756,6 +924,8 @@ export interface AdminContainerItem {
     port_name: string;
     port: number;
     ip: string;
+    url?: string;
+    protocol?: string;
   }[];
   team_name: string;
   game_name: string;
@@ -2100,6 +2270,33 @@ export class Api<
         ...params,
       }),
 
+    /**
+     * @description Unlock a paid hint, the cost is deducted from the team score
+     *
+     * @tags user
+     * @name UserUnlockHint
+     * @summary Unlock a hint
+     * @request POST:/api/game/{game_id}/challenge/{challenge_id}/hint/{hint_id}/unlock
+     */
+    userUnlockHint: (
+      gameId: number,
+      challengeId: number,
+      hintId: string,
+      params: RequestParams = {},
+    ) =>
+      this.request<
+        {
+          code: number;
+          data: UserHintInfo;
+        },
+        void | ErrorMessage
+      >({
+        path: `/api/game/${gameId}/challenge/${challengeId}/hint/${hintId}/unlock`,
+        method: "POST",
+        format: "json",
+        ...params,
+      }),
+
     /**
      * @description Submit a flag
      *
@@ -2225,6 +2422,25 @@ export class Api<
         ...params,
       }),
 
+    /**
+     * @description Reset a running container, it is recreated with the latest flag
+     *
+     * @tags user
+     * @name UserResetContainerForAChallenge
+     * @summary Reset a container for a challenge
+     * @request POST:/api/game/{game_id}/container/{challenge_id}/reset
+     */
+    userResetContainerForAChallenge: (
+      gameId: number,
+      challengeId: number,
+      params: RequestParams = {},
+    ) =>
+      this.request<void, void | ErrorMessage>({
+        path: `/api/game/${gameId}/container/${challengeId}/reset`,
+        method: "POST",
+        ...params,
+      }),
+
     /**
      * @description Get container info for a challenge
      *
@@ -2279,6 +2495,8 @@ export class Api<
       query?: {
         /** 分组ID，如果不传则显示所有队伍 */
         group_id?: number;
+        /** 阶段名，如果不传则显示整场比赛的排行榜 */
+        stage?: string;
         /**
          * 页码，从1开始
          * @default 1
@@ -2300,6 +2518,70 @@ export class Api<
         ...params,
       }),
 
+    /**
+     * @description 根据排行榜快照重建某个时间点的完整排行榜
+     *
+     * @tags user
+     * @name UserGetGameScoreboardReplay
+     * @summary Get game scoreboard at a point in time
+     * @request GET:/api/game/{game_id}/scoreboard/replay
+     */
+    userGetGameScoreboardReplay: (
+      gameId: number,
+      query?: {
+        /** 毫秒时间戳，默认是当前时间 */
+        time?: number;
+        /** 分组ID，传了之后只在组内排名 */
+        group_id?: number;
+      },
+      params: RequestParams = {},
+    ) =>
+      this.request<ScoreboardReplayResponse, ErrorMessage>({
+        path: `/api/game/${gameId}/scoreboard/replay`,
+        method: "GET",
+        query: query,
+        format: "json",
+        ...params,
+      }),
+
+    /**
+     * @description 按时间顺序分页获取排名变化事件
+     *
+     * @tags user
+     * @name UserGetGameScoreboardRankChanges
+     * @summary Get game scoreboard rank change events
+     * @request GET:/api/game/{game_id}/scoreboard/replay/events
+     */
+    userGetGameScoreboardRankChanges: (
+      gameId: number,
+      query?: {
+        /** 分组ID */
+        group_id?: number;
+        /** 开始时间（毫秒时间戳） */
+        since?: number;
+        /** 结束时间（毫秒时间戳） */
+        until?: number;
+        /**
+         * 页码，从1开始
+         * @default 1
+         */
+        page?: number;
+        /**
+         * 每页大小，最大 500
+         * @default 100
+         */
+        size?: number;
+      },
+      params: RequestParams = {},
+    ) =>
+      this.request<ScoreboardRankChangeEventsResponse, ErrorMessage>({
+        path: `/api/game/${gameId}/scoreboard/replay/events`,
+        method: "GET",
+        query: query,
+        format: "json",
+        ...params,
+      }),
+
     /**
      * @description 上传用户头像图片并更新用户资料
      *
@@ -2628,6 +2910,127 @@ export class Api<
         ...params,
       }),
 
+    /**
+     * @description Unfreeze the scoreboard and publish the final rankings
+     *
+     * @tags admin
+     * @name UnfreezeScoreboard
+     * @summary Unfreeze the scoreboard
+     * @request POST:/api/admin/game/{game_id}/scoreboard/unfreeze
+     */
+    unfreezeScoreboard: (gameId: number, params: RequestParams = {}) =>
+      this.request<
+        {
+          code: number;
+          data: {
+            /** @format date-time */
+            unfreeze_time: string;
+          };
+        },
+        void | ErrorMessage
+      >({
+        path: `/api/admin/game/${gameId}/scoreboard/unfreeze`,
+        method: "POST",
+        format: "json",
+        ...params,
+      }),
+
+    /**
+     * @description Get stage settings and promoted teams of a game
+     *
+     * @tags admin
+     * @name GetStageTeams
+     * @summary Get stage promoted teams
+     * @request GET:/api/admin/game/{game_id}/stages/teams
+     */
+    getStageTeams: (gameId: number, params: RequestParams = {}) =>
+      this.request<
+        {
+          code: number;
+          data: AdminStageTeamsInfo[];
+        },
+        void | ErrorMessage
+      >({
+        path: `/api/admin/game/${gameId}/stages/teams`,
+        method: "GET",
+        format: "json",
+        ...params,
+      }),
+
+    /**
+     * @description Promote the top N teams of a stage into another stage
+     *
+     * @tags admin
+     * @name PromoteStageTeams
+     * @summary Promote stage teams
+     * @request POST:/api/admin/game/{game_id}/stages/promote
+     */
+    promoteStageTeams: (
+      gameId: number,
+      data: {
+        from_stage: string;
+        to_stage: string;
+        /** 不传的时候使用上一阶段的 promote_top_n */
+        top_n?: number;
+        group_id?: number;
+        /** 清空下一阶段已有的晋级名单 */
+        replace?: boolean;
+      },
+      params: RequestParams = {},
+    ) =>
+      this.request<
+        {
+          code: number;
+          data: {
+            team_id: number;
+            team_name: string;
+            rank: number;
+            score: number;
+          }[];
+        },
+        void | ErrorMessage
+      >({
+        path: `/api/admin/game/${gameId}/stages/promote`,
+        method: "POST",
+        body: data,
+        type: ContentType.Json,
+        format: "json",
+        ...params,
+      }),
+
+    /**
+     * @description Remove teams from a stage, an empty team list clears the whole list
+     *
+     * @tags admin
+     * @name DeleteStageTeams
+     * @summary Remove stage promoted teams
+     * @request POST:/api/admin/game/{game_id}/stages/teams/delete
+     */
+    deleteStageTeams: (
+      gameId: number,
+      data: {
+        stage_name: string;
+        team_ids?: number[];
+      },
+      params: RequestParams = {},
+    ) =>
+      this.request<
+        {
+          code: number;
+          data: {
+            deleted_count: number;
+          };
+        },
+        void | ErrorMessage
+      >({
+        path: `/api/admin/game/${gameId}/stages/teams/delete`,
+        method: "POST",
+        body: data,
+        type: ContentType.Json,
+        format: "json",
+        ...params,
+      }),
+
     /**
      * @description Get a gamechallenge from a game
      *
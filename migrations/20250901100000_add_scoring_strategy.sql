@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE game_challenges ADD COLUMN scoring_strategy VARCHAR(20) NOT NULL DEFAULT 'exponential' CHECK (scoring_strategy IN ('exponential', 'linear', 'logarithmic', 'static'));
+ALTER TABLE game_challenges ADD COLUMN scoring_decay INTEGER NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE game_challenges DROP COLUMN scoring_strategy;
+ALTER TABLE game_challenges DROP COLUMN scoring_decay;
+-- +goose StatementEnd
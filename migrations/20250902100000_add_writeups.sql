@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS writeups (
+    writeup_id BIGSERIAL PRIMARY KEY,
+    game_id BIGINT NOT NULL,
+    team_id BIGINT NOT NULL,
+    file_id UUID NOT NULL,
+    submiter_id UUID NOT NULL,
+    submit_time TIMESTAMP NOT NULL,
+    review_status VARCHAR(20) NOT NULL DEFAULT 'Pending' CHECK (review_status IN ('Pending', 'Approved', 'Rejected')),
+    review_comment TEXT,
+    reviewer_id UUID,
+    review_time TIMESTAMP,
+
+    FOREIGN KEY (game_id) REFERENCES games(game_id) ON DELETE CASCADE,
+    FOREIGN KEY (team_id) REFERENCES teams(team_id) ON DELETE CASCADE,
+    FOREIGN KEY (file_id) REFERENCES uploads(file_id) ON DELETE CASCADE,
+    FOREIGN KEY (submiter_id) REFERENCES users(user_id) ON DELETE CASCADE,
+    FOREIGN KEY (reviewer_id) REFERENCES users(user_id) ON DELETE SET NULL,
+    CONSTRAINT writeups_game_team_unique UNIQUE (game_id, team_id)
+);
+
+CREATE INDEX idx_writeups_game ON writeups(game_id);
+
+ALTER TABLE games ADD COLUMN wp_exclude_unsubmitted BOOLEAN NOT NULL DEFAULT false;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE games DROP COLUMN IF EXISTS wp_exclude_unsubmitted;
+DROP TABLE IF EXISTS writeups;
+-- +goose StatementEnd
@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS hint_unlocks (
+    unlock_id BIGSERIAL PRIMARY KEY,
+    game_id BIGINT NOT NULL,
+    ingame_id BIGINT NOT NULL,
+    challenge_id BIGINT NOT NULL,
+    team_id BIGINT NOT NULL,
+    hint_id TEXT NOT NULL,
+    cost FLOAT NOT NULL,
+    unlocker_id UUID NOT NULL,
+    unlock_time TIMESTAMP NOT NULL,
+
+    FOREIGN KEY (game_id) REFERENCES games(game_id) ON DELETE CASCADE,
+    FOREIGN KEY (ingame_id) REFERENCES game_challenges(ingame_id) ON DELETE CASCADE,
+    FOREIGN KEY (challenge_id) REFERENCES challenges(challenge_id) ON DELETE CASCADE,
+    FOREIGN KEY (team_id) REFERENCES teams(team_id) ON DELETE CASCADE,
+    FOREIGN KEY (unlocker_id) REFERENCES users(user_id) ON DELETE CASCADE,
+    CONSTRAINT hint_unlocks_team_hint_unique UNIQUE (team_id, ingame_id, hint_id)
+);
+
+CREATE INDEX idx_hint_unlocks_game ON hint_unlocks(game_id);
+CREATE INDEX idx_hint_unlocks_team_ingame ON hint_unlocks(team_id, ingame_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS hint_unlocks;
+-- +goose StatementEnd
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS team_attachments (
+    attachment_id BIGSERIAL PRIMARY KEY,
+    game_id BIGINT NOT NULL,
+    challenge_id BIGINT NOT NULL,
+    team_id BIGINT NOT NULL,
+    attach_index INTEGER NOT NULL,
+    file_id UUID NOT NULL,
+    source_hash TEXT NOT NULL,
+    create_time TIMESTAMP NOT NULL,
+
+    FOREIGN KEY (game_id) REFERENCES games(game_id) ON DELETE CASCADE,
+    FOREIGN KEY (challenge_id) REFERENCES challenges(challenge_id) ON DELETE CASCADE,
+    FOREIGN KEY (team_id) REFERENCES teams(team_id) ON DELETE CASCADE,
+    FOREIGN KEY (file_id) REFERENCES uploads(file_id) ON DELETE CASCADE,
+    CONSTRAINT team_attachments_unique UNIQUE (game_id, challenge_id, team_id, attach_index)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS team_attachments;
+-- +goose StatementEnd
@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS attachment_downloads (
+    download_id BIGSERIAL PRIMARY KEY,
+    game_id BIGINT NOT NULL,
+    ingame_id BIGINT NOT NULL,
+    challenge_id BIGINT NOT NULL,
+    team_id BIGINT NOT NULL,
+    user_id UUID NOT NULL,
+    attach_index INTEGER NOT NULL,
+    attach_name TEXT NOT NULL,
+    file_id TEXT NOT NULL,
+    download_ip TEXT,
+    download_time TIMESTAMP NOT NULL,
+
+    FOREIGN KEY (game_id) REFERENCES games(game_id) ON DELETE CASCADE,
+    FOREIGN KEY (ingame_id) REFERENCES game_challenges(ingame_id) ON DELETE CASCADE,
+    FOREIGN KEY (challenge_id) REFERENCES challenges(challenge_id) ON DELETE CASCADE,
+    FOREIGN KEY (team_id) REFERENCES teams(team_id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_attachment_downloads_team_ingame ON attachment_downloads(team_id, ingame_id, download_time);
+CREATE INDEX idx_attachment_downloads_game ON attachment_downloads(game_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS attachment_downloads;
+-- +goose StatementEnd
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE cheats ADD COLUMN confidence DOUBLE PRECISION NOT NULL DEFAULT 1;
+
+-- 共用 IP、同时解题这类检测结果不对应某一次提交
+ALTER TABLE cheats ALTER COLUMN ingame_id DROP NOT NULL;
+ALTER TABLE cheats ALTER COLUMN ingame_id DROP DEFAULT;
+ALTER TABLE cheats ALTER COLUMN challenge_id DROP NOT NULL;
+ALTER TABLE cheats ALTER COLUMN challenge_id DROP DEFAULT;
+ALTER TABLE cheats ALTER COLUMN judge_id DROP NOT NULL;
+ALTER TABLE cheats ALTER COLUMN submiter_id DROP NOT NULL;
+
+CREATE INDEX idx_cheats_game_team ON cheats(game_id, team_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_cheats_game_team;
+DELETE FROM cheats WHERE ingame_id IS NULL OR challenge_id IS NULL OR judge_id IS NULL OR submiter_id IS NULL;
+ALTER TABLE cheats ALTER COLUMN submiter_id SET NOT NULL;
+ALTER TABLE cheats ALTER COLUMN judge_id SET NOT NULL;
+ALTER TABLE cheats ALTER COLUMN challenge_id SET NOT NULL;
+ALTER TABLE cheats ALTER COLUMN ingame_id SET NOT NULL;
+ALTER TABLE cheats DROP COLUMN IF EXISTS confidence;
+-- +goose StatementEnd
@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS static_containers (
+    container_id UUID PRIMARY KEY,
+    game_id BIGINT NOT NULL,
+    challenge_id BIGINT NOT NULL,
+    ingame_id BIGINT NOT NULL,
+    challenge_name TEXT NOT NULL,
+    container_config JSONB NOT NULL,
+    expose_ports JSONB NOT NULL DEFAULT '[]',
+    container_status JSONB NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    start_time TIMESTAMP NOT NULL,
+    unhealthy_since TIMESTAMP,
+    restart_count INTEGER NOT NULL DEFAULT 0,
+    last_restart_time TIMESTAMP,
+    last_error TEXT,
+
+    FOREIGN KEY (game_id) REFERENCES games(game_id) ON DELETE CASCADE,
+    FOREIGN KEY (challenge_id) REFERENCES challenges(challenge_id) ON DELETE CASCADE,
+    FOREIGN KEY (ingame_id) REFERENCES game_challenges(ingame_id) ON DELETE CASCADE,
+    UNIQUE (ingame_id)
+);
+
+CREATE INDEX idx_static_containers_game ON static_containers(game_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS static_containers;
+-- +goose StatementEnd
@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS proxy_traffic_logs (
+    log_id BIGSERIAL PRIMARY KEY,
+    game_id BIGINT NOT NULL,
+    ingame_id BIGINT NOT NULL,
+    challenge_id BIGINT NOT NULL,
+    team_id BIGINT NOT NULL,
+    user_id UUID,
+    container_id UUID NOT NULL,
+    static_container BOOLEAN NOT NULL DEFAULT FALSE,
+    container_name TEXT NOT NULL,
+    port_name TEXT NOT NULL,
+    transport TEXT NOT NULL,
+    client_ip TEXT,
+    target_address TEXT NOT NULL,
+    bytes_up BIGINT NOT NULL DEFAULT 0,
+    bytes_down BIGINT NOT NULL DEFAULT 0,
+    start_time TIMESTAMP NOT NULL,
+    end_time TIMESTAMP NOT NULL,
+    error_message TEXT,
+
+    FOREIGN KEY (game_id) REFERENCES games(game_id) ON DELETE CASCADE,
+    FOREIGN KEY (team_id) REFERENCES teams(team_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_proxy_traffic_logs_team ON proxy_traffic_logs(game_id, team_id, start_time);
+CREATE INDEX idx_proxy_traffic_logs_container ON proxy_traffic_logs(container_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS proxy_traffic_logs;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE game_challenges ADD COLUMN warm_pool_size INTEGER NOT NULL DEFAULT 0 CHECK (warm_pool_size >= 0);
+ALTER TABLE containers ADD COLUMN pod_name TEXT;
+CREATE UNIQUE INDEX idx_containers_pod_name ON containers(pod_name);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_containers_pod_name;
+ALTER TABLE containers DROP COLUMN pod_name;
+ALTER TABLE game_challenges DROP COLUMN warm_pool_size;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE games ADD COLUMN freeze_time TIMESTAMP;
+ALTER TABLE games ADD COLUMN unfreeze_time TIMESTAMP;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE games DROP COLUMN unfreeze_time;
+ALTER TABLE games DROP COLUMN freeze_time;
+-- +goose StatementEnd
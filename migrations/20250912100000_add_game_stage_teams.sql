@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS game_stage_teams (
+    id BIGSERIAL PRIMARY KEY,
+    game_id BIGINT NOT NULL,
+    stage_name TEXT NOT NULL,
+    team_id BIGINT NOT NULL,
+    from_stage TEXT,
+    from_rank BIGINT,
+    promoted_by UUID,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    FOREIGN KEY (game_id) REFERENCES games(game_id) ON DELETE CASCADE,
+    FOREIGN KEY (team_id) REFERENCES teams(team_id) ON DELETE CASCADE,
+    UNIQUE (game_id, stage_name, team_id)
+);
+
+CREATE INDEX idx_game_stage_teams_game ON game_stage_teams(game_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS game_stage_teams;
+-- +goose StatementEnd
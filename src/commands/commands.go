@@ -0,0 +1,33 @@
+package commands
+
+import (
+	solvetool "a1ctf/src/utils/solve_tool"
+	"a1ctf/src/utils/zaphelper"
+	"fmt"
+	"strconv"
+)
+
+// Run 执行维护命令，用法: ./app <command> [args...]
+func Run(args []string) error {
+	switch args[0] {
+	case "repair-solve-ranks":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: repair-solve-ranks <game_id>")
+		}
+
+		gameID, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid game id: %s", args[1])
+		}
+
+		affected, err := solvetool.RecalculateSolveRanks(gameID)
+		if err != nil {
+			return err
+		}
+
+		zaphelper.Sugar.Infof("Repaired %d solve ranks for game %d", affected, gameID)
+		return nil
+	default:
+		return fmt.Errorf("unknown command: %s", args[0])
+	}
+}
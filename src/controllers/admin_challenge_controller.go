@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"errors"
 	"log"
 	"net/http"
 	"sort"
@@ -13,8 +14,10 @@ import (
 	"gorm.io/gorm"
 
 	"a1ctf/src/db/models"
+	"a1ctf/src/tasks"
 	dbtool "a1ctf/src/utils/db_tool"
 	i18ntool "a1ctf/src/utils/i18n_tool"
+	judgetool "a1ctf/src/utils/judge_tool"
 	k8stool "a1ctf/src/utils/k8s_tool"
 	"a1ctf/src/utils/ristretto_tool"
 	"a1ctf/src/webmodels"
@@ -111,6 +114,19 @@ func AdminGetChallenge(c *gin.Context) {
 	})
 }
 
+// 动态附件必须同时配置模板文件和生成脚本
+func validAttachments(attachments models.AttachmentConfigs) bool {
+	for _, attachment := range attachments {
+		if attachment.AttachType != models.AttachmentTypeDynamicFile {
+			continue
+		}
+		if attachment.AttachHash == nil || *attachment.AttachHash == "" || attachment.GenerateScript == nil || *attachment.GenerateScript == "" {
+			return false
+		}
+	}
+	return true
+}
+
 func AdminCreateChallenge(c *gin.Context) {
 	var payload models.Challenge
 	if err := c.ShouldBindJSON(&payload); err != nil {
@@ -129,6 +145,14 @@ func AdminCreateChallenge(c *gin.Context) {
 		return
 	}
 
+	if !validAttachments(payload.Attachments) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidDynamicAttachment"}),
+		})
+		return
+	}
+
 	payload.CreateTime = time.Now().UTC()
 	payload.ChallengeID = nil
 
@@ -222,6 +246,14 @@ func AdminUpdateChallenge(c *gin.Context) {
 		}
 	}
 
+	if !validAttachments(payload.Attachments) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidDynamicAttachment"}),
+		})
+		return
+	}
+
 	var existingChallenge models.Challenge
 	if err := dbtool.DB().Where("challenge_id = ?", payload.ChallengeID).First(&existingChallenge).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -246,12 +278,57 @@ func AdminUpdateChallenge(c *gin.Context) {
 		return
 	}
 
+	// 排行榜上显示题目名称，改名之后用到这道题的比赛都要重建排行榜
+	if existingChallenge.Name != payload.Name {
+		var gameIDs []int64
+		dbtool.DB().Model(&models.GameChallenge{}).Where("challenge_id = ?", challengeID).Distinct().Pluck("game_id", &gameIDs)
+		for _, gameID := range gameIDs {
+			ristretto_tool.MarkGameScoreBoardRebuild(gameID)
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "Updated"}),
 	})
 }
 
+func AdminTestJudgeScript(c *gin.Context) {
+	payload := *c.MustGet("payload").(*webmodels.AdminTestJudgeScriptPayload)
+
+	result, err := judgetool.RunJudgeScript(c.Request.Context(), payload.JudgeScript, judgetool.ScriptJudgeInput{
+		Submission: payload.Submission,
+		TeamHash:   payload.TeamHash,
+		GameID:     payload.GameID,
+	})
+	if err != nil {
+		tasks.LogAdminOperationWithError(c, models.ActionJudge, models.ResourceTypeChallenge, nil, map[string]interface{}{
+			"submission": payload.Submission,
+			"team_hash":  payload.TeamHash,
+			"game_id":    payload.GameID,
+		}, err)
+
+		messageID := "FailedToRunJudgeScript"
+		switch {
+		case errors.Is(err, judgetool.ErrJudgeSandboxMissing):
+			messageID = "JudgeSandboxNotConfigured"
+		case errors.Is(err, judgetool.ErrJudgeSandboxWorkDir):
+			messageID = "JudgeSandboxWorkDirMissing"
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: messageID}),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": result,
+	})
+}
+
 func AdminGetSimpleGameChallenges(c *gin.Context) {
 	game := c.MustGet("game").(models.Game)
 	team := c.MustGet("team").(models.Team)
@@ -2,14 +2,17 @@ package controllers
 
 import (
 	"a1ctf/src/db/models"
+	"a1ctf/src/tasks"
 	dbtool "a1ctf/src/utils/db_tool"
 	i18ntool "a1ctf/src/utils/i18n_tool"
 	"a1ctf/src/webmodels"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
 	"gorm.io/gorm"
 )
@@ -125,7 +128,7 @@ func AdminListContainers(c *gin.Context) {
 			containerPorts = append(containerPorts, exposeInfo.ExposePorts...)
 		}
 
-		podID := fmt.Sprintf("cl-%d-%s", container.InGameID, container.TeamHash)
+		podID := container.InstanceName()
 
 		containerNameList := make([]string, 0)
 		for _, exposeInfo := range container.ContainerConfig {
@@ -320,3 +323,261 @@ func AdminGetContainerFlag(c *gin.Context) {
 		},
 	})
 }
+
+// 查询静态容器题目和它的共享实例，实例还没有创建的时候 staticContainer 为 nil
+func loadAdminStaticContainer(c *gin.Context, payload webmodels.AdminStaticContainerPayload) (*models.GameChallenge, *models.StaticContainer, bool) {
+	var gameChallenge models.GameChallenge
+	if err := dbtool.DB().Preload("Challenge").Where("game_id = ? AND challenge_id = ?", payload.GameID, payload.ChallengeID).First(&gameChallenge).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    404,
+				"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "GameChallengeNotFound"}),
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadGameChallenge"}),
+			})
+		}
+		return nil, nil, false
+	}
+
+	if gameChallenge.Challenge.ContainerType != models.STATIC_CONTAINER || gameChallenge.Challenge.ContainerConfig == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "NotStaticContainerChallenge"}),
+		})
+		return nil, nil, false
+	}
+
+	var staticContainers []models.StaticContainer
+	if err := dbtool.DB().Preload("Challenge").Preload("GameChallenge").Where("ingame_id = ?", gameChallenge.IngameID).Limit(1).Find(&staticContainers).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToQueryContainer"}),
+		})
+		return nil, nil, false
+	}
+
+	if len(staticContainers) == 0 {
+		return &gameChallenge, nil, true
+	}
+
+	return &gameChallenge, &staticContainers[0], true
+}
+
+// AdminListStaticContainers 获取比赛中所有静态容器题目的共享实例
+func AdminListStaticContainers(c *gin.Context) {
+	gameID, err := strconv.ParseInt(c.Query("game_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidGameID"}),
+		})
+		return
+	}
+
+	var staticContainers []models.StaticContainer
+	if err := dbtool.DB().Where("game_id = ?", gameID).Order("ingame_id ASC").Find(&staticContainers).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadContainers"}),
+		})
+		return
+	}
+
+	result := make([]gin.H, 0, len(staticContainers))
+	for _, staticContainer := range staticContainers {
+		result = append(result, gin.H{
+			"container_id":      staticContainer.ContainerID,
+			"challenge_id":      staticContainer.ChallengeID,
+			"challenge_name":    staticContainer.ChallengeName,
+			"pod_id":            fmt.Sprintf("cs-%d", staticContainer.InGameID),
+			"container_status":  staticContainer.ContainerStatus,
+			"container_ports":   staticContainer.ContainerExposeInfos,
+			"enabled":           staticContainer.Enabled,
+			"start_time":        staticContainer.StartTime,
+			"unhealthy_since":   staticContainer.UnhealthySince,
+			"restart_count":     staticContainer.RestartCount,
+			"last_restart_time": staticContainer.LastRestartTime,
+			"last_error":        staticContainer.LastError,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": result,
+	})
+}
+
+// AdminStartStaticContainer 开启静态容器，题目可见时由定时任务启动
+func AdminStartStaticContainer(c *gin.Context) {
+	var payload webmodels.AdminStaticContainerPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidRequestPayload"}),
+		})
+		return
+	}
+
+	gameChallenge, staticContainer, ok := loadAdminStaticContainer(c, payload)
+	if !ok {
+		return
+	}
+
+	if staticContainer == nil {
+		staticContainer = &models.StaticContainer{
+			ContainerID:          uuid.NewString(),
+			GameID:               gameChallenge.GameID,
+			ChallengeID:          gameChallenge.ChallengeID,
+			InGameID:             gameChallenge.IngameID,
+			ChallengeName:        gameChallenge.Challenge.Name,
+			ContainerConfig:      *gameChallenge.Challenge.ContainerConfig,
+			ContainerExposeInfos: models.ContainerExposeInfos{},
+			ContainerStatus:      models.ContainerQueueing,
+			Enabled:              true,
+			StartTime:            time.Now().UTC(),
+		}
+
+		if err := dbtool.DB().Create(staticContainer).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToStartStaticContainer"}),
+			})
+			return
+		}
+	} else {
+		updates := map[string]interface{}{
+			"enabled": true,
+		}
+		if staticContainer.ContainerStatus == models.ContainerStopped || staticContainer.ContainerStatus == models.ContainerError {
+			updates["container_status"] = models.ContainerQueueing
+		}
+
+		if err := dbtool.DB().Model(staticContainer).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToStartStaticContainer"}),
+			})
+			return
+		}
+	}
+
+	tasks.LogAdminOperation(c, models.ActionStartContainer, models.ResourceTypeContainer, &staticContainer.ContainerID, map[string]interface{}{
+		"game_id":        gameChallenge.GameID,
+		"challenge_id":   gameChallenge.ChallengeID,
+		"challenge_name": gameChallenge.Challenge.Name,
+		"ingame_id":      gameChallenge.IngameID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "StaticContainerStarted"}),
+	})
+}
+
+// AdminStopStaticContainer 关闭静态容器，关闭后题目重新可见也不会自动启动
+func AdminStopStaticContainer(c *gin.Context) {
+	var payload webmodels.AdminStaticContainerPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidRequestPayload"}),
+		})
+		return
+	}
+
+	gameChallenge, staticContainer, ok := loadAdminStaticContainer(c, payload)
+	if !ok {
+		return
+	}
+
+	if staticContainer == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    404,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "ContainerNotFound"}),
+		})
+		return
+	}
+
+	// Pod 由定时任务删除
+	if err := dbtool.DB().Model(staticContainer).Update("enabled", false).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToDeleteContainer"}),
+		})
+		return
+	}
+
+	tasks.LogAdminOperation(c, models.ActionStopContainer, models.ResourceTypeContainer, &staticContainer.ContainerID, map[string]interface{}{
+		"game_id":        gameChallenge.GameID,
+		"challenge_id":   gameChallenge.ChallengeID,
+		"challenge_name": gameChallenge.Challenge.Name,
+		"ingame_id":      gameChallenge.IngameID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "StaticContainerStopped"}),
+	})
+}
+
+// AdminRestartStaticContainer 重启静态容器，会使用题目最新的容器配置
+func AdminRestartStaticContainer(c *gin.Context) {
+	var payload webmodels.AdminStaticContainerPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidRequestPayload"}),
+		})
+		return
+	}
+
+	gameChallenge, staticContainer, ok := loadAdminStaticContainer(c, payload)
+	if !ok {
+		return
+	}
+
+	if staticContainer == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    404,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "ContainerNotFound"}),
+		})
+		return
+	}
+
+	if !staticContainer.Enabled {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "StaticContainerDisabled"}),
+		})
+		return
+	}
+
+	if err := tasks.RestartStaticContainer(*staticContainer, "restarted by admin"); err != nil {
+		tasks.LogAdminOperationWithError(c, models.ActionStartContainer, models.ResourceTypeContainer, &staticContainer.ContainerID, map[string]interface{}{
+			"game_id":      gameChallenge.GameID,
+			"challenge_id": gameChallenge.ChallengeID,
+			"restart":      true,
+		}, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToRestartStaticContainer"}),
+		})
+		return
+	}
+
+	tasks.LogAdminOperation(c, models.ActionStartContainer, models.ResourceTypeContainer, &staticContainer.ContainerID, map[string]interface{}{
+		"game_id":        gameChallenge.GameID,
+		"challenge_id":   gameChallenge.ChallengeID,
+		"challenge_name": gameChallenge.Challenge.Name,
+		"ingame_id":      gameChallenge.IngameID,
+		"restart":        true,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "StaticContainerRestarted"}),
+	})
+}
@@ -73,6 +73,12 @@ func AdminHandleContainerExec(c *gin.Context) {
 
 	var writeMu sync.Mutex
 
+	// 终端只支持 k8s 后端
+	if k8stool.Backend().Name() != k8stool.BackendK8s {
+		sendErrorMessage(ws, &writeMu, fmt.Sprintf("Exec is not supported by %s backend", k8stool.Backend().Name()))
+		return
+	}
+
 	clientset, err := k8stool.GetClient()
 	if err != nil {
 		sendErrorMessage(ws, &writeMu, fmt.Sprintf("Failed to get k8s client: %v", err))
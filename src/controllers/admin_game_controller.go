@@ -16,16 +16,23 @@ import (
 	"gorm.io/gorm"
 
 	"a1ctf/src/db/models"
+	"a1ctf/src/tasks"
 	dbtool "a1ctf/src/utils/db_tool"
 	"a1ctf/src/utils/general"
 	i18ntool "a1ctf/src/utils/i18n_tool"
+	k8stool "a1ctf/src/utils/k8s_tool"
 	noticetool "a1ctf/src/utils/notice_tool"
+	"a1ctf/src/utils/ristretto_tool"
+	scoretool "a1ctf/src/utils/score_tool"
+	solvetool "a1ctf/src/utils/solve_tool"
+	"a1ctf/src/utils/zaphelper"
 	"a1ctf/src/webmodels"
 	"mime"
 
 	"github.com/bytedance/sonic"
 	"github.com/google/uuid"
 	"github.com/lib/pq"
+	"go.uber.org/zap"
 )
 
 // helper: convert slice of strings to LIKE patterns for ILIKE ANY
@@ -100,6 +107,14 @@ func AdminCreateGame(c *gin.Context) {
 		return
 	}
 
+	if !validStageSettings(payload.Stages) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidStageSettings"}),
+		})
+		return
+	}
+
 	game := models.Game{
 		Name:                 payload.Name,
 		Summary:              payload.Summary,
@@ -110,6 +125,7 @@ func AdminCreateGame(c *gin.Context) {
 		WpExpireTime:         payload.WpExpireTime,
 		Stages:               payload.Stages,
 		RequireWp:            payload.RequireWp,
+		WpExcludeUnsubmitted: payload.WpExcludeUnsubmitted,
 		ContainerNumberLimit: payload.ContainerNumberLimit,
 		TeamNumberLimit:      payload.TeamNumberLimit,
 		PracticeMode:         payload.PracticeMode,
@@ -181,6 +197,9 @@ func AdminGetGame(c *gin.Context) {
 		"container_number_limit": game.ContainerNumberLimit,
 		"require_wp":             game.RequireWp,
 		"wp_expire_time":         game.WpExpireTime,
+		"wp_exclude_unsubmitted": game.WpExcludeUnsubmitted,
+		"freeze_time":            game.FreezeTime,
+		"unfreeze_time":          game.UnfreezeTime,
 		"stages":                 game.Stages,
 		"visible":                game.Visible,
 		"game_icon_light":        game.GameIconLight,
@@ -262,6 +281,9 @@ func AdminGetGameChallenge(c *gin.Context) {
 		"minimal_score":       gc.MinimalScore,
 		"difficulty":          gc.Difficulty,
 		"enable_blood_reward": gc.BloodRewardEnabled,
+		"scoring_strategy":    gc.ScoringStrategy,
+		"scoring_decay":       gc.ScoringDecay,
+		"warm_pool_size":      gc.WarmPoolSize,
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -270,12 +292,45 @@ func AdminGetGameChallenge(c *gin.Context) {
 	})
 }
 
+// 解锁记录通过 hint_id 关联提示，保存时沿用已有提示的 ID，只给新提示分配 ID。
+// 没有带 hint_id 的旧数据按内容和发布时间匹配已有提示，不认识的 hint_id 当作新提示处理
+func keepHintIDs(existingHints *models.Hints, hints models.Hints) {
+	existingIDs := make(map[string]bool)
+	legacyIDs := make(map[string]string)
+	if existingHints != nil {
+		for _, hint := range *existingHints {
+			if hint.HintID == "" {
+				continue
+			}
+			existingIDs[hint.HintID] = true
+			legacyIDs[hint.Content+"\x00"+hint.CreateTime.UTC().String()] = hint.HintID
+		}
+	}
+
+	usedIDs := make(map[string]bool, len(hints))
+	for idx := range hints {
+		hintID := hints[idx].HintID
+		if hintID == "" {
+			hintID = legacyIDs[hints[idx].Content+"\x00"+hints[idx].CreateTime.UTC().String()]
+		}
+		if !existingIDs[hintID] || usedIDs[hintID] {
+			hintID = uuid.NewString()
+		}
+
+		usedIDs[hintID] = true
+		hints[idx].HintID = hintID
+
+		if hints[idx].Cost < 0 {
+			hints[idx].Cost = 0
+		}
+	}
+}
+
 func AdminUpdateGameChallenge(c *gin.Context) {
 
 	gameID := c.MustGet("game_id").(int64)
 	// 实际上是 challenge_id
 	challengeID := c.MustGet("game_challenge_id").(int64)
-	game := c.MustGet("game").(models.Game)
 	existingGameChallenge := c.MustGet("game_challenge").(models.GameChallenge)
 
 	// 使用 map 来接收部分字段更新
@@ -344,16 +399,13 @@ func AdminUpdateGameChallenge(c *gin.Context) {
 		updateFields = append(updateFields, "total_score")
 	}
 
-	// 比赛开始前，题目的 cur_store 永远等于总分
-	if game.StartTime.Before(time.Now().UTC()) {
-		updateData["cur_score"] = existingGameChallenge.TotalScore
-		updateFields = append(updateFields, "cur_score")
-	}
 	if hintsData, ok := payload["hints"]; ok {
 		// 将 hints 数据转换为正确的 Hints 类型
 		var hints models.Hints
 		if hintsBytes, err := sonic.Marshal(hintsData); err == nil {
 			if err := sonic.Unmarshal(hintsBytes, &hints); err == nil {
+				keepHintIDs(existingGameChallenge.Hints, hints)
+
 				updateData["hints"] = hints
 				updateFields = append(updateFields, "hints")
 			}
@@ -379,16 +431,70 @@ func AdminUpdateGameChallenge(c *gin.Context) {
 	}
 	if difficulty, ok := payload["difficulty"]; ok {
 		updateData["difficulty"] = difficulty
+
+		existingGameChallenge.Difficulty, _ = difficulty.(float64)
+
 		updateFields = append(updateFields, "difficulty")
 	}
 	if minimalScore, ok := payload["minimal_score"]; ok {
 		updateData["minimal_score"] = minimalScore
+
+		existingGameChallenge.MinimalScore, _ = minimalScore.(float64)
+
 		updateFields = append(updateFields, "minimal_score")
 	}
 	if bloodRewardEnabled, ok := payload["enable_blood_reward"]; ok {
 		updateData["enable_blood_reward"] = bloodRewardEnabled
 		updateFields = append(updateFields, "enable_blood_reward")
 	}
+	if scoringStrategy, ok := payload["scoring_strategy"]; ok {
+		strategy, _ := scoringStrategy.(string)
+		updateData["scoring_strategy"] = models.ScoringStrategy(strategy)
+
+		existingGameChallenge.ScoringStrategy = models.ScoringStrategy(strategy)
+
+		updateFields = append(updateFields, "scoring_strategy")
+	}
+	if scoringDecay, ok := payload["scoring_decay"]; ok {
+		decay, _ := scoringDecay.(float64)
+		updateData["scoring_decay"] = int32(decay)
+
+		existingGameChallenge.ScoringDecay = int32(decay)
+
+		updateFields = append(updateFields, "scoring_decay")
+	}
+
+	if warmPoolSize, ok := payload["warm_pool_size"]; ok {
+		size, _ := warmPoolSize.(float64)
+		if size < 0 || size > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidWarmPoolSize"}),
+			})
+			return
+		}
+
+		// 预热实例创建的时候没有 flag，题目的 flag 注入方式需要支持启动之后写入
+		if size > 0 {
+			if existingGameChallenge.Challenge.ContainerType != models.DYNAMIC_CONTAINER || existingGameChallenge.Challenge.ContainerConfig == nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"code":    400,
+					"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "WarmPoolRequiresDynamicContainer"}),
+				})
+				return
+			}
+			if err := k8stool.ValidWarmPoolConfig(*existingGameChallenge.Challenge.ContainerConfig); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"code":    400,
+					"message": err.Error(),
+				})
+				return
+			}
+		}
+
+		updateData["warm_pool_size"] = int32(size)
+		updateFields = append(updateFields, "warm_pool_size")
+	}
 
 	// 如果没有要更新的字段，直接返回
 	if len(updateFields) == 0 {
@@ -398,6 +504,28 @@ func AdminUpdateGameChallenge(c *gin.Context) {
 		return
 	}
 
+	// 只有修改了计分相关的字段才校验，避免老题目的配置导致其他字段无法保存
+	scoringChanged := false
+	for _, field := range []string{"total_score", "minimal_score", "difficulty", "scoring_strategy", "scoring_decay"} {
+		if _, ok := payload[field]; ok {
+			scoringChanged = true
+		}
+	}
+
+	if scoringChanged {
+		if err := scoretool.ValidScoringConfig(&existingGameChallenge); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+
+	// 题目的 cur_score 和积分榜使用同一个计分策略计算，比赛开始前没有解题所以等于总分
+	updateData["cur_score"] = scoretool.CalculateChallengeScore(&existingGameChallenge, existingGameChallenge.SolveCount)
+	updateFields = append(updateFields, "cur_score")
+
 	// 执行数据库更新
 	if err := dbtool.DB().Model(&models.GameChallenge{}).
 		Select(updateFields).
@@ -409,6 +537,9 @@ func AdminUpdateGameChallenge(c *gin.Context) {
 		return
 	}
 
+	// 可见性和计分参数都会影响排行榜
+	ristretto_tool.MarkGameScoreBoardRebuild(gameID)
+
 	if shouldSendNotice {
 		go func() {
 			noticetool.InsertNotice(gameID, models.NoticeNewHint, noticeData)
@@ -420,6 +551,49 @@ func AdminUpdateGameChallenge(c *gin.Context) {
 	})
 }
 
+// AdminPreviewChallengeScore 预览题目在 1..N 个解时的分数，可以传入还没保存的计分参数
+func AdminPreviewChallengeScore(c *gin.Context) {
+	gameChallenge := c.MustGet("game_challenge").(models.GameChallenge)
+	payload := *c.MustGet("payload").(*webmodels.AdminScorePreviewPayload)
+
+	if payload.ScoringStrategy != nil {
+		gameChallenge.ScoringStrategy = *payload.ScoringStrategy
+	}
+	if payload.TotalScore != nil {
+		gameChallenge.TotalScore = *payload.TotalScore
+	}
+	if payload.MinimalScore != nil {
+		gameChallenge.MinimalScore = *payload.MinimalScore
+	}
+	if payload.Difficulty != nil {
+		gameChallenge.Difficulty = *payload.Difficulty
+	}
+	if payload.ScoringDecay != nil {
+		gameChallenge.ScoringDecay = *payload.ScoringDecay
+	}
+
+	if err := scoretool.ValidScoringConfig(&gameChallenge); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	result := make([]webmodels.ScorePreviewItem, 0, payload.MaxSolves)
+	for solveCount := int32(1); solveCount <= payload.MaxSolves; solveCount++ {
+		result = append(result, webmodels.ScorePreviewItem{
+			SolveCount: solveCount,
+			Score:      scoretool.CalculateChallengeScore(&gameChallenge, solveCount),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": result,
+	})
+}
+
 func AdminUpdateGame(c *gin.Context) {
 	game := c.MustGet("game").(models.Game)
 
@@ -432,6 +606,28 @@ func AdminUpdateGame(c *gin.Context) {
 		return
 	}
 
+	// 封榜时间需要在比赛时间内
+	if payload.FreezeTime != nil && (payload.FreezeTime.Before(payload.StartTime) || payload.FreezeTime.After(payload.EndTime)) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidFreezeTime"}),
+		})
+		return
+	}
+
+	if !validStageSettings(payload.Stages) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidStageSettings"}),
+		})
+		return
+	}
+
+	// 修改了封榜时间就重新封榜
+	if !sameTime(game.FreezeTime, payload.FreezeTime) {
+		game.UnfreezeTime = nil
+	}
+
 	// 更新比赛信息
 	game.Name = payload.Name
 	game.Summary = payload.Summary
@@ -445,6 +641,8 @@ func AdminUpdateGame(c *gin.Context) {
 	game.ContainerNumberLimit = payload.ContainerNumberLimit
 	game.RequireWp = payload.RequireWp
 	game.WpExpireTime = payload.WpExpireTime
+	game.WpExcludeUnsubmitted = payload.WpExcludeUnsubmitted
+	game.FreezeTime = payload.FreezeTime
 	game.Stages = payload.Stages
 	game.Visible = payload.Visible
 	game.TeamPolicy = payload.TeamPolicy
@@ -479,6 +677,8 @@ func AdminUpdateGame(c *gin.Context) {
 		return
 	}
 
+	ristretto_tool.MarkGameScoreBoardRebuild(game.GameID)
+
 	c.JSON(http.StatusOK, gin.H{
 		"code": 200,
 	})
@@ -511,6 +711,7 @@ func AdminAddGameChallenge(c *gin.Context) {
 		TotalScore:         500,
 		CurScore:           500,
 		Difficulty:         5,
+		ScoringStrategy:    models.ScoringStrategyExponential,
 		Hints:              &models.Hints{},
 		JudgeConfig:        challenge.JudgeConfig,
 		BelongStage:        nil,
@@ -526,6 +727,8 @@ func AdminAddGameChallenge(c *gin.Context) {
 		return
 	}
 
+	ristretto_tool.MarkGameScoreBoardRebuild(gameID)
+
 	c.JSON(http.StatusOK, gin.H{
 		"code": 200,
 		"data": gin.H{
@@ -556,6 +759,8 @@ func AdminDeleteGameChallenge(c *gin.Context) {
 		}
 	}
 
+	ristretto_tool.MarkGameScoreBoardRebuild(gameID)
+
 	c.JSON(http.StatusOK, gin.H{
 		"code": 200,
 	})
@@ -1241,6 +1446,9 @@ func AdminUpdateScoreAdjustment(c *gin.Context) {
 		"updated_at":          updatedAdjustment.UpdatedAt,
 	}
 
+	// 修改过的分数修正不会被增量读取到
+	ristretto_tool.MarkGameScoreBoardRebuild(gameID)
+
 	c.JSON(http.StatusOK, gin.H{
 		"code": 200,
 		"data": data,
@@ -1321,6 +1529,8 @@ func AdminDeleteScoreAdjustment(c *gin.Context) {
 		return
 	}
 
+	ristretto_tool.MarkGameScoreBoardRebuild(gameID)
+
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "ScoreAdjustmentDeletedSuccessfully"}),
@@ -1451,6 +1661,11 @@ func AdminDeleteChallengeSolves(c *gin.Context) {
 		return
 	}
 
+	// 删除解题记录后按解题时间重新计算排名，后面的队伍顺延补上三血
+	if _, err := solvetool.RecalculateSolveRanks(gameID); err != nil {
+		zaphelper.Logger.Error("Failed to recalculate solve ranks", zap.Error(err), zap.Int64("game_id", gameID))
+	}
+
 	// 构建响应消息
 	var message string
 	var data gin.H
@@ -1467,6 +1682,8 @@ func AdminDeleteChallengeSolves(c *gin.Context) {
 		}
 	}
 
+	ristretto_tool.MarkGameScoreBoardRebuild(gameID)
+
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": message,
@@ -1474,6 +1691,136 @@ func AdminDeleteChallengeSolves(c *gin.Context) {
 	})
 }
 
+// AdminRepairSolveRanks 按照解题时间重新计算比赛的解题排名
+func AdminRepairSolveRanks(c *gin.Context) {
+	game := c.MustGet("game").(models.Game)
+	gameIDStr := strconv.FormatInt(game.GameID, 10)
+
+	affected, err := solvetool.RecalculateSolveRanks(game.GameID)
+	if err != nil {
+		tasks.LogAdminOperationWithError(c, models.ActionUpdate, models.ResourceTypeGame, &gameIDStr, map[string]interface{}{
+			"operation": "repair_solve_ranks",
+		}, err)
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToRepairSolveRanks"}),
+		})
+		return
+	}
+
+	tasks.LogAdminOperation(c, models.ActionUpdate, models.ResourceTypeGame, &gameIDStr, map[string]interface{}{
+		"operation": "repair_solve_ranks",
+		"affected":  affected,
+	})
+
+	ristretto_tool.MarkGameScoreBoardRebuild(game.GameID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"affected": affected,
+		},
+	})
+}
+
+func sameTime(a *time.Time, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Equal(*b)
+}
+
+// AdminUnfreezeScoreboard 解除封榜，公布最终排行榜并推送给比赛中的所有连接
+func AdminUnfreezeScoreboard(c *gin.Context) {
+	game := c.MustGet("game").(models.Game)
+	gameIDStr := strconv.FormatInt(game.GameID, 10)
+
+	if game.FreezeTime == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "ScoreboardNotFrozen"}),
+		})
+		return
+	}
+
+	// 设置了 unfreeze_time 之后就不会再封榜，提前解除会让封榜失效并把实时排行榜当成最终排行榜推送出去
+	unfreezeTime := time.Now().UTC()
+	if unfreezeTime.Before(*game.FreezeTime) || unfreezeTime.Before(game.EndTime) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "ScoreboardUnfreezeBeforeGameEnd"}),
+		})
+		return
+	}
+
+	result := dbtool.DB().Model(&models.Game{}).
+		Where("game_id = ? AND unfreeze_time IS NULL", game.GameID).
+		Update("unfreeze_time", unfreezeTime)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToSaveGame"}),
+		})
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "ScoreboardAlreadyUnfrozen"}),
+		})
+		return
+	}
+
+	tasks.LogAdminOperation(c, models.ActionUpdate, models.ResourceTypeGame, &gameIDStr, map[string]interface{}{
+		"operation":     "unfreeze_scoreboard",
+		"freeze_time":   game.FreezeTime,
+		"unfreeze_time": unfreezeTime,
+	})
+
+	// 重新生成一次实时排行榜，推送的就是最终排行榜
+	ristretto_tool.MarkGameScoreBoardRebuild(game.GameID)
+	if err := ristretto_tool.MakeGameScoreBoardCache(game.GameID); err != nil {
+		zaphelper.Logger.Error("Failed to make game scoreboard cache", zap.Error(err), zap.Int64("game_id", game.GameID))
+	}
+
+	scoreBoard, err := ristretto_tool.CachedGameScoreBoard(game.GameID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadGameScoreboard"}),
+		})
+		return
+	}
+
+	rankings := make([]gin.H, 0, len(scoreBoard.TeamRankings))
+	for _, team := range scoreBoard.TeamRankings {
+		rankings = append(rankings, gin.H{
+			"rank":       team.Rank,
+			"team_id":    team.TeamID,
+			"team_name":  team.TeamName,
+			"group_name": team.GroupName,
+			"score":      team.Score,
+			"penalty":    team.Penalty,
+		})
+	}
+
+	go noticetool.Broadcast(game.GameID, "ScoreboardUnfrozen", gin.H{
+		"game_id":       game.GameID,
+		"unfreeze_time": unfreezeTime,
+		"rankings":      rankings,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"unfreeze_time": unfreezeTime,
+			"rankings":      rankings,
+		},
+	})
+}
+
 // AdminGetSubmits 获取指定比赛的提交记录（包含正确与错误）
 func AdminGetSubmits(c *gin.Context) {
 	// 解析并校验 game_id
@@ -1720,6 +2067,7 @@ func AdminGetCheats(c *gin.Context) {
 		TeamIDs        []int64  `json:"team_ids"`        // 多个队伍ID
 		TeamNames      []string `json:"team_names"`      // 多个队伍名称
 		CheatTypes     []string `json:"cheat_types"`     // 多个作弊类型
+		MinConfidence  *float64 `json:"min_confidence"`  // 最低置信度
 		StartTime      *string  `json:"start_time"`      // 起始时间 (ISO8601)
 		EndTime        *string  `json:"end_time"`        // 结束时间 (ISO8601)
 	}
@@ -1795,11 +2143,22 @@ func AdminGetCheats(c *gin.Context) {
 				coveredTypes = append(coveredTypes, models.CheatSubmitWithoutDownloadAttachments)
 			case "SubmitWithoutStartContainer":
 				coveredTypes = append(coveredTypes, models.CheatSubmitWithoutStartContainer)
+			case "SharedIP":
+				coveredTypes = append(coveredTypes, models.CheatSharedIP)
+			case "CloseSolveTime":
+				coveredTypes = append(coveredTypes, models.CheatCloseSolveTime)
+			case "SubmitSomeonesTeamHash":
+				coveredTypes = append(coveredTypes, models.CheatSubmitSomeonesTeamHash)
 			}
 		}
 		baseQuery = baseQuery.Where("cheat_type IN ?", coveredTypes)
 	}
 
+	// 置信度过滤
+	if payload.MinConfidence != nil {
+		baseQuery = baseQuery.Where("confidence >= ?", *payload.MinConfidence)
+	}
+
 	// 时间范围过滤
 	if payload.StartTime != nil && strings.TrimSpace(*payload.StartTime) != "" {
 		if t, err := time.Parse(time.RFC3339, *payload.StartTime); err == nil {
@@ -1865,6 +2224,7 @@ func AdminGetCheats(c *gin.Context) {
 			"extra_data":     cheat.ExtraData,
 			"cheat_time":     cheat.CheatTime,
 			"submiter_ip":    cheat.SubmiterIP,
+			"confidence":     cheat.Confidence,
 		})
 	}
 
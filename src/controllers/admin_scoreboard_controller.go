@@ -0,0 +1,286 @@
+package controllers
+
+import (
+	"a1ctf/src/db/models"
+	"a1ctf/src/tasks"
+	dbtool "a1ctf/src/utils/db_tool"
+	i18ntool "a1ctf/src/utils/i18n_tool"
+	"a1ctf/src/utils/ristretto_tool"
+	xlsxtool "a1ctf/src/utils/xlsx_tool"
+	"a1ctf/src/webmodels"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+const (
+	scoreboardExportCTFtime = "ctftime"
+	scoreboardExportCSV     = "csv"
+	scoreboardExportXLSX    = "xlsx"
+)
+
+// 按分组过滤排行榜并重新计算组内排名，和 CachedFilteredGameScoreBoard 一致
+func filterScoreboardByGroup(rankings []webmodels.TeamScoreItem, groupID *int64) []webmodels.TeamScoreItem {
+	if groupID == nil {
+		return rankings
+	}
+
+	filtered := make([]webmodels.TeamScoreItem, 0)
+	for _, team := range rankings {
+		if team.GroupID != nil && *team.GroupID == *groupID {
+			team.Rank = int64(len(filtered) + 1)
+			filtered = append(filtered, team)
+		}
+	}
+
+	return filtered
+}
+
+// 一支队伍的得分构成，三血奖励、分数修正和提示扣分分开统计
+type teamScoreBreakdown struct {
+	ChallengeScore float64
+	BloodReward    float64
+	Adjustment     float64
+	HintCost       float64
+}
+
+func scoreBreakdown(team webmodels.TeamScoreItem) teamScoreBreakdown {
+	var breakdown teamScoreBreakdown
+
+	for _, solve := range team.SolvedChallenges {
+		breakdown.ChallengeScore += solve.Score - solve.BloodReward
+		breakdown.BloodReward += solve.BloodReward
+	}
+
+	for _, adjustment := range team.ScoreAdjustments {
+		switch {
+		case adjustment.AdjustmentID == -1 && adjustment.AdjustmentType == string(models.AdjustmentTypeReward):
+			// 三血奖励已经算在解题记录里了
+		case adjustment.AdjustmentType == string(models.AdjustmentTypeHint):
+			breakdown.HintCost -= adjustment.ScoreChange
+		default:
+			breakdown.Adjustment += adjustment.ScoreChange
+		}
+	}
+
+	return breakdown
+}
+
+// 导出表格的所有行，第一行是表头，每道题一列记录解题时间
+func scoreboardExportRows(rankings []webmodels.TeamScoreItem, gameChallenges []models.GameChallenge) [][]interface{} {
+	header := []interface{}{"Rank", "Team", "Group", "Score", "Penalty", "Solved", "Challenge Score", "Blood Reward", "Score Adjustment", "Hint Cost"}
+	for _, gc := range gameChallenges {
+		header = append(header, gc.Challenge.Name)
+	}
+
+	rows := make([][]interface{}, 0, len(rankings)+1)
+	rows = append(rows, header)
+
+	for _, team := range rankings {
+		breakdown := scoreBreakdown(team)
+		row := []interface{}{
+			team.Rank,
+			team.TeamName,
+			team.GroupName,
+			team.Score,
+			team.Penalty,
+			len(team.SolvedChallenges),
+			breakdown.ChallengeScore,
+			breakdown.BloodReward,
+			breakdown.Adjustment,
+			breakdown.HintCost,
+		}
+
+		solveTimes := make(map[int64]time.Time, len(team.SolvedChallenges))
+		for _, solve := range team.SolvedChallenges {
+			solveTimes[solve.ChallengeID] = solve.SolveTime
+		}
+
+		for _, gc := range gameChallenges {
+			if solveTime, ok := solveTimes[gc.ChallengeID]; ok {
+				row = append(row, solveTime.UTC().Format(time.DateTime))
+			} else {
+				row = append(row, nil)
+			}
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+func writeScoreboardCSV(rows [][]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	// 加上 BOM，Excel 打开中文队伍名不会乱码
+	buf.WriteString("\ufeff")
+
+	writer := csv.NewWriter(&buf)
+	for _, row := range rows {
+		record := make([]string, len(row))
+		for i, value := range row {
+			switch v := value.(type) {
+			case nil:
+				record[i] = ""
+			case float64:
+				record[i] = strconv.FormatFloat(v, 'f', -1, 64)
+			case int:
+				record[i] = strconv.Itoa(v)
+			case int64:
+				record[i] = strconv.FormatInt(v, 10)
+			default:
+				// 数字以外的单元格都可能是用户输入，需要防止公式注入
+				record[i] = xlsxtool.EscapeFormula(fmt.Sprint(v))
+			}
+		}
+		if err := writer.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	writer.Flush()
+
+	return buf.Bytes(), writer.Error()
+}
+
+// AdminExportScoreboardFile 按照指定格式导出最终排行榜，可以按分组过滤
+//
+//   - ctftime: CTFtime 使用的 standings JSON
+//   - csv / xlsx: 包含得分构成和每道题的解题时间
+func AdminExportScoreboardFile(c *gin.Context) {
+	game := c.MustGet("game").(models.Game)
+
+	format := c.Param("format")
+	if format != scoreboardExportCTFtime && format != scoreboardExportCSV && format != scoreboardExportXLSX {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidExportFormat"}),
+		})
+		return
+	}
+
+	var groupID *int64
+	if groupIDStr := c.Query("group_id"); groupIDStr != "" {
+		gid, err := strconv.ParseInt(groupIDStr, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidGroupID"}),
+			})
+			return
+		}
+
+		groups, err := ristretto_tool.CachedGameGroups(game.GameID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadGameGroups"}),
+			})
+			return
+		}
+
+		if _, ok := groups[gid]; !ok {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    404,
+				"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "GroupNotFound"}),
+			})
+			return
+		}
+
+		groupID = &gid
+	}
+
+	scoreBoard, err := ristretto_tool.CachedGameScoreBoard(game.GameID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadGameScoreboard"}),
+		})
+		return
+	}
+
+	rankings, err := filterScoreboardByWriteup(game, filterScoreboardByGroup(scoreBoard.TeamRankings, groupID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadWriteup"}),
+		})
+		return
+	}
+
+	gameIDStr := fmt.Sprintf("%d", game.GameID)
+	tasks.LogAdminOperation(c, models.ActionView, models.ResourceTypeGame, &gameIDStr, map[string]interface{}{
+		"export":                 "scoreboard",
+		"format":                 format,
+		"group_id":               groupID,
+		"team_count":             len(rankings),
+		"wp_exclude_unsubmitted": game.RequireWp && game.WpExcludeUnsubmitted,
+	})
+
+	fileName := fmt.Sprintf("scoreboard_%d", game.GameID)
+	if groupID != nil {
+		fileName = fmt.Sprintf("%s_group_%d", fileName, *groupID)
+	}
+
+	if format == scoreboardExportCTFtime {
+		standings := make([]gin.H, 0, len(rankings))
+		for _, team := range rankings {
+			standings = append(standings, gin.H{
+				"pos":   team.Rank,
+				"team":  team.TeamName,
+				"score": team.Score,
+			})
+		}
+
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s_ctftime.json", fileName))
+		c.JSON(http.StatusOK, gin.H{
+			"standings": standings,
+		})
+		return
+	}
+
+	var gameChallenges []models.GameChallenge
+	if err := dbtool.DB().Preload("Challenge").Where("game_id = ? AND visible = ?", game.GameID, true).Find(&gameChallenges).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadGameChallenges"}),
+		})
+		return
+	}
+
+	sort.Slice(gameChallenges, func(i, j int) bool {
+		return gameChallenges[i].Challenge.Name < gameChallenges[j].Challenge.Name
+	})
+
+	rows := scoreboardExportRows(rankings, gameChallenges)
+
+	var data []byte
+	var contentType string
+	if format == scoreboardExportCSV {
+		data, err = writeScoreboardCSV(rows)
+		contentType = "text/csv; charset=utf-8"
+	} else {
+		var buf bytes.Buffer
+		err = xlsxtool.Write(&buf, game.Name, rows)
+		data = buf.Bytes()
+		contentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToExportScoreboard"}),
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.%s", fileName, format))
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, contentType, data)
+}
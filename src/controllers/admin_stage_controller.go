@@ -0,0 +1,288 @@
+package controllers
+
+import (
+	"a1ctf/src/db/models"
+	"a1ctf/src/tasks"
+	dbtool "a1ctf/src/utils/db_tool"
+	i18ntool "a1ctf/src/utils/i18n_tool"
+	"a1ctf/src/utils/ristretto_tool"
+	"a1ctf/src/utils/zaphelper"
+	"a1ctf/src/webmodels"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"go.uber.org/zap"
+	"gorm.io/gorm/clause"
+)
+
+// 阶段的得分倍率和晋级数量不能是负数，阶段名不能重复
+func validStageSettings(stages *models.GameStages) bool {
+	if stages == nil {
+		return true
+	}
+
+	names := make(map[string]bool, len(*stages))
+	for _, stage := range *stages {
+		if stage.ScoreMultiplier < 0 || stage.PromoteTopN < 0 || names[stage.StageName] {
+			return false
+		}
+		names[stage.StageName] = true
+	}
+
+	return true
+}
+
+// AdminGetStageTeams 获取每个阶段的设置和晋级名单，没有晋级名单的阶段所有队伍都能参加
+func AdminGetStageTeams(c *gin.Context) {
+	game := c.MustGet("game").(models.Game)
+
+	var stageTeams []models.GameStageTeam
+	if err := dbtool.DB().Preload("Team").Where("game_id = ?", game.GameID).Order("stage_name ASC, from_rank ASC, team_id ASC").Find(&stageTeams).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadStageTeams"}),
+		})
+		return
+	}
+
+	stageTeamMap := make(map[string][]gin.H)
+	for _, stageTeam := range stageTeams {
+		teamName := ""
+		if stageTeam.Team != nil {
+			teamName = stageTeam.Team.TeamName
+		}
+
+		stageTeamMap[stageTeam.StageName] = append(stageTeamMap[stageTeam.StageName], gin.H{
+			"team_id":     stageTeam.TeamID,
+			"team_name":   teamName,
+			"from_stage":  stageTeam.FromStage,
+			"from_rank":   stageTeam.FromRank,
+			"promoted_by": stageTeam.PromotedBy,
+			"created_at":  stageTeam.CreatedAt,
+		})
+	}
+
+	result := make([]gin.H, 0)
+	if game.Stages != nil {
+		for _, stage := range *game.Stages {
+			teams, restricted := stageTeamMap[stage.StageName]
+			if !restricted {
+				teams = make([]gin.H, 0)
+			}
+
+			result = append(result, gin.H{
+				"stage_name":       stage.StageName,
+				"start_time":       stage.StartTime,
+				"end_time":         stage.EndTime,
+				"score_multiplier": stage.Multiplier(),
+				"promote_top_n":    stage.PromoteTopN,
+				"restricted":       restricted,
+				"teams":            teams,
+			})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": result,
+	})
+}
+
+// AdminPromoteStageTeams 把一个阶段排行榜的前 N 名晋级到另一个阶段，
+// 晋级之后目标阶段只有晋级名单里的队伍能参加和参与排名
+func AdminPromoteStageTeams(c *gin.Context) {
+	game := c.MustGet("game").(models.Game)
+	payload := *c.MustGet("payload").(*webmodels.AdminPromoteStageTeamsPayload)
+
+	fromStage := game.FindStage(payload.FromStage)
+	toStage := game.FindStage(payload.ToStage)
+	if fromStage == nil || toStage == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    404,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "StageNotFound"}),
+		})
+		return
+	}
+
+	topN := fromStage.PromoteTopN
+	if payload.TopN != nil {
+		topN = *payload.TopN
+	}
+
+	if payload.FromStage == payload.ToStage || topN <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidStagePromotion"}),
+		})
+		return
+	}
+
+	if payload.GroupID != nil {
+		groups, err := ristretto_tool.CachedGameGroups(game.GameID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadGameGroups"}),
+			})
+			return
+		}
+
+		if _, ok := groups[*payload.GroupID]; !ok {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    404,
+				"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "GroupNotFound"}),
+			})
+			return
+		}
+	}
+
+	// 直接计算实时的阶段排行榜，不受封榜和缓存影响
+	scoreBoard, err := ristretto_tool.CalculateStageGameScoreBoard(game.GameID, payload.FromStage, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadGameScoreboard"}),
+		})
+		return
+	}
+
+	rankings := filterScoreboardByGroup(scoreBoard.TeamRankings, payload.GroupID)
+	if int64(len(rankings)) > topN {
+		rankings = rankings[:topN]
+	}
+
+	users, _ := c.Get("UserID")
+	userClaims := users.(*models.JWTUser)
+
+	now := time.Now().UTC()
+	stageTeams := make([]models.GameStageTeam, 0, len(rankings))
+	for _, team := range rankings {
+		rank := team.Rank
+		stageTeams = append(stageTeams, models.GameStageTeam{
+			GameID:     game.GameID,
+			StageName:  payload.ToStage,
+			TeamID:     team.TeamID,
+			FromStage:  &payload.FromStage,
+			FromRank:   &rank,
+			PromotedBy: &userClaims.UserID,
+			CreatedAt:  now,
+		})
+	}
+
+	tx := dbtool.DB().Begin()
+
+	if payload.Replace {
+		if err := tx.Where("game_id = ? AND stage_name = ?", game.GameID, payload.ToStage).Delete(&models.GameStageTeam{}).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToPromoteStageTeams"}),
+			})
+			return
+		}
+	}
+
+	// 已经在晋级名单里的队伍保持原来的记录
+	if len(stageTeams) > 0 {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&stageTeams).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToPromoteStageTeams"}),
+			})
+			return
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToCommitTransaction"}),
+		})
+		return
+	}
+
+	promoted := make([]gin.H, 0, len(rankings))
+	teamIDs := make([]int64, 0, len(rankings))
+	for _, team := range rankings {
+		promoted = append(promoted, gin.H{
+			"team_id":   team.TeamID,
+			"team_name": team.TeamName,
+			"rank":      team.Rank,
+			"score":     team.Score,
+		})
+		teamIDs = append(teamIDs, team.TeamID)
+	}
+
+	gameIDStr := strconv.FormatInt(game.GameID, 10)
+	tasks.LogAdminOperation(c, models.ActionUpdate, models.ResourceTypeGame, &gameIDStr, map[string]interface{}{
+		"operation":  "promote_stage_teams",
+		"from_stage": payload.FromStage,
+		"to_stage":   payload.ToStage,
+		"top_n":      topN,
+		"group_id":   payload.GroupID,
+		"replace":    payload.Replace,
+		"team_ids":   teamIDs,
+	})
+
+	ristretto_tool.MarkGameScoreBoardRebuild(game.GameID)
+	if err := ristretto_tool.MakeGameScoreBoardCache(game.GameID); err != nil {
+		zaphelper.Logger.Error("Failed to make game scoreboard cache", zap.Error(err), zap.Int64("game_id", game.GameID))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": promoted,
+	})
+}
+
+// AdminDeleteStageTeams 把队伍移出阶段的晋级名单，不指定队伍的时候清空名单，所有队伍都能参加这个阶段
+func AdminDeleteStageTeams(c *gin.Context) {
+	game := c.MustGet("game").(models.Game)
+	payload := *c.MustGet("payload").(*webmodels.AdminDeleteStageTeamsPayload)
+
+	if game.FindStage(payload.StageName) == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    404,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "StageNotFound"}),
+		})
+		return
+	}
+
+	query := dbtool.DB().Where("game_id = ? AND stage_name = ?", game.GameID, payload.StageName)
+	if len(payload.TeamIDs) > 0 {
+		query = query.Where("team_id IN ?", payload.TeamIDs)
+	}
+
+	result := query.Delete(&models.GameStageTeam{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToDeleteStageTeams"}),
+		})
+		return
+	}
+
+	gameIDStr := strconv.FormatInt(game.GameID, 10)
+	tasks.LogAdminOperation(c, models.ActionDelete, models.ResourceTypeGame, &gameIDStr, map[string]interface{}{
+		"operation":     "delete_stage_teams",
+		"stage_name":    payload.StageName,
+		"team_ids":      payload.TeamIDs,
+		"deleted_count": result.RowsAffected,
+	})
+
+	ristretto_tool.MarkGameScoreBoardRebuild(game.GameID)
+	if err := ristretto_tool.MakeGameScoreBoardCache(game.GameID); err != nil {
+		zaphelper.Logger.Error("Failed to make game scoreboard cache", zap.Error(err), zap.Int64("game_id", game.GameID))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"deleted_count": result.RowsAffected,
+		},
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"a1ctf/src/tasks"
 	dbtool "a1ctf/src/utils/db_tool"
 	i18ntool "a1ctf/src/utils/i18n_tool"
+	"a1ctf/src/utils/ristretto_tool"
 	"a1ctf/src/webmodels"
 	"fmt"
 	"net/http"
@@ -177,6 +178,8 @@ func AdminApproveTeam(c *gin.Context) {
 	}
 
 	// 记录批准队伍成功日志
+	ristretto_tool.MarkGameScoreBoardRebuild(team.GameID)
+
 	tasks.LogAdminOperation(c, models.ActionApprove, models.ResourceTypeTeam, &team.TeamName, map[string]interface{}{
 		"team_id":    team.TeamID,
 		"team_name":  team.TeamName,
@@ -247,6 +250,8 @@ func AdminBanTeam(c *gin.Context) {
 	}
 
 	// 记录禁赛队伍成功日志
+	ristretto_tool.MarkGameScoreBoardRebuild(team.GameID)
+
 	tasks.LogAdminOperation(c, models.ActionBan, models.ResourceTypeTeam, &team.TeamName, map[string]interface{}{
 		"team_id":    team.TeamID,
 		"team_name":  team.TeamName,
@@ -317,6 +322,8 @@ func AdminUnbanTeam(c *gin.Context) {
 	}
 
 	// 记录解禁队伍成功日志
+	ristretto_tool.MarkGameScoreBoardRebuild(team.GameID)
+
 	tasks.LogAdminOperation(c, models.ActionUnban, models.ResourceTypeTeam, &team.TeamName, map[string]interface{}{
 		"team_id":    team.TeamID,
 		"team_name":  team.TeamName,
@@ -415,6 +422,8 @@ func AdminDeleteTeam(c *gin.Context) {
 	}
 
 	// 记录删除队伍成功日志
+	ristretto_tool.MarkGameScoreBoardRebuild(team.GameID)
+
 	tasks.LogAdminOperation(c, models.ActionDelete, models.ResourceTypeTeam, &team.TeamName, map[string]interface{}{
 		"team_id":      team.TeamID,
 		"team_name":    team.TeamName,
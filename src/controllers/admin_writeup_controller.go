@@ -0,0 +1,334 @@
+package controllers
+
+import (
+	"a1ctf/src/db/models"
+	"a1ctf/src/tasks"
+	dbtool "a1ctf/src/utils/db_tool"
+	i18ntool "a1ctf/src/utils/i18n_tool"
+	"a1ctf/src/utils/ristretto_tool"
+	securitytool "a1ctf/src/utils/security_tool"
+	"a1ctf/src/webmodels"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"gorm.io/gorm"
+)
+
+// 加载比赛中所有队伍的 Writeup，key 是 team_id
+func loadGameWriteups(gameID int64) (map[int64]models.Writeup, error) {
+	var writeups []models.Writeup
+	if err := dbtool.DB().Preload("Upload").Preload("Submiter").Where("game_id = ?", gameID).Find(&writeups).Error; err != nil {
+		return nil, err
+	}
+
+	writeupMap := make(map[int64]models.Writeup, len(writeups))
+	for _, writeup := range writeups {
+		writeupMap[writeup.TeamID] = writeup
+	}
+
+	return writeupMap, nil
+}
+
+// 开启了 wp_exclude_unsubmitted 的比赛，导出排行榜时去掉没有提交 Writeup 的队伍并重新计算排名
+func filterScoreboardByWriteup(game models.Game, rankings []webmodels.TeamScoreItem) ([]webmodels.TeamScoreItem, error) {
+	if !game.RequireWp || !game.WpExcludeUnsubmitted {
+		return rankings, nil
+	}
+
+	writeupMap, err := loadGameWriteups(game.GameID)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := make([]webmodels.TeamScoreItem, 0, len(rankings))
+	for _, team := range rankings {
+		if _, ok := writeupMap[team.TeamID]; ok {
+			team.Rank = int64(len(filtered) + 1)
+			filtered = append(filtered, team)
+		}
+	}
+
+	return filtered, nil
+}
+
+// AdminListWriteups 列出比赛中所有正式参赛队伍的 Writeup 提交情况
+func AdminListWriteups(c *gin.Context) {
+	game := c.MustGet("game").(models.Game)
+	payload := *c.MustGet("payload").(*webmodels.AdminListWriteupsPayload)
+
+	query := dbtool.DB().Where("game_id = ? AND team_status = ? AND team_type = ?", game.GameID, models.ParticipateApproved, models.TeamTypePlayer)
+	if strings.TrimSpace(payload.TeamName) != "" {
+		query = query.Where("team_name ILIKE ?", "%"+strings.TrimSpace(payload.TeamName)+"%")
+	}
+
+	var teams []models.Team
+	if err := query.Order("team_id ASC").Find(&teams).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadTeams"}),
+		})
+		return
+	}
+
+	writeupMap, err := loadGameWriteups(game.GameID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadWriteup"}),
+		})
+		return
+	}
+
+	submittedCount := 0
+	items := make([]webmodels.AdminWriteupItem, 0, len(teams))
+	for _, team := range teams {
+		writeup, submitted := writeupMap[team.TeamID]
+		if submitted {
+			submittedCount++
+		}
+
+		if payload.Submission == "submitted" && !submitted {
+			continue
+		}
+		if payload.Submission == "unsubmitted" && submitted {
+			continue
+		}
+		if payload.ReviewStatus != nil && (!submitted || string(writeup.ReviewStatus) != *payload.ReviewStatus) {
+			continue
+		}
+
+		item := webmodels.AdminWriteupItem{
+			TeamID:    team.TeamID,
+			TeamName:  team.TeamName,
+			GroupName: team.GroupName,
+			Submitted: submitted,
+		}
+
+		if submitted {
+			downloadURL := fmt.Sprintf("/api/admin/game/%d/writeups/%d/download", game.GameID, team.TeamID)
+
+			item.WriteupID = &writeup.WriteupID
+			item.SubmitTime = &writeup.SubmitTime
+			item.ReviewStatus = &writeup.ReviewStatus
+			item.ReviewComment = writeup.ReviewComment
+			item.ReviewTime = writeup.ReviewTime
+			item.DownloadURL = &downloadURL
+
+			if writeup.Upload != nil {
+				item.FileName = &writeup.Upload.FileName
+				item.FileSize = &writeup.Upload.FileSize
+				item.FileType = &writeup.Upload.FileType
+			}
+			if writeup.Submiter != nil {
+				item.SubmiterName = &writeup.Submiter.Username
+			}
+		}
+
+		items = append(items, item)
+	}
+
+	total := len(items)
+
+	// 分页
+	start := payload.Offset
+	if start > total {
+		start = total
+	}
+	end := total
+	if payload.Size > 0 && start+payload.Size < total {
+		end = start + payload.Size
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":  200,
+		"data":  items[start:end],
+		"total": total,
+		"summary": gin.H{
+			"team_count":      len(teams),
+			"submitted_count": submittedCount,
+			"require_wp":      game.RequireWp,
+			"wp_expire_time":  game.WpExpireTime,
+		},
+	})
+}
+
+// 根据路径里的 team_id 查找 Writeup，同时检查队伍是否属于当前比赛
+func findTeamWriteup(c *gin.Context) (*models.Writeup, bool) {
+	gameID := c.MustGet("game_id").(int64)
+	team := c.MustGet("team").(models.Team)
+
+	if team.GameID != gameID {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    404,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "TeamNotFound"}),
+		})
+		return nil, false
+	}
+
+	var writeup models.Writeup
+	if err := dbtool.DB().Preload("Upload").Where("game_id = ? AND team_id = ?", gameID, team.TeamID).First(&writeup).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    404,
+				"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "WriteupNotFound"}),
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadWriteup"}),
+			})
+		}
+		return nil, false
+	}
+
+	return &writeup, true
+}
+
+func AdminDownloadWriteup(c *gin.Context) {
+	writeup, ok := findTeamWriteup(c)
+	if !ok {
+		return
+	}
+
+	if writeup.Upload == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    404,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FileNotFound"}),
+		})
+		return
+	}
+
+	uploadDirectionAbs, _ := filepath.Abs(writeupUploadDir)
+
+	validator := securitytool.NewSecurePathValidator()
+	filePath, err := validator.ValidatePathSafety(uploadDirectionAbs, writeup.Upload.FilePath)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{
+			"code":    403,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FileAccessDenied"}),
+		})
+		return
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    404,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FileNotFoundOnServer"}),
+		})
+		return
+	}
+	defer file.Close()
+
+	fileState, err := file.Stat()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "ErrorOpeningFile"}),
+		})
+		return
+	}
+
+	writeupIDStr := fmt.Sprintf("%d", writeup.WriteupID)
+	tasks.LogAdminOperation(c, models.ActionDownload, models.ResourceTypeWriteup, &writeupIDStr, map[string]interface{}{
+		"game_id": writeup.GameID,
+		"team_id": writeup.TeamID,
+		"file_id": writeup.FileID,
+	})
+
+	c.DataFromReader(
+		http.StatusOK,
+		fileState.Size(),
+		writeup.Upload.FileType,
+		file,
+		map[string]string{
+			"Content-Disposition": fmt.Sprintf("attachment; filename=%s", writeup.Upload.FileName),
+			"Cache-Control":       "no-store",
+		},
+	)
+}
+
+func AdminReviewWriteup(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+	payload := *c.MustGet("payload").(*webmodels.AdminReviewWriteupPayload)
+
+	writeup, ok := findTeamWriteup(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now().UTC()
+	writeupIDStr := fmt.Sprintf("%d", writeup.WriteupID)
+
+	if err := dbtool.DB().Model(&models.Writeup{}).Where("writeup_id = ?", writeup.WriteupID).Updates(map[string]interface{}{
+		"review_status":  payload.ReviewStatus,
+		"review_comment": payload.ReviewComment,
+		"reviewer_id":    user.UserID,
+		"review_time":    now,
+	}).Error; err != nil {
+		tasks.LogAdminOperationWithError(c, models.ActionUpdate, models.ResourceTypeWriteup, &writeupIDStr, map[string]interface{}{
+			"game_id":       writeup.GameID,
+			"team_id":       writeup.TeamID,
+			"review_status": payload.ReviewStatus,
+		}, err)
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToReviewWriteup"}),
+		})
+		return
+	}
+
+	tasks.LogAdminOperation(c, models.ActionUpdate, models.ResourceTypeWriteup, &writeupIDStr, map[string]interface{}{
+		"game_id":        writeup.GameID,
+		"team_id":        writeup.TeamID,
+		"review_status":  payload.ReviewStatus,
+		"review_comment": payload.ReviewComment,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+	})
+}
+
+// AdminExportScoreboard 导出最终排行榜，开启了相应选项时会排除没有提交 Writeup 的队伍
+func AdminExportScoreboard(c *gin.Context) {
+	game := c.MustGet("game").(models.Game)
+
+	scoreBoard, err := ristretto_tool.CachedGameScoreBoard(game.GameID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadGameScoreboard"}),
+		})
+		return
+	}
+
+	rankings, err := filterScoreboardByWriteup(game, scoreBoard.TeamRankings)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadWriteup"}),
+		})
+		return
+	}
+
+	gameIDStr := fmt.Sprintf("%d", game.GameID)
+	tasks.LogAdminOperation(c, models.ActionView, models.ResourceTypeGame, &gameIDStr, map[string]interface{}{
+		"export":                 "scoreboard",
+		"team_count":             len(rankings),
+		"wp_exclude_unsubmitted": game.RequireWp && game.WpExcludeUnsubmitted,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": rankings,
+	})
+}
@@ -145,7 +145,8 @@ func DownloadFile(c *gin.Context) {
 	}
 
 	uploadRecord, ok := filesMap[fileID.String()]
-	if !ok {
+	// Writeup 只能由管理员通过单独的接口下载，动态附件只能由对应队伍下载
+	if !ok || isWriteupFile(uploadRecord.FilePath) || isDynamicAttachmentFile(uploadRecord.FilePath) {
 		c.JSON(http.StatusNotFound, gin.H{
 			"code":    404,
 			"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FileNotFound"}),
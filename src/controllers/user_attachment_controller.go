@@ -0,0 +1,366 @@
+package controllers
+
+import (
+	"a1ctf/src/db/models"
+	"a1ctf/src/tasks"
+	dbtool "a1ctf/src/utils/db_tool"
+	i18ntool "a1ctf/src/utils/i18n_tool"
+	judgetool "a1ctf/src/utils/judge_tool"
+	"a1ctf/src/utils/ristretto_tool"
+	securitytool "a1ctf/src/utils/security_tool"
+	"a1ctf/src/utils/zaphelper"
+	"a1ctf/src/webmodels"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+	"gorm.io/gorm"
+)
+
+// 动态附件生成后存放的目录，只能通过队伍自己的下载地址访问
+var dynamicAttachmentDir = filepath.Join("data", "uploads", "dynamic")
+
+// 同一个队伍同一个附件同时只生成一次
+var dynamicAttachmentGroup singleflight.Group
+
+var errTeamFlagNotReady = errors.New("team flag is not ready")
+
+func isDynamicAttachmentFile(filePath string) bool {
+	return strings.HasPrefix(filepath.Clean(filePath), dynamicAttachmentDir+string(filepath.Separator))
+}
+
+// 队伍下载附件的地址，经过这个接口的下载会被记录下来
+func attachmentDownloadURL(gameID int64, challengeID int64, attachIndex int) string {
+	return fmt.Sprintf("/api/game/%d/challenge/%d/attachment/%d", gameID, challengeID, attachIndex)
+}
+
+// 静态附件和动态附件不返回文件 ID，改为返回队伍自己的下载地址
+func buildUserAttachments(gameID int64, challengeID int64, attachments []webmodels.UserAttachmentConfig) []webmodels.UserAttachmentConfig {
+	result := make([]webmodels.UserAttachmentConfig, 0, len(attachments))
+	for index, attachment := range attachments {
+		if attachment.AttachType == models.AttachmentTypeStaticFile || attachment.AttachType == models.AttachmentTypeDynamicFile {
+			downloadURL := attachmentDownloadURL(gameID, challengeID, index)
+			attachment.AttachURL = &downloadURL
+			attachment.AttachHash = nil
+			attachment.DownloadHash = nil
+		}
+		result = append(result, attachment)
+	}
+	return result
+}
+
+// 获取队伍当前题目的 flag，动态 flag 还没有生成时会加入生成队列
+func loadTeamFlagForAttachment(game models.Game, team models.Team, gameChallenge models.GameChallenge) (string, error) {
+	if gameChallenge.Challenge.FlagType != models.FlagTypeDynamic {
+		if gameChallenge.JudgeConfig == nil || gameChallenge.JudgeConfig.FlagTemplate == nil {
+			return "", nil
+		}
+		return *gameChallenge.JudgeConfig.FlagTemplate, nil
+	}
+
+	allFlags, err := ristretto_tool.CachedAllTeamFlags(game.GameID, gameChallenge.ChallengeID)
+	if err != nil {
+		return "", err
+	}
+
+	teamFlag, exists := allFlags[team.TeamID]
+	if !exists {
+		_ = tasks.NewTeamFlagCreateTask(*gameChallenge.JudgeConfig.FlagTemplate, team.TeamID, game.GameID, gameChallenge.ChallengeID, team.TeamHash, team.TeamName, gameChallenge.Challenge.FlagType)
+		return "", errTeamFlagNotReady
+	}
+
+	return teamFlag.FlagContent, nil
+}
+
+// 模板、生成脚本和 flag 任意一个变化都需要重新生成附件
+func dynamicAttachmentSourceHash(templateFileID string, script string, flag string) string {
+	hash := sha256.Sum256([]byte(templateFileID + "\x00" + script + "\x00" + flag))
+	return hex.EncodeToString(hash[:])
+}
+
+// 查找已经生成的附件，不存在或者过期时调用生成脚本重新生成
+func ensureTeamAttachment(user models.User, game models.Game, team models.Team, challengeID int64, attachIndex int, attachment models.AttachmentConfig, flag string) (*models.Upload, error) {
+	sourceHash := dynamicAttachmentSourceHash(*attachment.AttachHash, *attachment.GenerateScript, flag)
+
+	var existing models.TeamAttachment
+	err := dbtool.DB().Preload("Upload").Where("game_id = ? AND challenge_id = ? AND team_id = ? AND attach_index = ?", game.GameID, challengeID, team.TeamID, attachIndex).First(&existing).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	hasExisting := err == nil
+	if hasExisting && existing.SourceHash == sourceHash && existing.Upload != nil {
+		if _, err := os.Stat(existing.Upload.FilePath); err == nil {
+			return existing.Upload, nil
+		}
+	}
+
+	// 加载模板文件
+	var template models.Upload
+	if err := dbtool.DB().Where("file_id = ?", *attachment.AttachHash).First(&template).Error; err != nil {
+		return nil, fmt.Errorf("failed to load attachment template: %w", err)
+	}
+
+	uploadDirectionAbs, _ := filepath.Abs("./data/uploads")
+	validator := securitytool.NewSecurePathValidator()
+	templatePath, err := validator.ValidatePathSafety(uploadDirectionAbs, template.FilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	storePath := filepath.Join(dynamicAttachmentDir, fmt.Sprintf("%d", game.GameID))
+	if err := os.MkdirAll(storePath, 0755); err != nil {
+		return nil, err
+	}
+
+	fileID := uuid.NewString()
+	savedPath := filepath.Join(storePath, fileID)
+
+	result, err := judgetool.RunAttachmentGenerator(context.Background(), *attachment.GenerateScript, templatePath, savedPath, judgetool.AttachmentGenerateInput{
+		TeamFlag:    flag,
+		TeamHash:    team.TeamHash,
+		TeamID:      team.TeamID,
+		GameID:      game.GameID,
+		ChallengeID: challengeID,
+	})
+	if err != nil {
+		if result != nil && result.Output != "" {
+			return nil, fmt.Errorf("%w: %s", err, result.Output)
+		}
+		return nil, err
+	}
+
+	upload := models.Upload{
+		FileID:     fileID,
+		UserID:     user.UserID,
+		FileName:   attachment.AttachName,
+		FilePath:   savedPath,
+		FileHash:   result.FileHash,
+		FileType:   "application/octet-stream",
+		FileSize:   result.FileSize,
+		UploadTime: time.Now().UTC(),
+	}
+
+	err = dbtool.DB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&upload).Error; err != nil {
+			return err
+		}
+
+		if !hasExisting {
+			return tx.Create(&models.TeamAttachment{
+				GameID:      game.GameID,
+				ChallengeID: challengeID,
+				TeamID:      team.TeamID,
+				AttachIndex: attachIndex,
+				FileID:      fileID,
+				SourceHash:  sourceHash,
+				CreateTime:  upload.UploadTime,
+			}).Error
+		}
+
+		if err := tx.Model(&models.TeamAttachment{}).Where("attachment_id = ?", existing.AttachmentID).Updates(map[string]interface{}{
+			"file_id":     fileID,
+			"source_hash": sourceHash,
+			"create_time": upload.UploadTime,
+		}).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(&models.Upload{}, "file_id = ?", existing.FileID).Error
+	})
+
+	if err != nil {
+		_ = os.Remove(savedPath)
+		return nil, err
+	}
+
+	// 数据库提交成功之后再删除旧文件
+	if hasExisting && existing.Upload != nil {
+		_ = os.Remove(existing.Upload.FilePath)
+	}
+
+	return &upload, nil
+}
+
+// 加载静态附件对应的上传文件，并检查路径是否在上传目录里
+func loadStaticAttachment(attachment models.AttachmentConfig) (*models.Upload, error) {
+	var upload models.Upload
+	if err := dbtool.DB().Where("file_id = ?", *attachment.AttachHash).First(&upload).Error; err != nil {
+		return nil, err
+	}
+
+	uploadDirectionAbs, _ := filepath.Abs("./data/uploads")
+	validator := securitytool.NewSecurePathValidator()
+	filePath, err := validator.ValidatePathSafety(uploadDirectionAbs, upload.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	upload.FilePath = filePath
+
+	return &upload, nil
+}
+
+// UserDownloadAttachment 下载题目附件并记录下载的队伍和用户，动态附件第一次下载时生成
+func UserDownloadAttachment(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+	game := c.MustGet("game").(models.Game)
+	team := c.MustGet("team").(models.Team)
+	gameChallenge := c.MustGet("game_challenge").(models.GameChallenge)
+
+	attachIndex, err := strconv.Atoi(c.Param("attach_index"))
+	if err != nil || attachIndex < 0 || attachIndex >= len(gameChallenge.Challenge.Attachments) {
+		c.JSON(http.StatusNotFound, webmodels.ErrorMessage{
+			Code:    404,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "AttachmentNotFound"}),
+		})
+		return
+	}
+
+	attachment := gameChallenge.Challenge.Attachments[attachIndex]
+	if attachment.AttachHash == nil {
+		c.JSON(http.StatusNotFound, webmodels.ErrorMessage{
+			Code:    404,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "AttachmentNotFound"}),
+		})
+		return
+	}
+
+	var upload *models.Upload
+
+	switch attachment.AttachType {
+	case models.AttachmentTypeStaticFile:
+		upload, err = loadStaticAttachment(attachment)
+		if err != nil {
+			c.JSON(http.StatusNotFound, webmodels.ErrorMessage{
+				Code:    404,
+				Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FileNotFound"}),
+			})
+			return
+		}
+	case models.AttachmentTypeDynamicFile:
+		var ok bool
+		upload, ok = generateTeamAttachment(c, user, game, team, gameChallenge, attachIndex, attachment)
+		if !ok {
+			return
+		}
+	default:
+		c.JSON(http.StatusNotFound, webmodels.ErrorMessage{
+			Code:    404,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "AttachmentNotFound"}),
+		})
+		return
+	}
+
+	file, err := os.Open(upload.FilePath)
+	if err != nil {
+		c.JSON(http.StatusNotFound, webmodels.ErrorMessage{
+			Code:    404,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FileNotFoundOnServer"}),
+		})
+		return
+	}
+	defer file.Close()
+
+	fileState, err := file.Stat()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+			Code:    500,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "ErrorOpeningFile"}),
+		})
+		return
+	}
+
+	// 管理员队伍的下载不参与作弊检测，不需要记录
+	if team.TeamType != models.TeamTypeAdmin {
+		clientIP := c.ClientIP()
+		if err := dbtool.DB().Create(&models.AttachmentDownload{
+			GameID:       game.GameID,
+			IngameID:     gameChallenge.IngameID,
+			ChallengeID:  gameChallenge.ChallengeID,
+			TeamID:       team.TeamID,
+			UserID:       user.UserID,
+			AttachIndex:  attachIndex,
+			AttachName:   attachment.AttachName,
+			FileID:       upload.FileID,
+			DownloadIP:   &clientIP,
+			DownloadTime: time.Now().UTC(),
+		}).Error; err != nil {
+			zaphelper.Logger.Error("Failed to record attachment download", zap.Error(err), zap.Int64("game_id", game.GameID), zap.Int64("team_id", team.TeamID), zap.Int64("challenge_id", gameChallenge.ChallengeID))
+		}
+	}
+
+	c.DataFromReader(
+		http.StatusOK,
+		fileState.Size(),
+		upload.FileType,
+		file,
+		map[string]string{
+			"Content-Disposition": fmt.Sprintf("attachment; filename=%s", upload.FileName),
+			"Cache-Control":       "no-store",
+		},
+	)
+}
+
+// 获取或者生成队伍的动态附件，失败时直接写入响应
+func generateTeamAttachment(c *gin.Context, user models.User, game models.Game, team models.Team, gameChallenge models.GameChallenge, attachIndex int, attachment models.AttachmentConfig) (*models.Upload, bool) {
+	if attachment.GenerateScript == nil {
+		c.JSON(http.StatusNotFound, webmodels.ErrorMessage{
+			Code:    404,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "AttachmentNotFound"}),
+		})
+		return nil, false
+	}
+
+	flag, err := loadTeamFlagForAttachment(game, team, gameChallenge)
+	if err != nil {
+		if errors.Is(err, errTeamFlagNotReady) {
+			c.JSON(http.StatusServiceUnavailable, webmodels.ErrorMessage{
+				Code:    503,
+				Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "AttachmentNotReady"}),
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+				Code:    500,
+				Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "SystemError"}),
+			})
+		}
+		return nil, false
+	}
+
+	challengeID := gameChallenge.ChallengeID
+	key := fmt.Sprintf("%d_%d_%d_%d", game.GameID, challengeID, team.TeamID, attachIndex)
+
+	obj, err, _ := dynamicAttachmentGroup.Do(key, func() (interface{}, error) {
+		return ensureTeamAttachment(user, game, team, challengeID, attachIndex, attachment, flag)
+	})
+	if err != nil {
+		challengeIDStr := fmt.Sprintf("%d", challengeID)
+		tasks.LogUserOperationWithError(c, models.ActionCreate, models.ResourceTypeFile, &challengeIDStr, map[string]interface{}{
+			"game_id":      game.GameID,
+			"team_id":      team.TeamID,
+			"attach_index": attachIndex,
+			"attach_name":  attachment.AttachName,
+		}, err)
+
+		c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+			Code:    500,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToGenerateAttachment"}),
+		})
+		return nil, false
+	}
+
+	return obj.(*models.Upload), true
+}
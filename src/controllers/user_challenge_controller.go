@@ -7,6 +7,7 @@ import (
 	i18ntool "a1ctf/src/utils/i18n_tool"
 	"a1ctf/src/utils/ristretto_tool"
 	"a1ctf/src/webmodels"
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
@@ -14,6 +15,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"gorm.io/gorm"
 )
 
 func UserGetGameChallenges(c *gin.Context) {
@@ -36,6 +38,42 @@ func UserGetGameChallenges(c *gin.Context) {
 			return
 		}
 
+		// 封榜期间题目的分数和解题人数停在封榜时
+		if game.ScoreBoardFrozen(time.Now().UTC()) {
+			scoreBoard, err := ristretto_tool.CachedFrozenGameScoreBoard(game.GameID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+					Code:    500,
+					Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadGameScoreboard"}),
+				})
+				return
+			}
+			simpleGameChallenges = ristretto_tool.FrozenGameSimpleChallenges(scoreBoard, simpleGameChallenges)
+		}
+
+		// 没有晋级的阶段的题目不返回
+		stageTeams, err := ristretto_tool.CachedGameStageTeams(game.GameID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+				Code:    500,
+				Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadStageTeams"}),
+			})
+			return
+		}
+
+		if len(stageTeams) > 0 {
+			qualifiedChallenges := make([]webmodels.UserSimpleGameChallenge, 0, len(simpleGameChallenges))
+			for _, challenge := range simpleGameChallenges {
+				if challenge.BelongStage != nil {
+					if teams, restricted := stageTeams[*challenge.BelongStage]; restricted && !teams[team.TeamID] {
+						continue
+					}
+				}
+				qualifiedChallenges = append(qualifiedChallenges, challenge)
+			}
+			simpleGameChallenges = qualifiedChallenges
+		}
+
 		// Cache all solves to redis
 
 		solveMap, err := ristretto_tool.CachedSolvedChallengesForGame(game.GameID)
@@ -115,39 +153,90 @@ func UserGetGameChallenge(c *gin.Context) {
 		return
 	}
 
+	// 查询队伍已经解锁的付费提示
+	var unlockedHintIDs []string
+	if err := dbtool.DB().Model(&models.HintUnlock{}).Where("team_id = ? AND ingame_id = ?", team.TeamID, gameChallenge.IngameID).Pluck("hint_id", &unlockedHintIDs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+			Code:    500,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadChallengeHints"}),
+		})
+		return
+	}
+
 	result := webmodels.UserDetailGameChallenge{
 		ChallengeID:         *gameChallenge.Challenge.ChallengeID,
 		ChallengeName:       gameChallenge.Challenge.Name,
 		Description:         gameChallenge.Challenge.Description,
 		TotalScore:          gameChallenge.TotalScore,
 		CurScore:            gameChallenge.CurScore,
-		Hints:               visibleHints,
+		Hints:               buildUserHints(visibleHints, unlockedHintIDs),
 		BelongStage:         gameChallenge.BelongStage,
 		SolveCount:          gameChallenge.SolveCount,
 		Category:            gameChallenge.Challenge.Category,
-		Attachments:         userAttachments,
+		Attachments:         buildUserAttachments(game.GameID, gameChallenge.ChallengeID, userAttachments),
 		ContainerType:       gameChallenge.Challenge.ContainerType,
 		ContainerStatus:     models.NoContainer,
 		ContainerExpireTime: nil,
 		Visible:             gameChallenge.Visible,
 	}
 
-	// 6. 容器状态处理 - 使用短时缓存（200ms）平衡性能和实时性
-	containers, err := ristretto_tool.CachedContainerStatus(game.GameID, *gameChallenge.Challenge.ChallengeID, team.TeamID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
-			Code:    500,
-			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadContainers"}),
-		})
-		return
+	if game.ScoreBoardFrozen(time.Now().UTC()) {
+		scoreBoard, err := ristretto_tool.CachedFrozenGameScoreBoard(game.GameID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+				Code:    500,
+				Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadGameScoreboard"}),
+			})
+			return
+		}
+		if stat, ok := scoreBoard.ChallengeStats[gameChallenge.ChallengeID]; ok {
+			result.CurScore = stat.CurScore
+			result.SolveCount = stat.SolveCount
+		}
 	}
 
-	if len(containers) > 1 {
-		c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
-			Code:    500,
-			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadContainers"}),
-		})
-		return
+	// 6. 容器状态处理 - 使用短时缓存（200ms）平衡性能和实时性
+	var exposeInfos models.ContainerExposeInfos
+
+	if gameChallenge.Challenge.ContainerType == models.STATIC_CONTAINER {
+		// 静态容器所有队伍共享同一个实例
+		containerStatus, staticExposeInfos, err := loadStaticContainerInfo(gameChallenge.IngameID, team.TeamID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+				Code:    500,
+				Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadContainers"}),
+			})
+			return
+		}
+
+		result.ContainerStatus = containerStatus
+		exposeInfos = staticExposeInfos
+	} else {
+		containers, err := ristretto_tool.CachedContainerStatus(game.GameID, *gameChallenge.Challenge.ChallengeID, team.TeamID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+				Code:    500,
+				Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadContainers"}),
+			})
+			return
+		}
+
+		if len(containers) > 1 {
+			c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+				Code:    500,
+				Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadContainers"}),
+			})
+			return
+		}
+
+		if len(containers) > 0 {
+			result.ContainerStatus = containers[0].ContainerStatus
+			result.ContainerExpireTime = &containers[0].ExpireTime
+			exposeInfos = containers[0].ContainerExposeInfos
+		} else {
+			result.ContainerStatus = models.NoContainer
+			result.ContainerExpireTime = nil
+		}
 	}
 
 	result.Containers = make([]webmodels.ExposePortInfo, 0, len(*gameChallenge.Challenge.ContainerConfig))
@@ -157,29 +246,142 @@ func UserGetGameChallenge(c *gin.Context) {
 			ContainerPorts: make(models.ExposePorts, 0),
 		}
 
-		if len(containers) == 1 {
-			for _, container_expose := range containers[0].ContainerExposeInfos {
-				if container_expose.ContainerName == container.Name {
-					tempConfig.ContainerPorts = container_expose.ExposePorts
-					break
-				}
+		for _, container_expose := range exposeInfos {
+			if container_expose.ContainerName == container.Name {
+				tempConfig.ContainerPorts = container_expose.ExposePorts
+				break
 			}
 		}
 
 		result.Containers = append(result.Containers, tempConfig)
 	}
 
-	if len(containers) > 0 {
-		result.ContainerStatus = containers[0].ContainerStatus
-		result.ContainerExpireTime = &containers[0].ExpireTime
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": result,
+	})
+}
+
+// 把可见提示转换成返回给队伍的格式，没有解锁的付费提示隐藏内容
+func buildUserHints(hints models.Hints, unlockedHintIDs []string) []webmodels.UserHintInfo {
+	unlocked := make(map[string]struct{}, len(unlockedHintIDs))
+	for _, hintID := range unlockedHintIDs {
+		unlocked[hintID] = struct{}{}
+	}
+
+	result := make([]webmodels.UserHintInfo, 0, len(hints))
+	for _, hint := range hints {
+		item := webmodels.UserHintInfo{
+			HintID:     hint.HintID,
+			Content:    hint.Content,
+			CreateTime: hint.CreateTime,
+			Visible:    hint.Visible,
+			Cost:       hint.Cost,
+			Locked:     false,
+		}
+
+		if hint.Cost > 0 {
+			if _, ok := unlocked[hint.HintID]; !ok {
+				item.Content = ""
+				item.Locked = true
+			}
+		}
+
+		result = append(result, item)
+	}
+
+	return result
+}
+
+// UserUnlockHint 队伍解锁付费提示，解锁后的扣分在计算分数时作为 hint 类型的分数修正
+func UserUnlockHint(c *gin.Context) {
+	game := c.MustGet("game").(models.Game)
+	team := c.MustGet("team").(models.Team)
+	user := c.MustGet("user").(models.User)
+	gameChallenge := c.MustGet("game_challenge").(models.GameChallenge)
+
+	hintID := c.Param("hint_id")
+
+	visibleHints, err := ristretto_tool.CachedChallengeVisibleHints(game.GameID, gameChallenge.ChallengeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+			Code:    500,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadChallengeHints"}),
+		})
+		return
+	}
+
+	var hint *models.Hint
+	for idx := range visibleHints {
+		if visibleHints[idx].HintID != "" && visibleHints[idx].HintID == hintID {
+			hint = &visibleHints[idx]
+			break
+		}
+	}
+
+	if hint == nil {
+		c.JSON(http.StatusNotFound, webmodels.ErrorMessage{
+			Code:    404,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "HintNotFound"}),
+		})
+		return
+	}
+
+	if hint.Cost <= 0 {
+		c.JSON(http.StatusBadRequest, webmodels.ErrorMessage{
+			Code:    400,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "HintIsFree"}),
+		})
+		return
+	}
+
+	unlock := models.HintUnlock{
+		GameID:      game.GameID,
+		IngameID:    gameChallenge.IngameID,
+		ChallengeID: gameChallenge.ChallengeID,
+		TeamID:      team.TeamID,
+		HintID:      hint.HintID,
+		Cost:        hint.Cost,
+		UnlockerID:  user.UserID,
+		UnlockTime:  time.Now().UTC(),
+	}
+
+	if err := dbtool.DB().Create(&unlock).Error; err != nil {
+		// 已经解锁过的提示不重复扣分，直接返回内容
+		if !errors.Is(err, gorm.ErrDuplicatedKey) {
+			tasks.LogUserOperationWithError(c, models.ActionUpdate, models.ResourceTypeChallenge, &hintID, map[string]interface{}{
+				"game_id":      game.GameID,
+				"challenge_id": gameChallenge.ChallengeID,
+				"team_id":      team.TeamID,
+				"cost":         hint.Cost,
+			}, err)
+
+			c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+				Code:    500,
+				Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToUnlockHint"}),
+			})
+			return
+		}
 	} else {
-		result.ContainerStatus = models.NoContainer
-		result.ContainerExpireTime = nil
+		tasks.LogUserOperation(c, models.ActionUpdate, models.ResourceTypeChallenge, &hintID, map[string]interface{}{
+			"action":       "unlock_hint",
+			"game_id":      game.GameID,
+			"challenge_id": gameChallenge.ChallengeID,
+			"team_id":      team.TeamID,
+			"cost":         hint.Cost,
+		})
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"code": 200,
-		"data": result,
+		"data": webmodels.UserHintInfo{
+			HintID:     hint.HintID,
+			Content:    hint.Content,
+			CreateTime: hint.CreateTime,
+			Visible:    hint.Visible,
+			Cost:       hint.Cost,
+			Locked:     false,
+		},
 	})
 }
 
@@ -263,6 +465,26 @@ func UserGameChallengeSubmitFlag(c *gin.Context) {
 		return
 	}
 
+	// 投递判题任务，同一个队伍同一道题的 judge 会按提交顺序处理
+	if err := tasks.NewJudgeFlagTask(newJudge); err != nil {
+		dbtool.DB().Model(&models.Judge{}).Where("judge_id = ?", newJudge.JudgeID).Update("judge_status", models.JudgeError)
+
+		tasks.LogUserOperationWithError(c, models.ActionSubmitFlag, models.ResourceTypeChallenge, &challengeIDStr, map[string]interface{}{
+			"game_id":      game.GameID,
+			"team_id":      team.TeamID,
+			"user_id":      user.UserID,
+			"ingame_id":    gameChallenge.IngameID,
+			"judge_id":     newJudge.JudgeID,
+			"flag_content": payload.FlagContent,
+		}, err)
+
+		c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+			Code:    500,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "SystemError"}),
+		})
+		return
+	}
+
 	if game.EndTime.After(time.Now().UTC()) {
 		// 比赛结束前启动一个检查作弊任务
 		tasks.NewFlagAntiCheatTask(newJudge)
@@ -279,17 +501,6 @@ func UserGameChallengeSubmitFlag(c *gin.Context) {
 		"flag_content":   payload.FlagContent, // 只记录前50个字符
 	})
 
-	// dbtool.DB().Model(&models.Judge{}).Preload("TeamFlag").Where("judge_id = ?", newJudge.JudgeID).First(&newJudge)
-
-	// err = tasks.NewJudgeFlagTask(newJudge)
-	// if err != nil {
-	// 	c.JSON(http.StatusBadRequest, webmodels.ErrorMessage{
-	// 		Code:    400,
-	// 		Message: "You have a judge in queue, please wait for a moment",
-	// 	})
-	// 	return
-	// }
-
 	c.JSON(http.StatusOK, gin.H{
 		"code": 200,
 		"data": gin.H{
@@ -5,7 +5,9 @@ import (
 	"a1ctf/src/tasks"
 	dbtool "a1ctf/src/utils/db_tool"
 	i18ntool "a1ctf/src/utils/i18n_tool"
+	proxytool "a1ctf/src/utils/proxy_tool"
 	redistool "a1ctf/src/utils/redis_tool"
+	"a1ctf/src/utils/ristretto_tool"
 	"a1ctf/src/webmodels"
 	"errors"
 	"fmt"
@@ -32,12 +34,46 @@ func getTimeLimitConfig() time.Duration {
 
 var timeLimit = getTimeLimitConfig()
 
+// 静态容器所有队伍共享同一个实例，只有实例启动中或者运行中才返回状态和暴露信息
+//
+// 开启平台代理的时候每个队伍拿到的是各自的 Token，方便按队伍统计流量
+func loadStaticContainerInfo(inGameID int64, teamID int64) (models.ContainerStatus, models.ContainerExposeInfos, error) {
+	staticContainer, err := ristretto_tool.CachedStaticContainer(inGameID)
+	if err != nil {
+		return models.NoContainer, nil, err
+	}
+
+	if staticContainer == nil {
+		return models.NoContainer, models.ContainerExposeInfos{}, nil
+	}
+
+	switch staticContainer.ContainerStatus {
+	case models.ContainerRunning:
+		if proxytool.Enabled() {
+			return models.ContainerRunning, proxytool.ApplyEndpoints(staticContainer.ContainerExposeInfos, proxytool.TargetStaticContainer, staticContainer.ContainerID, teamID), nil
+		}
+		return models.ContainerRunning, staticContainer.ContainerExposeInfos, nil
+	case models.ContainerQueueing, models.ContainerStarting:
+		return staticContainer.ContainerStatus, models.ContainerExposeInfos{}, nil
+	default:
+		return models.NoContainer, models.ContainerExposeInfos{}, nil
+	}
+}
+
 func UserCreateGameContainer(c *gin.Context) {
 	game := c.MustGet("game").(models.Game)
 	team := c.MustGet("team").(models.Team)
 	user := c.MustGet("user").(models.User)
 	gameChallenge := c.MustGet("game_challenge").(models.GameChallenge)
 
+	if gameChallenge.Challenge.ContainerType == models.STATIC_CONTAINER {
+		c.JSON(http.StatusBadRequest, webmodels.ErrorMessage{
+			Code:    400,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "StaticContainerIsShared"}),
+		})
+		return
+	}
+
 	var containers []models.Container
 	if err := dbtool.DB().Where("game_id = ? AND team_id = ? AND (container_status = ? or container_status = ? or container_status = ?)", game.GameID, team.TeamID, models.ContainerRunning, models.ContainerQueueing, models.ContainerStarting).Find(&containers).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
@@ -376,23 +412,26 @@ func UserExtendGameContainer(c *gin.Context) {
 	})
 }
 
-func UserGetGameChallengeContainerInfo(c *gin.Context) {
+// UserResetGameContainer 重置运行中的实例，删除 Pod 后使用队伍最新的 flag 重新创建，到期时间不变
+func UserResetGameContainer(c *gin.Context) {
 	game := c.MustGet("game").(models.Game)
 	team := c.MustGet("team").(models.Team)
+	user := c.MustGet("user").(models.User)
+	challengeID := c.MustGet("challenge_id").(int64)
 
-	challengeIDStr := c.Param("challenge_id")
-	challengeID, err := strconv.ParseInt(challengeIDStr, 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, webmodels.ErrorMessage{
-			Code:    400,
-			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidChallengeID"}),
+	operationName := fmt.Sprintf("%s:containerOperation", user.UserID)
+	locked := redistool.LockForATime(operationName, timeLimit)
+
+	if !locked {
+		c.JSON(http.StatusTooManyRequests, webmodels.ErrorMessage{
+			Code:    429,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "RequestTooFast", TemplateData: map[string]interface{}{"Time": timeLimit.Seconds()}}),
 		})
-		c.Abort()
 		return
 	}
 
 	var containers []models.Container
-	if err := dbtool.DB().Where("challenge_id = ? AND team_id = ? AND (container_status = ? OR container_status = ? OR container_status = ?)", challengeID, team.TeamID, models.ContainerRunning, models.ContainerQueueing, models.ContainerStarting).Find(&containers).Error; err != nil {
+	if err := dbtool.DB().Where("challenge_id = ? AND team_id = ? AND container_status = ?", challengeID, team.TeamID, models.ContainerRunning).Find(&containers).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
 			Code:    500,
 			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadContainers"}),
@@ -416,6 +455,77 @@ func UserGetGameChallengeContainerInfo(c *gin.Context) {
 		return
 	}
 
+	curContainer := containers[0]
+
+	// 锁住对一个容器ID的操作
+	operationNameForContainer := fmt.Sprintf("containerLock:%s", curContainer.ContainerID)
+	lockedForContainer := redistool.LockForATime(operationNameForContainer, timeLimit)
+
+	if !lockedForContainer {
+		c.JSON(http.StatusTooManyRequests, webmodels.ErrorMessage{
+			Code:    429,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "RequestTooFast", TemplateData: map[string]interface{}{"Time": timeLimit.Seconds()}}),
+		})
+		return
+	}
+
+	logDetails := map[string]interface{}{
+		"game_id":        game.GameID,
+		"team_id":        team.TeamID,
+		"user_id":        user.UserID,
+		"challenge_id":   challengeID,
+		"challenge_name": curContainer.ChallengeName,
+		"container_id":   curContainer.ContainerID,
+	}
+
+	// 重新排队，等定时任务在旧 Pod 删除之后重新创建
+	if err := dbtool.DB().Model(&curContainer).Updates(map[string]interface{}{
+		"container_status": models.ContainerQueueing,
+		"expose_ports":     models.ContainerExposeInfos{},
+		"start_time":       time.Now().UTC(),
+	}).Error; err != nil {
+		tasks.LogUserOperationWithError(c, models.ActionResetContainer, models.ResourceTypeContainer, &curContainer.ContainerID, logDetails, err)
+
+		c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+			Code:    501,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "SystemError"}),
+		})
+		return
+	}
+
+	if err := tasks.NewContainerResetTask(curContainer); err != nil {
+		tasks.LogUserOperationWithError(c, models.ActionResetContainer, models.ResourceTypeContainer, &curContainer.ContainerID, logDetails, err)
+
+		c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+			Code:    501,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "SystemError"}),
+		})
+		return
+	}
+
+	tasks.LogUserOperation(c, models.ActionResetContainer, models.ResourceTypeContainer, &curContainer.ContainerID, logDetails)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "OK",
+	})
+}
+
+func UserGetGameChallengeContainerInfo(c *gin.Context) {
+	game := c.MustGet("game").(models.Game)
+	team := c.MustGet("team").(models.Team)
+
+	challengeIDStr := c.Param("challenge_id")
+	challengeID, err := strconv.ParseInt(challengeIDStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, webmodels.ErrorMessage{
+			Code:    400,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidChallengeID"}),
+		})
+		c.Abort()
+		return
+	}
+
 	var gameChallenges []models.GameChallenge
 
 	// 使用 Preload 进行关联查询
@@ -440,6 +550,79 @@ func UserGetGameChallengeContainerInfo(c *gin.Context) {
 
 	gameChallenge := gameChallenges[0]
 
+	if gameChallenge.Challenge.ContainerType == models.STATIC_CONTAINER {
+		// 静态容器所有队伍共享同一个实例
+		if !gameChallenge.Visible {
+			c.JSON(http.StatusNotFound, webmodels.ErrorMessage{
+				Code:    404,
+				Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "ChallengeNotFound"}),
+			})
+			return
+		}
+
+		containerStatus, exposeInfos, err := loadStaticContainerInfo(gameChallenge.IngameID, team.TeamID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+				Code:    500,
+				Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadContainers"}),
+			})
+			return
+		}
+
+		result := gin.H{
+			"container_status":     containerStatus,
+			"containers":           make([]gin.H, 0, len(*gameChallenge.Challenge.ContainerConfig)),
+			"container_expiretime": nil,
+		}
+
+		for _, container := range *gameChallenge.Challenge.ContainerConfig {
+			tempConfig := gin.H{
+				"container_name":  container.Name,
+				"container_ports": make(models.ExposePorts, 0),
+			}
+
+			for _, container_expose := range exposeInfos {
+				if container_expose.ContainerName == container.Name {
+					tempConfig["container_ports"] = container_expose.ExposePorts
+					break
+				}
+			}
+
+			result["containers"] = append(result["containers"].([]gin.H), tempConfig)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code": 200,
+			"data": result,
+		})
+		return
+	}
+
+	var containers []models.Container
+	if err := dbtool.DB().Where("challenge_id = ? AND team_id = ? AND (container_status = ? OR container_status = ? OR container_status = ?)", challengeID, team.TeamID, models.ContainerRunning, models.ContainerQueueing, models.ContainerStarting).Find(&containers).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+			Code:    500,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadContainers"}),
+		})
+		return
+	}
+
+	if len(containers) == 0 {
+		c.JSON(http.StatusBadRequest, webmodels.ErrorMessage{
+			Code:    400,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "LaunchContainerFirst"}),
+		})
+		return
+	}
+
+	if len(containers) != 1 {
+		c.JSON(http.StatusBadRequest, webmodels.ErrorMessage{
+			Code:    400,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "SystemError"}),
+		})
+		return
+	}
+
 	result := gin.H{
 		"container_status":     containers[0].ContainerStatus,
 		"containers":           make([]gin.H, 0, len(*gameChallenge.Challenge.ContainerConfig)),
@@ -9,6 +9,7 @@ import (
 	"a1ctf/src/webmodels"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
@@ -104,6 +105,7 @@ func UserGetGameDetailWithTeamInfo(c *gin.Context) {
 		"wp_expire_time":         game.WpExpireTime,
 		"stages":                 game.Stages,
 		"visible":                game.Visible,
+		"freeze_time":            game.FreezeTime,
 		"team_status":            team_status,
 		"team_info":              nil,
 	}
@@ -162,7 +164,8 @@ func UserGetGameDetailWithTeamInfo(c *gin.Context) {
 		}
 
 		if curTeam.TeamStatus == models.ParticipateApproved {
-			cachedData, err := ristretto_tool.CachedGameScoreBoard(game.GameID)
+			role, _ := claims["Role"].(string)
+			cachedData, _, err := ristretto_tool.CachedVisibleGameScoreBoard(&game, isLiveScoreBoardRole(models.UserRole(role)))
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
 					Code:    500,
@@ -219,8 +222,15 @@ func UserGetGameNotices(c *gin.Context) {
 		return
 	}
 
+	// 封榜之后的三血公告会泄露解题情况，解除封榜之前不返回
+	frozen := game.ScoreBoardFrozen(time.Now().UTC())
+
 	result := make([]webmodels.GameNotice, 0, len(notices))
 	for _, notice := range notices {
+		if frozen && isBloodNotice(notice.NoticeCategory) && notice.CreateTime.After(*game.FreezeTime) {
+			continue
+		}
+
 		result = append(result, webmodels.GameNotice{
 			NoticeID:       notice.NoticeID,
 			NoticeCategory: notice.NoticeCategory,
@@ -240,9 +250,22 @@ func UserGameGetScoreBoard(c *gin.Context) {
 
 	// 解析查询参数
 	groupIDStr := c.Query("group_id")
+	stageName := c.Query("stage")
 	pageStr := c.DefaultQuery("page", "1")
 	sizeStr := c.DefaultQuery("size", "20")
 
+	var currentStage *string
+	if stageName != "" {
+		if game.FindStage(stageName) == nil {
+			c.JSON(http.StatusNotFound, webmodels.ErrorMessage{
+				Code:    404,
+				Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "StageNotFound"}),
+			})
+			return
+		}
+		currentStage = &stageName
+	}
+
 	var groupID *int64
 	if groupIDStr != "" {
 		if gid, err := strconv.ParseInt(groupIDStr, 10, 64); err == nil {
@@ -297,8 +320,9 @@ func UserGameGetScoreBoard(c *gin.Context) {
 		return
 	}
 
-	// 获取排行榜数据（用于获取 Top10 时间线和当前用户队伍信息）
-	scoreBoard, err := ristretto_tool.CachedGameScoreBoard(game.GameID)
+	// 获取排行榜数据（用于获取 Top10 时间线和当前用户队伍信息），封榜期间选手看到的是封榜时的排行榜
+	role, _ := claims["Role"].(string)
+	scoreBoard, frozen, err := ristretto_tool.CachedVisibleStageGameScoreBoard(&game, stageName, isLiveScoreBoardRole(models.UserRole(role)))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
 			Code:    500,
@@ -329,7 +353,7 @@ func UserGameGetScoreBoard(c *gin.Context) {
 	}
 
 	// 获取过滤后的排行榜数据（已缓存）
-	filteredData, err := ristretto_tool.CachedFilteredGameScoreBoard(game.GameID, groupID)
+	filteredData, err := ristretto_tool.CachedFilteredGameScoreBoard(game.GameID, stageName, groupID, frozen)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
 			Code:    500,
@@ -358,9 +382,29 @@ func UserGameGetScoreBoard(c *gin.Context) {
 		pagination.CurrentPage = totalPages
 	}
 
+	// 封榜期间自己队伍的解题使用实时数据
+	var liveTeamScoreItem *webmodels.TeamScoreItem
+	if frozen && logined {
+		liveScoreBoard, err := ristretto_tool.CachedStageGameScoreBoard(game.GameID, stageName, false)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+				Code:    500,
+				Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadGameScoreboard"}),
+			})
+			return
+		}
+
+		if item, ok := liveScoreBoard.FinalScoreBoardMap[curTeam.TeamID]; ok {
+			liveTeamScoreItem = &item
+		}
+	}
+
 	// 设置当前用户的队伍信息
 	if logined {
 		if myTeamScoreItem, ok := scoreBoard.FinalScoreBoardMap[curTeam.TeamID]; ok {
+			if liveTeamScoreItem != nil {
+				myTeamScoreItem = withOwnSolves(myTeamScoreItem, *liveTeamScoreItem, scoreBoard.ChallengeStats, game.FreezeTime)
+			}
 			curTeamScoreItem = &myTeamScoreItem
 		}
 	}
@@ -383,6 +427,17 @@ func UserGameGetScoreBoard(c *gin.Context) {
 				Scores:   make([]webmodels.TimeLineScoreItem, 0),
 			})
 		}
+
+		// 分页数据是缓存里的切片，替换自己队伍之前先复制一份
+		if liveTeamScoreItem != nil {
+			for i := range pageTeamScores {
+				if pageTeamScores[i].TeamID == curTeam.TeamID {
+					pageTeamScores = append([]webmodels.TeamScoreItem(nil), pageTeamScores...)
+					pageTeamScores[i] = withOwnSolves(pageTeamScores[i], *liveTeamScoreItem, scoreBoard.ChallengeStats, game.FreezeTime)
+					break
+				}
+			}
+		}
 	} else {
 		pageTeamScores = make([]webmodels.TeamScoreItem, 0)
 		pageTimeLines = make([]webmodels.TimeLineItem, 0)
@@ -397,6 +452,30 @@ func UserGameGetScoreBoard(c *gin.Context) {
 		}
 	}
 
+	if frozen {
+		simpleGameChallenges = ristretto_tool.FrozenGameSimpleChallenges(scoreBoard, simpleGameChallenges)
+	}
+
+	// 阶段排行榜只显示这个阶段的题目
+	if currentStage != nil {
+		stageChallenges := make([]webmodels.UserSimpleGameChallenge, 0, len(simpleGameChallenges))
+		for _, challenge := range simpleGameChallenges {
+			if challenge.BelongStage != nil && *challenge.BelongStage == *currentStage {
+				stageChallenges = append(stageChallenges, challenge)
+			}
+		}
+		simpleGameChallenges = stageChallenges
+	}
+
+	stages, err := scoreBoardStages(&game)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+			Code:    500,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadStageTeams"}),
+		})
+		return
+	}
+
 	result := webmodels.GameScoreboardData{
 		GameID:               game.GameID,
 		Name:                 game.Name,
@@ -407,6 +486,10 @@ func UserGameGetScoreBoard(c *gin.Context) {
 		Groups:               simpleGameGroups,
 		CurrentGroup:         currentGroup,
 		Pagination:           &pagination,
+		Frozen:               frozen,
+		FreezeTime:           game.FreezeTime,
+		Stages:               stages,
+		CurrentStage:         currentStage,
 	}
 
 	if logined {
@@ -418,3 +501,256 @@ func UserGameGetScoreBoard(c *gin.Context) {
 		"data": result,
 	})
 }
+
+// 排行榜可以选择的阶段和每个阶段晋级的队伍数量
+func scoreBoardStages(game *models.Game) ([]webmodels.ScoreBoardStageInfo, error) {
+	stages := make([]webmodels.ScoreBoardStageInfo, 0)
+	if game.Stages == nil {
+		return stages, nil
+	}
+
+	stageTeams, err := ristretto_tool.CachedGameStageTeams(game.GameID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, stage := range *game.Stages {
+		stages = append(stages, webmodels.ScoreBoardStageInfo{
+			StageName:          stage.StageName,
+			StartTime:          stage.StartTime,
+			EndTime:            stage.EndTime,
+			ScoreMultiplier:    stage.Multiplier(),
+			PromoteTopN:        stage.PromoteTopN,
+			QualifiedTeamCount: int64(len(stageTeams[stage.StageName])),
+		})
+	}
+
+	return stages, nil
+}
+
+// 解析毫秒时间戳查询参数，没有传的时候返回 nil
+func parseReplayTimeQuery(c *gin.Context, key string) (*time.Time, bool) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, true
+	}
+
+	millis, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || millis < 0 {
+		return nil, false
+	}
+
+	t := time.UnixMilli(millis).UTC()
+	return &t, true
+}
+
+// 排行榜回放能看到的最晚时间，封榜期间选手只能回放到封榜时间
+func scoreBoardReplayLimit(c *gin.Context, game *models.Game) (time.Time, bool) {
+	now := time.Now().UTC()
+
+	claims, _ := jwtauth.GetJwtMiddleWare().GetClaimsFromJWT(c)
+	role, _ := claims["Role"].(string)
+
+	if game.ScoreBoardFrozen(now) && !isLiveScoreBoardRole(models.UserRole(role)) {
+		return *game.FreezeTime, true
+	}
+
+	return now, false
+}
+
+// UserGameGetScoreBoardReplay 重建比赛在某个时间点的完整排行榜，time 是毫秒时间戳，默认是当前时间
+func UserGameGetScoreBoardReplay(c *gin.Context) {
+	game := c.MustGet("game").(models.Game)
+
+	recordTime, ok := parseReplayTimeQuery(c, "time")
+	if !ok {
+		c.JSON(http.StatusBadRequest, webmodels.ErrorMessage{
+			Code:    400,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidReplayTime"}),
+		})
+		return
+	}
+
+	var groupID *int64
+	if groupIDStr := c.Query("group_id"); groupIDStr != "" {
+		gid, err := strconv.ParseInt(groupIDStr, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, webmodels.ErrorMessage{
+				Code:    400,
+				Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidGroupID"}),
+			})
+			return
+		}
+		groupID = &gid
+	}
+
+	limit, frozen := scoreBoardReplayLimit(c, &game)
+	if recordTime == nil || recordTime.After(limit) {
+		recordTime = &limit
+	}
+
+	replay, err := ristretto_tool.CachedGameScoreBoardReplay(game.GameID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+			Code:    500,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadScoreboardReplay"}),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": webmodels.ScoreBoardReplayData{
+			GameID:     game.GameID,
+			RecordTime: recordTime.UnixMilli(),
+			Frozen:     frozen,
+			Rankings:   replay.RankingAt(*recordTime, groupID),
+		},
+	})
+}
+
+// UserGameGetScoreBoardRankChanges 分页获取排名变化事件，可以用 since 和 until（毫秒时间戳）限定时间范围
+func UserGameGetScoreBoardRankChanges(c *gin.Context) {
+	game := c.MustGet("game").(models.Game)
+
+	pageStr := c.DefaultQuery("page", "1")
+	sizeStr := c.DefaultQuery("size", "100")
+
+	page, err := strconv.ParseInt(pageStr, 10, 64)
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	size, err := strconv.ParseInt(sizeStr, 10, 64)
+	if err != nil || size < 1 {
+		size = 100
+	}
+	size = min(size, 500)
+
+	since, sinceOK := parseReplayTimeQuery(c, "since")
+	until, untilOK := parseReplayTimeQuery(c, "until")
+	if !sinceOK || !untilOK {
+		c.JSON(http.StatusBadRequest, webmodels.ErrorMessage{
+			Code:    400,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidReplayTime"}),
+		})
+		return
+	}
+
+	var groupID *int64
+	if groupIDStr := c.Query("group_id"); groupIDStr != "" {
+		gid, err := strconv.ParseInt(groupIDStr, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, webmodels.ErrorMessage{
+				Code:    400,
+				Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidGroupID"}),
+			})
+			return
+		}
+		groupID = &gid
+	}
+
+	limit, frozen := scoreBoardReplayLimit(c, &game)
+	if until == nil || until.After(limit) {
+		until = &limit
+	}
+
+	allEvents, err := ristretto_tool.CachedGameScoreBoardRankChangeEvents(game.GameID, groupID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+			Code:    500,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadScoreboardReplay"}),
+		})
+		return
+	}
+
+	// 事件已经按时间排序，缓存里的切片不能修改
+	events := make([]webmodels.ScoreBoardRankChangeEvent, 0)
+	for _, event := range allEvents {
+		if since != nil && event.RecordTime < since.UnixMilli() {
+			continue
+		}
+		if event.RecordTime > until.UnixMilli() {
+			break
+		}
+		events = append(events, event)
+	}
+
+	totalCount := int64(len(events))
+	totalPages := (totalCount + size - 1) / size
+	pagination := webmodels.PaginationInfo{
+		CurrentPage: page,
+		PageSize:    size,
+		TotalCount:  totalCount,
+		TotalPages:  totalPages,
+	}
+
+	startIdx := min((page-1)*size, totalCount)
+	endIdx := min(startIdx+size, totalCount)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": webmodels.ScoreBoardRankChangeEvents{
+			GameID:     game.GameID,
+			Frozen:     frozen,
+			Events:     events[startIdx:endIdx],
+			Pagination: &pagination,
+		},
+	})
+}
+
+// 管理员和观察者在封榜期间也能看到实时排行榜
+func isLiveScoreBoardRole(role models.UserRole) bool {
+	return role == models.UserRoleAdmin || role == models.UserRoleMonitor
+}
+
+// 封榜期间队伍仍然能看到自己封榜后的解题，排名保持封榜时的排名。
+// 封榜后的解题按照封榜时的题目分数计分，不显示血量排名和奖励，避免从自己的分数推算出封榜后的解题人数；
+// 封榜前的解题和分数修正保持封榜时的数据，只追加封榜后新增的分数修正和提示解锁
+func withOwnSolves(frozenItem webmodels.TeamScoreItem, liveItem webmodels.TeamScoreItem, challengeStats map[int64]webmodels.ScoreBoardChallengeStat, freezeTime *time.Time) webmodels.TeamScoreItem {
+	frozenSolved := make(map[int64]bool, len(frozenItem.SolvedChallenges))
+	for _, solve := range frozenItem.SolvedChallenges {
+		frozenSolved[solve.ChallengeID] = true
+	}
+
+	solvedChallenges := append([]webmodels.TeamSolveItem(nil), frozenItem.SolvedChallenges...)
+	for _, solve := range liveItem.SolvedChallenges {
+		if frozenSolved[solve.ChallengeID] {
+			continue
+		}
+
+		solve.Score = challengeStats[solve.ChallengeID].SolveScore
+		solve.Rank = 0
+		solve.BloodReward = 0
+		frozenItem.Score += solve.Score
+		solvedChallenges = append(solvedChallenges, solve)
+	}
+
+	// 血量奖励和提示解锁的 AdjustmentID 是 -1，血量奖励不追加，提示解锁按照解锁时间判断是否是封榜后的
+	frozenAdjustments := make(map[int64]bool, len(frozenItem.ScoreAdjustments))
+	for _, adjustment := range frozenItem.ScoreAdjustments {
+		frozenAdjustments[adjustment.AdjustmentID] = true
+	}
+
+	scoreAdjustments := append([]webmodels.TeamScoreAdjustmentItem(nil), frozenItem.ScoreAdjustments...)
+	for _, adjustment := range liveItem.ScoreAdjustments {
+		if adjustment.AdjustmentID < 0 {
+			if adjustment.AdjustmentType != string(models.AdjustmentTypeHint) || freezeTime == nil || !adjustment.CreatedAt.After(*freezeTime) {
+				continue
+			}
+		} else if frozenAdjustments[adjustment.AdjustmentID] {
+			continue
+		}
+
+		frozenItem.Score += adjustment.ScoreChange
+		scoreAdjustments = append(scoreAdjustments, adjustment)
+	}
+
+	frozenItem.SolvedChallenges = solvedChallenges
+	frozenItem.ScoreAdjustments = scoreAdjustments
+	return frozenItem
+}
+
+func isBloodNotice(category models.NoticeCategory) bool {
+	return category == models.NoticeFirstBlood || category == models.NoticeSecondBlood || category == models.NoticeThirdBlood
+}
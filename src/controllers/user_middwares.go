@@ -53,7 +53,7 @@ func GameStatusMiddleware(props GameStatusMiddlewareProps) gin.HandlerFunc {
 		user, exists := c.Get("user")
 
 		// 再换一种方式获取登陆状态，给获取比赛信息接口用
-		if (c.FullPath() == "/api/game/:game_id" && c.Request.Method == "GET") || (c.FullPath() == "/api/game/:game_id/desc" && c.Request.Method == "GET") || (c.FullPath() == "/api/game/:game_id/scoreboard" && c.Request.Method == "GET") {
+		if (c.FullPath() == "/api/game/:game_id" && c.Request.Method == "GET") || (c.FullPath() == "/api/game/:game_id/desc" && c.Request.Method == "GET") || (c.FullPath() == "/api/game/:game_id/scoreboard" && c.Request.Method == "GET") || (c.FullPath() == "/api/game/:game_id/scoreboard/replay" && c.Request.Method == "GET") || (c.FullPath() == "/api/game/:game_id/scoreboard/replay/events" && c.Request.Method == "GET") {
 			claims, errFromJwt := jwtauth.GetJwtMiddleWare().GetClaimsFromJWT(c)
 			if errFromJwt == nil {
 				user_id, userIDExists := claims["UserID"]
@@ -288,6 +288,28 @@ func ChallengeStatusCheckMiddleWare(accessableAfterStageEnded bool) gin.HandlerF
 			return
 		}
 
+		// 有晋级名单的阶段只有晋级的队伍能参加
+		if team, ok := c.Get("team"); ok {
+			qualified, err := ristretto_tool.TeamQualifiedForStage(game.GameID, team.(models.Team).TeamID, gameChallenge.BelongStage)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+					Code:    500,
+					Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadStageTeams"}),
+				})
+				c.Abort()
+				return
+			}
+
+			if !qualified {
+				c.JSON(http.StatusForbidden, webmodels.ErrorMessage{
+					Code:    403,
+					Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "TeamNotQualifiedForStage"}),
+				})
+				c.Abort()
+				return
+			}
+		}
+
 		c.Next()
 	}
 }
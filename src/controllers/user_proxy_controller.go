@@ -0,0 +1,138 @@
+package controllers
+
+import (
+	"a1ctf/src/db/models"
+	dbtool "a1ctf/src/utils/db_tool"
+	i18ntool "a1ctf/src/utils/i18n_tool"
+	proxytool "a1ctf/src/utils/proxy_tool"
+	"a1ctf/src/webmodels"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/spf13/viper"
+)
+
+// 代理用 a1token cookie 认证，浏览器里其他网站的页面也会带上 cookie，所以只允许平台自己的页面发起连接。
+// 没有 Origin 的是命令行之类的客户端，不会自动带上 cookie
+var proxyUpgrader = websocket.Upgrader{
+	CheckOrigin: sameOriginAsBaseURL,
+}
+
+func sameOriginAsBaseURL(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	originURL, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	baseURL, err := url.Parse(viper.GetString("system.baseURL"))
+	if err != nil || baseURL.Host == "" {
+		return false
+	}
+
+	return strings.EqualFold(originURL.Scheme, baseURL.Scheme) && strings.EqualFold(originURL.Host, baseURL.Host)
+}
+
+// webSocketStream 把 WebSocket 的二进制消息包装成字节流
+type webSocketStream struct {
+	ws     *websocket.Conn
+	reader io.Reader
+}
+
+func (s *webSocketStream) Read(p []byte) (int, error) {
+	for {
+		if s.reader == nil {
+			messageType, reader, err := s.ws.NextReader()
+			if err != nil {
+				return 0, io.EOF
+			}
+			if messageType != websocket.BinaryMessage && messageType != websocket.TextMessage {
+				continue
+			}
+			s.reader = reader
+		}
+
+		n, err := s.reader.Read(p)
+		if err == io.EOF {
+			s.reader = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (s *webSocketStream) Write(p []byte) (int, error) {
+	if err := s.ws.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *webSocketStream) Close() error {
+	return s.ws.Close()
+}
+
+// UserProxyWebSocket 通过 WebSocket 连接题目实例，只有 Token 所属队伍的成员可以使用
+func UserProxyWebSocket(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+
+	if !proxytool.Enabled() {
+		c.JSON(http.StatusNotFound, webmodels.ErrorMessage{
+			Code:    404,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidProxyToken"}),
+		})
+		return
+	}
+
+	target, err := proxytool.Parse(c.Param("token"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, webmodels.ErrorMessage{
+			Code:    400,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidProxyToken"}),
+		})
+		return
+	}
+
+	var team models.Team
+	if err := dbtool.DB().Where("team_id = ?", target.TeamID).First(&team).Error; err != nil || !slices.Contains(team.TeamMembers, user.UserID) {
+		c.JSON(http.StatusForbidden, webmodels.ErrorMessage{
+			Code:    403,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidProxyToken"}),
+		})
+		return
+	}
+
+	resolved, err := proxytool.Resolve(target)
+	if err != nil {
+		c.JSON(http.StatusNotFound, webmodels.ErrorMessage{
+			Code:    404,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "ProxyTargetNotRunning"}),
+		})
+		return
+	}
+
+	ws, err := proxyUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+
+	userID := user.UserID
+	proxytool.Forward(&webSocketStream{ws: ws}, proxytool.Session{
+		Target:    target,
+		UserID:    &userID,
+		ClientIP:  c.ClientIP(),
+		Transport: models.ProxyTransportWebSocket,
+	}, resolved)
+}
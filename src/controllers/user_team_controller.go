@@ -107,6 +107,9 @@ func UserCreateGameTeam(c *gin.Context) {
 		return
 	}
 
+	// 自动审核的队伍直接出现在排行榜上
+	ristretto_tool.MarkGameScoreBoardRebuild(game.GameID)
+
 	tasks.LogUserOperation(c, models.ActionCreate, models.ResourceTypeTeam, nil, map[string]interface{}{
 		"game_id":     game.GameID,
 		"team_name":   payload.Name,
@@ -175,6 +178,12 @@ func TeamJoinRequest(c *gin.Context) {
 		return
 	}
 
+	// 手动审核模式下只创建申请，由队长审批
+	if game.TeamPolicy == models.TeamPolicyManual {
+		createTeamJoinRequest(c, game, user, team, payload.InviteCode)
+		return
+	}
+
 	team.TeamMembers = append(team.TeamMembers, user.UserID)
 
 	if err := dbtool.DB().Save(&team).Error; err != nil {
@@ -193,6 +202,8 @@ func TeamJoinRequest(c *gin.Context) {
 		return
 	}
 
+	ristretto_tool.MarkGameScoreBoardRebuild(team.GameID)
+
 	tasks.LogUserOperation(c, models.ActionJoinTeam, models.ResourceTypeTeam, &team.TeamName, map[string]interface{}{
 		"team_id":     team.TeamID,
 		"team_name":   team.TeamName,
@@ -295,6 +306,8 @@ func TransferTeamCaptain(c *gin.Context) {
 		return
 	}
 
+	ristretto_tool.MarkGameScoreBoardRebuild(team.GameID)
+
 	tasks.LogUserOperation(c, models.ActionTransfer, models.ResourceTypeTeam, &team.TeamName, map[string]interface{}{
 		"team_id":        team.TeamID,
 		"team_name":      team.TeamName,
@@ -403,6 +416,8 @@ func RemoveTeamMember(c *gin.Context) {
 		return
 	}
 
+	ristretto_tool.MarkGameScoreBoardRebuild(team.GameID)
+
 	tasks.LogUserOperation(c, "REMOVE_MEMBER", models.ResourceTypeTeam, &team.TeamName, map[string]interface{}{
 		"team_id":         team.TeamID,
 		"team_name":       team.TeamName,
@@ -502,6 +517,8 @@ func DeleteTeam(c *gin.Context) {
 		return
 	}
 
+	ristretto_tool.MarkGameScoreBoardRebuild(team.GameID)
+
 	tasks.LogUserOperation(c, models.ActionDelete, models.ResourceTypeTeam, &team.TeamName, map[string]interface{}{
 		"team_id":      team.TeamID,
 		"team_name":    team.TeamName,
@@ -589,6 +606,8 @@ func UpdateTeamInfo(c *gin.Context) {
 		return
 	}
 
+	ristretto_tool.MarkGameScoreBoardRebuild(team.GameID)
+
 	tasks.LogUserOperation(c, models.ActionUpdate, models.ResourceTypeTeam, &team.TeamName, map[string]interface{}{
 		"team_id":    team.TeamID,
 		"team_name":  team.TeamName,
@@ -0,0 +1,394 @@
+package controllers
+
+import (
+	"a1ctf/src/db/models"
+	"a1ctf/src/tasks"
+	dbtool "a1ctf/src/utils/db_tool"
+	i18ntool "a1ctf/src/utils/i18n_tool"
+	noticetool "a1ctf/src/utils/notice_tool"
+	"a1ctf/src/utils/ristretto_tool"
+	"a1ctf/src/utils/zaphelper"
+	"a1ctf/src/webmodels"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errJoinRequestHandled  = errors.New("join request has already been handled")
+	errJoinRequestTeamFull = errors.New("team is full")
+	errJoinRequestInTeam   = errors.New("user is already in a team")
+)
+
+func toTeamJoinRequestInfo(request models.TeamJoinRequest) webmodels.TeamJoinRequestInfo {
+	return webmodels.TeamJoinRequestInfo{
+		RequestID:  request.RequestID,
+		UserID:     request.UserID,
+		Username:   request.User.Username,
+		UserAvatar: request.User.Avatar,
+		Status:     request.Status,
+		CreateTime: request.CreateTime,
+		Message:    request.Message,
+	}
+}
+
+// 手动审核模式下创建入队申请，并通知队长
+func createTeamJoinRequest(c *gin.Context, game models.Game, user models.User, team models.Team, inviteCode string) {
+	if team.GameID != game.GameID {
+		c.JSON(http.StatusNotFound, webmodels.ErrorMessage{
+			Code:    404,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidInviteCode"}),
+		})
+		return
+	}
+
+	request := models.TeamJoinRequest{
+		TeamID:     team.TeamID,
+		UserID:     user.UserID,
+		GameID:     game.GameID,
+		Status:     models.JoinRequestPending,
+		CreateTime: time.Now().UTC(),
+	}
+
+	if err := dbtool.DB().Omit(clause.Associations).Create(&request).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			c.JSON(http.StatusBadRequest, webmodels.ErrorMessage{
+				Code:    400,
+				Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "JoinRequestAlreadyExists"}),
+			})
+			return
+		}
+
+		tasks.LogUserOperationWithError(c, models.ActionJoinTeam, models.ResourceTypeTeam, &team.TeamName, map[string]interface{}{
+			"team_id":     team.TeamID,
+			"team_name":   team.TeamName,
+			"game_id":     team.GameID,
+			"invite_code": inviteCode,
+		}, err)
+
+		c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+			Code:    500,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "SystemError"}),
+		})
+		return
+	}
+
+	tasks.LogUserOperation(c, models.ActionJoinTeam, models.ResourceTypeTeam, &team.TeamName, map[string]interface{}{
+		"team_id":     team.TeamID,
+		"team_name":   team.TeamName,
+		"game_id":     team.GameID,
+		"invite_code": inviteCode,
+		"request_id":  request.RequestID,
+	})
+
+	request.User = user
+	if len(team.TeamMembers) > 0 {
+		go noticetool.SendToUsers(game.GameID, []string{team.TeamMembers[0]}, "NewTeamJoinRequest", gin.H{
+			"team_id": team.TeamID,
+			"request": toTeamJoinRequestInfo(request),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "ApplicationSubmitted"}),
+		"data": gin.H{
+			"request_id": request.RequestID,
+		},
+	})
+}
+
+// 解析路径里的 team_id，并检查当前用户是不是这个队伍的队长
+func loadCaptainTeam(c *gin.Context) (*models.Team, bool) {
+	game := c.MustGet("game").(models.Game)
+	user := c.MustGet("user").(models.User)
+
+	teamID, err := strconv.ParseInt(c.Param("team_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, webmodels.ErrorMessage{
+			Code:    400,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidTeamID"}),
+		})
+		return nil, false
+	}
+
+	var team models.Team
+	if err := dbtool.DB().Where("team_id = ? AND game_id = ?", teamID, game.GameID).First(&team).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, webmodels.ErrorMessage{
+				Code:    404,
+				Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "TeamNotFound"}),
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+				Code:    500,
+				Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "SystemError"}),
+			})
+		}
+		return nil, false
+	}
+
+	if len(team.TeamMembers) == 0 || team.TeamMembers[0] != user.UserID {
+		c.JSON(http.StatusForbidden, webmodels.ErrorMessage{
+			Code:    403,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "OnlyTeamCaptainCanHandleJoinRequests"}),
+		})
+		return nil, false
+	}
+
+	return &team, true
+}
+
+// UserListTeamJoinRequests 队长查看队伍收到的入队申请，默认只返回待处理的申请
+func UserListTeamJoinRequests(c *gin.Context) {
+	team, ok := loadCaptainTeam(c)
+	if !ok {
+		return
+	}
+
+	query := dbtool.DB().Preload("User").Where("team_id = ?", team.TeamID)
+	if c.Query("all") != "true" {
+		query = query.Where("status = ?", models.JoinRequestPending)
+	}
+
+	var requests []models.TeamJoinRequest
+	if err := query.Order("create_time DESC").Find(&requests).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+			Code:    500,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadJoinRequests"}),
+		})
+		return
+	}
+
+	data := make([]webmodels.TeamJoinRequestInfo, 0, len(requests))
+	for _, request := range requests {
+		data = append(data, toTeamJoinRequestInfo(request))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": data,
+	})
+}
+
+// UserHandleTeamJoinRequest 队长通过或拒绝入队申请
+func UserHandleTeamJoinRequest(c *gin.Context) {
+	game := c.MustGet("game").(models.Game)
+	user := c.MustGet("user").(models.User)
+	payload := *c.MustGet("payload").(*webmodels.HandleJoinRequestPayload)
+
+	team, ok := loadCaptainTeam(c)
+	if !ok {
+		return
+	}
+
+	requestID, err := strconv.ParseInt(c.Param("request_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, webmodels.ErrorMessage{
+			Code:    400,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidJoinRequestID"}),
+		})
+		return
+	}
+
+	approved := payload.Action == "approve"
+	var request models.TeamJoinRequest
+
+	err = dbtool.DB().Transaction(func(tx *gorm.DB) error {
+		// 锁住队伍，防止并发通过申请导致人数超过限制
+		var lockedTeam models.Team
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("team_id = ?", team.TeamID).First(&lockedTeam).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("request_id = ? AND team_id = ?", requestID, team.TeamID).First(&request).Error; err != nil {
+			return err
+		}
+
+		if request.Status != models.JoinRequestPending {
+			return errJoinRequestHandled
+		}
+
+		now := time.Now().UTC()
+		request.HandleTime = &now
+		request.HandledBy = &user.UserID
+		request.Status = models.JoinRequestRejected
+
+		if approved {
+			var existingCount int64
+			if err := tx.Model(&models.Team{}).Where("game_id = ? AND team_members @> ?", game.GameID, pq.StringArray{request.UserID}).Count(&existingCount).Error; err != nil {
+				return err
+			}
+			if existingCount > 0 {
+				return errJoinRequestInTeam
+			}
+
+			if len(lockedTeam.TeamMembers) >= int(game.TeamNumberLimit) {
+				return errJoinRequestTeamFull
+			}
+
+			lockedTeam.TeamMembers = append(lockedTeam.TeamMembers, request.UserID)
+			if err := tx.Model(&models.Team{}).Where("team_id = ?", lockedTeam.TeamID).Update("team_members", lockedTeam.TeamMembers).Error; err != nil {
+				return err
+			}
+
+			request.Status = models.JoinRequestApproved
+
+			// 用户已经入队，这场比赛里其他还没处理的申请直接拒绝
+			if err := tx.Model(&models.TeamJoinRequest{}).
+				Where("game_id = ? AND user_id = ? AND request_id <> ? AND status = ?", game.GameID, request.UserID, request.RequestID, models.JoinRequestPending).
+				Updates(map[string]interface{}{
+					"status":      models.JoinRequestRejected,
+					"handle_time": now,
+					"handled_by":  user.UserID,
+				}).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&models.TeamJoinRequest{}).Where("request_id = ?", request.RequestID).Updates(map[string]interface{}{
+			"status":      request.Status,
+			"handle_time": request.HandleTime,
+			"handled_by":  request.HandledBy,
+		}).Error
+	})
+
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, webmodels.ErrorMessage{
+				Code:    404,
+				Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "JoinRequestNotFound"}),
+			})
+		case errors.Is(err, errJoinRequestHandled):
+			c.JSON(http.StatusBadRequest, webmodels.ErrorMessage{
+				Code:    400,
+				Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "JoinRequestAlreadyHandled"}),
+			})
+		case errors.Is(err, errJoinRequestInTeam):
+			c.JSON(http.StatusBadRequest, webmodels.ErrorMessage{
+				Code:    400,
+				Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "UserAlreadyInTeam"}),
+			})
+		case errors.Is(err, errJoinRequestTeamFull):
+			c.JSON(http.StatusBadRequest, webmodels.ErrorMessage{
+				Code:    400,
+				Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "TeamIsFull"}),
+			})
+		default:
+			tasks.LogUserOperationWithError(c, models.ActionUpdate, models.ResourceTypeTeam, &team.TeamName, map[string]interface{}{
+				"team_id":    team.TeamID,
+				"game_id":    game.GameID,
+				"request_id": requestID,
+				"action":     payload.Action,
+			}, err)
+
+			c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+				Code:    500,
+				Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToHandleJoinRequest"}),
+			})
+		}
+		return
+	}
+
+	logAction := models.ActionReject
+	if approved {
+		logAction = models.ActionApprove
+		ristretto_tool.MarkGameScoreBoardRebuild(game.GameID)
+	}
+
+	tasks.LogUserOperation(c, logAction, models.ResourceTypeTeam, &team.TeamName, map[string]interface{}{
+		"team_id":    team.TeamID,
+		"game_id":    game.GameID,
+		"request_id": request.RequestID,
+		"user_id":    request.UserID,
+	})
+
+	// 通知申请人处理结果
+	go noticetool.SendToUsers(game.GameID, []string{request.UserID}, "TeamJoinRequestResult", gin.H{
+		"request_id": request.RequestID,
+		"team_id":    team.TeamID,
+		"team_name":  team.TeamName,
+		"status":     request.Status,
+	})
+
+	var applicant models.User
+	if err := dbtool.DB().Where("user_id = ?", request.UserID).First(&applicant).Error; err == nil {
+		if err := tasks.NewTeamJoinResultMailTask(applicant, team.TeamName, game.Name, approved); err != nil {
+			zaphelper.Logger.Warn("Failed to send team join result mail", zap.Error(err), zap.Int64("request_id", request.RequestID))
+		}
+	}
+
+	messageID := "JoinRequestRejected"
+	if approved {
+		messageID = "JoinRequestApproved"
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: messageID}),
+	})
+}
+
+// UserWithdrawTeamJoinRequest 申请人撤回还没有被处理的入队申请
+func UserWithdrawTeamJoinRequest(c *gin.Context) {
+	game := c.MustGet("game").(models.Game)
+	user := c.MustGet("user").(models.User)
+
+	teamID, err := strconv.ParseInt(c.Param("team_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, webmodels.ErrorMessage{
+			Code:    400,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidTeamID"}),
+		})
+		return
+	}
+
+	requestID, err := strconv.ParseInt(c.Param("request_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, webmodels.ErrorMessage{
+			Code:    400,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidJoinRequestID"}),
+		})
+		return
+	}
+
+	result := dbtool.DB().Where("request_id = ? AND team_id = ? AND game_id = ? AND user_id = ? AND status = ?",
+		requestID, teamID, game.GameID, user.UserID, models.JoinRequestPending,
+	).Delete(&models.TeamJoinRequest{})
+
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+			Code:    500,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToHandleJoinRequest"}),
+		})
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, webmodels.ErrorMessage{
+			Code:    404,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "JoinRequestNotFound"}),
+		})
+		return
+	}
+
+	requestIDStr := strconv.FormatInt(requestID, 10)
+	tasks.LogUserOperation(c, models.ActionDelete, models.ResourceTypeTeam, &requestIDStr, map[string]interface{}{
+		"game_id":    game.GameID,
+		"request_id": requestID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "JoinRequestWithdrawn"}),
+	})
+}
@@ -0,0 +1,267 @@
+package controllers
+
+import (
+	"a1ctf/src/db/models"
+	"a1ctf/src/tasks"
+	dbtool "a1ctf/src/utils/db_tool"
+	i18ntool "a1ctf/src/utils/i18n_tool"
+	"a1ctf/src/webmodels"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"gorm.io/gorm"
+)
+
+// Writeup 单独存放，不允许通过公开的文件下载接口访问
+var writeupUploadDir = filepath.Join("data", "uploads", "writeups")
+
+const writeupMaxSize = 50 * 1024 * 1024
+
+// 检查 Writeup 的扩展名和文件头，返回保存时使用的 MIME 类型
+func validateWriteupFile(file *multipart.FileHeader) (string, error) {
+	src, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	buffer := make([]byte, 512)
+	n, err := src.Read(buffer)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	header := buffer[:n]
+
+	switch strings.ToLower(filepath.Ext(file.Filename)) {
+	case ".pdf":
+		if bytes.HasPrefix(header, []byte("%PDF-")) {
+			return "application/pdf", nil
+		}
+	case ".zip":
+		if bytes.HasPrefix(header, []byte("PK\x03\x04")) || bytes.HasPrefix(header, []byte("PK\x05\x06")) {
+			return "application/zip", nil
+		}
+	case ".md", ".markdown":
+		if strings.HasPrefix(http.DetectContentType(header), "text/plain") {
+			return "text/markdown", nil
+		}
+	}
+
+	return "", errors.New("unsupported writeup file type")
+}
+
+func isWriteupFile(filePath string) bool {
+	return strings.HasPrefix(filepath.Clean(filePath), writeupUploadDir+string(filepath.Separator))
+}
+
+func UserGetWriteup(c *gin.Context) {
+	game := c.MustGet("game").(models.Game)
+	team := c.MustGet("team").(models.Team)
+
+	result := webmodels.UserWriteupInfo{
+		RequireWp:    game.RequireWp,
+		WpExpireTime: game.WpExpireTime,
+		Submitted:    false,
+	}
+
+	var writeup models.Writeup
+	if err := dbtool.DB().Preload("Upload").Where("game_id = ? AND team_id = ?", game.GameID, team.TeamID).First(&writeup).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+				Code:    500,
+				Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToLoadWriteup"}),
+			})
+			return
+		}
+	} else {
+		result.Submitted = true
+		result.SubmitTime = &writeup.SubmitTime
+		result.ReviewStatus = writeup.ReviewStatus
+		result.ReviewComment = writeup.ReviewComment
+		if writeup.Upload != nil {
+			result.FileName = writeup.Upload.FileName
+			result.FileSize = writeup.Upload.FileSize
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": result,
+	})
+}
+
+func UserUploadWriteup(c *gin.Context) {
+	user := c.MustGet("user").(models.User)
+	game := c.MustGet("game").(models.Game)
+	team := c.MustGet("team").(models.Team)
+
+	if !game.RequireWp {
+		c.JSON(http.StatusBadRequest, webmodels.ErrorMessage{
+			Code:    400,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "WriteupNotRequired"}),
+		})
+		return
+	}
+
+	if time.Now().UTC().After(game.WpExpireTime) {
+		c.JSON(http.StatusForbidden, webmodels.ErrorMessage{
+			Code:    403,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "WriteupDeadlinePassed"}),
+		})
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, webmodels.ErrorMessage{
+			Code:    400,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "NoFileUploaded"}),
+		})
+		return
+	}
+
+	if file.Size > writeupMaxSize {
+		c.JSON(http.StatusBadRequest, webmodels.ErrorMessage{
+			Code:    400,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FileTooLarge"}),
+		})
+		return
+	}
+
+	fileType, err := validateWriteupFile(file)
+	if err != nil {
+		c.JSON(http.StatusUnsupportedMediaType, webmodels.ErrorMessage{
+			Code:    415,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "InvalidWriteupFileType"}),
+		})
+		return
+	}
+
+	storePath := filepath.Join(writeupUploadDir, fmt.Sprintf("%d", game.GameID))
+	if err := os.MkdirAll(storePath, 0755); err != nil {
+		c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+			Code:    500,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToCreateUploadDirectory"}),
+		})
+		return
+	}
+
+	fileID := uuid.NewString()
+	savedPath := filepath.Join(storePath, fileID)
+
+	if err := saveUploadedFile(file, savedPath); err != nil {
+		tasks.LogUserOperationWithError(c, models.ActionUpload, models.ResourceTypeWriteup, &fileID, map[string]interface{}{
+			"game_id":           game.GameID,
+			"team_id":           team.TeamID,
+			"original_filename": file.Filename,
+			"file_size":         file.Size,
+		}, err)
+
+		c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+			Code:    500,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToSaveFile"}),
+		})
+		return
+	}
+
+	now := time.Now().UTC()
+	var oldUpload *models.Upload
+
+	// 同一个队伍重复提交时覆盖之前的 Writeup，并重置审核状态
+	err = dbtool.DB().Transaction(func(tx *gorm.DB) error {
+		upload := models.Upload{
+			FileID:     fileID,
+			UserID:     user.UserID,
+			FileName:   filepath.Base(file.Filename),
+			FilePath:   savedPath,
+			FileType:   fileType,
+			FileSize:   file.Size,
+			UploadTime: now,
+		}
+		if err := tx.Create(&upload).Error; err != nil {
+			return err
+		}
+
+		var writeup models.Writeup
+		err := tx.Preload("Upload").Where("game_id = ? AND team_id = ?", game.GameID, team.TeamID).First(&writeup).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return tx.Create(&models.Writeup{
+				GameID:       game.GameID,
+				TeamID:       team.TeamID,
+				FileID:       fileID,
+				SubmiterID:   user.UserID,
+				SubmitTime:   now,
+				ReviewStatus: models.WriteupPending,
+			}).Error
+		} else if err != nil {
+			return err
+		}
+
+		oldUpload = writeup.Upload
+
+		if err := tx.Model(&models.Writeup{}).Where("writeup_id = ?", writeup.WriteupID).Updates(map[string]interface{}{
+			"file_id":        fileID,
+			"submiter_id":    user.UserID,
+			"submit_time":    now,
+			"review_status":  models.WriteupPending,
+			"review_comment": nil,
+			"reviewer_id":    nil,
+			"review_time":    nil,
+		}).Error; err != nil {
+			return err
+		}
+
+		if oldUpload != nil {
+			return tx.Delete(&models.Upload{}, "file_id = ?", oldUpload.FileID).Error
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		_ = os.Remove(savedPath)
+
+		tasks.LogUserOperationWithError(c, models.ActionUpload, models.ResourceTypeWriteup, &fileID, map[string]interface{}{
+			"game_id":           game.GameID,
+			"team_id":           team.TeamID,
+			"original_filename": file.Filename,
+			"file_size":         file.Size,
+			"error_type":        "database_save_failed",
+		}, err)
+
+		c.JSON(http.StatusInternalServerError, webmodels.ErrorMessage{
+			Code:    500,
+			Message: i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "FailedToSaveWriteup"}),
+		})
+		return
+	}
+
+	// 数据库提交成功之后再删除旧文件
+	if oldUpload != nil {
+		_ = os.Remove(oldUpload.FilePath)
+	}
+
+	tasks.LogUserOperation(c, models.ActionUpload, models.ResourceTypeWriteup, &fileID, map[string]interface{}{
+		"game_id":           game.GameID,
+		"team_id":           team.TeamID,
+		"original_filename": file.Filename,
+		"file_size":         file.Size,
+		"replaced":          oldUpload != nil,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18ntool.Translate(c, &i18n.LocalizeConfig{MessageID: "WriteupUploadedSuccessfully"}),
+	})
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+const TableNameAttachmentDownload = "attachment_downloads"
+
+// AttachmentDownload 队伍成员下载题目附件的记录，用于作弊检测
+type AttachmentDownload struct {
+	DownloadID   int64     `gorm:"column:download_id;primaryKey;autoIncrement" json:"download_id"`
+	GameID       int64     `gorm:"column:game_id;not null" json:"game_id"`
+	IngameID     int64     `gorm:"column:ingame_id;not null" json:"ingame_id"`
+	ChallengeID  int64     `gorm:"column:challenge_id;not null" json:"challenge_id"`
+	TeamID       int64     `gorm:"column:team_id;not null" json:"team_id"`
+	UserID       string    `gorm:"column:user_id;not null" json:"user_id"`
+	AttachIndex  int       `gorm:"column:attach_index;not null" json:"attach_index"`
+	AttachName   string    `gorm:"column:attach_name;not null" json:"attach_name"`
+	FileID       string    `gorm:"column:file_id;not null" json:"file_id"`
+	DownloadIP   *string   `gorm:"column:download_ip" json:"download_ip"`
+	DownloadTime time.Time `gorm:"column:download_time;not null" json:"download_time"`
+}
+
+// TableName 获取AttachmentDownload的表名
+func (*AttachmentDownload) TableName() string {
+	return TableNameAttachmentDownload
+}
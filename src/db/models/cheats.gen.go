@@ -14,11 +14,30 @@ const (
 	CheatSubmitSomeonesFlag               = "SubmitSomeonesFlag"
 	CheatSubmitWithoutDownloadAttachments = "SubmitWithoutDownloadAttachments"
 	CheatSubmitWithoutStartContainer      = "SubmitWithoutStartContainer"
+
+	// 以下由定时任务关联分析得出，需要管理员结合 confidence 人工确认
+	CheatSharedIP               = "SharedIP"               // 不同队伍使用了相同的 IP
+	CheatCloseSolveTime         = "CloseSolveTime"         // 两个队伍多次在很短的时间内解出同一道题
+	CheatSubmitSomeonesTeamHash = "SubmitSomeonesTeamHash" // 错误提交里包含别的队伍的 team hash
 )
 
 type CheatExtraData struct {
 	RelevantTeam     int64  `json:"relevant_team"`
 	RelevantTeamName string `json:"relevant_teamname"`
+
+	// 未下载附件 / 未启动靶机时记录，提交之后才下载或启动时 ActionTime 是第一次操作的时间
+	ActionTime *time.Time `json:"action_time,omitempty"`
+	// ActionTime 相对提交时间的秒数，正数表示在提交之后才操作
+	ActionDelta *int64 `json:"action_delta,omitempty"`
+	// 从比赛开始到提交正确 flag 经过的秒数
+	SinceGameStart *int64 `json:"since_game_start,omitempty"`
+
+	// 共用的 IP 以及 IP 的来源 (judge / container / login / register)
+	SharedIPs []string `json:"shared_ips,omitempty"`
+	IPSources []string `json:"ip_sources,omitempty"`
+	// 解题时间接近的题目，以及每道题两个队伍解题的时间差（秒）
+	RelevantChallenges []int64 `json:"relevant_challenges,omitempty"`
+	SolveDeltas        []int64 `json:"solve_deltas,omitempty"`
 }
 
 func (e CheatExtraData) Value() (driver.Value, error) {
@@ -53,21 +72,22 @@ type Cheat struct {
 	CheatType     CheatType      `gorm:"column:cheat_type;not null" json:"cheat_type"`
 	GameID        int64          `gorm:"column:game_id;not null" json:"game_id"`
 	Game          Game           `gorm:"foreignKey:GameID;references:game_id" json:"-"`
-	IngameID      int64          `gorm:"column:ingame_id;not null" json:"ingame_id"`
+	IngameID      *int64         `gorm:"column:ingame_id" json:"ingame_id"`
 	GameChallenge GameChallenge  `gorm:"foreignKey:IngameID;references:ingame_id" json:"-"`
-	ChallengeID   int64          `gorm:"column:challenge_id;not null" json:"challenge_id"`
+	ChallengeID   *int64         `gorm:"column:challenge_id" json:"challenge_id"`
 	Challenge     Challenge      `gorm:"foreignKey:ChallengeID;references:challenge_id" json:"-"`
 	TeamID        int64          `gorm:"column:team_id;not null" json:"team_id"`
 	Team          Team           `gorm:"foreignKey:TeamID;references:team_id" json:"-"`
 	FlagID        *int64         `gorm:"column:flag_id" json:"flag_id"`
 	TeamFlag      *TeamFlag      `gorm:"foreignKey:FlagID;references:flag_id" json:"-"`
-	JudgeID       string         `gorm:"column:judge_id;not null" json:"judge_id"`
+	JudgeID       *string        `gorm:"column:judge_id" json:"judge_id"`
 	Judge         Judge          `gorm:"foreignKey:JudgeID;references:judge_id" json:"-"`
-	SubmiterID    string         `gorm:"column:submiter_id;not null" json:"submiter_id"`
+	SubmiterID    *string        `gorm:"column:submiter_id" json:"submiter_id"`
 	Submiter      User           `gorm:"foreignKey:SubmiterID;references:user_id" json:"-"`
 	ExtraData     CheatExtraData `gorm:"column:extra_data;type:jsonb" json:"extra_data"`
 	CheatTime     time.Time      `gorm:"column:cheat_time;not null" json:"cheat_time"`
 	SubmiterIP    *string        `gorm:"column:submiter_ip" json:"submiter_ip"`
+	Confidence    float64        `gorm:"column:confidence;not null;default:1" json:"confidence"`
 }
 
 // TableName Cheat's table name
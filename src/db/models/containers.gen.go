@@ -4,6 +4,7 @@ import (
 	k8stool "a1ctf/src/utils/k8s_tool"
 	"database/sql/driver"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/bytedance/sonic"
@@ -15,6 +16,14 @@ type ExposePort struct {
 	PortName string `json:"port_name"`
 	Port     int32  `json:"port"`
 	IP       string `json:"ip"`
+	// 开启平台代理后 IP 和 Port 是 TCP 网关的地址，连接后先发送 Token 再转发流量，
+	// ProxyURL 是同一个端口的 WebSocket 隧道地址
+	Token    string `json:"token,omitempty"`
+	ProxyURL string `json:"proxy_url,omitempty"`
+	// HTTP 端口开启 container-ingress 后只返回访问地址
+	URL string `json:"url,omitempty"`
+	// TCP 或 UDP
+	Protocol string `json:"protocol,omitempty"`
 }
 
 type ExposePorts []ExposePort
@@ -94,9 +103,27 @@ type Container struct {
 	ChallengeName        string               `gorm:"column:challenge_name;not null" json:"challenge_name"`
 	TeamHash             string               `gorm:"column:team_hash;not null" json:"team_hash"`
 	SubmiterIP           *string              `gorm:"column:submiter_ip" json:"submiter_ip"`
+	// 领取的预热实例名，有唯一索引，为空的时候实例名是 cl-<ingame_id>-<team_hash>
+	PodName *string `gorm:"column:pod_name" json:"pod_name"`
 }
 
 // TableName Container's table name
 func (*Container) TableName() string {
 	return TableNameContainer
 }
+
+// InstanceName 容器在后端里的实例名
+func (c *Container) InstanceName() string {
+	if c.PodName != nil && *c.PodName != "" {
+		return *c.PodName
+	}
+	return fmt.Sprintf("cl-%d-%s", c.InGameID, c.TeamHash)
+}
+
+// HTTPHostPrefix 预热实例创建的时候还不知道队伍，域名使用预热实例的编号
+func (c *Container) HTTPHostPrefix() string {
+	if poolID, ok := k8stool.WarmPoolID(c.InstanceName()); ok {
+		return k8stool.HTTPHostPrefix(poolID, c.InGameID)
+	}
+	return k8stool.HTTPHostPrefix(c.TeamHash, c.InGameID)
+}
@@ -11,9 +11,11 @@ import (
 const TableNameGameChallenge = "game_challenges"
 
 type Hint struct {
+	HintID     string    `json:"hint_id"`
 	Content    string    `json:"content"`
 	CreateTime time.Time `json:"create_time"`
 	Visible    bool      `json:"visible"`
+	Cost       float64   `json:"cost"` // 解锁提示需要扣除的分数，0 表示免费提示
 }
 
 type Hints []Hint
@@ -30,6 +32,36 @@ func (e *Hints) Scan(value interface{}) error {
 	return sonic.Unmarshal(b, e)
 }
 
+type ScoringStrategy string
+
+const (
+	ScoringStrategyExponential ScoringStrategy = "exponential" // 指数衰减
+	ScoringStrategyLinear      ScoringStrategy = "linear"      // 线性衰减，ScoringDecay 个解之后降到最低分
+	ScoringStrategyLogarithmic ScoringStrategy = "logarithmic" // CTFd 的 logarithmic 曲线
+	ScoringStrategyStatic      ScoringStrategy = "static"      // 固定分数
+)
+
+func (e ScoringStrategy) Value() (driver.Value, error) {
+	if e == "" {
+		return string(ScoringStrategyExponential), nil
+	}
+	return string(e), nil
+}
+
+func (e *ScoringStrategy) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		*e = ScoringStrategy(v)
+	case []byte:
+		*e = ScoringStrategy(v)
+	case nil:
+		*e = ScoringStrategyExponential
+	default:
+		return errors.New("cannot scan value into ScoringStrategy")
+	}
+	return nil
+}
+
 type GameChallenge struct {
 	IngameID     int64        `gorm:"column:ingame_id;primaryKey;autoIncrement:true" json:"ingame_id"`
 	GameID       int64        `gorm:"column:game_id;not null" json:"game_id"`
@@ -47,6 +79,11 @@ type GameChallenge struct {
 	Visible      bool         `gorm:"column:visible" json:"visible"`
 
 	BloodRewardEnabled bool `gorm:"column:enable_blood_reward" json:"enable_blood_reward"`
+
+	ScoringStrategy ScoringStrategy `gorm:"column:scoring_strategy;default:exponential" json:"scoring_strategy"`
+	ScoringDecay    int32           `gorm:"column:scoring_decay;default:0" json:"scoring_decay"`
+	// 预热池大小，比赛期间保持这么多个没有被领取的实例
+	WarmPoolSize int32 `gorm:"column:warm_pool_size;default:0" json:"warm_pool_size"`
 	// Challenge Challenge `gorm:"foreignKey:challenge_id;references:challenges.challenge_id"`
 }
 
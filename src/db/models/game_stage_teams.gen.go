@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+const TableNameGameStageTeam = "game_stage_teams"
+
+// GameStageTeam 晋级到某个阶段的队伍，一个阶段有晋级记录之后只有这些队伍能参加这个阶段
+type GameStageTeam struct {
+	ID        int64   `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	GameID    int64   `gorm:"column:game_id;not null" json:"game_id"`
+	StageName string  `gorm:"column:stage_name;not null" json:"stage_name"`
+	TeamID    int64   `gorm:"column:team_id;not null" json:"team_id"`
+	FromStage *string `gorm:"column:from_stage" json:"from_stage"`
+	// 晋级时在上一阶段的排名
+	FromRank   *int64    `gorm:"column:from_rank" json:"from_rank"`
+	PromotedBy *string   `gorm:"column:promoted_by" json:"promoted_by"`
+	CreatedAt  time.Time `gorm:"column:created_at;default:CURRENT_TIMESTAMP" json:"created_at"`
+
+	// 关联
+	Team *Team `gorm:"foreignKey:TeamID;references:team_id" json:"team,omitempty"`
+}
+
+// TableName GameStageTeam's table name
+func (*GameStageTeam) TableName() string {
+	return TableNameGameStageTeam
+}
@@ -14,6 +14,18 @@ type GameStage struct {
 	StageName string    `json:"stage_name"`
 	StartTime time.Time `json:"start_time"`
 	EndTime   time.Time `json:"end_time"`
+	// 这个阶段题目得分的倍率，0 表示不加权
+	ScoreMultiplier float64 `json:"score_multiplier"`
+	// 阶段结束后晋级到下一阶段的队伍数量，0 表示所有队伍都能参加下一阶段
+	PromoteTopN int64 `json:"promote_top_n"`
+}
+
+// Multiplier 阶段的得分倍率，没有设置的时候是 1
+func (s *GameStage) Multiplier() float64 {
+	if s.ScoreMultiplier <= 0 {
+		return 1
+	}
+	return s.ScoreMultiplier
 }
 
 type GameStages []GameStage
@@ -73,9 +85,45 @@ type Game struct {
 	FirstBloodReward  int64 `gorm:"column:first_blood_reward" json:"first_blood_reward"`
 	SecondBloodReward int64 `gorm:"column:second_blood_reward" json:"second_blood_reward"`
 	ThirdBloodReward  int64 `gorm:"column:third_blood_reward" json:"third_blood_reward"`
+
+	// 导出最终排行榜时排除没有提交 Writeup 的队伍
+	WpExcludeUnsubmitted bool `gorm:"column:wp_exclude_unsubmitted;not null;default:false" json:"wp_exclude_unsubmitted"`
+
+	// 封榜时间，之后选手只能看到封榜时的排行榜，管理员解除封榜之后公布最终排行榜
+	FreezeTime   *time.Time `gorm:"column:freeze_time" json:"freeze_time"`
+	UnfreezeTime *time.Time `gorm:"column:unfreeze_time" json:"unfreeze_time"`
 }
 
 // TableName Game's table name
 func (*Game) TableName() string {
 	return TableNameGame
 }
+
+// FindStage 按名字查找阶段，找不到返回 nil
+func (g *Game) FindStage(stageName string) *GameStage {
+	if g.Stages == nil {
+		return nil
+	}
+	for i := range *g.Stages {
+		if (*g.Stages)[i].StageName == stageName {
+			return &(*g.Stages)[i]
+		}
+	}
+	return nil
+}
+
+// StageMultiplier 题目所属阶段的得分倍率，不属于任何阶段的题目是 1
+func (g *Game) StageMultiplier(belongStage *string) float64 {
+	if belongStage == nil {
+		return 1
+	}
+	if stage := g.FindStage(*belongStage); stage != nil {
+		return stage.Multiplier()
+	}
+	return 1
+}
+
+// ScoreBoardFrozen 设置了封榜时间，已经到了封榜时间并且还没有解除封榜
+func (g *Game) ScoreBoardFrozen(now time.Time) bool {
+	return g.FreezeTime != nil && g.UnfreezeTime == nil && !now.Before(*g.FreezeTime)
+}
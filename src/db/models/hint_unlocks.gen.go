@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+)
+
+const TableNameHintUnlock = "hint_unlocks"
+
+// HintUnlock 队伍解锁付费提示的记录，Cost 记录的是解锁时的价格，之后修改提示价格不影响已经解锁的队伍
+type HintUnlock struct {
+	UnlockID    int64     `gorm:"column:unlock_id;primaryKey;autoIncrement" json:"unlock_id"`
+	GameID      int64     `gorm:"column:game_id;not null" json:"game_id"`
+	IngameID    int64     `gorm:"column:ingame_id;not null" json:"ingame_id"`
+	ChallengeID int64     `gorm:"column:challenge_id;not null" json:"challenge_id"`
+	TeamID      int64     `gorm:"column:team_id;not null" json:"team_id"`
+	HintID      string    `gorm:"column:hint_id;not null" json:"hint_id"`
+	Cost        float64   `gorm:"column:cost;not null" json:"cost"`
+	UnlockerID  string    `gorm:"column:unlocker_id;not null" json:"unlocker_id"`
+	UnlockTime  time.Time `gorm:"column:unlock_time;not null" json:"unlock_time"`
+
+	// 关联
+	Team      *Team      `gorm:"foreignKey:TeamID;references:team_id" json:"team,omitempty"`
+	Challenge *Challenge `gorm:"foreignKey:ChallengeID;references:challenge_id" json:"challenge,omitempty"`
+}
+
+// TableName 获取HintUnlock的表名
+func (*HintUnlock) TableName() string {
+	return TableNameHintUnlock
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+const TableNameProxyTrafficLog = "proxy_traffic_logs"
+
+const (
+	ProxyTransportTCP       = "tcp"
+	ProxyTransportWebSocket = "websocket"
+)
+
+// ProxyTrafficLog 平台代理转发的每条连接，连接关闭时写入
+type ProxyTrafficLog struct {
+	LogID           int64     `gorm:"column:log_id;primaryKey;autoIncrement" json:"log_id"`
+	GameID          int64     `gorm:"column:game_id;not null" json:"game_id"`
+	IngameID        int64     `gorm:"column:ingame_id;not null" json:"ingame_id"`
+	ChallengeID     int64     `gorm:"column:challenge_id;not null" json:"challenge_id"`
+	TeamID          int64     `gorm:"column:team_id;not null" json:"team_id"`
+	UserID          *string   `gorm:"column:user_id" json:"user_id"`
+	ContainerID     string    `gorm:"column:container_id;not null" json:"container_id"`
+	StaticContainer bool      `gorm:"column:static_container;not null" json:"static_container"`
+	ContainerName   string    `gorm:"column:container_name;not null" json:"container_name"`
+	PortName        string    `gorm:"column:port_name;not null" json:"port_name"`
+	Transport       string    `gorm:"column:transport;not null" json:"transport"`
+	ClientIP        *string   `gorm:"column:client_ip" json:"client_ip"`
+	TargetAddress   string    `gorm:"column:target_address;not null" json:"target_address"`
+	BytesUp         int64     `gorm:"column:bytes_up;not null" json:"bytes_up"`
+	BytesDown       int64     `gorm:"column:bytes_down;not null" json:"bytes_down"`
+	StartTime       time.Time `gorm:"column:start_time;not null" json:"start_time"`
+	EndTime         time.Time `gorm:"column:end_time;not null" json:"end_time"`
+	ErrorMessage    *string   `gorm:"column:error_message" json:"error_message"`
+}
+
+// TableName ProxyTrafficLog's table name
+func (*ProxyTrafficLog) TableName() string {
+	return TableNameProxyTrafficLog
+}
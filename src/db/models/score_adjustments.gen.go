@@ -16,6 +16,7 @@ const (
 	AdjustmentTypeCheat  AdjustmentType = "cheat"  // 作弊扣分
 	AdjustmentTypeReward AdjustmentType = "reward" // 奖励加分
 	AdjustmentTypeOther  AdjustmentType = "other"  // 其他调整
+	AdjustmentTypeHint   AdjustmentType = "hint"   // 解锁付费提示扣分，由 hint_unlocks 计算，不写入 score_adjustments
 )
 
 func (e AdjustmentType) Value() (driver.Value, error) {
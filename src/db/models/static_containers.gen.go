@@ -0,0 +1,35 @@
+package models
+
+import (
+	k8stool "a1ctf/src/utils/k8s_tool"
+	"time"
+)
+
+const TableNameStaticContainer = "static_containers"
+
+// StaticContainer STATIC_CONTAINER 题目在比赛里共享的唯一实例，所有队伍看到同一份 expose_ports
+//
+// enabled 为 false 表示管理员手动关闭了实例，此时即使题目可见也不会自动启动
+type StaticContainer struct {
+	ContainerID          string               `gorm:"column:container_id;primaryKey" json:"container_id"`
+	GameID               int64                `gorm:"column:game_id;not null" json:"game_id"`
+	ChallengeID          int64                `gorm:"column:challenge_id;not null" json:"challenge_id"`
+	InGameID             int64                `gorm:"column:ingame_id;not null" json:"ingame_id"`
+	GameChallenge        GameChallenge        `gorm:"foreignKey:InGameID;references:ingame_id" json:"-"`
+	Challenge            Challenge            `gorm:"foreignKey:ChallengeID;references:challenge_id" json:"-"`
+	ChallengeName        string               `gorm:"column:challenge_name;not null" json:"challenge_name"`
+	ContainerConfig      k8stool.A1Containers `gorm:"column:container_config;not null" json:"container_config"`
+	ContainerExposeInfos ContainerExposeInfos `gorm:"column:expose_ports;not null" json:"expose_ports"`
+	ContainerStatus      ContainerStatus      `gorm:"column:container_status;not null" json:"container_status"`
+	Enabled              bool                 `gorm:"column:enabled;not null;default:true" json:"enabled"`
+	StartTime            time.Time            `gorm:"column:start_time;not null" json:"start_time"`
+	UnhealthySince       *time.Time           `gorm:"column:unhealthy_since" json:"unhealthy_since"`
+	RestartCount         int32                `gorm:"column:restart_count;not null;default:0" json:"restart_count"`
+	LastRestartTime      *time.Time           `gorm:"column:last_restart_time" json:"last_restart_time"`
+	LastError            *string              `gorm:"column:last_error" json:"last_error"`
+}
+
+// TableName StaticContainer's table name
+func (*StaticContainer) TableName() string {
+	return TableNameStaticContainer
+}
@@ -75,6 +75,7 @@ const (
 	ResourceTypeSystem    = "SYSTEM"
 	ResourceTypeScore     = "SCORE"
 	ResourceTypeFile      = "FILE"
+	ResourceTypeWriteup   = "WRITEUP"
 )
 
 // 操作类型常量
@@ -104,11 +105,15 @@ const (
 	ActionContainerDeleting  = "CONTAINER_DELETING"
 	ActionContainerDeleted   = "CONTAINER_DELETED"
 	ActionContainerFailed    = "CONTAINER_FAILED"
+	// 垃圾回收发现的后端和数据库不一致
+	ActionContainerOrphanDeleted = "CONTAINER_ORPHAN_DELETED"
+	ActionContainerDrift         = "CONTAINER_DRIFT"
 
 	// 用户请求
 	ActionStartContainer  = "START_CONTAINER"
 	ActionStopContainer   = "STOP_CONTAINER"
 	ActionExtendContainer = "EXTEND_CONTAINER"
+	ActionResetContainer  = "RESET_CONTAINER"
 
 	ActionView      = "VIEW"
 	ActionTransfer  = "TRANSFER"
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+const TableNameTeamAttachment = "team_attachments"
+
+// TeamAttachment 动态附件为每个队伍生成的文件，source_hash 变化（模板、脚本、flag 变了）时需要重新生成
+type TeamAttachment struct {
+	AttachmentID int64     `gorm:"column:attachment_id;primaryKey;autoIncrement" json:"attachment_id"`
+	GameID       int64     `gorm:"column:game_id;not null" json:"game_id"`
+	ChallengeID  int64     `gorm:"column:challenge_id;not null" json:"challenge_id"`
+	TeamID       int64     `gorm:"column:team_id;not null" json:"team_id"`
+	AttachIndex  int       `gorm:"column:attach_index;not null" json:"attach_index"`
+	FileID       string    `gorm:"column:file_id;not null" json:"file_id"`
+	SourceHash   string    `gorm:"column:source_hash;not null" json:"source_hash"`
+	CreateTime   time.Time `gorm:"column:create_time;not null" json:"create_time"`
+
+	// 关联
+	Upload *Upload `gorm:"foreignKey:FileID;references:file_id" json:"upload,omitempty"`
+}
+
+// TableName 获取TeamAttachment的表名
+func (*TeamAttachment) TableName() string {
+	return TableNameTeamAttachment
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"time"
+)
+
+const TableNameWriteup = "writeups"
+
+type WriteupReviewStatus string
+
+const (
+	WriteupPending  WriteupReviewStatus = "Pending"  // 已提交，等待审核
+	WriteupApproved WriteupReviewStatus = "Approved" // 审核通过
+	WriteupRejected WriteupReviewStatus = "Rejected" // 审核不通过
+)
+
+func (e WriteupReviewStatus) Value() (driver.Value, error) {
+	return string(e), nil
+}
+
+func (e *WriteupReviewStatus) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		*e = WriteupReviewStatus(v)
+	case []byte:
+		*e = WriteupReviewStatus(v)
+	case nil:
+		*e = ""
+	default:
+		return errors.New("cannot scan value into WriteupReviewStatus")
+	}
+	return nil
+}
+
+// Writeup 队伍提交的 Writeup，每个队伍在一场比赛中只保留最后一次提交
+type Writeup struct {
+	WriteupID     int64               `gorm:"column:writeup_id;primaryKey;autoIncrement" json:"writeup_id"`
+	GameID        int64               `gorm:"column:game_id;not null" json:"game_id"`
+	TeamID        int64               `gorm:"column:team_id;not null" json:"team_id"`
+	FileID        string              `gorm:"column:file_id;not null" json:"file_id"`
+	SubmiterID    string              `gorm:"column:submiter_id;not null" json:"submiter_id"`
+	SubmitTime    time.Time           `gorm:"column:submit_time;not null" json:"submit_time"`
+	ReviewStatus  WriteupReviewStatus `gorm:"column:review_status;not null;default:Pending" json:"review_status"`
+	ReviewComment *string             `gorm:"column:review_comment" json:"review_comment"`
+	ReviewerID    *string             `gorm:"column:reviewer_id" json:"reviewer_id"`
+	ReviewTime    *time.Time          `gorm:"column:review_time" json:"review_time"`
+
+	// 关联
+	Team     *Team   `gorm:"foreignKey:TeamID;references:team_id" json:"team,omitempty"`
+	Upload   *Upload `gorm:"foreignKey:FileID;references:file_id" json:"upload,omitempty"`
+	Submiter *User   `gorm:"foreignKey:SubmiterID;references:user_id" json:"submiter,omitempty"`
+}
+
+// TableName 获取Writeup的表名
+func (*Writeup) TableName() string {
+	return TableNameWriteup
+}
@@ -0,0 +1,467 @@
+package jobs
+
+import (
+	"a1ctf/src/db/models"
+	dbtool "a1ctf/src/utils/db_tool"
+	"a1ctf/src/utils/zaphelper"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultCloseSolveWindow   = 30 * time.Second
+	defaultMinCloseSolves     = 3
+	defaultScanAfterGameEnded = time.Hour
+
+	// team hash 太短的话容易误报
+	minTeamHashLength = 8
+)
+
+type teamPair struct {
+	TeamA int64
+	TeamB int64
+}
+
+func newTeamPair(a int64, b int64) teamPair {
+	if a > b {
+		a, b = b, a
+	}
+	return teamPair{TeamA: a, TeamB: b}
+}
+
+type teamIPRow struct {
+	TeamID int64
+	IP     string
+}
+
+func closeSolveWindow() time.Duration {
+	window := viper.GetDuration("anticheat-settings.close-solve-window")
+	if window <= 0 {
+		return defaultCloseSolveWindow
+	}
+	return window
+}
+
+func minCloseSolves() int {
+	count := viper.GetInt("anticheat-settings.min-close-solves")
+	if count <= 0 {
+		return defaultMinCloseSolves
+	}
+	return count
+}
+
+func scanAfterGameEnded() time.Duration {
+	duration := viper.GetDuration("anticheat-settings.scan-after-game-ended")
+	if duration <= 0 {
+		return defaultScanAfterGameEnded
+	}
+	return duration
+}
+
+type correlationCheatKey struct {
+	TeamID       int64
+	CheatType    models.CheatType
+	RelevantTeam int64
+}
+
+// 一场比赛一轮关联分析的结果。同一对队伍同一种类型只保留一条记录，
+// 开始时一次性读出已有的记录，和新的结果比较之后只批量写入有变化的记录
+type correlationCheatBatch struct {
+	gameID   int64
+	existing map[correlationCheatKey]models.Cheat
+	changed  []models.Cheat
+}
+
+func loadCorrelationCheats(gameID int64) (*correlationCheatBatch, error) {
+	var cheats []models.Cheat
+	if err := dbtool.DB().Where("game_id = ? AND cheat_type IN ?", gameID, []models.CheatType{models.CheatSharedIP, models.CheatCloseSolveTime}).Find(&cheats).Error; err != nil {
+		return nil, err
+	}
+
+	batch := &correlationCheatBatch{
+		gameID:   gameID,
+		existing: make(map[correlationCheatKey]models.Cheat, len(cheats)),
+		changed:  make([]models.Cheat, 0),
+	}
+	for _, cheat := range cheats {
+		batch.existing[correlationCheatKey{
+			TeamID:       cheat.TeamID,
+			CheatType:    cheat.CheatType,
+			RelevantTeam: cheat.ExtraData.RelevantTeam,
+		}] = cheat
+	}
+
+	return batch, nil
+}
+
+// 证据和置信度都没有变化的记录不重新写入，有变化时 cheat_time 更新为最新的证据时间
+func (b *correlationCheatBatch) add(teamID int64, relevantTeam models.Team, cheatType models.CheatType, confidence float64, extraData models.CheatExtraData, cheatTime time.Time) {
+	extraData.RelevantTeam = relevantTeam.TeamID
+	extraData.RelevantTeamName = relevantTeam.TeamName
+
+	key := correlationCheatKey{
+		TeamID:       teamID,
+		CheatType:    cheatType,
+		RelevantTeam: relevantTeam.TeamID,
+	}
+
+	cheat, ok := b.existing[key]
+	if ok {
+		if cheat.Confidence == confidence && reflect.DeepEqual(cheat.ExtraData, extraData) {
+			return
+		}
+	} else {
+		cheat = models.Cheat{
+			CheatID:   uuid.NewString(),
+			CheatType: cheatType,
+			GameID:    b.gameID,
+			TeamID:    teamID,
+		}
+	}
+
+	cheat.ExtraData = extraData
+	cheat.Confidence = confidence
+	cheat.CheatTime = cheatTime
+
+	b.existing[key] = cheat
+	b.changed = append(b.changed, cheat)
+}
+
+func (b *correlationCheatBatch) save() {
+	if len(b.changed) == 0 {
+		return
+	}
+
+	if err := dbtool.DB().Omit(clause.Associations).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "cheat_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"extra_data", "confidence", "cheat_time"}),
+	}).CreateInBatches(b.changed, 200).Error; err != nil {
+		zaphelper.Logger.Error("Failed to save cheat info for game ", zap.Error(err), zap.Int64("game_id", b.gameID), zap.Int("count", len(b.changed)))
+	}
+}
+
+// 查询比赛中队伍使用过的 IP，key 是 IP，value 是 team_id -> 来源
+func collectGameTeamIPs(game models.Game, teams []models.Team) (map[string]map[int64]map[string]bool, error) {
+	ipMap := make(map[string]map[int64]map[string]bool)
+	addIP := func(ip string, teamID int64, source string) {
+		ip = strings.TrimSpace(ip)
+		if ip == "" {
+			return
+		}
+		if _, ok := ipMap[ip]; !ok {
+			ipMap[ip] = make(map[int64]map[string]bool)
+		}
+		if _, ok := ipMap[ip][teamID]; !ok {
+			ipMap[ip][teamID] = make(map[string]bool)
+		}
+		ipMap[ip][teamID][source] = true
+	}
+
+	var judgeIPs []teamIPRow
+	if err := dbtool.DB().Model(&models.Judge{}).Select("DISTINCT team_id, submiter_ip AS ip").Where("game_id = ? AND submiter_ip IS NOT NULL", game.GameID).Scan(&judgeIPs).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range judgeIPs {
+		addIP(row.IP, row.TeamID, "judge")
+	}
+
+	var containerIPs []teamIPRow
+	if err := dbtool.DB().Model(&models.Container{}).Select("DISTINCT team_id, submiter_ip AS ip").Where("game_id = ? AND submiter_ip IS NOT NULL", game.GameID).Scan(&containerIPs).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range containerIPs {
+		addIP(row.IP, row.TeamID, "container")
+	}
+
+	// 队员的登录 IP 和注册 IP
+	memberTeam := make(map[string]int64)
+	memberIDs := make([]string, 0)
+	for _, team := range teams {
+		for _, member := range team.TeamMembers {
+			memberTeam[member] = team.TeamID
+			memberIDs = append(memberIDs, member)
+		}
+	}
+
+	if len(memberIDs) > 0 {
+		var users []models.User
+		if err := dbtool.DB().Select("user_id", "last_login_ip", "register_ip").Where("user_id IN ?", memberIDs).Find(&users).Error; err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			if user.LastLoginIP != nil {
+				addIP(*user.LastLoginIP, memberTeam[user.UserID], "login")
+			}
+			if user.RegisterIP != nil {
+				addIP(*user.RegisterIP, memberTeam[user.UserID], "register")
+			}
+		}
+	}
+
+	return ipMap, nil
+}
+
+// 检查不同队伍是否使用了相同的 IP
+// 只有登录 / 注册 IP 重合的时候置信度比较低（可能是同一个校园网出口），比赛中的提交和靶机操作也重合时置信度更高
+func detectSharedIP(game models.Game, teams []models.Team, teamMap map[int64]models.Team, batch *correlationCheatBatch) {
+	ipMap, err := collectGameTeamIPs(game, teams)
+	if err != nil {
+		zaphelper.Logger.Error("Failed to collect team ips for game ", zap.Error(err), zap.Int64("game_id", game.GameID))
+		return
+	}
+
+	type sharedInfo struct {
+		IPs        []string
+		Sources    map[string]bool
+		InGameBoth bool
+	}
+
+	pairs := make(map[teamPair]*sharedInfo)
+	for ip, teamSources := range ipMap {
+		if len(teamSources) < 2 {
+			continue
+		}
+
+		teamIDs := make([]int64, 0, len(teamSources))
+		for teamID := range teamSources {
+			if _, ok := teamMap[teamID]; ok {
+				teamIDs = append(teamIDs, teamID)
+			}
+		}
+
+		for i := 0; i < len(teamIDs); i++ {
+			for j := i + 1; j < len(teamIDs); j++ {
+				pair := newTeamPair(teamIDs[i], teamIDs[j])
+				info, ok := pairs[pair]
+				if !ok {
+					info = &sharedInfo{Sources: make(map[string]bool)}
+					pairs[pair] = info
+				}
+				info.IPs = append(info.IPs, ip)
+
+				inGame := func(sources map[string]bool) bool {
+					return sources["judge"] || sources["container"]
+				}
+				if inGame(teamSources[teamIDs[i]]) && inGame(teamSources[teamIDs[j]]) {
+					info.InGameBoth = true
+				}
+				for _, teamID := range []int64{teamIDs[i], teamIDs[j]} {
+					for source := range teamSources[teamID] {
+						info.Sources[source] = true
+					}
+				}
+			}
+		}
+	}
+
+	now := time.Now().UTC()
+	for pair, info := range pairs {
+		confidence := 0.4
+		if info.InGameBoth {
+			confidence = 0.7
+		}
+		confidence = math.Min(0.95, confidence+0.1*float64(len(info.IPs)-1))
+
+		sort.Strings(info.IPs)
+		sources := make([]string, 0, len(info.Sources))
+		for source := range info.Sources {
+			sources = append(sources, source)
+		}
+		sort.Strings(sources)
+
+		extraData := models.CheatExtraData{
+			SharedIPs: info.IPs,
+			IPSources: sources,
+		}
+
+		batch.add(pair.TeamA, teamMap[pair.TeamB], models.CheatSharedIP, confidence, extraData, now)
+		batch.add(pair.TeamB, teamMap[pair.TeamA], models.CheatSharedIP, confidence, extraData, now)
+	}
+}
+
+// 检查两个队伍是否多次在很短的时间内先后解出同一道题
+func detectCloseSolveTime(game models.Game, teamMap map[int64]models.Team, batch *correlationCheatBatch) {
+	var solves []models.Solve
+	if err := dbtool.DB().Where("game_id = ? AND solve_status = ?", game.GameID, models.SolveCorrect).Order("solve_time ASC").Find(&solves).Error; err != nil {
+		zaphelper.Logger.Error("Failed to load solves for game ", zap.Error(err), zap.Int64("game_id", game.GameID))
+		return
+	}
+
+	solvesByChallenge := make(map[int64][]models.Solve)
+	for _, solve := range solves {
+		if _, ok := teamMap[solve.TeamID]; !ok {
+			continue
+		}
+		solvesByChallenge[solve.IngameID] = append(solvesByChallenge[solve.IngameID], solve)
+	}
+
+	type closeInfo struct {
+		Challenges []int64
+		Deltas     []int64
+		LastTime   time.Time
+	}
+
+	// 按题目顺序遍历，保证每次生成的证据顺序一致，没有变化的记录不会被重复写入
+	ingameIDs := make([]int64, 0, len(solvesByChallenge))
+	for ingameID := range solvesByChallenge {
+		ingameIDs = append(ingameIDs, ingameID)
+	}
+	sort.Slice(ingameIDs, func(i, j int) bool { return ingameIDs[i] < ingameIDs[j] })
+
+	window := closeSolveWindow()
+	pairs := make(map[teamPair]*closeInfo)
+	for _, ingameID := range ingameIDs {
+		challengeSolves := solvesByChallenge[ingameID]
+		for i := 0; i < len(challengeSolves); i++ {
+			for j := i + 1; j < len(challengeSolves); j++ {
+				delta := challengeSolves[j].SolveTime.Sub(challengeSolves[i].SolveTime)
+				if delta > window {
+					break
+				}
+
+				pair := newTeamPair(challengeSolves[i].TeamID, challengeSolves[j].TeamID)
+				info, ok := pairs[pair]
+				if !ok {
+					info = &closeInfo{}
+					pairs[pair] = info
+				}
+				info.Challenges = append(info.Challenges, challengeSolves[i].ChallengeID)
+				info.Deltas = append(info.Deltas, int64(delta.Seconds()))
+				if challengeSolves[j].SolveTime.After(info.LastTime) {
+					info.LastTime = challengeSolves[j].SolveTime
+				}
+			}
+		}
+	}
+
+	minCount := minCloseSolves()
+	for pair, info := range pairs {
+		if len(info.Challenges) < minCount {
+			continue
+		}
+
+		// 刚好达到阈值时 0.6，每多一道题增加 0.1
+		confidence := math.Min(0.95, 0.6+0.1*float64(len(info.Challenges)-minCount))
+
+		extraData := models.CheatExtraData{
+			RelevantChallenges: info.Challenges,
+			SolveDeltas:        info.Deltas,
+		}
+
+		batch.add(pair.TeamA, teamMap[pair.TeamB], models.CheatCloseSolveTime, confidence, extraData, info.LastTime)
+		batch.add(pair.TeamB, teamMap[pair.TeamA], models.CheatCloseSolveTime, confidence, extraData, info.LastTime)
+	}
+}
+
+// 检查错误提交里是否包含别的队伍的 team hash，每条提交只记录一次
+func detectSubmitSomeonesTeamHash(game models.Game, teams []models.Team, teamMap map[int64]models.Team) {
+	var judges []models.Judge
+	if err := dbtool.DB().Where("game_id = ? AND judge_status = ?", game.GameID, models.JudgeWA).Find(&judges).Error; err != nil {
+		zaphelper.Logger.Error("Failed to load judges for game ", zap.Error(err), zap.Int64("game_id", game.GameID))
+		return
+	}
+
+	if len(judges) == 0 {
+		return
+	}
+
+	var recordedJudgeIDs []string
+	if err := dbtool.DB().Model(&models.Cheat{}).Where("game_id = ? AND cheat_type = ? AND judge_id IS NOT NULL", game.GameID, models.CheatType(models.CheatSubmitSomeonesTeamHash)).Pluck("judge_id", &recordedJudgeIDs).Error; err != nil {
+		zaphelper.Logger.Error("Failed to load cheats for game ", zap.Error(err), zap.Int64("game_id", game.GameID))
+		return
+	}
+
+	recorded := make(map[string]bool, len(recordedJudgeIDs))
+	for _, judgeID := range recordedJudgeIDs {
+		recorded[judgeID] = true
+	}
+
+	for _, judge := range judges {
+		if recorded[judge.JudgeID] {
+			continue
+		}
+		if _, ok := teamMap[judge.TeamID]; !ok {
+			continue
+		}
+
+		for _, team := range teams {
+			if team.TeamID == judge.TeamID || len(team.TeamHash) < minTeamHashLength {
+				continue
+			}
+			if !strings.Contains(judge.JudgeContent, team.TeamHash) {
+				continue
+			}
+
+			cheat := models.Cheat{
+				CheatID:     uuid.NewString(),
+				CheatType:   models.CheatSubmitSomeonesTeamHash,
+				GameID:      judge.GameID,
+				IngameID:    &judge.IngameID,
+				ChallengeID: &judge.ChallengeID,
+				TeamID:      judge.TeamID,
+				JudgeID:     &judge.JudgeID,
+				SubmiterID:  &judge.SubmiterID,
+				CheatTime:   judge.JudgeTime,
+				SubmiterIP:  judge.SubmiterIP,
+				ExtraData: models.CheatExtraData{
+					RelevantTeam:     team.TeamID,
+					RelevantTeamName: team.TeamName,
+				},
+				Confidence: 0.9,
+			}
+
+			if err := dbtool.DB().Create(&cheat).Error; err != nil {
+				zaphelper.Logger.Error("Failed to save cheat info for game ", zap.Error(err), zap.Int64("game_id", game.GameID), zap.Any("cheat_data", cheat))
+			}
+			break
+		}
+	}
+}
+
+// AntiCheatCorrelationJob 定时对进行中（以及刚结束）的比赛做跨队伍的关联分析
+func AntiCheatCorrelationJob() {
+	now := time.Now().UTC()
+
+	var games []models.Game
+	if err := dbtool.DB().Where("start_time <= ? AND end_time >= ?", now, now.Add(-scanAfterGameEnded())).Find(&games).Error; err != nil {
+		zaphelper.Logger.Error("Failed to load active games", zap.Error(err))
+		return
+	}
+
+	for _, game := range games {
+		var teams []models.Team
+		if err := dbtool.DB().Where("game_id = ? AND team_type = ? AND team_status = ?", game.GameID, models.TeamTypePlayer, models.ParticipateApproved).Find(&teams).Error; err != nil {
+			zaphelper.Logger.Error("Failed to load teams for game ", zap.Error(err), zap.Int64("game_id", game.GameID))
+			continue
+		}
+
+		if len(teams) < 2 {
+			continue
+		}
+
+		teamMap := make(map[int64]models.Team, len(teams))
+		for _, team := range teams {
+			teamMap[team.TeamID] = team
+		}
+
+		batch, err := loadCorrelationCheats(game.GameID)
+		if err != nil {
+			zaphelper.Logger.Error("Failed to load cheats for game ", zap.Error(err), zap.Int64("game_id", game.GameID))
+			continue
+		}
+
+		detectSharedIP(game, teams, teamMap, batch)
+		detectCloseSolveTime(game, teamMap, batch)
+		batch.save()
+
+		detectSubmitSomeonesTeamHash(game, teams, teamMap)
+	}
+}
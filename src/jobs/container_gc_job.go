@@ -0,0 +1,208 @@
+package jobs
+
+import (
+	"a1ctf/src/db/models"
+	"a1ctf/src/modules/monitoring"
+	"a1ctf/src/tasks"
+	dbtool "a1ctf/src/utils/db_tool"
+	k8stool "a1ctf/src/utils/k8s_tool"
+	"fmt"
+	"time"
+
+	"a1ctf/src/utils/zaphelper"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+const defaultContainerGCGracePeriod = 2 * time.Minute
+
+// 刚创建的资源可能还没来得及写数据库，超过这个时间才会被当成孤儿
+func containerGCGracePeriod() time.Duration {
+	gracePeriod := viper.GetDuration("container-gc.grace-period")
+	if gracePeriod <= 0 {
+		return defaultContainerGCGracePeriod
+	}
+	return gracePeriod
+}
+
+// 数据库里认为应该存在的实例
+func expectedInstances() (map[string]bool, []models.Container, error) {
+	expected := make(map[string]bool)
+
+	var containers []models.Container
+	if err := dbtool.DB().Where("container_status IN ?", []models.ContainerStatus{
+		models.ContainerQueueing,
+		models.ContainerStarting,
+		models.ContainerRunning,
+		models.ContainerStopping,
+	}).Find(&containers).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to load containers: %w", err)
+	}
+	for _, container := range containers {
+		expected[container.InstanceName()] = true
+	}
+
+	// 静态容器的重启和恢复由静态容器任务负责，这里只要不是关闭状态就保留
+	var staticContainers []models.StaticContainer
+	if err := dbtool.DB().Where("container_status != ?", models.ContainerStopped).Find(&staticContainers).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to load static containers: %w", err)
+	}
+	for _, staticContainer := range staticContainers {
+		expected[fmt.Sprintf("cs-%d", staticContainer.InGameID)] = true
+	}
+
+	return expected, containers, nil
+}
+
+// 被已经关闭的容器领取过的预热实例
+func releasedWarmPods(instances []k8stool.Instance) (map[string]bool, error) {
+	names := make([]string, 0)
+	for _, instance := range instances {
+		if k8stool.IsWarmPod(instance.Name) {
+			names = append(names, instance.Name)
+		}
+	}
+
+	released := make(map[string]bool)
+	if len(names) == 0 {
+		return released, nil
+	}
+
+	var containers []models.Container
+	if err := dbtool.DB().Select("pod_name").Where("pod_name IN ? AND container_status IN ?", names, []models.ContainerStatus{
+		models.ContainerStopped,
+		models.ContainerError,
+	}).Find(&containers).Error; err != nil {
+		return nil, err
+	}
+	for _, container := range containers {
+		released[container.InstanceName()] = true
+	}
+
+	return released, nil
+}
+
+// ContainerGarbageCollect 对比后端里的资源和数据库记录
+//
+//   - 没有对应记录，或者记录已经停止的实例资源是孤儿，超过宽限期之后删除
+//   - 数据库里运行中的实例在后端找不到，把状态改成已停止，选手可以重新启动
+func ContainerGarbageCollect() {
+	start := time.Now()
+	defer monitoring.RecordContainerGC(start)
+
+	// 先列出后端资源再查询数据库，保证列出来的资源对应的记录已经写入
+	resources, err := k8stool.ListResources()
+	if err != nil {
+		zaphelper.Logger.Error("Failed to list challenge resources", zap.Error(err))
+		return
+	}
+
+	instances, err := k8stool.ListInstances()
+	if err != nil {
+		zaphelper.Logger.Error("Failed to list pods", zap.Error(err))
+		return
+	}
+
+	expected, containers, err := expectedInstances()
+	if err != nil {
+		zaphelper.Logger.Error("Failed to load expected instances", zap.Error(err))
+		return
+	}
+
+	// 没有被领取的预热实例由预热池任务管理，领取之后容器已经关闭的才回收
+	released, err := releasedWarmPods(instances)
+	if err != nil {
+		zaphelper.Logger.Error("Failed to load claimed warm pods", zap.Error(err))
+		return
+	}
+	for _, instance := range instances {
+		if k8stool.IsWarmPod(instance.Name) && !released[instance.Name] {
+			expected[instance.Name] = true
+		}
+	}
+
+	gracePeriod := containerGCGracePeriod()
+	now := time.Now()
+
+	orphans := make(map[string]int)
+	deleted := make([]string, 0)
+	failed := make([]string, 0)
+	for _, resource := range resources {
+		if expected[resource.Instance] || now.Sub(resource.CreatedAt) < gracePeriod {
+			continue
+		}
+
+		orphans[resource.Kind]++
+
+		err := k8stool.DeleteResource(resource)
+		monitoring.RecordContainerOrphanDeleted(resource.Kind, err)
+		name := fmt.Sprintf("%s/%s", resource.Kind, resource.Name)
+		if err != nil {
+			zaphelper.Logger.Error("Failed to delete orphaned resource", zap.Error(err), zap.String("kind", resource.Kind), zap.String("name", resource.Name))
+			failed = append(failed, name)
+			continue
+		}
+		deleted = append(deleted, name)
+	}
+
+	monitoring.RecordContainerOrphans(orphans)
+
+	if len(deleted) > 0 || len(failed) > 0 {
+		zaphelper.Logger.Info("Deleted orphaned challenge resources", zap.Strings("deleted", deleted), zap.Strings("failed", failed))
+
+		var logErr error
+		if len(failed) > 0 {
+			logErr = fmt.Errorf("failed to delete %d resources", len(failed))
+		}
+		tasks.LogSystemOperation(models.ActionContainerOrphanDeleted, map[string]interface{}{
+			"deleted": deleted,
+			"failed":  failed,
+		}, logErr)
+	}
+
+	running := make(map[string]bool, len(instances))
+	for _, instance := range instances {
+		running[instance.Name] = true
+	}
+
+	for i := range containers {
+		container := &containers[i]
+		podName := container.InstanceName()
+		if container.ContainerStatus != models.ContainerRunning || running[podName] {
+			continue
+		}
+
+		// 实例是在查询数据库之前列出的，刚启动的容器可能在这之间才变成 Running
+		if now.Sub(container.StartTime) < gracePeriod {
+			continue
+		}
+
+		// 再确认一次状态，避免覆盖掉这段时间里的其他修改
+		result := dbtool.DB().Model(&models.Container{}).
+			Where("container_id = ? AND container_status = ?", container.ContainerID, models.ContainerRunning).
+			Update("container_status", models.ContainerStopped)
+		if result.Error != nil {
+			zaphelper.Logger.Error("failed to update container status", zap.Error(result.Error), zap.String("container_id", container.ContainerID))
+			continue
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		monitoring.RecordContainerDrift(string(models.ContainerRunning), string(models.ContainerStopped))
+		zaphelper.Logger.Warn("Running container has no instance", zap.String("container_id", container.ContainerID), zap.String("pod_name", podName))
+
+		tasks.LogContainerOperation(nil, nil, models.ActionContainerDrift, container.ContainerID, map[string]interface{}{
+			"game_id":        container.GameID,
+			"team_id":        container.TeamID,
+			"team_hash":      container.TeamHash,
+			"challenge_name": container.ChallengeName,
+			"ingame_id":      container.InGameID,
+			"pod_name":       podName,
+			"container_id":   container.ContainerID,
+			"from":           models.ContainerRunning,
+			"to":             models.ContainerStopped,
+		}, fmt.Errorf("instance not found in container backend"))
+	}
+}
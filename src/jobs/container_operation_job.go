@@ -5,6 +5,7 @@ import (
 	"a1ctf/src/tasks"
 	dbtool "a1ctf/src/utils/db_tool"
 	k8stool "a1ctf/src/utils/k8s_tool"
+	proxytool "a1ctf/src/utils/proxy_tool"
 	"fmt"
 	"log"
 	"strconv"
@@ -13,7 +14,6 @@ import (
 	"a1ctf/src/utils/zaphelper"
 
 	"go.uber.org/zap"
-	v1 "k8s.io/api/core/v1"
 )
 
 func findExistContainer(containers []models.Container, teamHash string, inGameID int64) *models.Container {
@@ -25,49 +25,108 @@ func findExistContainer(containers []models.Container, teamHash string, inGameID
 	return nil
 }
 
-func findExistPod(podList []v1.Pod, teamHash string, inGameID int64) *v1.Pod {
-	for _, pod := range podList {
-		if pod.Labels["team_hash"] == teamHash && pod.Labels["ingame_id"] == fmt.Sprintf("%d", inGameID) {
-			return &pod
+func findExistPod(instances []k8stool.Instance, teamHash string, inGameID int64) *k8stool.Instance {
+	for _, instance := range instances {
+		if instance.Labels["team_hash"] == teamHash && instance.Labels["ingame_id"] == fmt.Sprintf("%d", inGameID) {
+			return &instance
 		}
 	}
 	return nil
 }
 
-func getContainerPorts(podInfo k8stool.PodInfo, task *models.Container) error {
+// 预热实例没有队伍标签，通过容器记录里的实例名找到领取它的容器
+func findClaimedContainer(containers []models.Container, podName string) *models.Container {
+	for _, container := range containers {
+		if container.PodName != nil && *container.PodName == podName {
+			return &container
+		}
+	}
+	return nil
+}
+
+func findInstance(instances []k8stool.Instance, name string) *k8stool.Instance {
+	for _, instance := range instances {
+		if instance.Name == name {
+			return &instance
+		}
+	}
+	return nil
+}
+
+// 根据 Service 分配的 NodePort 生成每个容器的暴露端口信息，HTTP 端口返回域名
+func collectExposeInfos(podInfo k8stool.PodInfo, containerConfig k8stool.A1Containers) (models.ContainerExposeInfos, error) {
 	ports, err := k8stool.GetPodPorts(&podInfo)
 	if err != nil {
-		return fmt.Errorf("getContainerPorts error: %w", err)
-	} else {
-		for index, container := range task.ContainerConfig {
-			for _, expose_port := range container.ExposePorts {
-				port_name := fmt.Sprintf("%d-%s", index, expose_port.Name)
+		return nil, err
+	}
 
-				expose_ports := make([]models.ExposePort, 0)
+	httpHosts := k8stool.PodHTTPHosts(&podInfo)
 
-				for _, port := range *ports {
-					if port.Name == port_name {
+	exposeInfos := make(models.ContainerExposeInfos, 0)
+	for index, container := range containerConfig {
+		for _, expose_port := range container.ExposePorts {
+			// 实例内部的端口不返回给选手
+			if expose_port.Internal {
+				continue
+			}
 
-						address, ok := k8stool.NodeAddressMap[port.NodeName]
-						if !ok {
-							address = port.NodeName
-						}
+			port_name := fmt.Sprintf("%d-%s", index, expose_port.Name)
 
-						expose_ports = append(expose_ports, models.ExposePort{
-							PortName: expose_port.Name,
-							Port:     port.NodePort,
-							IP:       address,
-						})
-					}
-				}
+			expose_ports := make([]models.ExposePort, 0)
 
-				task.ContainerExposeInfos = append(task.ContainerExposeInfos, models.ContainerExposeInfo{
+			// Web 题目通过域名访问
+			if host, ok := httpHosts[port_name]; ok {
+				expose_ports = append(expose_ports, models.ExposePort{
+					PortName: expose_port.Name,
+					URL:      k8stool.HTTPURL(host),
+				})
+
+				exposeInfos = append(exposeInfos, models.ContainerExposeInfo{
 					ContainerName: container.Name,
 					ExposePorts:   expose_ports,
 				})
+				continue
+			}
+
+			for _, port := range *ports {
+				if port.Name == port_name {
+
+					address, ok := k8stool.NodeAddressMap[port.NodeName]
+					if !ok {
+						address = port.NodeName
+					}
+
+					expose_ports = append(expose_ports, models.ExposePort{
+						PortName: expose_port.Name,
+						Port:     port.NodePort,
+						IP:       address,
+						Protocol: expose_port.PortProtocol(),
+					})
+				}
 			}
+
+			exposeInfos = append(exposeInfos, models.ContainerExposeInfo{
+				ContainerName: container.Name,
+				ExposePorts:   expose_ports,
+			})
+		}
+	}
+
+	return exposeInfos, nil
+}
+
+func getContainerPorts(podInfo k8stool.PodInfo, task *models.Container) error {
+	exposeInfos, err := collectExposeInfos(podInfo, task.ContainerConfig)
+	if err != nil {
+		return fmt.Errorf("getContainerPorts error: %w", err)
+	} else {
+		// 开启平台代理后选手只能通过网关访问实例
+		if proxytool.Enabled() {
+			exposeInfos = proxytool.ApplyEndpoints(exposeInfos, proxytool.TargetContainer, task.ContainerID, task.TeamID)
 		}
 
+		task.ContainerExposeInfos = append(task.ContainerExposeInfos, exposeInfos...)
+
 		if err := dbtool.DB().Model(&task).Updates(map[string]interface{}{
 			"container_status": models.ContainerRunning,
 			"expose_ports":     task.ContainerExposeInfos,
@@ -135,27 +194,33 @@ func UpdateLivingContainers() {
 		log.Fatalf("Failed to find queued containers: %v\n", err)
 	}
 
-	podList, err := k8stool.ListPods()
+	instances, err := k8stool.ListInstances()
 	if err != nil {
 		zaphelper.Logger.Error("Failed to list pods", zap.Error(err))
 		return
 	}
 
-	for _, pod := range podList.Items {
-		podLabels := pod.Labels
-		teamHash, exists1 := podLabels["team_hash"]
-		inGameID, exists2 := podLabels["ingame_id"]
+	for _, pod := range instances {
+		var container *models.Container
+		if k8stool.IsWarmPod(pod.Name) {
+			container = findClaimedContainer(containers, pod.Name)
+		} else {
+			podLabels := pod.Labels
+			teamHash, exists1 := podLabels["team_hash"]
+			inGameID, exists2 := podLabels["ingame_id"]
+
+			if !exists1 || !exists2 {
+				continue
+			}
 
-		if !exists1 || !exists2 {
-			continue
-		}
+			inGameIDInt, err := strconv.ParseInt(inGameID, 10, 64)
+			if err != nil {
+				continue
+			}
 
-		inGameIDInt, err := strconv.ParseInt(inGameID, 10, 64)
-		if err != nil {
-			continue
+			container = findExistContainer(containers, teamHash, inGameIDInt)
 		}
 
-		container := findExistContainer(containers, teamHash, inGameIDInt)
 		if container == nil {
 			// zaphelper.Logger.Info("Stopping container that not found in database", zap.Any("container", container))
 			// k8stool.ForceDeletePod(pod.Name)
@@ -163,23 +228,37 @@ func UpdateLivingContainers() {
 		}
 
 		podInfo := k8stool.PodInfo{
-			Name:       fmt.Sprintf("cl-%d-%s", container.InGameID, container.TeamHash),
+			Name:       container.InstanceName(),
 			TeamHash:   container.TeamHash,
 			Containers: container.ContainerConfig,
 			Labels: map[string]string{
 				"team_hash": container.TeamHash,
 				"ingame_id": fmt.Sprintf("%d", container.InGameID),
 			},
-			Flag:     container.TeamFlag.FlagContent,
-			AllowWAN: container.Challenge.AllowWAN,
-			AllowDNS: container.Challenge.AllowDNS,
+			Flag:           container.TeamFlag.FlagContent,
+			AllowWAN:       container.Challenge.AllowWAN,
+			AllowDNS:       container.Challenge.AllowDNS,
+			HTTPHostPrefix: container.HTTPHostPrefix(),
+			Warm:           k8stool.IsWarmPod(container.InstanceName()),
 		}
 
-		podStatus, _ := k8stool.CheckPodStatus(&pod)
+		podStatus := pod.Status
 		// zaphelper.Logger.Info("pod status", zap.Any("podStatus", podStatus))
 
 		if podStatus.Status == k8stool.CustomPodRunning {
 			if container.ContainerStatus == models.ContainerStarting {
+				// 预热实例的 flag 文件和 ExecCommand 需要在实例运行之后写入
+				if k8stool.NeedsFlagInjection(&podInfo) {
+					if err := k8stool.InjectFlag(&podInfo); err != nil {
+						zaphelper.Logger.Error("Failed to inject flag", zap.Error(err), zap.Any("container", container))
+						tasks.NewContainerFailedTask(*container, k8stool.PodStatusDecision{
+							Status:  k8stool.CustomPodFailed,
+							Message: err.Error(),
+						})
+						continue
+					}
+				}
+
 				// 如果远程服务器Pod已经是Running状态，就获取端口并且更新数据库
 				zaphelper.Logger.Info("Getting container port", zap.Any("container", container))
 				getContainerPorts(podInfo, container)
@@ -196,7 +275,8 @@ func UpdateLivingContainers() {
 				zaphelper.Logger.Info("Stopping deaded container", zap.Any("container", container))
 				tasks.NewContainerStopTask(*container)
 			}
-		} else if podStatus.Status == k8stool.CustomPodFailed {
+		} else if podStatus.Status == k8stool.CustomPodFailed && container.ContainerStatus != models.ContainerQueueing {
+			// 正在重置的实例旧 Pod 失败不影响新实例
 			zaphelper.Logger.Info("Stopping failed container", zap.Any("container", container), zap.Any("pod_status", podStatus))
 			tasks.NewContainerFailedTask(*container, podStatus)
 		} else {
@@ -207,6 +287,11 @@ func UpdateLivingContainers() {
 	for _, container := range containers {
 		// 处理队列中的容器
 		if container.ContainerStatus == models.ContainerQueueing {
+			// 重置的实例等旧 Pod 删除干净再创建
+			if findExistPod(instances, container.TeamHash, container.InGameID) != nil ||
+				findInstance(instances, container.InstanceName()) != nil {
+				continue
+			}
 			if err := dbtool.DB().Model(&container).Update("container_status", models.ContainerStarting).Error; err != nil {
 				zaphelper.Logger.Error("failed to update container status", zap.Error(err), zap.Any("container", container))
 				continue
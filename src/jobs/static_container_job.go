@@ -0,0 +1,275 @@
+package jobs
+
+import (
+	"a1ctf/src/db/models"
+	"a1ctf/src/tasks"
+	dbtool "a1ctf/src/utils/db_tool"
+	k8stool "a1ctf/src/utils/k8s_tool"
+	"fmt"
+	"time"
+
+	"a1ctf/src/utils/zaphelper"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultStaticRestartDelay     = 10 * time.Second
+	defaultStaticUnhealthyTimeout = 2 * time.Minute
+	defaultStaticStartTimeout     = 10 * time.Minute
+)
+
+func staticContainerSetting(key string, defaultValue time.Duration) time.Duration {
+	value := viper.GetDuration("static-container-settings." + key)
+	if value <= 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// 题目可见并且比赛没有结束的时候，共享实例需要保持运行
+func staticContainerWanted(gameChallenge *models.GameChallenge, now time.Time) bool {
+	return gameChallenge.Visible &&
+		gameChallenge.Challenge.ContainerType == models.STATIC_CONTAINER &&
+		gameChallenge.Challenge.ContainerConfig != nil &&
+		now.Before(gameChallenge.Game.EndTime)
+}
+
+func findStaticPod(instances []k8stool.Instance, inGameID int64) *k8stool.Instance {
+	for _, instance := range instances {
+		if instance.Labels["static_container"] == "true" && instance.Labels["ingame_id"] == fmt.Sprintf("%d", inGameID) {
+			return &instance
+		}
+	}
+	return nil
+}
+
+func updateStaticContainer(staticContainer *models.StaticContainer, updates map[string]interface{}) bool {
+	if err := dbtool.DB().Model(staticContainer).Updates(updates).Error; err != nil {
+		zaphelper.Logger.Error("failed to update static container", zap.Error(err), zap.String("container_id", staticContainer.ContainerID))
+		return false
+	}
+	return true
+}
+
+func restartStaticContainer(staticContainer *models.StaticContainer, reason string) {
+	zaphelper.Logger.Info("Restarting static container", zap.String("container_id", staticContainer.ContainerID), zap.Int64("ingame_id", staticContainer.InGameID), zap.String("reason", reason))
+	if err := tasks.RestartStaticContainer(*staticContainer, reason); err != nil {
+		zaphelper.Logger.Error("failed to restart static container", zap.Error(err), zap.String("container_id", staticContainer.ContainerID))
+	}
+}
+
+// UpdateStaticContainers 维护 STATIC_CONTAINER 题目的共享实例
+//
+//   - 题目可见时自动创建实例，题目隐藏或者比赛结束后关闭
+//   - 管理员手动关闭（enabled = false）的实例不会被自动启动
+//   - Pod 失败、探针长时间不通过或者启动超时的时候删除 Pod 重新创建
+func UpdateStaticContainers() {
+	now := time.Now().UTC()
+
+	var gameChallenges []models.GameChallenge
+	if err := dbtool.DB().Joins("JOIN challenges ON challenges.challenge_id = game_challenges.challenge_id").
+		Where("challenges.container_type = ?", models.STATIC_CONTAINER).
+		Preload("Challenge").Preload("Game").Find(&gameChallenges).Error; err != nil {
+		zaphelper.Logger.Error("Failed to load static container challenges", zap.Error(err))
+		return
+	}
+
+	var staticContainers []models.StaticContainer
+	if err := dbtool.DB().Preload("Challenge").Preload("GameChallenge").Find(&staticContainers).Error; err != nil {
+		zaphelper.Logger.Error("Failed to load static containers", zap.Error(err))
+		return
+	}
+
+	staticContainerMap := make(map[int64]*models.StaticContainer, len(staticContainers))
+	for i := range staticContainers {
+		staticContainerMap[staticContainers[i].InGameID] = &staticContainers[i]
+	}
+
+	// 1. 新出现的可见题目创建实例记录，交给下面的状态机启动
+	for i := range gameChallenges {
+		gameChallenge := &gameChallenges[i]
+		if _, exists := staticContainerMap[gameChallenge.IngameID]; exists || !staticContainerWanted(gameChallenge, now) {
+			continue
+		}
+
+		newStaticContainer := models.StaticContainer{
+			ContainerID:          uuid.NewString(),
+			GameID:               gameChallenge.GameID,
+			ChallengeID:          gameChallenge.ChallengeID,
+			InGameID:             gameChallenge.IngameID,
+			ChallengeName:        gameChallenge.Challenge.Name,
+			ContainerConfig:      *gameChallenge.Challenge.ContainerConfig,
+			ContainerExposeInfos: models.ContainerExposeInfos{},
+			ContainerStatus:      models.ContainerQueueing,
+			Enabled:              true,
+			StartTime:            now,
+		}
+
+		if err := dbtool.DB().Create(&newStaticContainer).Error; err != nil {
+			zaphelper.Logger.Error("Failed to create static container", zap.Error(err), zap.Int64("ingame_id", gameChallenge.IngameID))
+			continue
+		}
+
+		zaphelper.Logger.Info("Created static container", zap.Int64("ingame_id", gameChallenge.IngameID), zap.String("challenge_name", newStaticContainer.ChallengeName))
+	}
+
+	if len(staticContainers) == 0 {
+		// 新建的记录下一轮再处理
+		return
+	}
+
+	gameChallengeMap := make(map[int64]*models.GameChallenge, len(gameChallenges))
+	for i := range gameChallenges {
+		gameChallengeMap[gameChallenges[i].IngameID] = &gameChallenges[i]
+	}
+
+	instances, err := k8stool.ListInstances()
+	if err != nil {
+		zaphelper.Logger.Error("Failed to list pods", zap.Error(err))
+		return
+	}
+
+	restartDelay := staticContainerSetting("restart-delay", defaultStaticRestartDelay)
+	unhealthyTimeout := staticContainerSetting("unhealthy-timeout", defaultStaticUnhealthyTimeout)
+	startTimeout := staticContainerSetting("start-timeout", defaultStaticStartTimeout)
+
+	for i := range staticContainers {
+		staticContainer := &staticContainers[i]
+
+		gameChallenge, exists := gameChallengeMap[staticContainer.InGameID]
+		wanted := exists && staticContainer.Enabled && staticContainerWanted(gameChallenge, now)
+
+		pod := findStaticPod(instances, staticContainer.InGameID)
+
+		// 2. 不需要运行的实例直接关闭
+		if !wanted {
+			if staticContainer.ContainerStatus != models.ContainerStopped {
+				zaphelper.Logger.Info("Stopping static container", zap.String("container_id", staticContainer.ContainerID), zap.Int64("ingame_id", staticContainer.InGameID))
+				if updateStaticContainer(staticContainer, map[string]interface{}{
+					"container_status": models.ContainerStopped,
+					"expose_ports":     models.ContainerExposeInfos{},
+					"unhealthy_since":  nil,
+				}) {
+					tasks.NewStaticContainerStopTask(*staticContainer)
+				}
+			}
+			continue
+		}
+
+		switch staticContainer.ContainerStatus {
+		case models.ContainerStopped:
+			// 3. 重新可见或者管理员重新开启，重新排队启动
+			updateStaticContainer(staticContainer, map[string]interface{}{
+				"container_status": models.ContainerQueueing,
+			})
+
+		case models.ContainerError:
+			// 4. 创建失败的实例隔一段时间再重试
+			if staticContainer.LastRestartTime == nil || now.Sub(*staticContainer.LastRestartTime) > restartDelay {
+				restartStaticContainer(staticContainer, "retry after error")
+			}
+
+		case models.ContainerQueueing:
+			// 5. 刚刚重启的实例等旧 Pod 删除干净再创建
+			if staticContainer.LastRestartTime != nil && now.Sub(*staticContainer.LastRestartTime) < restartDelay {
+				continue
+			}
+			if pod != nil {
+				continue
+			}
+
+			// 使用最新的题目配置启动
+			staticContainer.ContainerConfig = *gameChallenge.Challenge.ContainerConfig
+			staticContainer.ChallengeName = gameChallenge.Challenge.Name
+			if !updateStaticContainer(staticContainer, map[string]interface{}{
+				"container_status": models.ContainerStarting,
+				"container_config": staticContainer.ContainerConfig,
+				"challenge_name":   staticContainer.ChallengeName,
+				"start_time":       now,
+			}) {
+				continue
+			}
+
+			zaphelper.Logger.Info("Starting static container", zap.String("container_id", staticContainer.ContainerID), zap.Int64("ingame_id", staticContainer.InGameID))
+			tasks.NewStaticContainerStartTask(*staticContainer)
+
+		case models.ContainerStarting, models.ContainerRunning:
+			if pod == nil {
+				if staticContainer.ContainerStatus == models.ContainerRunning {
+					restartStaticContainer(staticContainer, "pod not found")
+				} else if now.Sub(staticContainer.StartTime) > startTimeout {
+					restartStaticContainer(staticContainer, "start timeout")
+				}
+				continue
+			}
+
+			podStatus := pod.Status
+
+			switch podStatus.Status {
+			case k8stool.CustomPodRunning:
+				if staticContainer.ContainerStatus == models.ContainerStarting {
+					podInfo := tasks.StaticContainerPodInfo(*staticContainer)
+					exposeInfos, err := collectExposeInfos(podInfo, staticContainer.ContainerConfig)
+					if err != nil {
+						zaphelper.Logger.Error("Failed to get static container ports", zap.Error(err), zap.String("container_id", staticContainer.ContainerID))
+						continue
+					}
+
+					staticContainer.ContainerExposeInfos = exposeInfos
+					if updateStaticContainer(staticContainer, map[string]interface{}{
+						"container_status": models.ContainerRunning,
+						"expose_ports":     exposeInfos,
+						"unhealthy_since":  nil,
+					}) {
+						tasks.LogContainerOperation(nil, nil, models.ActionContainerStarted, staticContainer.ContainerID, map[string]interface{}{
+							"game_id":               staticContainer.GameID,
+							"challenge_name":        staticContainer.ChallengeName,
+							"ingame_id":             staticContainer.InGameID,
+							"pod_name":              podInfo.Name,
+							"container_id":          staticContainer.ContainerID,
+							"container_expose_info": exposeInfos,
+							"restart_count":         staticContainer.RestartCount,
+							"static_container":      true,
+						}, nil)
+					}
+				} else if staticContainer.UnhealthySince != nil {
+					updateStaticContainer(staticContainer, map[string]interface{}{
+						"unhealthy_since": nil,
+					})
+				}
+
+			case k8stool.CustomPodFailed:
+				tasks.LogContainerOperation(nil, nil, models.ActionContainerFailed, staticContainer.ContainerID, map[string]interface{}{
+					"game_id":          staticContainer.GameID,
+					"challenge_name":   staticContainer.ChallengeName,
+					"ingame_id":        staticContainer.InGameID,
+					"pod_name":         pod.Name,
+					"container_id":     staticContainer.ContainerID,
+					"reason":           podStatus.Message,
+					"static_container": true,
+				}, fmt.Errorf("static container failed"))
+				restartStaticContainer(staticContainer, podStatus.Message)
+
+			default:
+				// 6. 运行中的实例探针不通过，超过一段时间就重启
+				if staticContainer.ContainerStatus == models.ContainerStarting {
+					if now.Sub(staticContainer.StartTime) > startTimeout {
+						restartStaticContainer(staticContainer, "start timeout")
+					}
+					continue
+				}
+
+				if staticContainer.UnhealthySince == nil {
+					updateStaticContainer(staticContainer, map[string]interface{}{
+						"unhealthy_since": now,
+					})
+				} else if now.Sub(*staticContainer.UnhealthySince) > unhealthyTimeout {
+					restartStaticContainer(staticContainer, "health check failed: "+podStatus.Message)
+				}
+			}
+		}
+	}
+}
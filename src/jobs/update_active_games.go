@@ -5,197 +5,106 @@ import (
 	dbtool "a1ctf/src/utils/db_tool"
 	"a1ctf/src/utils/ristretto_tool"
 	"a1ctf/src/utils/zaphelper"
-	"math"
 	"time"
 
 	"go.uber.org/zap"
 	"gorm.io/gorm/clause"
 )
 
-func filterValidSolves(solves []models.Solve) []models.Solve {
-	var filtered []models.Solve
-	for _, solve := range solves {
-		if solve.Team.TeamStatus == models.ParticipateApproved {
-			filtered = append(filtered, solve)
-		}
-	}
-	return filtered
-}
-
-// 往 更新解题数量, 题目当前分数, 队伍分数
-func updateActiveGameScores(game_ids []int64) {
-	if len(game_ids) == 0 {
-		return
-	}
+// 已经写入数据库的题目分数和队伍分数，只回写和上次不一样的。只在 UpdateActivateGameScore 里访问
+var persistedScoreVersions = make(map[int64]int64)                                  // game_id -> 分数汇总版本
+var persistedChallengeScores = make(map[int64]ristretto_tool.ChallengeScoreSummary) // ingame_id -> 题目分数
+var persistedTeamScores = make(map[int64]float64)                                   // team_id -> 队伍分数
 
-	// 1. 查询所有相关的 GameChallenge
+// 第一次处理这场比赛的时候读取一次数据库里的值，之后和内存里的比较
+func loadPersistedGameScores(gameID int64) error {
 	var gameChallenges []models.GameChallenge
-	if err := dbtool.DB().Where("game_id IN ?", game_ids).Find(&gameChallenges).Error; err != nil {
-		zaphelper.Logger.Error("Failed to load game challenges", zap.Error(err))
-		return
+	if err := dbtool.DB().Select("ingame_id", "solve_count", "cur_score").Where("game_id = ?", gameID).Find(&gameChallenges).Error; err != nil {
+		return err
 	}
 
-	// 2. 查询所有正确的解题记录
-	var solves []models.Solve
-	if err := dbtool.DB().Where("game_id IN ? AND solve_status = ?", game_ids, models.SolveCorrect).Preload("Game").Preload("Team").Find(&solves).Error; err != nil {
-		zaphelper.Logger.Error("Failed to load solves", zap.Error(err))
-		return
+	var teams []models.Team
+	if err := dbtool.DB().Select("team_id", "team_score").Where("game_id = ?", gameID).Find(&teams).Error; err != nil {
+		return err
 	}
 
-	// 过滤掉被 Ban 的队伍
-	solves = filterValidSolves(solves)
-
-	// 3. 统计每道题的解题人数
-	solveCountMap := make(map[int64]int32) // ingame_id -> solve_count
-	for _, solve := range solves {
-		if solve.SolveTime.After(solve.Game.StartTime) && solve.SolveTime.Before(solve.Game.EndTime) {
-			solveCountMap[solve.IngameID]++
-		}
-	}
-
-	// 4. 更新每道题的解题人数和分数（只更新有变化的）
-	var challengesToUpdate []models.GameChallenge
-	gameChallengeMap := make(map[int64]models.GameChallenge)
 	for _, gc := range gameChallenges {
-		solveCount := solveCountMap[gc.IngameID]
-		oldSolveCount := gc.SolveCount
-		oldCurScore := gc.CurScore
-
-		gc.SolveCount = solveCount
-
-		// 计算当前分数
-		var newCurScore float64
-		if solveCount == 0 {
-			newCurScore = gc.TotalScore
-		} else {
-			// 动态分数计算公式
-			minRatio := gc.MinimalScore / gc.TotalScore
-			dynamicRatio := (1 - minRatio) * math.Exp((1-float64(solveCount))/gc.Difficulty)
-			newCurScore = math.Floor(gc.TotalScore * (minRatio + dynamicRatio))
-		}
-		gc.CurScore = newCurScore
-
-		gameChallengeMap[gc.IngameID] = gc
-
-		// 只有当解题人数或分数发生变化时才加入更新列表
-		if oldSolveCount != solveCount || oldCurScore != newCurScore {
-			challengesToUpdate = append(challengesToUpdate, gc)
+		persistedChallengeScores[gc.IngameID] = ristretto_tool.ChallengeScoreSummary{
+			SolveCount: gc.SolveCount,
+			CurScore:   gc.CurScore,
 		}
 	}
 
-	// 批量更新 GameChallenge（只更新有变化的）
-	if len(challengesToUpdate) > 0 {
-		for _, gc := range challengesToUpdate {
-			if err := dbtool.DB().Model(&gc).Select("solve_count", "cur_score").Updates(gc).Error; err != nil {
-				zaphelper.Logger.Error("Failed to update game challenge", zap.Error(err), zap.Int64("ingame_id", gc.IngameID))
-			}
-		}
-	}
-
-	// 5. 查询游戏信息（用于血奖计算）
-	var games []models.Game
-	if err := dbtool.DB().Where("game_id IN ?", game_ids).Find(&games).Error; err != nil {
-		zaphelper.Logger.Error("Failed to load games", zap.Error(err))
-		return
-	}
-	gameMap := make(map[int64]models.Game)
-	for _, game := range games {
-		gameMap[game.GameID] = game
-	}
-
-	// 6. 查询分数调整记录
-	var adjustments []models.ScoreAdjustment
-	if err := dbtool.DB().Where("game_id IN ?", game_ids).Find(&adjustments).Error; err != nil {
-		zaphelper.Logger.Error("Failed to load score adjustments", zap.Error(err))
-		return
+	for _, team := range teams {
+		persistedTeamScores[team.TeamID] = team.TeamScore
 	}
 
-	// 7. 计算每个队伍的总分
-	teamScores := make(map[int64]float64) // team_id -> total_score
-
-	for _, solve := range solves {
+	return nil
+}
 
-		// 过滤掉非比赛时间的 solves
-		if !(solve.SolveTime.After(solve.Game.StartTime) && solve.SolveTime.Before(solve.Game.EndTime)) {
+// 往 更新解题数量, 题目当前分数, 队伍分数
+// 分数由排行榜引擎增量计算，汇总版本没有变化的比赛直接跳过
+func updateActiveGameScores(game_ids []int64) {
+	for _, gameID := range game_ids {
+		// 结束之后已经从排行榜引擎移除的比赛分数不会再变化
+		if ristretto_tool.ScoreBoardGameArchived(gameID) {
 			continue
 		}
 
-		if gc, exists := gameChallengeMap[solve.IngameID]; exists && gc.Visible {
-			teamScores[solve.TeamID] += gc.CurScore
+		summary, err := ristretto_tool.CurrentGameScoreSummary(gameID)
+		if err != nil {
+			zaphelper.Logger.Error("Failed to load game score summary", zap.Error(err), zap.Int64("game_id", gameID))
+			continue
 		}
-	}
-
-	// 7.2 计算血奖分数
-	for _, solve := range solves {
 
-		// 过滤掉非比赛时间的 solves
-		if !(solve.SolveTime.After(solve.Game.StartTime) && solve.SolveTime.Before(solve.Game.EndTime)) {
+		lastVersion, persisted := persistedScoreVersions[gameID]
+		if persisted && lastVersion == summary.Version {
 			continue
 		}
 
-		if gc, exists := gameChallengeMap[solve.IngameID]; exists && gc.Visible && gc.BloodRewardEnabled {
-			if game, gameExists := gameMap[solve.GameID]; gameExists {
-				var rewardPercent int64
-				switch solve.Rank {
-				case 1:
-					rewardPercent = game.FirstBloodReward
-				case 2:
-					rewardPercent = game.SecondBloodReward
-				case 3:
-					rewardPercent = game.ThirdBloodReward
-				}
-				if rewardPercent > 0 {
-					reward := gc.CurScore * float64(rewardPercent) / 100.0
-					teamScores[solve.TeamID] += math.Max(math.Floor(reward), 1)
-				}
+		if !persisted {
+			if err := loadPersistedGameScores(gameID); err != nil {
+				zaphelper.Logger.Error("Failed to load persisted game scores", zap.Error(err), zap.Int64("game_id", gameID))
+				continue
 			}
 		}
-	}
-
-	// 7.3 计算分数调整
-	for _, adj := range adjustments {
-		teamScores[adj.TeamID] += adj.ScoreChange
-	}
 
-	// 8. 查询当前队伍分数，只更新有变化的
-	var currentTeams []models.Team
-	var teamIDsToQuery []int64
-	for teamID := range teamScores {
-		teamIDsToQuery = append(teamIDsToQuery, teamID)
-	}
+		// 更新每道题的解题人数和分数（只更新有变化的）
+		for ingameID, score := range summary.Challenges {
+			if old, exists := persistedChallengeScores[ingameID]; exists && old == score {
+				continue
+			}
 
-	if len(teamIDsToQuery) > 0 {
-		if err := dbtool.DB().Where("team_id IN ? AND game_id IN ?", teamIDsToQuery, game_ids).Find(&currentTeams).Error; err != nil {
-			zaphelper.Logger.Error("Failed to load current team scores", zap.Error(err))
-			return
+			gc := models.GameChallenge{
+				IngameID:   ingameID,
+				SolveCount: score.SolveCount,
+				CurScore:   score.CurScore,
+			}
+			if err := dbtool.DB().Model(&gc).Select("solve_count", "cur_score").Updates(gc).Error; err != nil {
+				zaphelper.Logger.Error("Failed to update game challenge", zap.Error(err), zap.Int64("ingame_id", ingameID))
+				continue
+			}
+			persistedChallengeScores[ingameID] = score
 		}
-	}
 
-	// 比较分数，只更新有变化的队伍
-	currentTeamScoreMap := make(map[int64]float64)
-	for _, team := range currentTeams {
-		currentTeamScoreMap[team.TeamID] = team.TeamScore
-	}
+		// 更新队伍分数（只更新有变化的）
+		for teamID, teamScore := range summary.Teams {
+			if old, exists := persistedTeamScores[teamID]; exists && old == teamScore.Score {
+				continue
+			}
 
-	var teamsToUpdate []models.Team
-	for teamID, newScore := range teamScores {
-		currentScore, exists := currentTeamScoreMap[teamID]
-		// 如果队伍不存在或分数发生变化，则需要更新
-		if !exists || currentScore != newScore {
 			team := models.Team{
 				TeamID:    teamID,
-				TeamScore: newScore,
+				TeamScore: teamScore.Score,
 			}
-			teamsToUpdate = append(teamsToUpdate, team)
-		}
-	}
-
-	if len(teamsToUpdate) > 0 {
-		for _, team := range teamsToUpdate {
 			if err := dbtool.DB().Model(&team).Select("team_score").Updates(team).Error; err != nil {
-				zaphelper.Logger.Error("Failed to update team score", zap.Error(err), zap.Int64("team_id", team.TeamID))
+				zaphelper.Logger.Error("Failed to update team score", zap.Error(err), zap.Int64("team_id", teamID))
+				continue
 			}
+			persistedTeamScores[teamID] = teamScore.Score
 		}
+
+		persistedScoreVersions[gameID] = summary.Version
 	}
 }
 
@@ -220,6 +129,7 @@ func UpdateActivateGameScore() {
 }
 
 // 更新比赛每个队伍的分数, 往 scoreboard 表里插入当前某个比赛每个队伍的分数(仅在分数变动时候)
+// 分数和已有的快照都从排行榜引擎读取，只写入有变化的队伍
 func UpdateActiveGameScoreBoard() {
 	var active_games []models.Game
 	query := dbtool.DB()
@@ -233,147 +143,57 @@ func UpdateActiveGameScoreBoard() {
 	for _, game := range active_games {
 		gameID := game.GameID
 
+		if ristretto_tool.ScoreBoardGameArchived(gameID) {
+			continue
+		}
+
 		// 先获取时间，统一的
 		curTime := time.Now().UTC()
 
-		// 先获取比赛下的所有队伍
-		var teamsParticipated []models.Team = make([]models.Team, 0)
-		var participatedTeamIDs []int64
-		if err := dbtool.DB().Where("game_id = ? AND team_type = ?", gameID, models.TeamTypePlayer).Find(&teamsParticipated).Error; err != nil {
-			zaphelper.Logger.Error("Failed to load teams for game ", zap.Error(err), zap.Int64("game_id", gameID))
-			return
-		}
-
-		for _, team := range teamsParticipated {
-			participatedTeamIDs = append(participatedTeamIDs, team.TeamID)
+		summary, err := ristretto_tool.CurrentGameScoreSummary(gameID)
+		if err != nil {
+			zaphelper.Logger.Error("Failed to load game score summary", zap.Error(err), zap.Int64("game_id", gameID))
+			continue
 		}
 
-		// 获取上述队伍的积分榜
-		var teamGameScoreborad []models.ScoreBoard = make([]models.ScoreBoard, 0)
-		var teamGameScoreboardMap map[int64]models.ScoreBoard = make(map[int64]models.ScoreBoard)
-		if err := dbtool.DB().Where("game_id = ? AND team_id IN ?", gameID, participatedTeamIDs).Preload("Team").Find(&teamGameScoreborad).Error; err != nil {
+		teamGameScoreboardMap, err := ristretto_tool.GameScoreBoardSnapshots(gameID)
+		if err != nil {
 			zaphelper.Logger.Error("Failed to load team scoreboard for game ", zap.Error(err), zap.Int64("game_id", gameID))
-			return
-		}
-
-		for _, scoreboard := range teamGameScoreborad {
-			teamGameScoreboardMap[scoreboard.TeamID] = scoreboard
-		}
-
-		// 获取当前比赛的正确解题记录
-		var solves []models.Solve
-		if err := dbtool.DB().Where("game_id = ? AND solve_status = ? AND solve_time BETWEEN ? AND ?", gameID, models.SolveCorrect, game.StartTime, game.EndTime).Preload("GameChallenge").Preload("Game").Preload("Team").Find(&solves).Error; err != nil {
-			zaphelper.Logger.Error("Failed to load solves for game ", zap.Error(err), zap.Int64("game_id", gameID))
-			return
+			continue
 		}
 
-		solves = filterValidSolves(solves)
-
 		// 计算每个队伍的解题信息
 		var teamMap = make(map[int64]models.ScoreBoardData)
 
 		// 这里先根据现有的 Scoreboard 表项初始化一次 teamMap，防止后期后台操作导致队伍 0 solves 0 score-adjustments 后不更新 0 分
-		for _, teamScore := range teamGameScoreborad {
-			solvedList := make([]string, 0)
-			scoreBoardData := models.ScoreBoardData{
-				TeamName:             teamScore.Team.TeamName,
-				SolvedChallenges:     solvedList,
+		for teamID, teamScore := range teamGameScoreboardMap {
+			teamName := ""
+			if len(teamScore.Data) > 0 {
+				teamName = teamScore.Data[len(teamScore.Data)-1].TeamName
+			}
+
+			teamMap[teamID] = models.ScoreBoardData{
+				TeamName:             teamName,
+				SolvedChallenges:     make([]string, 0),
 				NewSolvedChallengeID: nil,
 				Score:                0,
 				RecordTime:           curTime,
 			}
-			teamMap[teamScore.TeamID] = scoreBoardData
 		}
 
-		for _, solve := range solves {
-			if !solve.GameChallenge.Visible {
-				// 如果题目现在不可见，就跳过
-				continue
-			}
-
-			challengeScore := solve.GameChallenge.CurScore
-
-			// 这里计算分数了，处理一下三血
-			if solve.GameChallenge.BloodRewardEnabled && solve.Rank <= 3 {
-
-				var rankRewardEnabled bool = false
-
-				rewardScore := 0.0
-				switch solve.Rank {
-				case 3:
-					rewardScore = float64(solve.Game.ThirdBloodReward) * solve.GameChallenge.CurScore / 100
-					if solve.Game.ThirdBloodReward != 0 {
-						rankRewardEnabled = true
-					}
-				case 2:
-					rewardScore = float64(solve.Game.SecondBloodReward) * solve.GameChallenge.CurScore / 100
-					if solve.Game.SecondBloodReward != 0 {
-						rankRewardEnabled = true
-					}
-				case 1:
-					rewardScore = float64(solve.Game.FirstBloodReward) * solve.GameChallenge.CurScore / 100
-					if solve.Game.FirstBloodReward != 0 {
-						rankRewardEnabled = true
-					}
-				}
-
-				if rankRewardEnabled {
-					rewardScore = math.Max(math.Floor(rewardScore), 1)
-
-					challengeScore += rewardScore
-				}
-			}
-
-			// 更新解题信息
-			if scoreBoardData, exists := teamMap[solve.TeamID]; exists {
-
-				scoreBoardData.Score += challengeScore
-				scoreBoardData.SolvedChallenges = append(scoreBoardData.SolvedChallenges, solve.SolveID)
-
-				teamMap[solve.TeamID] = scoreBoardData
-			} else {
-				solvedList := make([]string, 0)
-				solvedList = append(solvedList, solve.SolveID)
-				scoreBoardData := models.ScoreBoardData{
-					TeamName:             solve.Team.TeamName,
-					SolvedChallenges:     solvedList,
-					NewSolvedChallengeID: nil,
-					Score:                0,
-					RecordTime:           curTime,
-				}
-				scoreBoardData.Score += challengeScore
-				teamMap[solve.TeamID] = scoreBoardData
-			}
-		}
-
-		// 加载分数修正
-		var adjustments []models.ScoreAdjustment
-		if err := dbtool.DB().Where("game_id = ?", gameID).Preload("Team").Find(&adjustments).Error; err != nil {
-			zaphelper.Logger.Error("Failed to load score adjuestment for game ", zap.Error(err), zap.Int64("game_id", gameID))
-			return
-		}
-
-		for _, adjustment := range adjustments {
-			if scoreBoardData, exists := teamMap[adjustment.TeamID]; exists {
-				// 有解题记录，直接修正
-				scoreBoardData.Score += adjustment.ScoreChange
-				teamMap[adjustment.TeamID] = scoreBoardData
-			} else {
-				// 没解题记录，创建新的
-				solvedList := make([]string, 0)
-				scoreBoardData := models.ScoreBoardData{
-					TeamName:             adjustment.Team.TeamName,
-					SolvedChallenges:     solvedList,
-					NewSolvedChallengeID: nil,
-					Score:                adjustment.ScoreChange,
-					RecordTime:           curTime,
-				}
-				teamMap[adjustment.TeamID] = scoreBoardData
+		for teamID, teamScore := range summary.Teams {
+			teamMap[teamID] = models.ScoreBoardData{
+				TeamName:             teamScore.TeamName,
+				SolvedChallenges:     teamScore.SolveIDs,
+				NewSolvedChallengeID: nil,
+				Score:                teamScore.Score,
+				RecordTime:           curTime,
 			}
 		}
 
 		// 现在已经计算完成当前所有队伍的解题记录，只需要更新进 sql 就行了
 
+		var scoreboards []models.ScoreBoard = make([]models.ScoreBoard, 0)
 		for teamID, teamData := range teamMap {
 			// 先判断是否是新数据
 			tmpScoreboard, exists := teamGameScoreboardMap[teamID]
@@ -383,45 +203,36 @@ func UpdateActiveGameScoreBoard() {
 				tmpScoreboardDatas := make(models.ScoreBoardDatas, 0)
 				tmpScoreboardDatas = append(tmpScoreboardDatas, teamData)
 
-				tmpScoreboard = models.ScoreBoard{
+				scoreboards = append(scoreboards, models.ScoreBoard{
 					GameID:         gameID,
 					TeamID:         teamID,
 					GenerateTime:   curTime,
 					CurScore:       teamData.Score,
 					Data:           tmpScoreboardDatas,
 					LastUpdateTime: curTime,
-				}
-
-				teamGameScoreboardMap[teamID] = tmpScoreboard
-			} else {
-				// 如果存在，插入新数据
-
-				if tmpScoreboard.CurScore != teamData.Score {
-					tmpScoreboard.Data = append(tmpScoreboard.Data, teamData)
-					tmpScoreboard.LastUpdateTime = curTime
-					tmpScoreboard.CurScore = teamData.Score
-
-				}
-
-				teamGameScoreboardMap[teamID] = tmpScoreboard
+				})
+			} else if tmpScoreboard.CurScore != teamData.Score {
+				// 如果存在并且分数有变化，插入新数据
+				tmpScoreboard.Data = append(tmpScoreboard.Data, teamData)
+				tmpScoreboard.LastUpdateTime = curTime
+				tmpScoreboard.CurScore = teamData.Score
+
+				scoreboards = append(scoreboards, tmpScoreboard)
 			}
 		}
 
-		var scoreboards []models.ScoreBoard = make([]models.ScoreBoard, 0)
-		for _, scoreboard := range teamGameScoreboardMap {
-			scoreboards = append(scoreboards, scoreboard)
-		}
-
 		if len(scoreboards) > 0 {
-			err := dbtool.DB().Clauses(clause.OnConflict{
+			err := dbtool.DB().Omit(clause.Associations).Clauses(clause.OnConflict{
 				UpdateAll: true,
 			}).Create(&scoreboards).Error
 
 			if err != nil {
 				zaphelper.Logger.Error("Failed to update scoreboard for game ", zap.Error(err), zap.Int64("game_id", gameID))
+				continue
 			}
-		}
 
+			ristretto_tool.ApplyGameScoreBoardSnapshots(gameID, scoreboards)
+		}
 	}
 }
 
@@ -0,0 +1,185 @@
+package jobs
+
+import (
+	"a1ctf/src/db/models"
+	dbtool "a1ctf/src/utils/db_tool"
+	k8stool "a1ctf/src/utils/k8s_tool"
+	redistool "a1ctf/src/utils/redis_tool"
+	"strconv"
+	"time"
+
+	"a1ctf/src/utils/zaphelper"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultWarmPoolLeadTime = 10 * time.Minute
+	// 删除预热实例之后锁保留的时间，需要比后端真正删掉实例的时间长
+	warmPodDeleteLockTime = 10 * time.Minute
+)
+
+// 比赛开始前提前这么久开始预热
+func warmPoolLeadTime() time.Duration {
+	leadTime := viper.GetDuration("warm-pool-settings.lead-time")
+	if leadTime <= 0 {
+		return defaultWarmPoolLeadTime
+	}
+	return leadTime
+}
+
+// 动态容器题目开启了预热池，并且比赛快要开始或者正在进行的时候需要保持预热实例
+func warmPoolWanted(gameChallenge *models.GameChallenge, now time.Time) bool {
+	if gameChallenge.WarmPoolSize <= 0 ||
+		gameChallenge.Challenge.ContainerType != models.DYNAMIC_CONTAINER ||
+		gameChallenge.Challenge.ContainerConfig == nil {
+		return false
+	}
+
+	if now.Before(gameChallenge.Game.StartTime.Add(-warmPoolLeadTime())) || now.After(gameChallenge.Game.EndTime) {
+		return false
+	}
+
+	if err := k8stool.ValidWarmPoolConfig(*gameChallenge.Challenge.ContainerConfig); err != nil {
+		zaphelper.Logger.Debug("Warm pool disabled for challenge", zap.Error(err), zap.Int64("ingame_id", gameChallenge.IngameID))
+		return false
+	}
+
+	return true
+}
+
+func warmConfigHash(gameChallenge *models.GameChallenge) string {
+	return k8stool.WarmConfigHash(*gameChallenge.Challenge.ContainerConfig, gameChallenge.Challenge.AllowWAN, gameChallenge.Challenge.AllowDNS)
+}
+
+// 按照 ListResources 的顺序删除实例的所有资源，不依赖创建时的题目配置
+func deleteWarmPod(resources []k8stool.ManagedResource, name string) {
+	for _, resource := range resources {
+		if resource.Instance != name {
+			continue
+		}
+		if err := k8stool.DeleteResource(resource); err != nil {
+			zaphelper.Logger.Error("Failed to delete warm pod resource", zap.Error(err), zap.String("kind", resource.Kind), zap.String("name", resource.Name))
+		}
+	}
+}
+
+// UpdateWarmPools 补充和收缩预热池
+//
+//   - 被容器领取的预热实例不再属于预热池，由容器的任务管理
+//   - 题目配置修改、比赛结束或者启动失败的空闲实例直接删除
+//   - 空闲实例不够的时候创建新的实例，多了的时候删除
+func UpdateWarmPools() {
+	now := time.Now().UTC()
+
+	var gameChallenges []models.GameChallenge
+	if err := dbtool.DB().Preload("Game").Preload("Challenge").Where("warm_pool_size > 0").Find(&gameChallenges).Error; err != nil {
+		zaphelper.Logger.Error("Failed to load warm pool challenges", zap.Error(err))
+		return
+	}
+
+	wanted := make(map[int64]*models.GameChallenge)
+	for i := range gameChallenges {
+		if warmPoolWanted(&gameChallenges[i], now) {
+			wanted[gameChallenges[i].IngameID] = &gameChallenges[i]
+		}
+	}
+
+	instances, err := k8stool.ListInstances()
+	if err != nil {
+		zaphelper.Logger.Error("Failed to list pods", zap.Error(err))
+		return
+	}
+
+	warmNames := make([]string, 0)
+	for _, instance := range instances {
+		if k8stool.IsWarmPod(instance.Name) {
+			warmNames = append(warmNames, instance.Name)
+		}
+	}
+
+	claimed := make(map[string]bool)
+	if len(warmNames) > 0 {
+		var containers []models.Container
+		if err := dbtool.DB().Select("pod_name").Where("pod_name IN ?", warmNames).Find(&containers).Error; err != nil {
+			zaphelper.Logger.Error("Failed to load claimed warm pods", zap.Error(err))
+			return
+		}
+		for _, container := range containers {
+			claimed[container.InstanceName()] = true
+		}
+	}
+
+	// 没有空闲实例需要删除的时候不用列出所有资源
+	var resources []k8stool.ManagedResource
+	deletePod := func(name string, reason string) {
+		if resources == nil {
+			if resources, err = k8stool.ListResources(); err != nil {
+				zaphelper.Logger.Error("Failed to list challenge resources", zap.Error(err))
+				return
+			}
+		}
+
+		// 先拿到实例的锁再检查是否被领取，领取也需要这把锁。删除之后不释放锁，
+		// 等锁过期之前实例列表里残留的这个实例都不会再被领取
+		lockName := k8stool.WarmPodLockName(name)
+		lockToken, locked := redistool.LockWithToken(lockName, warmPodDeleteLockTime)
+		if !locked {
+			return
+		}
+
+		// 列出实例之后可能已经被领取了
+		var count int64
+		if err := dbtool.DB().Model(&models.Container{}).Where("pod_name = ?", name).Count(&count).Error; err != nil || count > 0 {
+			if err := redistool.UnlockWithToken(lockName, lockToken); err != nil {
+				zaphelper.Logger.Error("Failed to release warm pod lock", zap.Error(err), zap.String("lock", lockName))
+			}
+			return
+		}
+
+		zaphelper.Logger.Info("Deleting warm pod", zap.String("pod_name", name), zap.String("reason", reason))
+		deleteWarmPod(resources, name)
+	}
+
+	idle := make(map[int64][]string)
+	for _, instance := range instances {
+		if !k8stool.IsWarmPod(instance.Name) || claimed[instance.Name] {
+			continue
+		}
+
+		inGameID, err := strconv.ParseInt(instance.Labels["ingame_id"], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		gameChallenge, ok := wanted[inGameID]
+		switch {
+		case !ok:
+			deletePod(instance.Name, "warm pool disabled")
+		case instance.Labels[k8stool.LabelWarmConfig] != warmConfigHash(gameChallenge):
+			deletePod(instance.Name, "challenge config changed")
+		case instance.Status.Status == k8stool.CustomPodFailed:
+			deletePod(instance.Name, instance.Status.Message)
+		default:
+			idle[inGameID] = append(idle[inGameID], instance.Name)
+		}
+	}
+
+	for inGameID, gameChallenge := range wanted {
+		pods := idle[inGameID]
+
+		for i := int(gameChallenge.WarmPoolSize); i < len(pods); i++ {
+			deletePod(pods[i], "warm pool shrunk")
+		}
+
+		for i := len(pods); i < int(gameChallenge.WarmPoolSize); i++ {
+			podInfo := k8stool.NewWarmPodInfo(inGameID, *gameChallenge.Challenge.ContainerConfig, gameChallenge.Challenge.AllowWAN, gameChallenge.Challenge.AllowDNS)
+			if err := k8stool.CreatePod(&podInfo); err != nil {
+				zaphelper.Logger.Error("Failed to create warm pod", zap.Error(err), zap.Int64("ingame_id", inGameID), zap.String("pod_name", podInfo.Name))
+				break
+			}
+			zaphelper.Logger.Info("Created warm pod", zap.Int64("ingame_id", inGameID), zap.String("pod_name", podInfo.Name))
+		}
+	}
+}
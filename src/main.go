@@ -11,8 +11,10 @@ import (
 	"syscall"
 	"time"
 
+	"a1ctf/src/commands"
 	"a1ctf/src/controllers"
 	"a1ctf/src/db"
+	"a1ctf/src/db/models"
 	"a1ctf/src/jobs"
 	clientconfig "a1ctf/src/modules/client_config"
 	jwtauth "a1ctf/src/modules/jwt_auth"
@@ -24,6 +26,7 @@ import (
 	dbtool "a1ctf/src/utils/db_tool"
 	i18ntool "a1ctf/src/utils/i18n_tool"
 	k8stool "a1ctf/src/utils/k8s_tool"
+	proxytool "a1ctf/src/utils/proxy_tool"
 	ratelimiter "a1ctf/src/utils/rate_limiter"
 	redistool "a1ctf/src/utils/redis_tool"
 	"a1ctf/src/utils/ristretto_tool"
@@ -75,6 +78,16 @@ func StartLoopEvent() {
 		gocron.WithSingletonMode(gocron.LimitModeWait),
 	)
 
+	s.NewJob(
+		gocron.DurationJob(
+			viper.GetDuration("job-intervals.static-container-updating"),
+		),
+		gocron.NewTask(
+			jobs.UpdateStaticContainers,
+		),
+		gocron.WithSingletonMode(gocron.LimitModeWait),
+	)
+
 	s.NewJob(
 		gocron.DurationJob(
 			viper.GetDuration("job-intervals.flag-judge"),
@@ -95,6 +108,36 @@ func StartLoopEvent() {
 		gocron.WithSingletonMode(gocron.LimitModeWait),
 	)
 
+	s.NewJob(
+		gocron.DurationJob(
+			viper.GetDuration("job-intervals.anticheat-correlation"),
+		),
+		gocron.NewTask(
+			jobs.AntiCheatCorrelationJob,
+		),
+		gocron.WithSingletonMode(gocron.LimitModeWait),
+	)
+
+	s.NewJob(
+		gocron.DurationJob(
+			viper.GetDuration("job-intervals.container-gc"),
+		),
+		gocron.NewTask(
+			jobs.ContainerGarbageCollect,
+		),
+		gocron.WithSingletonMode(gocron.LimitModeWait),
+	)
+
+	s.NewJob(
+		gocron.DurationJob(
+			viper.GetDuration("job-intervals.warm-pool"),
+		),
+		gocron.NewTask(
+			jobs.UpdateWarmPools,
+		),
+		gocron.WithSingletonMode(gocron.LimitModeWait),
+	)
+
 	s.NewJob(
 		gocron.DurationJob(
 			viper.GetDuration("job-intervals.compress-and-delete-old-logs"),
@@ -154,9 +197,30 @@ func main() {
 	// 初始化 db
 	db.InitDB()
 
-	// 初始化k8s命名空间
-	if err := k8stool.InitNamespace(); err != nil {
-		log.Fatalf("Failed to initialize k8s namespace: %v", err)
+	// 运行维护命令，例如 ./app repair-solve-ranks <game_id>
+	if len(os.Args) > 1 {
+		if err := commands.Run(os.Args[1:]); err != nil {
+			log.Fatalf("Command failed: %v", err)
+		}
+		return
+	}
+
+	// 初始化容器后端（k8s 或者 docker）
+	if err := k8stool.InitContainerBackend(); err != nil {
+		log.Fatalf("Failed to initialize container backend: %v", err)
+	}
+
+	// 启动题目实例的 TCP 代理网关
+	if err := proxytool.CheckSecret(); err != nil {
+		log.Fatalf("Invalid container proxy config: %v", err)
+	}
+	if err := proxytool.StartTCPGateway(); err != nil {
+		log.Fatalf("Failed to start container proxy gateway: %v", err)
+	}
+
+	// 启动 Web 题目的域名转发
+	if err := proxytool.StartHTTPRouter(); err != nil {
+		log.Fatalf("Failed to start container http router: %v", err)
 	}
 
 	// 加载配置文件
@@ -229,6 +293,16 @@ func main() {
 			CheckGameStarted:  true,
 		}), controllers.UserGameGetScoreBoard)
 
+		public.GET("/game/:game_id/scoreboard/replay", bestGzipMiddleware, controllers.GameStatusMiddleware(controllers.GameStatusMiddlewareProps{
+			VisibleAfterEnded: true,
+			CheckGameStarted:  true,
+		}), controllers.UserGameGetScoreBoardReplay)
+
+		public.GET("/game/:game_id/scoreboard/replay/events", bestGzipMiddleware, controllers.GameStatusMiddleware(controllers.GameStatusMiddlewareProps{
+			VisibleAfterEnded: true,
+			CheckGameStarted:  true,
+		}), controllers.UserGameGetScoreBoardRankChanges)
+
 		public.GET("/game/:game_id", defaultGzipMiddleware, controllers.GameStatusMiddleware(controllers.GameStatusMiddlewareProps{
 			VisibleAfterEnded: true,
 			CheckGameStarted:  false,
@@ -296,6 +370,9 @@ func main() {
 			userAvatarGroup.POST("/avatar/upload", controllers.UploadUserAvatar)
 		}
 
+		// 题目实例的 WebSocket 代理
+		auth.GET("/proxy/:token", controllers.UserProxyWebSocket)
+
 		// 团队相关管理接口
 		teamManagePublicGroup := auth.Group("/game/:game_id/team")
 		teamManagePublicGroup.Use(controllers.GameStatusMiddleware(controllers.GameStatusMiddlewareProps{
@@ -307,6 +384,13 @@ func main() {
 			teamManagePublicGroup.POST("/join", controllers.PayloadValidator(
 				webmodels.TeamJoinPayload{},
 			), controllers.TeamJoinRequest)
+
+			// 入队申请处理，队伍可能还在等待审核，所以也不做 TeamStatus 验证，队长权限在接口里检查
+			teamManagePublicGroup.GET("/:team_id/requests", controllers.UserListTeamJoinRequests)
+			teamManagePublicGroup.POST("/:team_id/requests/:request_id", controllers.PayloadValidator(
+				webmodels.HandleJoinRequestPayload{},
+			), controllers.UserHandleTeamJoinRequest)
+			teamManagePublicGroup.DELETE("/:team_id/requests/:request_id", controllers.UserWithdrawTeamJoinRequest)
 		}
 
 		// 这里需要验证比赛状态
@@ -341,6 +425,11 @@ func main() {
 			challengeGroup.PUT("/:challenge_id", controllers.AdminUpdateChallenge)
 
 			challengeGroup.POST("/search", controllers.AdminSearchChallenges)
+
+			// 判题脚本测试
+			challengeGroup.POST("/judge-script/test", controllers.PayloadValidator(
+				webmodels.AdminTestJudgeScriptPayload{},
+			), controllers.AdminTestJudgeScript)
 		}
 
 		// 管理员用户管理接口
@@ -376,6 +465,9 @@ func main() {
 			gameGroup.PUT("/:game_id/challenge/:challenge_id", controllers.PathParmsMiddlewareBuilder("G|GC"), controllers.AdminUpdateGameChallenge)
 			gameGroup.POST("/:game_id/challenge/:challenge_id", controllers.PathParmsMiddlewareBuilder("g|C"), controllers.AdminAddGameChallenge)
 			gameGroup.DELETE("/:game_id/challenge/:challenge_id", controllers.PathParmsMiddlewareBuilder("g|c"), controllers.AdminDeleteGameChallenge)
+			gameGroup.POST("/:game_id/challenge/:challenge_id/score-preview", controllers.PathParmsMiddlewareBuilder("g|GC"), controllers.PayloadValidator(
+				webmodels.AdminScorePreviewPayload{},
+			), controllers.AdminPreviewChallengeScore)
 
 			gameGroup.POST("/:game_id/submits", controllers.AdminGetSubmits)
 			gameGroup.POST("/:game_id/cheats", controllers.AdminGetCheats)
@@ -402,6 +494,32 @@ func main() {
 
 			// 题目解题记录管理路由
 			gameGroup.POST("/:game_id/challenge/:challenge_id/solves/delete", controllers.AdminDeleteChallengeSolves)
+			gameGroup.POST("/:game_id/solves/repair-ranks", controllers.PathParmsMiddlewareBuilder("G"), controllers.AdminRepairSolveRanks)
+
+			// Writeup 管理
+			gameGroup.POST("/:game_id/writeups", controllers.PathParmsMiddlewareBuilder("G"), controllers.PayloadValidator(
+				webmodels.AdminListWriteupsPayload{},
+			), controllers.AdminListWriteups)
+			gameGroup.GET("/:game_id/writeups/:team_id/download", controllers.PathParmsMiddlewareBuilder("g|T"), controllers.AdminDownloadWriteup)
+			gameGroup.POST("/:game_id/writeups/:team_id/review", controllers.PathParmsMiddlewareBuilder("g|T"), controllers.PayloadValidator(
+				webmodels.AdminReviewWriteupPayload{},
+			), controllers.AdminReviewWriteup)
+
+			// 导出最终排行榜
+			gameGroup.GET("/:game_id/scoreboard/export", controllers.PathParmsMiddlewareBuilder("G"), controllers.AdminExportScoreboard)
+			gameGroup.GET("/:game_id/scoreboard/export/:format", controllers.PathParmsMiddlewareBuilder("G"), controllers.AdminExportScoreboardFile)
+
+			// 解除封榜，公布最终排行榜
+			gameGroup.POST("/:game_id/scoreboard/unfreeze", controllers.PathParmsMiddlewareBuilder("G"), controllers.AdminUnfreezeScoreboard)
+
+			// 阶段晋级名单
+			gameGroup.GET("/:game_id/stages/teams", controllers.PathParmsMiddlewareBuilder("G"), controllers.AdminGetStageTeams)
+			gameGroup.POST("/:game_id/stages/promote", controllers.PathParmsMiddlewareBuilder("G"), controllers.PayloadValidator(
+				webmodels.AdminPromoteStageTeamsPayload{},
+			), controllers.AdminPromoteStageTeams)
+			gameGroup.POST("/:game_id/stages/teams/delete", controllers.PathParmsMiddlewareBuilder("G"), controllers.PayloadValidator(
+				webmodels.AdminDeleteStageTeamsPayload{},
+			), controllers.AdminDeleteStageTeams)
 		}
 
 		// 用户比赛访问相关接口
@@ -421,6 +539,12 @@ func main() {
 				CheckGameStarted:  true,
 			}), controllers.TeamStatusMiddleware(), controllers.ChallengeStatusCheckMiddleWare(true), controllers.UserGetGameChallenge)
 
+			// 下载题目附件，动态附件按队伍生成
+			userGameGroup.GET("/:game_id/challenge/:challenge_id/attachment/:attach_index", controllers.GameStatusMiddleware(controllers.GameStatusMiddlewareProps{
+				VisibleAfterEnded: false,
+				CheckGameStarted:  true,
+			}), controllers.TeamStatusMiddleware(), controllers.ChallengeStatusCheckMiddleWare(true), controllers.UserDownloadAttachment)
+
 			// 比赛通知接口
 			userGameGroup.GET("/:game_id/notices", cache.CacheByRequestURI(memoryStore, 1*time.Second), controllers.GameStatusMiddleware(controllers.GameStatusMiddlewareProps{
 				VisibleAfterEnded: false,
@@ -452,11 +576,21 @@ func main() {
 				VisibleAfterEnded: false,
 				CheckGameStarted:  true,
 			}), controllers.TeamStatusMiddleware(), controllers.ChallengeStatusCheckMiddleWare(false), controllers.UserExtendGameContainer)
+			userGameGroup.POST("/:game_id/container/:challenge_id/reset", controllers.GameStatusMiddleware(controllers.GameStatusMiddlewareProps{
+				VisibleAfterEnded: false,
+				CheckGameStarted:  true,
+			}), controllers.TeamStatusMiddleware(), controllers.ChallengeStatusCheckMiddleWare(false), controllers.UserResetGameContainer)
 			userGameGroup.GET("/:game_id/container/:challenge_id", controllers.GameStatusMiddleware(controllers.GameStatusMiddlewareProps{
 				VisibleAfterEnded: false,
 				CheckGameStarted:  true,
 			}), controllers.TeamStatusMiddleware(), controllers.UserGetGameChallengeContainerInfo)
 
+			// 解锁付费提示
+			userGameGroup.POST("/:game_id/challenge/:challenge_id/hint/:hint_id/unlock", controllers.GameStatusMiddleware(controllers.GameStatusMiddlewareProps{
+				VisibleAfterEnded: false,
+				CheckGameStarted:  true,
+			}), controllers.TeamStatusMiddleware(), controllers.ChallengeStatusCheckMiddleWare(false), controllers.UserUnlockHint)
+
 			// 提交 Flag
 			userGameGroup.POST("/:game_id/flag/:challenge_id", ratelimiter.RateLimiter(100, 100*time.Millisecond), controllers.PayloadValidator(
 				webmodels.UserSubmitFlagPayload{},
@@ -468,6 +602,16 @@ func main() {
 				VisibleAfterEnded: false,
 				CheckGameStarted:  true,
 			}), controllers.TeamStatusMiddleware(), controllers.UserGameGetJudgeResult)
+
+			// Writeup 提交，比赛结束后到 Writeup 截止时间之前都可以提交
+			userGameGroup.GET("/:game_id/writeup", controllers.GameStatusMiddleware(controllers.GameStatusMiddlewareProps{
+				VisibleAfterEnded: true,
+				CheckGameStarted:  true,
+			}), controllers.TeamStatusMiddleware(), controllers.UserGetWriteup)
+			userGameGroup.POST("/:game_id/writeup", controllers.GameStatusMiddleware(controllers.GameStatusMiddlewareProps{
+				VisibleAfterEnded: true,
+				CheckGameStarted:  true,
+			}), controllers.TeamStatusMiddleware(), controllers.UserUploadWriteup)
 		}
 
 		// 实时通知服务
@@ -479,9 +623,12 @@ func main() {
 				return
 			}
 
-			// 处理WebSocket连接
+			user := c.MustGet("user").(models.User)
+
+			// 处理WebSocket连接，userID 用来给指定用户推送消息
 			dbtool.Melody().HandleRequestWithKeys(c.Writer, c.Request, map[string]interface{}{
 				"gameID": gameID,
+				"userID": user.UserID,
 			})
 		})
 
@@ -494,6 +641,12 @@ func main() {
 			containerGroup.POST("/delete", controllers.AdminDeleteContainer)
 			containerGroup.POST("/extend", controllers.AdminExtendContainer)
 			containerGroup.GET("/flag", controllers.AdminGetContainerFlag)
+
+			// 静态容器共享实例
+			containerGroup.GET("/static", controllers.AdminListStaticContainers)
+			containerGroup.POST("/static/start", controllers.AdminStartStaticContainer)
+			containerGroup.POST("/static/stop", controllers.AdminStopStaticContainer)
+			containerGroup.POST("/static/restart", controllers.AdminRestartStaticContainer)
 		}
 
 		// 系统设置相关API
@@ -0,0 +1,68 @@
+package monitoring
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// 题目容器垃圾回收的 Prometheus 指标
+var (
+	// 最近一次回收发现的孤儿资源数量
+	containerOrphanResources = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "a1ctf_container_orphan_resources",
+		Help: "Number of orphaned challenge resources found by the last garbage collection",
+	}, []string{"kind"})
+
+	// 已经删除的孤儿资源
+	containerOrphanDeleted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "a1ctf_container_orphan_deleted_total",
+		Help: "Total number of orphaned challenge resources deleted",
+	}, []string{"kind", "status"})
+
+	// 数据库里的状态和后端不一致的次数
+	containerStatusDrift = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "a1ctf_container_status_drift_total",
+		Help: "Total number of container rows corrected because the instance was missing",
+	}, []string{"from", "to"})
+
+	containerGCLastRun = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "a1ctf_container_gc_last_run_timestamp_seconds",
+		Help: "Unix timestamp of the last finished container garbage collection",
+	})
+
+	containerGCDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "a1ctf_container_gc_duration_seconds",
+		Help:    "Container garbage collection duration in seconds",
+		Buckets: []float64{0.1, 0.5, 1, 2, 5, 10, 30},
+	})
+)
+
+// RecordContainerOrphans 记录一次回收发现的孤儿资源，没有出现的类型清零
+func RecordContainerOrphans(orphans map[string]int) {
+	containerOrphanResources.Reset()
+	for kind, count := range orphans {
+		containerOrphanResources.WithLabelValues(kind).Set(float64(count))
+	}
+}
+
+// RecordContainerOrphanDeleted 记录删除孤儿资源的结果
+func RecordContainerOrphanDeleted(kind string, err error) {
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	containerOrphanDeleted.WithLabelValues(kind, status).Inc()
+}
+
+// RecordContainerDrift 记录修正的数据库状态
+func RecordContainerDrift(from string, to string) {
+	containerStatusDrift.WithLabelValues(from, to).Inc()
+}
+
+// RecordContainerGC 记录一次回收的耗时
+func RecordContainerGC(start time.Time) {
+	containerGCDuration.Observe(time.Since(start).Seconds())
+	containerGCLastRun.Set(float64(time.Now().Unix()))
+}
@@ -26,7 +26,7 @@ func NewFlagAntiCheatTask(judge models.Judge) error {
 
 	task := asynq.NewTask(TypeAntiCheat, payload)
 	// taskID 是为了防止重复创建任务
-	_, err = client.Enqueue(task, asynq.TaskID(fmt.Sprintf("flag_antiCheat_%d_%d_%d", judge.TeamID, judge.GameID, judge.ChallengeID)),
+	_, err = client.Enqueue(task, asynq.TaskID(fmt.Sprintf("flag_antiCheat_%s", judge.JudgeID)),
 		asynq.MaxRetry(100),
 		asynq.Timeout(10*time.Second),
 	)
@@ -41,7 +41,14 @@ func HandleFlagAntiCheatTask(ctx context.Context, t *asynq.Task) error {
 	}
 
 	var judge models.Judge
-	dbtool.DB().Model(&models.Judge{}).Where("judge_id = ?", p.Judge.JudgeID).Preload("TeamFlag").Preload("Challenge").First(&judge)
+	if err := dbtool.DB().Model(&models.Judge{}).Where("judge_id = ?", p.Judge.JudgeID).Preload("TeamFlag").Preload("Challenge").Preload("Game").Preload("Team").First(&judge).Error; err != nil {
+		return fmt.Errorf("failed to load judge %s: %w", p.Judge.JudgeID, err)
+	}
+
+	// 判题是异步的，还没出结果的时候等重试。必须在写入任何作弊记录之前检查，否则每次重试都会重复插入
+	if judge.JudgeStatus == models.JudgeQueueing || judge.JudgeStatus == models.JudgeRunning {
+		return fmt.Errorf("judge %s is still running, retry", judge.JudgeID)
+	}
 
 	if judge.TeamFlag.FlagContent != judge.JudgeContent && judge.Challenge.FlagType == models.FlagTypeDynamic {
 		// 如果 flag 不一致，需要检查是否是别的队伍的 Flag
@@ -52,18 +59,19 @@ func HandleFlagAntiCheatTask(ctx context.Context, t *asynq.Task) error {
 				CheatID:     uuid.NewString(),
 				CheatType:   models.CheatSubmitSomeonesFlag,
 				GameID:      judge.GameID,
-				IngameID:    judge.IngameID,
-				ChallengeID: judge.ChallengeID,
+				IngameID:    &judge.IngameID,
+				ChallengeID: &judge.ChallengeID,
 				TeamID:      judge.TeamID,
 				FlagID:      &teamFlag.FlagID,
-				JudgeID:     judge.JudgeID,
-				SubmiterID:  judge.SubmiterID,
+				JudgeID:     &judge.JudgeID,
+				SubmiterID:  &judge.SubmiterID,
 				CheatTime:   judge.JudgeTime,
 				SubmiterIP:  judge.SubmiterIP,
 				ExtraData: models.CheatExtraData{
 					RelevantTeam:     teamFlag.TeamID,
 					RelevantTeamName: teamFlag.Team.TeamName,
 				},
+				Confidence: 1,
 			}
 
 			if err := dbtool.DB().Create(cheat).Error; err != nil {
@@ -72,7 +80,132 @@ func HandleFlagAntiCheatTask(ctx context.Context, t *asynq.Task) error {
 		}
 	}
 
-	// TODO 检查是否在未下载附件或者未启动靶机的情况下提交正确 flag
+	// 检查是否在未下载附件或者未启动靶机的情况下提交正确 flag
+	if judge.JudgeStatus == models.JudgeAC && judge.Team.TeamType != models.TeamTypeAdmin {
+		if err := checkSubmitWithoutDownloadAttachments(&judge); err != nil {
+			return err
+		}
+		if err := checkSubmitWithoutStartContainer(&judge); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 附件下载和靶机启动只会通过平台接口记录，远程附件无法统计
+func challengeHasTrackedAttachments(challenge models.Challenge) bool {
+	for _, attachment := range challenge.Attachments {
+		if attachment.AttachType == models.AttachmentTypeStaticFile || attachment.AttachType == models.AttachmentTypeDynamicFile {
+			return true
+		}
+	}
+	return false
+}
+
+// 同一个队伍同一道题同一种作弊类型只记录一次
+func cheatRecorded(judge *models.Judge, cheatType models.CheatType) (bool, error) {
+	var count int64
+	if err := dbtool.DB().Model(&models.Cheat{}).Where("team_id = ? AND ingame_id = ? AND cheat_type = ?", judge.TeamID, judge.IngameID, cheatType).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// 根据第一次操作的时间构造 CheatExtraData，firstActionTime 为空表示从来没有操作过
+func buildActionExtraData(judge *models.Judge, firstActionTime *time.Time) models.CheatExtraData {
+	extraData := models.CheatExtraData{}
+
+	sinceGameStart := int64(judge.JudgeTime.Sub(judge.Game.StartTime).Seconds())
+	extraData.SinceGameStart = &sinceGameStart
+
+	if firstActionTime != nil {
+		actionDelta := int64(firstActionTime.Sub(judge.JudgeTime).Seconds())
+		extraData.ActionTime = firstActionTime
+		extraData.ActionDelta = &actionDelta
+	}
+
+	return extraData
+}
+
+func saveActionCheat(judge *models.Judge, cheatType models.CheatType, extraData models.CheatExtraData) {
+	cheat := models.Cheat{
+		CheatID:     uuid.NewString(),
+		CheatType:   cheatType,
+		GameID:      judge.GameID,
+		IngameID:    &judge.IngameID,
+		ChallengeID: &judge.ChallengeID,
+		TeamID:      judge.TeamID,
+		FlagID:      judge.FlagID,
+		JudgeID:     &judge.JudgeID,
+		SubmiterID:  &judge.SubmiterID,
+		CheatTime:   judge.JudgeTime,
+		SubmiterIP:  judge.SubmiterIP,
+		ExtraData:   extraData,
+		Confidence:  1,
+	}
+
+	if err := dbtool.DB().Create(&cheat).Error; err != nil {
+		zaphelper.Logger.Error("Failed to save cheat info for game ", zap.Error(err), zap.Int64("game_id", judge.GameID), zap.Any("cheat_data", cheat))
+	}
+}
+
+func checkSubmitWithoutDownloadAttachments(judge *models.Judge) error {
+	if !challengeHasTrackedAttachments(judge.Challenge) {
+		return nil
+	}
+
+	recorded, err := cheatRecorded(judge, models.CheatSubmitWithoutDownloadAttachments)
+	if err != nil {
+		return fmt.Errorf("failed to check cheat records: %w", err)
+	}
+	if recorded {
+		return nil
+	}
+
+	var downloads []models.AttachmentDownload
+	if err := dbtool.DB().Where("team_id = ? AND ingame_id = ?", judge.TeamID, judge.IngameID).Order("download_time ASC").Limit(1).Find(&downloads).Error; err != nil {
+		return fmt.Errorf("failed to load attachment downloads: %w", err)
+	}
+
+	var firstDownloadTime *time.Time
+	if len(downloads) > 0 {
+		if !downloads[0].DownloadTime.After(judge.JudgeTime) {
+			return nil
+		}
+		firstDownloadTime = &downloads[0].DownloadTime
+	}
+
+	saveActionCheat(judge, models.CheatSubmitWithoutDownloadAttachments, buildActionExtraData(judge, firstDownloadTime))
+	return nil
+}
+
+func checkSubmitWithoutStartContainer(judge *models.Judge) error {
+	if judge.Challenge.ContainerType != models.DYNAMIC_CONTAINER {
+		return nil
+	}
+
+	recorded, err := cheatRecorded(judge, models.CheatSubmitWithoutStartContainer)
+	if err != nil {
+		return fmt.Errorf("failed to check cheat records: %w", err)
+	}
+	if recorded {
+		return nil
+	}
+
+	var containers []models.Container
+	if err := dbtool.DB().Where("team_id = ? AND ingame_id = ?", judge.TeamID, judge.IngameID).Order("start_time ASC").Limit(1).Find(&containers).Error; err != nil {
+		return fmt.Errorf("failed to load containers: %w", err)
+	}
+
+	var firstStartTime *time.Time
+	if len(containers) > 0 {
+		if !containers[0].StartTime.After(judge.JudgeTime) {
+			return nil
+		}
+		firstStartTime = &containers[0].StartTime
+	}
 
+	saveActionCheat(judge, models.CheatSubmitWithoutStartContainer, buildActionExtraData(judge, firstStartTime))
 	return nil
 }
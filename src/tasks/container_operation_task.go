@@ -5,6 +5,7 @@ import (
 	dbtool "a1ctf/src/utils/db_tool"
 	"context"
 	"fmt"
+	"time"
 
 	"a1ctf/src/utils/zaphelper"
 
@@ -13,6 +14,7 @@ import (
 	"go.uber.org/zap"
 
 	k8stool "a1ctf/src/utils/k8s_tool"
+	redistool "a1ctf/src/utils/redis_tool"
 )
 
 type ContainerFailedPayload struct {
@@ -56,23 +58,88 @@ func NewContainerFailedTask(data models.Container, podStatus k8stool.PodStatusDe
 	return err
 }
 
+const warmPodClaimLockTime = 30 * time.Second
+
+// 领取一个空闲的预热实例，pod_name 有唯一索引，同一个预热实例只能被一个容器领取，
+// 领取的时候持有预热实例的锁，避免预热池任务在检查之后把刚领取的实例删掉
+func claimWarmPod(task *models.Container) bool {
+	var gameChallenge models.GameChallenge
+	if err := dbtool.DB().Select("warm_pool_size").Where("ingame_id = ?", task.InGameID).First(&gameChallenge).Error; err != nil || gameChallenge.WarmPoolSize <= 0 {
+		return false
+	}
+
+	instances, err := k8stool.ListInstances()
+	if err != nil {
+		zaphelper.Logger.Error("Failed to list pods", zap.Error(err))
+		return false
+	}
+
+	configHash := k8stool.WarmConfigHash(task.ContainerConfig, task.Challenge.AllowWAN, task.Challenge.AllowDNS)
+	for _, instance := range instances {
+		if !k8stool.IsWarmPod(instance.Name) ||
+			instance.Labels["ingame_id"] != fmt.Sprintf("%d", task.InGameID) ||
+			instance.Labels[k8stool.LabelWarmConfig] != configHash ||
+			instance.Status.Status != k8stool.CustomPodRunning {
+			continue
+		}
+
+		// 拿不到锁说明实例正在被删除或者被别的容器领取
+		podName := instance.Name
+		lockName := k8stool.WarmPodLockName(podName)
+		lockToken, locked := redistool.LockWithToken(lockName, warmPodClaimLockTime)
+		if !locked {
+			continue
+		}
+
+		err := dbtool.DB().Model(task).Update("pod_name", podName).Error
+		if unlockErr := redistool.UnlockWithToken(lockName, lockToken); unlockErr != nil {
+			zaphelper.Logger.Error("Failed to release warm pod lock", zap.Error(unlockErr), zap.String("lock", lockName))
+		}
+		if err != nil {
+			continue
+		}
+		task.PodName = &podName
+		return true
+	}
+
+	return false
+}
+
 func HandleContainerStartTask(ctx context.Context, t *asynq.Task) error {
 	var task models.Container
 	if err := msgpack.Unmarshal(t.Payload(), &task); err != nil {
 		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
 	}
 
+	// 重置之后重新启动的容器不再使用之前领取的实例
+	if task.PodName != nil {
+		if err := dbtool.DB().Model(&task).Update("pod_name", nil).Error; err != nil {
+			return fmt.Errorf("failed to clear pod name: %v", err)
+		}
+		task.PodName = nil
+	}
+
+	// 有预热实例的时候直接领取，flag 等实例运行之后由定时任务写入
+	if claimWarmPod(&task) {
+		zaphelper.Logger.Info("Claimed warm pod", zap.String("container_id", task.ContainerID), zap.String("pod_name", task.InstanceName()))
+		if err := dbtool.DB().Model(&task).Update("container_status", models.ContainerStarting).Error; err != nil {
+			return fmt.Errorf("failed to update container status: %v", err)
+		}
+		return nil
+	}
+
 	podInfo := k8stool.PodInfo{
-		Name:       fmt.Sprintf("cl-%d-%s", task.InGameID, task.TeamHash),
+		Name:       task.InstanceName(),
 		TeamHash:   task.TeamHash,
 		Containers: task.ContainerConfig,
 		Labels: map[string]string{
 			"team_hash": task.TeamHash,
 			"ingame_id": fmt.Sprintf("%d", task.InGameID),
 		},
-		Flag:     task.TeamFlag.FlagContent,
-		AllowWAN: task.Challenge.AllowWAN,
-		AllowDNS: task.Challenge.AllowDNS,
+		Flag:           task.TeamFlag.FlagContent,
+		AllowWAN:       task.Challenge.AllowWAN,
+		AllowDNS:       task.Challenge.AllowDNS,
+		HTTPHostPrefix: task.HTTPHostPrefix(),
 	}
 
 	err := k8stool.CreatePod(&podInfo)
@@ -119,16 +186,17 @@ func HandleContainerStopTask(ctx context.Context, t *asynq.Task) error {
 	}
 
 	podInfo := k8stool.PodInfo{
-		Name:       fmt.Sprintf("cl-%d-%s", task.InGameID, task.TeamHash),
+		Name:       task.InstanceName(),
 		TeamHash:   task.TeamHash,
 		Containers: task.ContainerConfig,
 		Labels: map[string]string{
 			"team_hash": task.TeamHash,
 			"ingame_id": fmt.Sprintf("%d", task.InGameID),
 		},
-		Flag:     task.TeamFlag.FlagContent,
-		AllowWAN: task.Challenge.AllowWAN,
-		AllowDNS: task.Challenge.AllowDNS,
+		Flag:           task.TeamFlag.FlagContent,
+		AllowWAN:       task.Challenge.AllowWAN,
+		AllowDNS:       task.Challenge.AllowDNS,
+		HTTPHostPrefix: task.HTTPHostPrefix(),
 	}
 
 	err := k8stool.DeletePod(&podInfo)
@@ -186,16 +254,17 @@ func HandleContainerFailedTask(ctx context.Context, t *asynq.Task) error {
 	podStatus := payload.PodStatus
 
 	podInfo := k8stool.PodInfo{
-		Name:       fmt.Sprintf("cl-%d-%s", task.InGameID, task.TeamHash),
+		Name:       task.InstanceName(),
 		TeamHash:   task.TeamHash,
 		Containers: task.ContainerConfig,
 		Labels: map[string]string{
 			"team_hash": task.TeamHash,
 			"ingame_id": fmt.Sprintf("%d", task.InGameID),
 		},
-		Flag:     task.TeamFlag.FlagContent,
-		AllowWAN: task.Challenge.AllowWAN,
-		AllowDNS: task.Challenge.AllowDNS,
+		Flag:           task.TeamFlag.FlagContent,
+		AllowWAN:       task.Challenge.AllowWAN,
+		AllowDNS:       task.Challenge.AllowDNS,
+		HTTPHostPrefix: task.HTTPHostPrefix(),
 	}
 
 	err := k8stool.DeletePod(&podInfo)
@@ -243,3 +312,51 @@ func HandleContainerFailedTask(ctx context.Context, t *asynq.Task) error {
 
 	return nil
 }
+
+// NewContainerResetTask 重置实例，调用之前容器状态已经改成 Queueing，
+// Pod 删除干净后定时任务会用最新的 flag 和题目配置重新创建
+func NewContainerResetTask(data models.Container) error {
+	payload, err := msgpack.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	task := asynq.NewTask(TypeResetContainer, payload)
+	_, err = client.Enqueue(task, asynq.TaskID(fmt.Sprintf("container_reset_for_%d_%d", data.TeamID, data.InGameID)))
+	return err
+}
+
+func HandleContainerResetTask(ctx context.Context, t *asynq.Task) error {
+	var task models.Container
+	if err := msgpack.Unmarshal(t.Payload(), &task); err != nil {
+		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+	}
+
+	podInfo := k8stool.PodInfo{
+		Name:       task.InstanceName(),
+		TeamHash:   task.TeamHash,
+		Containers: task.ContainerConfig,
+		Labels: map[string]string{
+			"team_hash": task.TeamHash,
+			"ingame_id": fmt.Sprintf("%d", task.InGameID),
+		},
+	}
+
+	// 只删除 Pod，不修改容器状态
+	err := k8stool.DeletePod(&podInfo)
+	LogContainerOperation(nil, nil, models.ActionContainerStopping, task.ContainerID, map[string]interface{}{
+		"game_id":        task.GameID,
+		"team_id":        task.TeamID,
+		"team_hash":      task.TeamHash,
+		"challenge_name": task.ChallengeName,
+		"ingame_id":      task.InGameID,
+		"pod_name":       podInfo.Name,
+		"container_id":   task.ContainerID,
+		"reset":          true,
+	}, err)
+	if err != nil {
+		return fmt.Errorf("DeletePod %+v error: %v", task, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,251 @@
+package tasks
+
+import (
+	"a1ctf/src/db/models"
+	dbtool "a1ctf/src/utils/db_tool"
+	judgetool "a1ctf/src/utils/judge_tool"
+	redistool "a1ctf/src/utils/redis_tool"
+	solvetool "a1ctf/src/utils/solve_tool"
+	"a1ctf/src/utils/zaphelper"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+	"github.com/vmihailenco/msgpack/v5"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	judgeLockTime = 30 * time.Second
+	// 拿不到锁之后重新投递的延迟
+	judgeLockWaitDelay = 500 * time.Millisecond
+)
+
+var errJudgeLocked = errors.New("another judge for this team and challenge is running")
+
+type JudgeFlagPayload struct {
+	JudgeID  string `json:"judge_id"`
+	TeamID   int64  `json:"team_id"`
+	IngameID int64  `json:"ingame_id"`
+}
+
+func NewJudgeFlagTask(judge models.Judge) error {
+	// 用 judge_id 作为 taskID，同一个 judge 只会入队一次
+	return enqueueJudgeFlagTask(judge, fmt.Sprintf("judge_flag_%s", judge.JudgeID))
+}
+
+// NewRecoverJudgeFlagTask 重新投递卡住的 judge。原来的任务可能已经被归档，继续用原来的 taskID 会一直冲突，
+// 所以恢复任务按 window 分桶生成新的 taskID，同一个时间窗口里只会投递一次
+func NewRecoverJudgeFlagTask(judge models.Judge, window time.Duration) error {
+	bucket := time.Now().UTC().Truncate(window).Unix()
+	return enqueueJudgeFlagTask(judge, fmt.Sprintf("judge_flag_recover_%s_%d", judge.JudgeID, bucket))
+}
+
+// 拿不到锁的时候不计入重试次数，隔一小段时间用新的 taskID 重新投递，前一个判题脚本再慢也不会把任务耗到归档
+func requeueLockedJudgeFlagTask(judge models.Judge) error {
+	taskID := fmt.Sprintf("judge_flag_wait_%s_%d", judge.JudgeID, time.Now().UnixNano())
+	return enqueueJudgeFlagTask(judge, taskID, asynq.ProcessIn(judgeLockWaitDelay))
+}
+
+func enqueueJudgeFlagTask(judge models.Judge, taskID string, opts ...asynq.Option) error {
+	payload, err := msgpack.Marshal(JudgeFlagPayload{
+		JudgeID:  judge.JudgeID,
+		TeamID:   judge.TeamID,
+		IngameID: judge.IngameID,
+	})
+	if err != nil {
+		return err
+	}
+
+	task := asynq.NewTask(TypeJudgeFlag, payload)
+	opts = append([]asynq.Option{
+		asynq.TaskID(taskID),
+		asynq.Queue("critical"),
+		asynq.MaxRetry(20),
+		asynq.Timeout(judgeLockTime),
+	}, opts...)
+	_, err = client.Enqueue(task, opts...)
+
+	if errors.Is(err, asynq.ErrTaskIDConflict) {
+		return nil
+	}
+
+	return err
+}
+
+// 判题任务拿不到锁并且重新投递失败的时候需要尽快重试，其他任务保持 asynq 默认的重试间隔
+func judgeRetryDelay(n int, e error, t *asynq.Task) time.Duration {
+	if t.Type() == TypeJudgeFlag && errors.Is(e, errJudgeLocked) {
+		return time.Duration(n+1) * 200 * time.Millisecond
+	}
+	return asynq.DefaultRetryDelayFunc(n, e, t)
+}
+
+// flag 正确之后插入解题记录，排名和三血公告在同一个事务里完成
+func acceptJudge(judge *models.Judge) error {
+	// 如果是系统管理员队伍，不插入 Solves，防止影响积分榜
+	if judge.Team.TeamType == models.TeamTypeAdmin {
+		judge.JudgeStatus = models.JudgeAC
+		return nil
+	}
+
+	newSolve := models.Solve{
+		IngameID:    judge.IngameID,
+		JudgeID:     judge.JudgeID,
+		SolveID:     uuid.NewString(),
+		GameID:      judge.GameID,
+		ChallengeID: judge.ChallengeID,
+		TeamID:      judge.TeamID,
+		SolveStatus: models.SolveCorrect,
+		SolveTime:   time.Now().UTC(),
+		SolverID:    judge.SubmiterID,
+	}
+
+	if err := solvetool.CreateSolve(&newSolve, judge.Team.TeamName, judge.Challenge.Name); err != nil {
+		// 队伍已经解出过这道题，重复提交的正确 flag 不再插入解题记录
+		if errors.Is(err, solvetool.ErrAlreadySolved) {
+			judge.JudgeStatus = models.JudgeAC
+			return nil
+		}
+
+		judge.JudgeStatus = models.JudgeError
+		LogJudgeOperation(nil, nil, models.ActionJudge, judge.JudgeID, map[string]interface{}{
+			"team_id": judge.TeamID,
+			"game_id": judge.GameID,
+			"judge":   judge,
+		}, err)
+		return fmt.Errorf("database error: %w data: %+v", err, judge)
+	}
+
+	judge.JudgeStatus = models.JudgeAC
+	return nil
+}
+
+func processQueueingJudge(ctx context.Context, judge *models.Judge) error {
+	switch judge.JudgeType {
+	case models.JudgeTypeDynamic:
+		flagCorrect := false
+
+		switch judge.Challenge.FlagType {
+		case models.FlagTypeDynamic:
+			// 动态和TeamFlag库里的比较
+			flagCorrect = judge.JudgeContent == judge.TeamFlag.FlagContent
+		case models.FlagTypeStatic:
+			// 静态直接比较
+			flagCorrect = judge.JudgeContent == *judge.GameChallenge.JudgeConfig.FlagTemplate
+		}
+
+		if flagCorrect {
+			return acceptJudge(judge)
+		} else {
+			judge.JudgeStatus = models.JudgeWA
+			return nil
+		}
+	case models.JudgeTypeScript:
+		judgeConfig := judge.GameChallenge.JudgeConfig
+		if judgeConfig == nil || judgeConfig.JudgeScript == nil {
+			judge.JudgeStatus = models.JudgeError
+			return fmt.Errorf("judge script not found for ingame_id %d", judge.IngameID)
+		}
+
+		result, err := judgetool.RunJudgeScript(ctx, *judgeConfig.JudgeScript, judgetool.ScriptJudgeInput{
+			Submission: judge.JudgeContent,
+			TeamHash:   judge.Team.TeamHash,
+			GameID:     judge.GameID,
+		})
+		if err != nil {
+			judge.JudgeStatus = models.JudgeError
+			return fmt.Errorf("run judge script failed: %w", err)
+		}
+
+		// 脚本输出只给管理员看，方便排查判题脚本的问题
+		judge.JudgeResult = result.Output
+
+		switch result.Status {
+		case models.JudgeAC:
+			return acceptJudge(judge)
+		case models.JudgeError:
+			judge.JudgeStatus = models.JudgeError
+			return fmt.Errorf("judge script exited with code %d", result.ExitCode)
+		default:
+			judge.JudgeStatus = result.Status
+			return nil
+		}
+	default:
+		judge.JudgeStatus = models.JudgeError
+		return fmt.Errorf("unknown judge type: %s", judge.JudgeType)
+	}
+}
+
+// 按提交顺序处理同一个队伍同一道题下所有还没判完的 judge
+func judgePendingForTeamChallenge(ctx context.Context, teamID int64, ingameID int64) error {
+	var judges []models.Judge
+	if err := dbtool.DB().Where(
+		"team_id = ? AND ingame_id = ? AND judge_status IN (?)",
+		teamID, ingameID, []interface{}{models.JudgeQueueing, models.JudgeRunning},
+	).Order("judge_time ASC").Preload("TeamFlag").Preload("GameChallenge").Preload("Challenge").Preload("Team").Find(&judges).Error; err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	for _, judge := range judges {
+		// 先标记为 JudgeRunning，如果 worker 在判题过程中挂掉，恢复任务会重新投递
+		if err := dbtool.DB().Model(&models.Judge{}).Where("judge_id = ?", judge.JudgeID).Update("judge_status", models.JudgeRunning).Error; err != nil {
+			return fmt.Errorf("database error: %w", err)
+		}
+
+		if err := processQueueingJudge(ctx, &judge); err != nil {
+			zaphelper.Logger.Error("Judge task failed", zap.Error(err), zap.Any("judge", judge))
+		}
+
+		if err := dbtool.DB().Model(&models.Judge{}).Where("judge_id = ?", judge.JudgeID).Updates(map[string]interface{}{
+			"judge_status": judge.JudgeStatus,
+			"judge_result": judge.JudgeResult,
+		}).Error; err != nil {
+			return fmt.Errorf("database error: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func HandleJudgeFlagTask(ctx context.Context, t *asynq.Task) error {
+	var p JudgeFlagPayload
+	if err := msgpack.Unmarshal(t.Payload(), &p); err != nil {
+		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+	}
+
+	var judge models.Judge
+	if err := dbtool.DB().Where("judge_id = ?", p.JudgeID).First(&judge).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("judge %s not found: %w", p.JudgeID, asynq.SkipRetry)
+		}
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	// 已经判过的 judge 直接跳过，保证重复投递不会重复判题
+	if judge.JudgeStatus != models.JudgeQueueing && judge.JudgeStatus != models.JudgeRunning {
+		return nil
+	}
+
+	// 同一个队伍同一道题同时只允许一个 worker 判题，保证按提交顺序处理
+	lockName := fmt.Sprintf("judge_lock_%d_%d", p.TeamID, p.IngameID)
+	lockToken, locked := redistool.LockWithToken(lockName, judgeLockTime)
+	if !locked {
+		if err := requeueLockedJudgeFlagTask(judge); err != nil {
+			zaphelper.Logger.Error("Failed to requeue locked judge", zap.Error(err), zap.String("judge_id", judge.JudgeID))
+			return errJudgeLocked
+		}
+		return nil
+	}
+	defer func() {
+		if err := redistool.UnlockWithToken(lockName, lockToken); err != nil {
+			zaphelper.Logger.Error("Failed to release judge lock", zap.Error(err), zap.String("lock", lockName))
+		}
+	}()
+
+	return judgePendingForTeamChallenge(ctx, p.TeamID, p.IngameID)
+}
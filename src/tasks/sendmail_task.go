@@ -7,6 +7,7 @@ import (
 	"a1ctf/src/utils/zaphelper"
 	"context"
 	"fmt"
+	"html"
 	"strings"
 	"time"
 
@@ -23,15 +24,24 @@ const (
 	MailTaskTypeEmailVerification MailTaskType = "emailVerification"
 	MailTaskTypeSendTestMail      MailTaskType = "emailSendTestMail"
 	MailTaskTypeForgetPassword    MailTaskType = "forgetPasswordEmail"
+	MailTaskTypeTeamJoinResult    MailTaskType = "teamJoinResultEmail"
 )
 
 type EmailVerificationData struct {
 	User models.User
 }
 
+type TeamJoinResultData struct {
+	User     models.User
+	TeamName string
+	GameName string
+	Approved bool
+}
+
 type SendMailTaskPayload struct {
 	MailSendType          MailTaskType
 	EmailVerificationData *EmailVerificationData
+	TeamJoinResultData    *TeamJoinResultData
 	SendTestMailTo        *string
 	TestMailType          *string
 }
@@ -96,6 +106,39 @@ func NewForgePasswordEmailTask(user models.User) error {
 	return err
 }
 
+// NewTeamJoinResultMailTask 通知申请人入队申请的处理结果
+func NewTeamJoinResultMailTask(user models.User, teamName string, gameName string, approved bool) error {
+	if err := checkEmailConfig(); err != nil {
+		return err
+	}
+
+	if user.Email == nil || *user.Email == "" {
+		return fmt.Errorf("user %s has no email", user.UserID)
+	}
+
+	payload, err := msgpack.Marshal(SendMailTaskPayload{
+		MailSendType: MailTaskTypeTeamJoinResult,
+		TeamJoinResultData: &TeamJoinResultData{
+			User:     user,
+			TeamName: teamName,
+			GameName: gameName,
+			Approved: approved,
+		},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	task := asynq.NewTask(TypeSendMail, payload)
+	_, err = client.Enqueue(task,
+		asynq.MaxRetry(3),
+		asynq.Timeout(10*time.Second),
+	)
+
+	return err
+}
+
 func NewSendTestMailTask(to string, mailType string) error {
 	if err := checkEmailConfig(); err != nil {
 		return err
@@ -183,6 +226,18 @@ func HandleSendMailTask(ctx context.Context, t *asynq.Task) error {
 		mailTeamplate = strings.ReplaceAll(mailTeamplate, "{reset_link}", reset_url)
 
 		m.SetBody("text/html", mailTeamplate)
+	case MailTaskTypeTeamJoinResult:
+		data := p.TeamJoinResultData
+		m.SetAddressHeader("To", *data.User.Email, data.User.Username)
+
+		result := "已被拒绝"
+		if data.Approved {
+			result = "已通过"
+		}
+
+		m.SetHeader("Subject", fmt.Sprintf("[%s] 入队申请%s", data.GameName, result))
+		m.SetBody("text/html", fmt.Sprintf("<p>%s，你好：</p><p>你在比赛 %s 中加入队伍 %s 的申请%s。</p>",
+			html.EscapeString(data.User.Username), html.EscapeString(data.GameName), html.EscapeString(data.TeamName), result))
 	case MailTaskTypeSendTestMail:
 		m.SetAddressHeader("To", *p.SendTestMailTo, "EMMMMMMMMM")
 
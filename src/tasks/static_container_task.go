@@ -0,0 +1,138 @@
+package tasks
+
+import (
+	"a1ctf/src/db/models"
+	dbtool "a1ctf/src/utils/db_tool"
+	"context"
+	"fmt"
+	"time"
+
+	"a1ctf/src/utils/zaphelper"
+
+	"github.com/hibiken/asynq"
+	"github.com/vmihailenco/msgpack/v5"
+	"go.uber.org/zap"
+
+	k8stool "a1ctf/src/utils/k8s_tool"
+)
+
+// StaticContainerPodInfo 共享静态容器的 Pod 信息，没有 team_hash 标签，不会被队伍容器的同步逻辑匹配到
+func StaticContainerPodInfo(task models.StaticContainer) k8stool.PodInfo {
+	flag := ""
+	if task.GameChallenge.JudgeConfig != nil && task.GameChallenge.JudgeConfig.FlagTemplate != nil {
+		flag = *task.GameChallenge.JudgeConfig.FlagTemplate
+	}
+
+	return k8stool.PodInfo{
+		Name:       fmt.Sprintf("cs-%d", task.InGameID),
+		Containers: task.ContainerConfig,
+		Labels: map[string]string{
+			"ingame_id":        fmt.Sprintf("%d", task.InGameID),
+			"static_container": "true",
+		},
+		Flag:           flag,
+		AllowWAN:       task.Challenge.AllowWAN,
+		AllowDNS:       task.Challenge.AllowDNS,
+		HealthCheck:    true,
+		HTTPHostPrefix: k8stool.HTTPHostPrefix("", task.InGameID),
+	}
+}
+
+func staticContainerLogDetails(task models.StaticContainer, podName string) map[string]interface{} {
+	return map[string]interface{}{
+		"game_id":               task.GameID,
+		"challenge_name":        task.ChallengeName,
+		"ingame_id":             task.InGameID,
+		"pod_name":              podName,
+		"container_id":          task.ContainerID,
+		"container_expose_info": task.ContainerExposeInfos,
+		"restart_count":         task.RestartCount,
+		"static_container":      true,
+	}
+}
+
+func NewStaticContainerStartTask(data models.StaticContainer) error {
+	payload, err := msgpack.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	task := asynq.NewTask(TypeStartStaticContainer, payload)
+	_, err = client.Enqueue(task, asynq.TaskID(fmt.Sprintf("static_container_start_for_%d", data.InGameID)))
+	return err
+}
+
+func NewStaticContainerStopTask(data models.StaticContainer) error {
+	payload, err := msgpack.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	task := asynq.NewTask(TypeStopStaticContainer, payload)
+	_, err = client.Enqueue(task, asynq.TaskID(fmt.Sprintf("static_container_stop_for_%d", data.InGameID)))
+	return err
+}
+
+// RestartStaticContainer 删除共享实例的 Pod 并重新排队，等 Pod 删除干净后由定时任务重新启动
+func RestartStaticContainer(data models.StaticContainer, reason string) error {
+	now := time.Now().UTC()
+	if err := dbtool.DB().Model(&data).Updates(map[string]interface{}{
+		"container_status":  models.ContainerQueueing,
+		"expose_ports":      models.ContainerExposeInfos{},
+		"unhealthy_since":   nil,
+		"restart_count":     data.RestartCount + 1,
+		"last_restart_time": now,
+		"last_error":        reason,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to update static container status: %w", err)
+	}
+
+	data.RestartCount += 1
+	return NewStaticContainerStopTask(data)
+}
+
+func HandleStaticContainerStartTask(ctx context.Context, t *asynq.Task) error {
+	var task models.StaticContainer
+	if err := msgpack.Unmarshal(t.Payload(), &task); err != nil {
+		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+	}
+
+	podInfo := StaticContainerPodInfo(task)
+
+	err := k8stool.CreatePod(&podInfo)
+	if err != nil {
+		LogContainerOperation(nil, nil, models.ActionContainerStarting, task.ContainerID, staticContainerLogDetails(task, podInfo.Name), err)
+		zaphelper.Logger.Error("CreatePod for static container", zap.Error(err), zap.Any("task", task))
+
+		// 清理掉创建了一半的资源，定时任务会按照重启间隔再次尝试
+		_ = k8stool.DeletePod(&podInfo)
+		errMsg := err.Error()
+		dbtool.DB().Model(&task).Updates(map[string]interface{}{
+			"container_status": models.ContainerError,
+			"last_error":       errMsg,
+		})
+		return fmt.Errorf("CreatePod %+v error: %v: %w", task, err, asynq.SkipRetry)
+	}
+
+	LogContainerOperation(nil, nil, models.ActionContainerStarting, task.ContainerID, staticContainerLogDetails(task, podInfo.Name), nil)
+	return nil
+}
+
+func HandleStaticContainerStopTask(ctx context.Context, t *asynq.Task) error {
+	var task models.StaticContainer
+	if err := msgpack.Unmarshal(t.Payload(), &task); err != nil {
+		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+	}
+
+	podInfo := StaticContainerPodInfo(task)
+
+	// 容器状态在入队之前已经更新过了，这里只负责删除 Pod
+	err := k8stool.DeletePod(&podInfo)
+	if err != nil {
+		LogContainerOperation(nil, nil, models.ActionContainerStopping, task.ContainerID, staticContainerLogDetails(task, podInfo.Name), err)
+		return fmt.Errorf("DeletePod %+v error: %v", task, err)
+	}
+
+	LogContainerOperation(nil, nil, models.ActionContainerStopped, task.ContainerID, staticContainerLogDetails(task, podInfo.Name), nil)
+	return nil
+}
@@ -43,6 +43,7 @@ func InitTaskQueue() {
 					"low":      1,
 				},
 				StrictPriority: true,
+				RetryDelayFunc: judgeRetryDelay,
 				Logger:         zaphelper.NewZapLogger(zaphelper.Logger),
 				// See the godoc for other configuration options
 			},
@@ -55,7 +56,11 @@ func InitTaskQueue() {
 		mux.HandleFunc(TypeStartContainer, HandleContainerStartTask)
 		mux.HandleFunc(TypeStopContainer, HandleContainerStopTask)
 		mux.HandleFunc(TypeContainerFailedOperation, HandleContainerFailedTask)
+		mux.HandleFunc(TypeResetContainer, HandleContainerResetTask)
+		mux.HandleFunc(TypeStartStaticContainer, HandleStaticContainerStartTask)
+		mux.HandleFunc(TypeStopStaticContainer, HandleStaticContainerStopTask)
 
+		mux.HandleFunc(TypeJudgeFlag, HandleJudgeFlagTask)
 		mux.HandleFunc(TypeAntiCheat, HandleFlagAntiCheatTask)
 		mux.HandleFunc(TypeSendMail, HandleSendMailTask)
 
@@ -78,6 +83,9 @@ const (
 	TypeStartContainer           = "container:start"
 	TypeStopContainer            = "container:stop"
 	TypeContainerFailedOperation = "container:failed"
+	TypeResetContainer           = "container:reset"
+	TypeStartStaticContainer     = "staticContainer:start"
+	TypeStopStaticContainer      = "staticContainer:stop"
 	TypeAntiCheat                = "flag:anticheat"
 	TypeSendMail                 = "mail:send"
 )
@@ -0,0 +1,180 @@
+package judgetool
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/spf13/viper"
+)
+
+// 动态附件生成脚本的约定：
+//   - 工作目录里的 template 文件是题目配置的附件模板，生成结果需要写到 output 文件
+//   - 队伍 flag、队伍 hash 等信息通过 stdin (JSON) 和环境变量传入
+//   - 退出码 0 且 output 文件存在表示生成成功，其余情况视为生成失败
+//   - 与判题脚本共用 interpreter 和 sandbox-command 配置
+const (
+	defaultGeneratorTimeout = 30 * time.Second
+	defaultGeneratorMaxSize = 100 * 1024 * 1024
+
+	generatorTemplateName = "template"
+	generatorOutputName   = "output"
+)
+
+var (
+	ErrGenerateScriptEmpty = errors.New("generate script is empty")
+	ErrGeneratorTimeout    = errors.New("attachment generator timeout")
+	ErrGeneratorOutputSize = errors.New("attachment generator output is too large")
+	ErrGeneratorOutputType = errors.New("attachment generator output is not a regular file")
+)
+
+type AttachmentGenerateInput struct {
+	TeamFlag    string `json:"team_flag"`
+	TeamHash    string `json:"team_hash"`
+	TeamID      int64  `json:"team_id"`
+	GameID      int64  `json:"game_id"`
+	ChallengeID int64  `json:"challenge_id"`
+}
+
+type AttachmentGenerateResult struct {
+	FileSize int64  `json:"file_size"`
+	FileHash string `json:"file_hash"`
+	Output   string `json:"output"`
+	TimeCost int64  `json:"time_cost"`
+}
+
+func generatorTimeout() time.Duration {
+	timeout := viper.GetDuration("judge-settings.generator-timeout")
+	if timeout <= 0 {
+		return defaultGeneratorTimeout
+	}
+	return timeout
+}
+
+func generatorMaxSize() int64 {
+	maxSize := viper.GetInt64("judge-settings.generator-max-size")
+	if maxSize <= 0 {
+		return defaultGeneratorMaxSize
+	}
+	return maxSize
+}
+
+// 只复制普通文件，生成脚本可能把 output 做成指向服务器上其他文件的符号链接或者硬链接
+func copyFile(src string, dst string, limit int64) (int64, string, error) {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return 0, "", err
+	}
+	if !info.Mode().IsRegular() {
+		return 0, "", ErrGeneratorOutputType
+	}
+
+	// O_NOFOLLOW 防止 Lstat 之后文件被替换成符号链接
+	in, err := os.OpenFile(src, os.O_RDONLY|syscall.O_NOFOLLOW, 0)
+	if err != nil {
+		return 0, "", err
+	}
+	defer in.Close()
+
+	openedInfo, err := in.Stat()
+	if err != nil {
+		return 0, "", err
+	}
+	if !openedInfo.Mode().IsRegular() || !os.SameFile(info, openedInfo) {
+		return 0, "", ErrGeneratorOutputType
+	}
+	if stat, ok := openedInfo.Sys().(*syscall.Stat_t); ok && stat.Nlink > 1 {
+		return 0, "", ErrGeneratorOutputType
+	}
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return 0, "", err
+	}
+	defer out.Close()
+
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(out, hash), io.LimitReader(in, limit+1))
+	if err != nil {
+		return 0, "", err
+	}
+	if written > limit {
+		return 0, "", ErrGeneratorOutputSize
+	}
+
+	return written, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// RunAttachmentGenerator 在临时目录里运行附件生成脚本，成功后把生成的文件复制到 outputPath
+func RunAttachmentGenerator(ctx context.Context, script string, templatePath string, outputPath string, input AttachmentGenerateInput) (*AttachmentGenerateResult, error) {
+	if script == "" {
+		return nil, ErrGenerateScriptEmpty
+	}
+
+	workDir, err := newScriptWorkDir("a1ctf-generator-", "generator", script)
+	if err != nil {
+		return nil, err
+	}
+	defer workDir.Remove()
+
+	// 模板复制一份进工作目录，避免脚本改动到上传目录里的原文件
+	workTemplatePath := workDir.Path(generatorTemplateName)
+	if _, _, err := copyFile(templatePath, workTemplatePath, generatorMaxSize()); err != nil {
+		return nil, fmt.Errorf("failed to copy attachment template: %w", err)
+	}
+
+	stdin, err := sonic.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal generator input: %w", err)
+	}
+
+	workOutputPath := workDir.Path(generatorOutputName)
+
+	runResult, err := runScript(ctx, workDir, generatorTimeout(), []string{
+		"A1CTF_TEMPLATE=" + workTemplatePath,
+		"A1CTF_OUTPUT=" + workOutputPath,
+		"A1CTF_TEAM_FLAG=" + input.TeamFlag,
+		"A1CTF_TEAM_HASH=" + input.TeamHash,
+		"A1CTF_TEAM_ID=" + strconv.FormatInt(input.TeamID, 10),
+		"A1CTF_GAME_ID=" + strconv.FormatInt(input.GameID, 10),
+		"A1CTF_CHALLENGE_ID=" + strconv.FormatInt(input.ChallengeID, 10),
+	}, stdin)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &AttachmentGenerateResult{
+		Output:   runResult.Output,
+		TimeCost: runResult.TimeCost,
+	}
+
+	if runResult.TimedOut {
+		return result, ErrGeneratorTimeout
+	}
+
+	if runResult.ExitCode != 0 {
+		return result, fmt.Errorf("attachment generator exited with code %d", runResult.ExitCode)
+	}
+
+	fileSize, fileHash, err := copyFile(workOutputPath, outputPath, generatorMaxSize())
+	if err != nil {
+		_ = os.Remove(outputPath)
+		if errors.Is(err, os.ErrNotExist) {
+			return result, fmt.Errorf("attachment generator produced no output: %w", err)
+		}
+		return result, err
+	}
+
+	result.FileSize = fileSize
+	result.FileHash = fileHash
+
+	return result, nil
+}
@@ -0,0 +1,105 @@
+package judgetool
+
+import (
+	"a1ctf/src/db/models"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/spf13/viper"
+)
+
+// 判题脚本的约定：
+//   - 选手提交的内容、队伍 hash、比赛 ID 通过 stdin (JSON) 和环境变量传入
+//   - 退出码 0 表示 flag 正确，退出码 1 表示 flag 错误，其他退出码视为判题脚本出错
+//   - 超过 judge-settings.script-timeout 仍未退出会被强制杀死，结果为 JudgeTimeout
+const (
+	ScriptExitAccepted = 0
+	ScriptExitWrong    = 1
+
+	defaultScriptTimeout   = 5 * time.Second
+	defaultScriptMaxOutput = 4096
+)
+
+var ErrJudgeScriptEmpty = errors.New("judge script is empty")
+
+type ScriptJudgeInput struct {
+	Submission string `json:"submission"`
+	TeamHash   string `json:"team_hash"`
+	GameID     int64  `json:"game_id"`
+}
+
+type ScriptJudgeResult struct {
+	Status   models.JudgeStatus `json:"status"`
+	ExitCode int                `json:"exit_code"`
+	Output   string             `json:"output"`
+	TimeCost int64              `json:"time_cost"`
+}
+
+func scriptTimeout() time.Duration {
+	timeout := viper.GetDuration("judge-settings.script-timeout")
+	if timeout <= 0 {
+		return defaultScriptTimeout
+	}
+	return timeout
+}
+
+func scriptMaxOutput() int {
+	maxOutput := viper.GetInt("judge-settings.script-max-output")
+	if maxOutput <= 0 {
+		return defaultScriptMaxOutput
+	}
+	return maxOutput
+}
+
+// RunJudgeScript 在临时目录中以最小环境变量运行判题脚本，超时后杀死整个进程组
+func RunJudgeScript(ctx context.Context, script string, input ScriptJudgeInput) (*ScriptJudgeResult, error) {
+	if script == "" {
+		return nil, ErrJudgeScriptEmpty
+	}
+
+	workDir, err := newScriptWorkDir("a1ctf-judge-", "judge", script)
+	if err != nil {
+		return nil, err
+	}
+	defer workDir.Remove()
+
+	stdin, err := sonic.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal judge input: %w", err)
+	}
+
+	runResult, err := runScript(ctx, workDir, scriptTimeout(), []string{
+		"A1CTF_SUBMISSION=" + input.Submission,
+		"A1CTF_TEAM_HASH=" + input.TeamHash,
+		"A1CTF_GAME_ID=" + strconv.FormatInt(input.GameID, 10),
+	}, stdin)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ScriptJudgeResult{
+		Output:   runResult.Output,
+		TimeCost: runResult.TimeCost,
+		ExitCode: runResult.ExitCode,
+	}
+
+	if runResult.TimedOut {
+		result.Status = models.JudgeTimeout
+		return result, nil
+	}
+
+	switch result.ExitCode {
+	case ScriptExitAccepted:
+		result.Status = models.JudgeAC
+	case ScriptExitWrong:
+		result.Status = models.JudgeWA
+	default:
+		result.Status = models.JudgeError
+	}
+
+	return result, nil
+}
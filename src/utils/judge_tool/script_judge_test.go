@@ -0,0 +1,228 @@
+package judgetool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"a1ctf/src/db/models"
+
+	"github.com/spf13/viper"
+)
+
+// 测试里用 env 代替真正的沙箱，只把 {work_dir} 放进环境变量，脚本用 sh 运行，不依赖 bwrap 和 python
+
+func useStubSandbox(t *testing.T) {
+	t.Helper()
+
+	viper.Set("judge-settings.sandbox-command", []string{"env", "SANDBOX_WORK_DIR={work_dir}"})
+	viper.Set("judge-settings.script-interpreter", []string{"sh"})
+	viper.Set("judge-settings.work-dir", t.TempDir())
+	t.Cleanup(func() {
+		viper.Set("judge-settings.sandbox-command", nil)
+		viper.Set("judge-settings.script-interpreter", nil)
+		viper.Set("judge-settings.work-dir", nil)
+		viper.Set("judge-settings.script-timeout", nil)
+		viper.Set("judge-settings.script-max-output", nil)
+	})
+}
+
+func TestBuildScriptCommand(t *testing.T) {
+	tests := []struct {
+		name        string
+		sandbox     []string
+		interpreter []string
+		want        []string
+		wantErr     error
+	}{
+		{
+			name:    "no sandbox",
+			sandbox: nil,
+			wantErr: ErrJudgeSandboxMissing,
+		},
+		{
+			name:    "sandbox without work dir",
+			sandbox: []string{"bwrap", "--unshare-all", "--"},
+			wantErr: ErrJudgeSandboxWorkDir,
+		},
+		{
+			name:    "default interpreter",
+			sandbox: []string{"bwrap", "--bind", "{work_dir}", "{work_dir}", "--"},
+			want:    []string{"bwrap", "--bind", "/tmp/run", "/tmp/run", "--", "python3", "-I", "/tmp/run/judge"},
+		},
+		{
+			name:        "placeholder inside an argument",
+			sandbox:     []string{"nsjail", "--bindmount={work_dir}:/work", "--"},
+			interpreter: []string{"sh"},
+			want:        []string{"nsjail", "--bindmount=/tmp/run:/work", "--", "sh", "/tmp/run/judge"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("judge-settings.sandbox-command", tt.sandbox)
+			viper.Set("judge-settings.script-interpreter", tt.interpreter)
+			t.Cleanup(func() {
+				viper.Set("judge-settings.sandbox-command", nil)
+				viper.Set("judge-settings.script-interpreter", nil)
+			})
+
+			got, err := buildScriptCommand("/tmp/run", "/tmp/run/judge")
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("buildScriptCommand: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("args = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunJudgeScriptRefusesWithoutSandbox(t *testing.T) {
+	viper.Set("judge-settings.sandbox-command", nil)
+	viper.Set("judge-settings.work-dir", t.TempDir())
+	t.Cleanup(func() { viper.Set("judge-settings.work-dir", nil) })
+
+	_, err := RunJudgeScript(context.Background(), "exit 0", ScriptJudgeInput{})
+	if !errors.Is(err, ErrJudgeSandboxMissing) {
+		t.Fatalf("err = %v, want %v", err, ErrJudgeSandboxMissing)
+	}
+}
+
+func TestRunJudgeScriptExitCode(t *testing.T) {
+	useStubSandbox(t)
+
+	tests := []struct {
+		name     string
+		script   string
+		status   models.JudgeStatus
+		exitCode int
+	}{
+		{name: "accepted", script: "exit 0", status: models.JudgeAC, exitCode: 0},
+		{name: "wrong answer", script: "exit 1", status: models.JudgeWA, exitCode: 1},
+		{name: "script error", script: "exit 2", status: models.JudgeError, exitCode: 2},
+		{name: "killed by signal", script: "kill -9 $$", status: models.JudgeError, exitCode: -1},
+		{
+			name:     "submission from env",
+			script:   `[ "$A1CTF_SUBMISSION" = "flag{test}" ] || exit 1`,
+			status:   models.JudgeAC,
+			exitCode: 0,
+		},
+		{
+			name:     "submission from stdin",
+			script:   `grep -q '"submission":"flag{test}"' || exit 1`,
+			status:   models.JudgeAC,
+			exitCode: 0,
+		},
+		{
+			// 沙箱命令里的 {work_dir} 和脚本运行的目录是同一个
+			name:     "work dir placeholder",
+			script:   `[ "$SANDBOX_WORK_DIR" = "$(pwd)" ] && [ "$HOME" = "$(pwd)" ] || exit 1`,
+			status:   models.JudgeAC,
+			exitCode: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := RunJudgeScript(context.Background(), tt.script, ScriptJudgeInput{
+				Submission: "flag{test}",
+				TeamHash:   "hash",
+				GameID:     1,
+			})
+			if err != nil {
+				t.Fatalf("RunJudgeScript: %v", err)
+			}
+			if result.Status != tt.status || result.ExitCode != tt.exitCode {
+				t.Fatalf("status = %s exit code = %d, want %s %d, output %q", result.Status, result.ExitCode, tt.status, tt.exitCode, result.Output)
+			}
+		})
+	}
+}
+
+func TestRunJudgeScriptOutputLimit(t *testing.T) {
+	useStubSandbox(t)
+	viper.Set("judge-settings.script-max-output", 100)
+
+	// stdout 和 stderr 合并之后只保留前 100 个字节
+	script := `i=0; while [ $i -lt 200 ]; do echo 0123456789; echo abcdefghij >&2; i=$((i+1)); done`
+	result, err := RunJudgeScript(context.Background(), script, ScriptJudgeInput{})
+	if err != nil {
+		t.Fatalf("RunJudgeScript: %v", err)
+	}
+	if result.Status != models.JudgeAC {
+		t.Fatalf("status = %s, want %s", result.Status, models.JudgeAC)
+	}
+	if len(result.Output) != 100 {
+		t.Fatalf("output length = %d, want 100", len(result.Output))
+	}
+}
+
+func TestRunJudgeScriptTimeoutKillsProcessGroup(t *testing.T) {
+	useStubSandbox(t)
+	viper.Set("judge-settings.script-timeout", "500ms")
+
+	// 脚本在后台起一个子进程，超时之后子进程也要被杀掉
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	script := fmt.Sprintf("sleep 30 &\necho $! > %s\nwait\n", pidFile)
+
+	startTime := time.Now()
+	result, err := RunJudgeScript(context.Background(), script, ScriptJudgeInput{})
+	if err != nil {
+		t.Fatalf("RunJudgeScript: %v", err)
+	}
+	if result.Status != models.JudgeTimeout {
+		t.Fatalf("status = %s, want %s", result.Status, models.JudgeTimeout)
+	}
+	if elapsed := time.Since(startTime); elapsed > 5*time.Second {
+		t.Fatalf("timeout took %s", elapsed)
+	}
+
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatalf("read pid file: %v", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatalf("parse pid: %v", err)
+	}
+
+	// 子进程被杀之后由 init 回收，等一小会儿
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		if err := syscall.Kill(pid, 0); errors.Is(err, syscall.ESRCH) {
+			return
+		}
+		if processZombie(pid) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("background process %d is still running after the timeout", pid)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// 已经退出但是还没被回收的进程
+func processZombie(pid int) bool {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+	fields := strings.Fields(string(data[strings.LastIndexByte(string(data), ')')+1:]))
+	return len(fields) > 0 && fields[0] == "Z"
+}
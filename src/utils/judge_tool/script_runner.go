@@ -0,0 +1,174 @@
+package judgetool
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// 判题脚本和附件生成脚本共用的运行逻辑：
+//   - 每次运行创建一个临时工作目录，脚本写到工作目录里，运行结束后删除
+//   - 必须配置 sandbox-command，{work_dir} 会被替换成本次的工作目录
+//   - 只传入最小的环境变量，stdout 和 stderr 合并后只保留前 script-max-output 个字节
+//   - 超时后杀死整个进程组
+
+// 没有配置沙箱的时候拒绝运行脚本，避免脚本以服务进程的身份读取配置文件和访问网络
+var ErrJudgeSandboxMissing = errors.New("judge-settings.sandbox-command is not configured, refuse to run scripts without a sandbox")
+
+// sandbox-command 里没有 {work_dir} 的时候沙箱里看不到脚本，或者脚本能看到的不是本次的工作目录
+var ErrJudgeSandboxWorkDir = errors.New("judge-settings.sandbox-command must contain the {work_dir} placeholder")
+
+// sandbox-command 里的占位符，运行时替换成本次的临时工作目录
+const sandboxWorkDirPlaceholder = "{work_dir}"
+
+// 只保留前 limit 个字节的输出，防止脚本刷爆内存
+type limitedBuffer struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+func (l *limitedBuffer) Write(p []byte) (int, error) {
+	remain := l.limit - l.buf.Len()
+	if remain > 0 {
+		if len(p) > remain {
+			l.buf.Write(p[:remain])
+		} else {
+			l.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// 拼接最终执行的命令，sandbox-command 是 nsjail / bwrap 之类的外层沙箱，必须配置
+func buildScriptCommand(workDir string, scriptPath string) ([]string, error) {
+	sandbox := viper.GetStringSlice("judge-settings.sandbox-command")
+	if len(sandbox) == 0 {
+		return nil, ErrJudgeSandboxMissing
+	}
+
+	interpreter := viper.GetStringSlice("judge-settings.script-interpreter")
+	if len(interpreter) == 0 {
+		interpreter = []string{"python3", "-I"}
+	}
+
+	args := make([]string, 0, len(sandbox)+len(interpreter)+1)
+	hasWorkDir := false
+	for _, arg := range sandbox {
+		if strings.Contains(arg, sandboxWorkDirPlaceholder) {
+			hasWorkDir = true
+		}
+		args = append(args, strings.ReplaceAll(arg, sandboxWorkDirPlaceholder, workDir))
+	}
+	if !hasWorkDir {
+		return nil, ErrJudgeSandboxWorkDir
+	}
+	args = append(args, interpreter...)
+	args = append(args, scriptPath)
+
+	return args, nil
+}
+
+type scriptWorkDir struct {
+	Dir        string
+	ScriptPath string
+}
+
+func (w *scriptWorkDir) Path(name string) string {
+	return filepath.Join(w.Dir, name)
+}
+
+func (w *scriptWorkDir) Remove() {
+	_ = os.RemoveAll(w.Dir)
+}
+
+// 创建临时工作目录并写入脚本，调用方负责 Remove
+func newScriptWorkDir(prefix string, scriptName string, script string) (*scriptWorkDir, error) {
+	dir, err := os.MkdirTemp(viper.GetString("judge-settings.work-dir"), prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create script work dir: %w", err)
+	}
+
+	workDir := &scriptWorkDir{
+		Dir:        dir,
+		ScriptPath: filepath.Join(dir, scriptName),
+	}
+
+	if err := os.WriteFile(workDir.ScriptPath, []byte(script), 0o644); err != nil {
+		workDir.Remove()
+		return nil, fmt.Errorf("failed to write script: %w", err)
+	}
+
+	return workDir, nil
+}
+
+type scriptRunResult struct {
+	ExitCode int
+	Output   string
+	TimeCost int64
+	TimedOut bool
+}
+
+// 在沙箱里运行工作目录中的脚本，脚本正常退出（包括非 0 退出码）和超时都不返回 error，只有启动失败才返回
+func runScript(ctx context.Context, workDir *scriptWorkDir, timeout time.Duration, env []string, stdin []byte) (*scriptRunResult, error) {
+	args, err := buildScriptCommand(workDir.Dir, workDir.ScriptPath)
+	if err != nil {
+		return nil, err
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(timeoutCtx, args[0], args[1:]...)
+	cmd.Dir = workDir.Dir
+	cmd.Env = append([]string{
+		"PATH=/usr/local/bin:/usr/bin:/bin",
+		"HOME=" + workDir.Dir,
+		"LANG=C.UTF-8",
+	}, env...)
+	cmd.Stdin = bytes.NewReader(stdin)
+
+	output := &limitedBuffer{limit: scriptMaxOutput()}
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	// 脚本可能会 fork 子进程，超时的时候需要把整个进程组一起杀掉
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = time.Second
+
+	startTime := time.Now()
+	runErr := cmd.Run()
+
+	result := &scriptRunResult{
+		ExitCode: -1,
+		Output:   output.buf.String(),
+		TimeCost: time.Since(startTime).Milliseconds(),
+	}
+
+	if errors.Is(timeoutCtx.Err(), context.DeadlineExceeded) {
+		result.TimedOut = true
+		return result, nil
+	}
+
+	if runErr != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(runErr, &exitErr) {
+			return nil, fmt.Errorf("failed to run script: %w", runErr)
+		}
+	}
+
+	result.ExitCode = cmd.ProcessState.ExitCode()
+
+	return result, nil
+}
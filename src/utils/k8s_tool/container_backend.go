@@ -0,0 +1,160 @@
+package k8stool
+
+import (
+	"fmt"
+
+	"a1ctf/src/utils/zaphelper"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+const (
+	BackendK8s    = "k8s"
+	BackendDocker = "docker"
+)
+
+// Instance 后端里的一个题目实例，对应一个 PodInfo
+type Instance struct {
+	Name   string
+	Labels map[string]string
+	Status PodStatusDecision
+}
+
+// ContainerBackend 题目实例的运行后端
+//
+// PodInfo 描述的一组容器在后端中作为一个整体创建和删除，同一个组件的容器之间共享网络，
+// 暴露端口通过 GetPodPorts 返回，名字和 k8s Service 一样是 <容器下标>-<端口名>，
+// ListInstances 把一个实例的多个组件合并成一个 Instance
+type ContainerBackend interface {
+	Name() string
+	Init() error
+	CreatePod(podInfo *PodInfo) error
+	DeletePod(podInfo *PodInfo) error
+	GetPodPorts(podInfo *PodInfo) (*PodPorts, error)
+	ListInstances() ([]Instance, error)
+	// 在运行中的实例里写入 flag 文件（预热实例）并执行 ExecCommand
+	InjectFlag(podInfo *PodInfo) error
+	// 列出平台创建的所有资源，给垃圾回收使用，删除的时候需要按照返回的顺序
+	ListResources() ([]ManagedResource, error)
+	DeleteResource(resource ManagedResource) error
+}
+
+var backend ContainerBackend
+
+// InitContainerBackend 根据 container-backend.driver 选择后端并初始化
+func InitContainerBackend() error {
+	driver := viper.GetString("container-backend.driver")
+
+	switch driver {
+	case "", BackendK8s:
+		backend = &k8sBackend{}
+	case BackendDocker:
+		backend = newDockerBackend()
+	default:
+		return fmt.Errorf("unknown container backend: %s", driver)
+	}
+
+	// Ingress 对象只有 k8s 后端可以创建，其他后端只能使用平台转发
+	if IngressEnabled() && IngressMode() == IngressModeK8s && backend.Name() != BackendK8s {
+		return fmt.Errorf("container-ingress mode %s requires the k8s backend", IngressModeK8s)
+	}
+
+	if err := backend.Init(); err != nil {
+		return fmt.Errorf("failed to init %s backend: %w", backend.Name(), err)
+	}
+
+	zaphelper.Logger.Info("Container backend initialized", zap.String("driver", backend.Name()))
+	return nil
+}
+
+// Backend 当前使用的后端，没有初始化的时候默认使用 k8s
+func Backend() ContainerBackend {
+	if backend == nil {
+		backend = &k8sBackend{}
+	}
+	return backend
+}
+
+func CreatePod(podInfo *PodInfo) error {
+	return Backend().CreatePod(podInfo)
+}
+
+func DeletePod(podInfo *PodInfo) error {
+	return Backend().DeletePod(podInfo)
+}
+
+func GetPodPorts(podInfo *PodInfo) (*PodPorts, error) {
+	return Backend().GetPodPorts(podInfo)
+}
+
+func ListInstances() ([]Instance, error) {
+	return Backend().ListInstances()
+}
+
+type k8sBackend struct{}
+
+func (k *k8sBackend) Name() string {
+	return BackendK8s
+}
+
+func (k *k8sBackend) Init() error {
+	return initK8sNamespace()
+}
+
+func (k *k8sBackend) CreatePod(podInfo *PodInfo) error {
+	return createK8sPod(podInfo)
+}
+
+func (k *k8sBackend) DeletePod(podInfo *PodInfo) error {
+	return deleteK8sInstance(podInfo)
+}
+
+func (k *k8sBackend) GetPodPorts(podInfo *PodInfo) (*PodPorts, error) {
+	return getK8sPodPorts(podInfo)
+}
+
+func (k *k8sBackend) InjectFlag(podInfo *PodInfo) error {
+	return injectK8sFlag(podInfo)
+}
+
+func (k *k8sBackend) ListResources() ([]ManagedResource, error) {
+	return listK8sResources()
+}
+
+func (k *k8sBackend) DeleteResource(resource ManagedResource) error {
+	return deleteK8sResource(resource)
+}
+
+func (k *k8sBackend) ListInstances() ([]Instance, error) {
+	podList, err := listK8sPods()
+	if err != nil {
+		return nil, err
+	}
+
+	// 多组件的实例有多个 Pod，按照实例标签合并，旧的 Pod 没有这个标签，直接使用 Pod 名
+	instances := make([]Instance, 0, len(podList.Items))
+	statuses := make(map[string][]PodStatusDecision)
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		instanceName, ok := pod.Labels[LabelInstance]
+		if !ok {
+			instanceName = pod.Name
+		}
+
+		podStatus, _ := CheckPodStatus(pod)
+		if _, exists := statuses[instanceName]; !exists {
+			instances = append(instances, Instance{
+				Name:   instanceName,
+				Labels: pod.Labels,
+			})
+		}
+		statuses[instanceName] = append(statuses[instanceName], podStatus)
+	}
+
+	for i := range instances {
+		instances[i].Status = mergePodStatus(statuses[instances[i].Name])
+	}
+
+	return instances, nil
+}
@@ -0,0 +1,579 @@
+package k8stool
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"a1ctf/src/utils/zaphelper"
+
+	"github.com/bytedance/sonic"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// 所有后端都要通过的一致性测试：创建、列出实例、状态变化、端口、资源列表和删除。
+// k8s 后端使用 client-go 的 fake clientset，Docker 后端使用内存里的 Engine API，
+// 两者都没有真正的调度器，测试通过 markRunning / markFailed 模拟实例启动成功或者失败
+
+func TestMain(m *testing.M) {
+	zaphelper.Logger = zap.NewNop()
+	os.Exit(m.Run())
+}
+
+type conformanceDriver struct {
+	name        string
+	newBackend  func(t *testing.T) ContainerBackend
+	markRunning func(t *testing.T, podInfo *PodInfo)
+	markFailed  func(t *testing.T, podInfo *PodInfo)
+}
+
+func conformancePodInfos() []PodInfo {
+	return []PodInfo{
+		{
+			Name:     "cl-1-0123456789abcdef",
+			TeamHash: "0123456789abcdef",
+			Labels:   map[string]string{"team_hash": "0123456789abcdef", "ingame_id": "1"},
+			Flag:     "flag{single}",
+			AllowWAN: false,
+			Containers: []A1Container{
+				{
+					Name:  "web",
+					Image: "nginx:alpine",
+					ExposePorts: []PortName{
+						{Name: "http", Port: 80},
+						{Name: "debug", Port: 9000, Internal: true},
+					},
+				},
+			},
+		},
+		{
+			Name:     "cl-2-fedcba9876543210",
+			TeamHash: "fedcba9876543210",
+			Labels:   map[string]string{"team_hash": "fedcba9876543210", "ingame_id": "2"},
+			Flag:     "flag{multi}",
+			AllowWAN: true,
+			Containers: []A1Container{
+				{
+					Name:  "web",
+					Image: "nginx:alpine",
+					ExposePorts: []PortName{
+						{Name: "http", Port: 80},
+					},
+				},
+				{
+					Name:      "db",
+					Image:     "mysql:8",
+					Component: "db",
+					ExposePorts: []PortName{
+						{Name: "mysql", Port: 3306, Internal: true},
+					},
+				},
+				{
+					Name:      "dns",
+					Image:     "coredns:latest",
+					Component: "dns",
+					ExposePorts: []PortName{
+						{Name: "dns", Port: 53, Protocol: ProtocolUDP},
+					},
+				},
+			},
+		},
+	}
+}
+
+// 期望返回的端口名，internal 端口不对外暴露
+func expectedPortNames(podInfo *PodInfo) []string {
+	names := make([]string, 0)
+	for index, c := range podInfo.Containers {
+		for _, port := range c.ExposePorts {
+			if !port.Internal {
+				names = append(names, fmt.Sprintf("%d-%s", index, port.Name))
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func findInstance(t *testing.T, b ContainerBackend, name string) (Instance, bool) {
+	t.Helper()
+
+	instances, err := b.ListInstances()
+	if err != nil {
+		t.Fatalf("ListInstances: %v", err)
+	}
+
+	found := false
+	var result Instance
+	for _, instance := range instances {
+		if instance.Name != name {
+			continue
+		}
+		if found {
+			t.Fatalf("instance %s is listed more than once", name)
+		}
+		found = true
+		result = instance
+	}
+
+	return result, found
+}
+
+func instanceResources(t *testing.T, b ContainerBackend, name string) []ManagedResource {
+	t.Helper()
+
+	resources, err := b.ListResources()
+	if err != nil {
+		t.Fatalf("ListResources: %v", err)
+	}
+
+	result := make([]ManagedResource, 0)
+	for _, resource := range resources {
+		if resource.Instance == name {
+			result = append(result, resource)
+		}
+	}
+	return result
+}
+
+func runConformance(t *testing.T, driver conformanceDriver) {
+	for _, podInfo := range conformancePodInfos() {
+		podInfo := podInfo
+		t.Run(podInfo.Name, func(t *testing.T) {
+			b := driver.newBackend(t)
+			if err := b.Init(); err != nil {
+				t.Fatalf("Init: %v", err)
+			}
+
+			if err := b.CreatePod(&podInfo); err != nil {
+				t.Fatalf("CreatePod: %v", err)
+			}
+
+			instance, ok := findInstance(t, b, podInfo.Name)
+			if !ok {
+				t.Fatalf("instance %s is not listed after create", podInfo.Name)
+			}
+			for key, value := range podInfo.Labels {
+				if instance.Labels[key] != value {
+					t.Errorf("label %s = %q, want %q", key, instance.Labels[key], value)
+				}
+			}
+
+			driver.markRunning(t, &podInfo)
+
+			instance, _ = findInstance(t, b, podInfo.Name)
+			if instance.Status.Status != CustomPodRunning || instance.Status.ShouldContinue {
+				t.Errorf("status after running = %+v, want %s", instance.Status, CustomPodRunning)
+			}
+
+			ports, err := b.GetPodPorts(&podInfo)
+			if err != nil {
+				t.Fatalf("GetPodPorts: %v", err)
+			}
+			portNames := make([]string, 0, len(*ports))
+			for _, port := range *ports {
+				portNames = append(portNames, port.Name)
+				if port.NodePort <= 0 {
+					t.Errorf("port %s has no node port", port.Name)
+				}
+				if _, _, err := splitHostPort(port.ClusterAddress); err != nil {
+					t.Errorf("port %s cluster address %q: %v", port.Name, port.ClusterAddress, err)
+				}
+			}
+			sort.Strings(portNames)
+			if strings.Join(portNames, ",") != strings.Join(expectedPortNames(&podInfo), ",") {
+				t.Errorf("ports = %v, want %v", portNames, expectedPortNames(&podInfo))
+			}
+
+			driver.markFailed(t, &podInfo)
+
+			instance, _ = findInstance(t, b, podInfo.Name)
+			if instance.Status.Status != CustomPodFailed || !instance.Status.ShouldReport {
+				t.Errorf("status after failure = %+v, want %s", instance.Status, CustomPodFailed)
+			}
+
+			if len(instanceResources(t, b, podInfo.Name)) == 0 {
+				t.Errorf("no resources listed for instance %s", podInfo.Name)
+			}
+
+			if err := b.DeletePod(&podInfo); err != nil {
+				t.Fatalf("DeletePod: %v", err)
+			}
+
+			if _, ok := findInstance(t, b, podInfo.Name); ok {
+				t.Errorf("instance %s is still listed after delete", podInfo.Name)
+			}
+			if resources := instanceResources(t, b, podInfo.Name); len(resources) > 0 {
+				t.Errorf("resources left after delete: %+v", resources)
+			}
+
+			// 删除已经不存在的实例不能报错，容器回收会重复删除
+			if err := b.DeletePod(&podInfo); err != nil {
+				t.Errorf("DeletePod twice: %v", err)
+			}
+		})
+	}
+}
+
+func splitHostPort(address string) (string, int, error) {
+	index := strings.LastIndex(address, ":")
+	if index <= 0 {
+		return "", 0, fmt.Errorf("missing port")
+	}
+	port, err := strconv.Atoi(address[index+1:])
+	if err != nil {
+		return "", 0, err
+	}
+	return address[:index], port, nil
+}
+
+func TestFakeBackendConformance(t *testing.T) {
+	var backend *FakeBackend
+
+	runConformance(t, conformanceDriver{
+		name: "fake",
+		newBackend: func(t *testing.T) ContainerBackend {
+			backend = NewFakeBackend()
+			return backend
+		},
+		markRunning: func(t *testing.T, podInfo *PodInfo) {
+			backend.SetInstanceStatus(podInfo.Name, PodStatusDecision{
+				Status:  CustomPodRunning,
+				Message: "Pod is running successfully",
+			})
+		},
+		markFailed: func(t *testing.T, podInfo *PodInfo) {
+			backend.SetInstanceStatus(podInfo.Name, PodStatusDecision{
+				Status:       CustomPodFailed,
+				ShouldReport: true,
+				Message:      "Container exited",
+			})
+		},
+	})
+}
+
+func TestK8sBackendConformance(t *testing.T) {
+	const namespace = "a1ctf-challenges"
+	var fakeClient *fake.Clientset
+
+	// 修改实例的所有 Pod，fake clientset 没有调度器，需要手动设置节点和状态
+	updatePods := func(t *testing.T, podInfo *PodInfo, update func(pod *corev1.Pod)) {
+		t.Helper()
+
+		pods, err := fakeClient.CoreV1().Pods(namespace).List(context.Background(), metav1.ListOptions{})
+		if err != nil {
+			t.Fatalf("list pods: %v", err)
+		}
+		for i := range pods.Items {
+			pod := &pods.Items[i]
+			if pod.Labels[LabelInstance] != podInfo.Name {
+				continue
+			}
+			update(pod)
+			if _, err := fakeClient.CoreV1().Pods(namespace).Update(context.Background(), pod, metav1.UpdateOptions{}); err != nil {
+				t.Fatalf("update pod %s: %v", pod.Name, err)
+			}
+		}
+	}
+
+	runConformance(t, conformanceDriver{
+		name: BackendK8s,
+		newBackend: func(t *testing.T) ContainerBackend {
+			previous := clientset
+			fakeClient = fake.NewClientset()
+			clientset = fakeClient
+			t.Cleanup(func() { clientset = previous })
+			return &k8sBackend{}
+		},
+		markRunning: func(t *testing.T, podInfo *PodInfo) {
+			updatePods(t, podInfo, func(pod *corev1.Pod) {
+				pod.Spec.NodeName = "node-1"
+				pod.Status.Phase = corev1.PodRunning
+				pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+			})
+
+			// 分配 ClusterIP 和 NodePort
+			services, err := fakeClient.CoreV1().Services(namespace).List(context.Background(), metav1.ListOptions{})
+			if err != nil {
+				t.Fatalf("list services: %v", err)
+			}
+			for i := range services.Items {
+				service := &services.Items[i]
+				service.Spec.ClusterIP = fmt.Sprintf("10.96.0.%d", i+1)
+				for j := range service.Spec.Ports {
+					service.Spec.Ports[j].NodePort = int32(30000 + i*10 + j)
+				}
+				if _, err := fakeClient.CoreV1().Services(namespace).Update(context.Background(), service, metav1.UpdateOptions{}); err != nil {
+					t.Fatalf("update service %s: %v", service.Name, err)
+				}
+			}
+		},
+		markFailed: func(t *testing.T, podInfo *PodInfo) {
+			updatePods(t, podInfo, func(pod *corev1.Pod) {
+				pod.Status.Phase = corev1.PodFailed
+			})
+		},
+	})
+}
+
+func TestDockerBackendConformance(t *testing.T) {
+	var engine *fakeDockerEngine
+
+	runConformance(t, conformanceDriver{
+		name: BackendDocker,
+		newBackend: func(t *testing.T) ContainerBackend {
+			engine = newFakeDockerEngine()
+			server := httptest.NewServer(engine)
+			t.Cleanup(server.Close)
+
+			return &dockerBackend{
+				client:        server.Client(),
+				baseURL:       server.URL,
+				dialHost:      "127.0.0.1",
+				publicAddress: "127.0.0.1",
+				pauseImage:    dockerDefaultPause,
+			}
+		},
+		// 容器 start 之后就是 running，没有开启健康检查的时候不需要额外处理
+		markRunning: func(t *testing.T, podInfo *PodInfo) {},
+		markFailed: func(t *testing.T, podInfo *PodInfo) {
+			engine.setPodState(podInfo.Name, dockerRoleApp, "exited")
+		},
+	})
+}
+
+// 内存里的 Docker Engine API，只实现 Docker 后端用到的接口
+type fakeDockerEngine struct {
+	mu         sync.Mutex
+	containers map[string]*fakeDockerContainer
+	networks   map[string]map[string]string
+	nextID     int
+	nextPort   int
+}
+
+type fakeDockerContainer struct {
+	ID      string
+	Name    string
+	Labels  map[string]string
+	State   string
+	Exposed []string
+	Ports   map[string][]dockerPortBinding
+	Created int64
+}
+
+func newFakeDockerEngine() *fakeDockerEngine {
+	return &fakeDockerEngine{
+		containers: make(map[string]*fakeDockerContainer),
+		networks:   make(map[string]map[string]string),
+		nextPort:   32768,
+	}
+}
+
+func (e *fakeDockerEngine) setPodState(podName string, role string, state string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, container := range e.containers {
+		if container.Labels[dockerLabelPod] == podName && container.Labels[dockerLabelRole] == role {
+			container.State = state
+		}
+	}
+}
+
+// 按 ID 或者名字查找容器，需要持有 mu
+func (e *fakeDockerEngine) findContainer(idOrName string) *fakeDockerContainer {
+	if container, ok := e.containers[idOrName]; ok {
+		return container
+	}
+	for _, container := range e.containers {
+		if container.Name == idOrName {
+			return container
+		}
+	}
+	return nil
+}
+
+func matchLabelFilters(labels map[string]string, rawFilters string) bool {
+	if rawFilters == "" {
+		return true
+	}
+
+	var filters map[string][]string
+	if err := sonic.Unmarshal([]byte(rawFilters), &filters); err != nil {
+		return false
+	}
+
+	for _, filter := range filters["label"] {
+		key, value, hasValue := strings.Cut(filter, "=")
+		actual, ok := labels[key]
+		if !ok || (hasValue && actual != value) {
+			return false
+		}
+	}
+	return true
+}
+
+func writeDockerJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if body != nil {
+		data, _ := sonic.Marshal(body)
+		_, _ = w.Write(data)
+	}
+}
+
+func (e *fakeDockerEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/"+dockerAPIVersion)
+	query := r.URL.Query()
+	notFound := func() {
+		writeDockerJSON(w, http.StatusNotFound, map[string]string{"message": "not found"})
+	}
+
+	switch {
+	case path == "/_ping":
+		writeDockerJSON(w, http.StatusOK, nil)
+
+	case strings.HasPrefix(path, "/images/"):
+		// 镜像都当作本地已经存在
+		if r.Method == http.MethodPost {
+			_, _ = io.WriteString(w, "{\"status\":\"done\"}\n")
+			return
+		}
+		writeDockerJSON(w, http.StatusOK, map[string]string{})
+
+	case path == "/networks/create" && r.Method == http.MethodPost:
+		var body struct {
+			Name   string            `json:"Name"`
+			Labels map[string]string `json:"Labels"`
+		}
+		data, _ := io.ReadAll(r.Body)
+		_ = sonic.Unmarshal(data, &body)
+		if _, ok := e.networks[body.Name]; ok {
+			writeDockerJSON(w, http.StatusConflict, map[string]string{"message": "network exists"})
+			return
+		}
+		e.networks[body.Name] = body.Labels
+		writeDockerJSON(w, http.StatusCreated, map[string]string{"Id": body.Name})
+
+	case path == "/networks" && r.Method == http.MethodGet:
+		networks := make([]dockerListNetwork, 0)
+		for name, labels := range e.networks {
+			if matchLabelFilters(labels, query.Get("filters")) {
+				networks = append(networks, dockerListNetwork{Name: name, Created: time.Now(), Labels: labels})
+			}
+		}
+		writeDockerJSON(w, http.StatusOK, networks)
+
+	case strings.HasPrefix(path, "/networks/"):
+		name := strings.TrimPrefix(path, "/networks/")
+		name = strings.TrimSuffix(name, "/connect")
+		if _, ok := e.networks[name]; !ok {
+			notFound()
+			return
+		}
+		if r.Method == http.MethodDelete {
+			delete(e.networks, name)
+		}
+		writeDockerJSON(w, http.StatusOK, map[string]string{})
+
+	case path == "/containers/create" && r.Method == http.MethodPost:
+		var config dockerContainerConfig
+		data, _ := io.ReadAll(r.Body)
+		_ = sonic.Unmarshal(data, &config)
+
+		name := query.Get("name")
+		if e.findContainer(name) != nil {
+			writeDockerJSON(w, http.StatusConflict, map[string]string{"message": "container name in use"})
+			return
+		}
+
+		e.nextID++
+		container := &fakeDockerContainer{
+			ID:      fmt.Sprintf("container%04d", e.nextID),
+			Name:    name,
+			Labels:  config.Labels,
+			State:   "created",
+			Ports:   make(map[string][]dockerPortBinding),
+			Created: time.Now().Unix(),
+		}
+		for port := range config.ExposedPorts {
+			container.Exposed = append(container.Exposed, port)
+		}
+		e.containers[container.ID] = container
+		writeDockerJSON(w, http.StatusCreated, map[string]string{"Id": container.ID})
+
+	case path == "/containers/json" && r.Method == http.MethodGet:
+		containers := make([]dockerListContainer, 0)
+		for _, container := range e.containers {
+			if !matchLabelFilters(container.Labels, query.Get("filters")) {
+				continue
+			}
+			listed := dockerListContainer{
+				ID:      container.ID,
+				Names:   []string{"/" + container.Name},
+				Created: container.Created,
+				Labels:  container.Labels,
+				State:   container.State,
+				Status:  container.State,
+			}
+			for key, bindings := range container.Ports {
+				privatePort, protocol, _ := strings.Cut(key, "/")
+				port, _ := strconv.Atoi(privatePort)
+				publicPort, _ := strconv.Atoi(bindings[0].HostPort)
+				listed.Ports = append(listed.Ports, dockerListPort{PrivatePort: int32(port), PublicPort: int32(publicPort), Type: protocol})
+			}
+			containers = append(containers, listed)
+		}
+		writeDockerJSON(w, http.StatusOK, containers)
+
+	case strings.HasPrefix(path, "/containers/"):
+		rest := strings.TrimPrefix(path, "/containers/")
+		idOrName, action, _ := strings.Cut(rest, "/")
+		container := e.findContainer(idOrName)
+		if container == nil {
+			notFound()
+			return
+		}
+
+		switch {
+		case action == "start" && r.Method == http.MethodPost:
+			container.State = "running"
+			for _, port := range container.Exposed {
+				container.Ports[port] = []dockerPortBinding{{HostIP: "0.0.0.0", HostPort: strconv.Itoa(e.nextPort)}}
+				e.nextPort++
+			}
+			w.WriteHeader(http.StatusNoContent)
+		case action == "archive" && r.Method == http.MethodPut:
+			_, _ = io.Copy(io.Discard, r.Body)
+			writeDockerJSON(w, http.StatusOK, nil)
+		case action == "json" && r.Method == http.MethodGet:
+			var inspect dockerInspectContainer
+			inspect.NetworkSettings.Ports = container.Ports
+			writeDockerJSON(w, http.StatusOK, inspect)
+		case action == "" && r.Method == http.MethodDelete:
+			delete(e.containers, container.ID)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			writeDockerJSON(w, http.StatusNotImplemented, map[string]string{"message": "not implemented: " + r.Method + " " + path})
+		}
+
+	default:
+		writeDockerJSON(w, http.StatusNotImplemented, map[string]string{"message": "not implemented: " + r.Method + " " + path + "?" + url.Values(query).Encode()})
+	}
+}
@@ -0,0 +1,883 @@
+package k8stool
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/spf13/viper"
+)
+
+// Docker 后端直接调用 Docker Engine API，一个实例由一个 pause 容器和若干题目容器组成：
+//   - pause 容器持有网络命名空间并发布所有暴露端口，题目容器通过 container:<pause> 共享网络，和 k8s Pod 的行为一致
+//   - 允许出网的实例接入普通 bridge 网络，不允许出网的实例接入关闭了 ip masquerade 的 bridge 网络，
+//     端口发布不受影响，但容器无法访问外网（包括外部 DNS，AllowDNS 只对 k8s 后端生效）
+//   - 两个网络都关闭了 icc，不同实例之间不能互相访问
+//   - 多组件的实例每个组件一个 pause 容器，组件之间通过实例独占的 internal 网络互相访问
+const (
+	dockerAPIVersion     = "v1.41"
+	dockerNetwork        = "a1ctf-challenges"
+	dockerNoWANNetwork   = "a1ctf-challenges-nowan"
+	dockerDefaultHost    = "unix:///var/run/docker.sock"
+	dockerDefaultPause   = "registry.k8s.io/pause:3.9"
+	dockerRequestTimeout = 30 * time.Second
+	dockerPullTimeout    = 10 * time.Minute
+
+	dockerLabelManaged     = "a1ctf.managed"
+	dockerLabelPod         = "a1ctf.pod"
+	dockerLabelRole        = "a1ctf.role"
+	dockerLabelHealthCheck = "a1ctf.health_check"
+	dockerLabelComponent   = "a1ctf.component"
+
+	dockerRolePause = "pause"
+	dockerRoleApp   = "app"
+)
+
+var errDockerNotFound = errors.New("docker object not found")
+
+type dockerBackend struct {
+	client        *http.Client
+	baseURL       string
+	dialHost      string
+	publicAddress string
+	bindAddress   string
+	pauseImage    string
+}
+
+type dockerPortBinding struct {
+	HostIP   string `json:"HostIp"`
+	HostPort string `json:"HostPort"`
+}
+
+type dockerRestartPolicy struct {
+	Name              string `json:"Name"`
+	MaximumRetryCount int    `json:"MaximumRetryCount"`
+}
+
+type dockerHostConfig struct {
+	NetworkMode    string                         `json:"NetworkMode,omitempty"`
+	PortBindings   map[string][]dockerPortBinding `json:"PortBindings,omitempty"`
+	Memory         int64                          `json:"Memory,omitempty"`
+	NanoCPUs       int64                          `json:"NanoCpus,omitempty"`
+	RestartPolicy  dockerRestartPolicy            `json:"RestartPolicy"`
+	Runtime        string                         `json:"Runtime,omitempty"`
+	ReadonlyRootfs bool                           `json:"ReadonlyRootfs,omitempty"`
+	CapAdd         []string                       `json:"CapAdd,omitempty"`
+	CapDrop        []string                       `json:"CapDrop,omitempty"`
+	SecurityOpt    []string                       `json:"SecurityOpt,omitempty"`
+}
+
+type dockerContainerConfig struct {
+	Image        string              `json:"Image"`
+	User         string              `json:"User,omitempty"`
+	Entrypoint   []string            `json:"Entrypoint,omitempty"`
+	Env          []string            `json:"Env,omitempty"`
+	Labels       map[string]string   `json:"Labels"`
+	ExposedPorts map[string]struct{} `json:"ExposedPorts,omitempty"`
+	HostConfig   dockerHostConfig    `json:"HostConfig"`
+}
+
+type dockerListPort struct {
+	PrivatePort int32  `json:"PrivatePort"`
+	PublicPort  int32  `json:"PublicPort"`
+	Type        string `json:"Type"`
+}
+
+type dockerListContainer struct {
+	ID      string            `json:"Id"`
+	Names   []string          `json:"Names"`
+	Created int64             `json:"Created"`
+	Labels  map[string]string `json:"Labels"`
+	State   string            `json:"State"`
+	Status  string            `json:"Status"`
+	Ports   []dockerListPort  `json:"Ports"`
+}
+
+type dockerInspectContainer struct {
+	NetworkSettings struct {
+		Ports map[string][]dockerPortBinding `json:"Ports"`
+	} `json:"NetworkSettings"`
+}
+
+func newDockerBackend() *dockerBackend {
+	host := viper.GetString("container-backend.docker.host")
+	if host == "" {
+		host = dockerDefaultHost
+	}
+
+	d := &dockerBackend{
+		publicAddress: viper.GetString("container-backend.docker.public-address"),
+		bindAddress:   viper.GetString("container-backend.docker.bind-address"),
+		pauseImage:    viper.GetString("container-backend.docker.pause-image"),
+	}
+
+	if d.pauseImage == "" {
+		d.pauseImage = dockerDefaultPause
+	}
+
+	if strings.HasPrefix(host, "unix://") {
+		socketPath := strings.TrimPrefix(host, "unix://")
+		d.client = &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+				},
+			},
+		}
+		d.baseURL = "http://docker"
+		d.dialHost = "127.0.0.1"
+	} else {
+		hostURL := strings.Replace(host, "tcp://", "http://", 1)
+		d.client = &http.Client{}
+		d.baseURL = strings.TrimRight(hostURL, "/")
+		if parsed, err := url.Parse(hostURL); err == nil {
+			d.dialHost = parsed.Hostname()
+		}
+	}
+
+	if d.bindAddress != "" && d.bindAddress != "0.0.0.0" {
+		d.dialHost = d.bindAddress
+	}
+
+	if d.publicAddress == "" {
+		d.publicAddress = d.dialHost
+	}
+
+	return d
+}
+
+func (d *dockerBackend) request(ctx context.Context, method string, path string, query url.Values, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := sonic.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	requestURL := d.baseURL + "/" + dockerAPIVersion + path
+	if len(query) > 0 {
+		requestURL += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, requestURL, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("docker api %s %s: %w", method, path, err)
+	}
+
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, errDockerNotFound
+		}
+
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		_ = sonic.Unmarshal(data, &apiErr)
+		return nil, fmt.Errorf("docker api %s %s: %d %s", method, path, resp.StatusCode, apiErr.Message)
+	}
+
+	return resp, nil
+}
+
+func (d *dockerBackend) call(method string, path string, query url.Values, body interface{}, out interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dockerRequestTimeout)
+	defer cancel()
+
+	resp, err := d.request(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return sonic.Unmarshal(data, out)
+}
+
+func (d *dockerBackend) Name() string {
+	return BackendDocker
+}
+
+func (d *dockerBackend) Init() error {
+	if err := d.call(http.MethodGet, "/_ping", nil, nil, nil); err != nil {
+		return err
+	}
+
+	if err := d.ensureNetwork(dockerNetwork, true); err != nil {
+		return err
+	}
+
+	return d.ensureNetwork(dockerNoWANNetwork, false)
+}
+
+func (d *dockerBackend) ensureNetwork(name string, allowWAN bool) error {
+	err := d.call(http.MethodGet, "/networks/"+name, nil, nil, nil)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, errDockerNotFound) {
+		return err
+	}
+
+	return d.call(http.MethodPost, "/networks/create", nil, map[string]interface{}{
+		"Name":   name,
+		"Driver": "bridge",
+		"Options": map[string]string{
+			"com.docker.network.bridge.enable_icc":           "false",
+			"com.docker.network.bridge.enable_ip_masquerade": strconv.FormatBool(allowWAN),
+		},
+		"Labels": map[string]string{
+			dockerLabelManaged: "true",
+		},
+	}, nil)
+}
+
+// 本地没有镜像的时候拉取，拉取进度是流式返回的，出错信息在流里面
+func (d *dockerBackend) ensureImage(image string) error {
+	err := d.call(http.MethodGet, "/images/"+image+"/json", nil, nil, nil)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, errDockerNotFound) {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dockerPullTimeout)
+	defer cancel()
+
+	resp, err := d.request(ctx, http.MethodPost, "/images/create", url.Values{"fromImage": []string{image}}, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var progress struct {
+			Error string `json:"error"`
+		}
+		if sonic.Unmarshal(scanner.Bytes(), &progress) == nil && progress.Error != "" {
+			return fmt.Errorf("failed to pull image %s: %s", image, progress.Error)
+		}
+	}
+
+	return scanner.Err()
+}
+
+func (d *dockerBackend) createAndStart(name string, config dockerContainerConfig) error {
+	return d.createWithFilesAndStart(name, config, nil)
+}
+
+type dockerFile struct {
+	Path    string
+	Content []byte
+	Mode    int64
+	UID     int
+	GID     int
+}
+
+// 容器创建之后启动之前写入文件，文件所在的目录需要在镜像里已经存在
+func (d *dockerBackend) createWithFilesAndStart(name string, config dockerContainerConfig, files []dockerFile) error {
+	var created struct {
+		ID string `json:"Id"`
+	}
+	if err := d.call(http.MethodPost, "/containers/create", url.Values{"name": []string{name}}, config, &created); err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if err := d.putFile(created.ID, file); err != nil {
+			return err
+		}
+	}
+
+	return d.call(http.MethodPost, "/containers/"+created.ID+"/start", nil, nil, nil)
+}
+
+func (d *dockerBackend) putFile(containerID string, file dockerFile) error {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    path.Base(file.Path),
+		Mode:    file.Mode,
+		Uid:     file.UID,
+		Gid:     file.GID,
+		Size:    int64(len(file.Content)),
+		ModTime: time.Now(),
+	}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(file.Content); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dockerRequestTimeout)
+	defer cancel()
+
+	requestURL := d.baseURL + "/" + dockerAPIVersion + "/containers/" + containerID + "/archive?" + url.Values{"path": []string{path.Dir(file.Path)}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, requestURL, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-tar")
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("docker api put archive: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("failed to write %s: %d %s", file.Path, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	return nil
+}
+
+func (d *dockerBackend) CreatePod(podInfo *PodInfo) error {
+	if err := d.createPod(podInfo); err != nil {
+		// 清理掉创建了一半的容器
+		_ = d.DeletePod(podInfo)
+		return err
+	}
+	return nil
+}
+
+func (d *dockerBackend) createPod(podInfo *PodInfo) error {
+	if err := d.ensureImage(d.pauseImage); err != nil {
+		return err
+	}
+
+	network := dockerNetwork
+	if !podInfo.AllowWAN {
+		network = dockerNoWANNetwork
+	}
+
+	// 多组件的实例额外创建一个只属于这个实例的内部网络，组件名作为网络别名
+	components := podComponents(podInfo)
+	multiComponent := len(components) > 1
+	if multiComponent {
+		if err := d.call(http.MethodPost, "/networks/create", nil, map[string]interface{}{
+			"Name":     podInfo.Name,
+			"Driver":   "bridge",
+			"Internal": true,
+			"Labels": map[string]string{
+				dockerLabelManaged: "true",
+				dockerLabelPod:     podInfo.Name,
+			},
+		}, nil); err != nil {
+			return fmt.Errorf("error creating instance network: %w", err)
+		}
+	}
+
+	for _, component := range components {
+		pauseLabels := map[string]string{
+			dockerLabelManaged:   "true",
+			dockerLabelPod:       podInfo.Name,
+			dockerLabelRole:      dockerRolePause,
+			dockerLabelComponent: component.Name,
+		}
+		for key, value := range podInfo.Labels {
+			pauseLabels[key] = value
+		}
+		if podInfo.HealthCheck {
+			pauseLabels[dockerLabelHealthCheck] = "true"
+		}
+
+		// internal 端口不发布到宿主机，同一个组件里的容器通过 localhost 访问，其他组件通过内部网络访问
+		exposedPorts := make(map[string]struct{})
+		portBindings := make(map[string][]dockerPortBinding)
+		for _, index := range component.Indexes {
+			for _, port := range podInfo.Containers[index].ExposePorts {
+				if port.Internal {
+					continue
+				}
+				key := dockerPortKey(port)
+				exposedPorts[key] = struct{}{}
+				// HostPort 留空由 Docker 分配随机端口
+				portBindings[key] = []dockerPortBinding{{HostIP: d.bindAddress}}
+			}
+		}
+
+		if err := d.createAndStart(dockerPauseName(component), dockerContainerConfig{
+			Image:        d.pauseImage,
+			Labels:       pauseLabels,
+			ExposedPorts: exposedPorts,
+			HostConfig: dockerHostConfig{
+				NetworkMode:   network,
+				PortBindings:  portBindings,
+				RestartPolicy: dockerRestartPolicy{Name: "unless-stopped"},
+			},
+		}); err != nil {
+			return fmt.Errorf("error creating pause container: %w", err)
+		}
+
+		if multiComponent {
+			if err := d.call(http.MethodPost, "/networks/"+podInfo.Name+"/connect", nil, map[string]interface{}{
+				"Container": dockerPauseName(component),
+				"EndpointConfig": map[string]interface{}{
+					"Aliases": []string{component.Name},
+				},
+			}, nil); err != nil {
+				return fmt.Errorf("error connecting %s to instance network: %w", component.Name, err)
+			}
+		}
+
+		for _, index := range component.Indexes {
+			if err := d.createAppContainer(podInfo, &podInfo.Containers[index], component); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (d *dockerBackend) createAppContainer(podInfo *PodInfo, c *A1Container, component podComponent) error {
+	if err := d.ensureImage(c.Image); err != nil {
+		return err
+	}
+
+	env := make([]string, 0, len(c.Env)+1)
+	for _, e := range c.Env {
+		env = append(env, e.Name+"="+e.Value)
+	}
+	if envName, ok := c.FlagEnv(); ok && !podInfo.Warm {
+		env = append(env, envName+"="+podInfo.Flag)
+	}
+
+	// Docker 可以直接设置文件所有者，不需要 init 容器，预热实例领取之后再写入
+	var files []dockerFile
+	if _, ok := c.flagFile(); ok && !podInfo.Warm {
+		files = append(files, c.dockerFlagFile(podInfo.Flag))
+	}
+
+	// 和 k8s 一样只限制资源，存储限制依赖存储驱动，这里不处理
+	config := dockerContainerConfig{
+		Image:      c.Image,
+		Entrypoint: c.RenderCommand(podInfo.Flag),
+		Env:        env,
+		Labels: map[string]string{
+			dockerLabelManaged:   "true",
+			dockerLabelPod:       podInfo.Name,
+			dockerLabelRole:      dockerRoleApp,
+			dockerLabelComponent: component.Name,
+		},
+		HostConfig: dockerHostConfig{
+			NetworkMode:   "container:" + dockerPauseName(component),
+			Memory:        c.MemoryLimit * 1024 * 1024,
+			NanoCPUs:      c.CPULimit * 1000 * 1000,
+			RestartPolicy: dockerRestartPolicy{Name: "on-failure", MaximumRetryCount: 3},
+		},
+	}
+	if err := c.applyDockerSecurity(&config); err != nil {
+		return fmt.Errorf("error creating container %s: %w", c.Name, err)
+	}
+	// Docker 不能往只读的根文件系统里写文件
+	if config.HostConfig.ReadonlyRootfs && len(files) > 0 {
+		return fmt.Errorf("error creating container %s: flag file requires a writable root filesystem on the docker backend", c.Name)
+	}
+
+	if err := d.createWithFilesAndStart(fmt.Sprintf("%s-%s", podInfo.Name, c.Name), config, files); err != nil {
+		return fmt.Errorf("error creating container %s: %w", c.Name, err)
+	}
+
+	return nil
+}
+
+func (c *A1Container) dockerFlagFile(flag string) dockerFile {
+	filePath, _ := c.flagFile()
+	uid, gid, _ := c.flagFileOwner()
+	return dockerFile{
+		Path:    filePath,
+		Content: []byte(flag),
+		Mode:    int64(c.flagFileMode()),
+		UID:     int(uid),
+		GID:     int(gid),
+	}
+}
+
+func (d *dockerBackend) InjectFlag(podInfo *PodInfo) error {
+	for index := range podInfo.Containers {
+		c := &podInfo.Containers[index]
+		containerName := fmt.Sprintf("%s-%s", podInfo.Name, c.Name)
+
+		if _, ok := c.flagFile(); ok && podInfo.Warm {
+			if err := d.putFile(containerName, c.dockerFlagFile(podInfo.Flag)); err != nil {
+				return fmt.Errorf("error writing flag file for %s: %w", c.Name, err)
+			}
+		}
+
+		if command := c.RenderExecCommand(podInfo.Flag); len(command) > 0 {
+			if err := d.exec(containerName, command); err != nil {
+				return fmt.Errorf("error executing flag command for %s: %w", c.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// 不分离执行的时候 start 请求会等到命令结束，输出是 stdout/stderr 复用的流
+func (d *dockerBackend) exec(containerName string, command []string) error {
+	var created struct {
+		ID string `json:"Id"`
+	}
+	if err := d.call(http.MethodPost, "/containers/"+containerName+"/exec", nil, map[string]interface{}{
+		"Cmd":          command,
+		"AttachStdout": true,
+		"AttachStderr": true,
+	}, &created); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dockerRequestTimeout)
+	defer cancel()
+
+	resp, err := d.request(ctx, http.MethodPost, "/exec/"+created.ID+"/start", nil, map[string]interface{}{
+		"Detach": false,
+		"Tty":    false,
+	})
+	if err != nil {
+		return err
+	}
+	output, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	var inspect struct {
+		ExitCode int `json:"ExitCode"`
+	}
+	if err := d.call(http.MethodGet, "/exec/"+created.ID+"/json", nil, nil, &inspect); err != nil {
+		return err
+	}
+	if inspect.ExitCode != 0 {
+		return fmt.Errorf("command exited with code %d: %s", inspect.ExitCode, strings.TrimSpace(dockerStreamOutput(output)))
+	}
+
+	return nil
+}
+
+// 复用流每一帧前面有 8 字节的头，第 5 到 8 字节是帧长度
+func dockerStreamOutput(data []byte) string {
+	var output strings.Builder
+	for len(data) >= 8 {
+		size := int(binary.BigEndian.Uint32(data[4:8]))
+		data = data[8:]
+		if size > len(data) {
+			size = len(data)
+		}
+		output.Write(data[:size])
+		data = data[size:]
+	}
+	return output.String()
+}
+
+// 组件的 pause 容器名。题目容器名是 <实例名>-<容器名>，和组件名 <实例名>-<组件名> 可能重名，
+// 容器名只能是 DNS_LABEL，加上下划线后缀就不会冲突
+func dockerPauseName(component podComponent) string {
+	return component.PodName + "_pause"
+}
+
+// Docker 的端口格式是 <端口>/<小写协议>
+func dockerPortKey(port PortName) string {
+	return fmt.Sprintf("%d/%s", port.Port, strings.ToLower(port.PortProtocol()))
+}
+
+func (d *dockerBackend) listContainers(podName string) ([]dockerListContainer, error) {
+	labelFilters := []string{dockerLabelManaged + "=true"}
+	if podName != "" {
+		labelFilters = append(labelFilters, dockerLabelPod+"="+podName)
+	}
+
+	filters, err := sonic.Marshal(map[string][]string{"label": labelFilters})
+	if err != nil {
+		return nil, err
+	}
+
+	var containers []dockerListContainer
+	if err := d.call(http.MethodGet, "/containers/json", url.Values{
+		"all":     []string{"true"},
+		"filters": []string{string(filters)},
+	}, nil, &containers); err != nil {
+		return nil, err
+	}
+
+	return containers, nil
+}
+
+func (d *dockerBackend) DeletePod(podInfo *PodInfo) error {
+	containers, err := d.listContainers(podInfo.Name)
+	if err != nil {
+		return err
+	}
+
+	// 先删除题目容器，再删除持有网络的 pause 容器
+	for _, role := range []string{dockerRoleApp, dockerRolePause} {
+		for _, container := range containers {
+			if container.Labels[dockerLabelRole] != role {
+				continue
+			}
+			err := d.call(http.MethodDelete, "/containers/"+container.ID, url.Values{"force": []string{"true"}}, nil, nil)
+			if err != nil && !errors.Is(err, errDockerNotFound) {
+				return fmt.Errorf("error deleting container %s: %w", container.ID, err)
+			}
+		}
+	}
+
+	// 多组件实例的内部网络，容器都删除之后才能删除
+	if len(podComponents(podInfo)) > 1 {
+		err := d.call(http.MethodDelete, "/networks/"+podInfo.Name, nil, nil, nil)
+		if err != nil && !errors.Is(err, errDockerNotFound) {
+			return fmt.Errorf("error deleting instance network: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (d *dockerBackend) GetPodPorts(podInfo *PodInfo) (*PodPorts, error) {
+	result := make(PodPorts, 0)
+	for _, component := range podComponents(podInfo) {
+		if len(component.exposedPorts(podInfo)) == 0 {
+			continue
+		}
+
+		var inspect dockerInspectContainer
+		if err := d.call(http.MethodGet, "/containers/"+dockerPauseName(component)+"/json", nil, nil, &inspect); err != nil {
+			return nil, fmt.Errorf("error getting pause container: %w", err)
+		}
+
+		for _, index := range component.Indexes {
+			for _, port := range podInfo.Containers[index].ExposePorts {
+				if port.Internal {
+					continue
+				}
+
+				bindings := inspect.NetworkSettings.Ports[dockerPortKey(port)]
+				if len(bindings) == 0 {
+					return nil, fmt.Errorf("port %d of %s is not published yet", port.Port, dockerPauseName(component))
+				}
+
+				hostPort, err := strconv.ParseInt(bindings[0].HostPort, 10, 32)
+				if err != nil {
+					return nil, fmt.Errorf("invalid host port %q: %w", bindings[0].HostPort, err)
+				}
+
+				result = append(result, PodPort{
+					Name:           fmt.Sprintf("%d-%s", index, port.Name),
+					Port:           port.Port,
+					NodePort:       int32(hostPort),
+					NodeName:       d.publicAddress,
+					ClusterAddress: net.JoinHostPort(d.dialHost, bindings[0].HostPort),
+				})
+			}
+		}
+	}
+
+	return &result, nil
+}
+
+// 在宿主机上连接发布出来的端口，代替 k8s 的 TCP 探针
+func (d *dockerBackend) checkPorts(pause dockerListContainer) error {
+	for _, port := range pause.Ports {
+		if port.PublicPort == 0 || port.Type != "tcp" {
+			continue
+		}
+
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(d.dialHost, strconv.Itoa(int(port.PublicPort))), 3*time.Second)
+		if err != nil {
+			return fmt.Errorf("port %d is not reachable: %w", port.PrivatePort, err)
+		}
+		conn.Close()
+	}
+	return nil
+}
+
+func (d *dockerBackend) instanceStatus(pauses []dockerListContainer, apps []dockerListContainer) PodStatusDecision {
+	for _, container := range append(append([]dockerListContainer{}, pauses...), apps...) {
+		switch container.State {
+		case "running":
+			continue
+		case "exited", "dead":
+			// on-failure 重试次数用完之后停在 exited，相当于 k8s 的 CrashLoopBackOff
+			return PodStatusDecision{
+				Status:         CustomPodFailed,
+				ShouldContinue: false,
+				ShouldReport:   true,
+				Message:        fmt.Sprintf("Container %s %s", strings.TrimPrefix(firstName(container.Names), "/"), container.Status),
+			}
+		default:
+			return PodStatusDecision{
+				Status:         CustomPodWaiting,
+				ShouldContinue: true,
+				ShouldReport:   false,
+				Message:        fmt.Sprintf("Container %s is %s", strings.TrimPrefix(firstName(container.Names), "/"), container.State),
+			}
+		}
+	}
+
+	for _, pause := range pauses {
+		if pause.Labels[dockerLabelHealthCheck] != "true" {
+			continue
+		}
+		if err := d.checkPorts(pause); err != nil {
+			return PodStatusDecision{
+				Status:         CustomPodWaiting,
+				ShouldContinue: true,
+				ShouldReport:   false,
+				Message:        err.Error(),
+			}
+		}
+	}
+
+	return PodStatusDecision{
+		Status:         CustomPodRunning,
+		ShouldContinue: false,
+		ShouldReport:   false,
+		Message:        "Pod is running successfully",
+	}
+}
+
+func firstName(names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	return names[0]
+}
+
+func (d *dockerBackend) ListInstances() ([]Instance, error) {
+	containers, err := d.listContainers("")
+	if err != nil {
+		return nil, fmt.Errorf("error listing containers: %w", err)
+	}
+
+	// 多组件的实例有多个 pause 容器
+	pauses := make(map[string][]dockerListContainer)
+	apps := make(map[string][]dockerListContainer)
+	for _, container := range containers {
+		podName := container.Labels[dockerLabelPod]
+		if container.Labels[dockerLabelRole] == dockerRolePause {
+			pauses[podName] = append(pauses[podName], container)
+		} else {
+			apps[podName] = append(apps[podName], container)
+		}
+	}
+
+	instances := make([]Instance, 0, len(pauses))
+	for podName, podPauses := range pauses {
+		instances = append(instances, Instance{
+			Name:   podName,
+			Labels: podPauses[0].Labels,
+			Status: d.instanceStatus(podPauses, apps[podName]),
+		})
+	}
+
+	return instances, nil
+}
+
+type dockerListNetwork struct {
+	Name    string            `json:"Name"`
+	Created time.Time         `json:"Created"`
+	Labels  map[string]string `json:"Labels"`
+}
+
+// 先返回题目容器，再返回 pause 容器和实例网络，按顺序删除不会被依赖关系卡住
+func (d *dockerBackend) ListResources() ([]ManagedResource, error) {
+	containers, err := d.listContainers("")
+	if err != nil {
+		return nil, fmt.Errorf("error listing containers: %w", err)
+	}
+
+	resources := make([]ManagedResource, 0, len(containers))
+	for _, role := range []string{dockerRoleApp, dockerRolePause} {
+		for _, container := range containers {
+			if container.Labels[dockerLabelRole] != role || container.Labels[dockerLabelPod] == "" {
+				continue
+			}
+			resources = append(resources, ManagedResource{
+				Kind:      ResourceContainer,
+				Name:      strings.TrimPrefix(firstName(container.Names), "/"),
+				Instance:  container.Labels[dockerLabelPod],
+				CreatedAt: time.Unix(container.Created, 0),
+			})
+		}
+	}
+
+	filters, err := sonic.Marshal(map[string][]string{"label": {dockerLabelManaged + "=true"}})
+	if err != nil {
+		return nil, err
+	}
+
+	var networks []dockerListNetwork
+	if err := d.call(http.MethodGet, "/networks", url.Values{"filters": []string{string(filters)}}, nil, &networks); err != nil {
+		return nil, fmt.Errorf("error listing networks: %w", err)
+	}
+
+	// 公共网络没有实例标签，不会被回收
+	for _, network := range networks {
+		if network.Labels[dockerLabelPod] == "" {
+			continue
+		}
+		resources = append(resources, ManagedResource{
+			Kind:      ResourceNetwork,
+			Name:      network.Name,
+			Instance:  network.Labels[dockerLabelPod],
+			CreatedAt: network.Created,
+		})
+	}
+
+	return resources, nil
+}
+
+func (d *dockerBackend) DeleteResource(resource ManagedResource) error {
+	var err error
+	switch resource.Kind {
+	case ResourceContainer:
+		err = d.call(http.MethodDelete, "/containers/"+resource.Name, url.Values{"force": []string{"true"}}, nil, nil)
+	case ResourceNetwork:
+		err = d.call(http.MethodDelete, "/networks/"+resource.Name, nil, nil, nil)
+	default:
+		return fmt.Errorf("unknown resource kind %s", resource.Kind)
+	}
+
+	if err != nil && !errors.Is(err, errDockerNotFound) {
+		return fmt.Errorf("error deleting %s %s: %w", resource.Kind, resource.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package k8stool
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// FakeBackend 只在内存里记录实例的后端，只在测试里编译，行为和 k8s / Docker 后端保持一致：
+//   - 创建之后实例处于等待状态，SetInstanceStatus 模拟实例启动成功或者失败
+//   - 暴露端口的名字是 <容器下标>-<端口名>，internal 端口不返回
+//   - 重复创建同名实例返回错误，删除不存在的实例不报错
+type FakeBackend struct {
+	mu        sync.Mutex
+	instances map[string]*fakeInstance
+	nextPort  int32
+}
+
+type fakeInstance struct {
+	podInfo   PodInfo
+	status    PodStatusDecision
+	ports     map[string]int32
+	createdAt time.Time
+	// InjectFlag 写入的 flag
+	flag string
+}
+
+func NewFakeBackend() *FakeBackend {
+	return &FakeBackend{
+		instances: make(map[string]*fakeInstance),
+		nextPort:  30000,
+	}
+}
+
+func (f *FakeBackend) Name() string {
+	return "fake"
+}
+
+func (f *FakeBackend) Init() error {
+	return nil
+}
+
+func (f *FakeBackend) CreatePod(podInfo *PodInfo) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.instances[podInfo.Name]; ok {
+		return fmt.Errorf("instance %s already exists", podInfo.Name)
+	}
+
+	instance := &fakeInstance{
+		podInfo: *podInfo,
+		status: PodStatusDecision{
+			Status:         CustomPodWaiting,
+			ShouldContinue: true,
+			ShouldReport:   false,
+			Message:        "Pod is being created",
+		},
+		ports:     make(map[string]int32),
+		createdAt: time.Now(),
+	}
+	if !podInfo.Warm {
+		instance.flag = podInfo.Flag
+	}
+
+	for index, c := range podInfo.Containers {
+		for _, port := range c.ExposePorts {
+			if port.Internal {
+				continue
+			}
+			instance.ports[fmt.Sprintf("%d-%s", index, port.Name)] = f.nextPort
+			f.nextPort++
+		}
+	}
+
+	f.instances[podInfo.Name] = instance
+	return nil
+}
+
+func (f *FakeBackend) DeletePod(podInfo *PodInfo) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.instances, podInfo.Name)
+	return nil
+}
+
+func (f *FakeBackend) GetPodPorts(podInfo *PodInfo) (*PodPorts, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	instance, ok := f.instances[podInfo.Name]
+	if !ok {
+		return nil, fmt.Errorf("instance %s not found", podInfo.Name)
+	}
+
+	result := make(PodPorts, 0, len(instance.ports))
+	for index, c := range instance.podInfo.Containers {
+		for _, port := range c.ExposePorts {
+			if port.Internal {
+				continue
+			}
+			nodePort := instance.ports[fmt.Sprintf("%d-%s", index, port.Name)]
+			result = append(result, PodPort{
+				Name:           fmt.Sprintf("%d-%s", index, port.Name),
+				Port:           port.Port,
+				NodePort:       nodePort,
+				NodeName:       "127.0.0.1",
+				ClusterAddress: net.JoinHostPort("127.0.0.1", strconv.Itoa(int(nodePort))),
+			})
+		}
+	}
+
+	return &result, nil
+}
+
+func (f *FakeBackend) ListInstances() ([]Instance, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	instances := make([]Instance, 0, len(f.instances))
+	for name, instance := range f.instances {
+		labels := make(map[string]string, len(instance.podInfo.Labels)+1)
+		for key, value := range instance.podInfo.Labels {
+			labels[key] = value
+		}
+		labels[LabelInstance] = name
+
+		instances = append(instances, Instance{
+			Name:   name,
+			Labels: labels,
+			Status: instance.status,
+		})
+	}
+
+	return instances, nil
+}
+
+func (f *FakeBackend) InjectFlag(podInfo *PodInfo) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	instance, ok := f.instances[podInfo.Name]
+	if !ok {
+		return fmt.Errorf("instance %s not found", podInfo.Name)
+	}
+
+	instance.flag = podInfo.Flag
+	return nil
+}
+
+func (f *FakeBackend) ListResources() ([]ManagedResource, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	resources := make([]ManagedResource, 0, len(f.instances))
+	for name, instance := range f.instances {
+		resources = append(resources, ManagedResource{
+			Kind:      ResourceContainer,
+			Name:      name,
+			Instance:  name,
+			CreatedAt: instance.createdAt,
+		})
+	}
+
+	return resources, nil
+}
+
+func (f *FakeBackend) DeleteResource(resource ManagedResource) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if resource.Kind != ResourceContainer {
+		return fmt.Errorf("unknown resource kind %s", resource.Kind)
+	}
+
+	delete(f.instances, resource.Name)
+	return nil
+}
+
+// SetInstanceStatus 模拟实例状态变化，实例不存在的时候返回 false
+func (f *FakeBackend) SetInstanceStatus(name string, status PodStatusDecision) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	instance, ok := f.instances[name]
+	if !ok {
+		return false
+	}
+
+	instance.status = status
+	return true
+}
+
+// InstanceFlag 实例当前的 flag，预热实例在 InjectFlag 之前为空
+func (f *FakeBackend) InstanceFlag(name string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	instance, ok := f.instances[name]
+	if !ok {
+		return "", false
+	}
+
+	return instance.flag, true
+}
@@ -0,0 +1,333 @@
+package k8stool
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+const (
+	DefaultFlagEnvName = "A1CTF_FLAG"
+	// FlagPlaceholder command 里的占位符，开启 TemplateCommand 后替换成 flag
+	FlagPlaceholder = "{{flag}}"
+
+	defaultFlagFileMode  = 0444
+	defaultFlagInitImage = "busybox:1.36"
+
+	flagSecretKey    = "flag"
+	flagSecretVolume = "a1ctf-flag-secret"
+
+	flagExecTimeout = 30 * time.Second
+)
+
+// FlagInjection 容器的 flag 注入方式，没有配置的时候和以前一样只注入 A1CTF_FLAG 环境变量
+type FlagInjection struct {
+	// 环境变量名，为空的时候使用 A1CTF_FLAG
+	EnvName string `json:"env_name" validate:"omitempty,env_name" label:"FlagEnvName" message:"Flag env name must be a valid environment variable name"`
+	// 不注入环境变量，避免 flag 出现在 /proc/<pid>/environ
+	DisableEnv bool `json:"disable_env"`
+	// 写入文件的绝对路径，为空的时候不写文件
+	FilePath string `json:"file_path" validate:"omitempty,flag_path" label:"FlagFilePath" message:"Flag file path must be a clean absolute path"`
+	// 文件权限，默认 0444
+	FileMode *int32 `json:"file_mode" validate:"omitempty,min=0,max=511" label:"FlagFileMode" message:"Flag file mode must be between 0000 and 0777"`
+	// 文件所有者，设置之后 k8s 后端通过 init 容器复制文件并修改所有者
+	FileUID *int64 `json:"file_uid" validate:"omitempty,min=0" label:"FlagFileUID"`
+	FileGID *int64 `json:"file_gid" validate:"omitempty,min=0" label:"FlagFileGID"`
+	// 把 command 里的 {{flag}} 替换成 flag
+	TemplateCommand bool `json:"template_command"`
+	// 实例运行之后在容器里执行的命令，{{flag}} 会被替换成 flag，命令需要可以重复执行
+	ExecCommand []string `json:"exec_command,omitempty"`
+}
+
+func validateEnvName(fl validator.FieldLevel) bool {
+	return len(validation.IsEnvVarName(fl.Field().String())) == 0
+}
+
+func validateFlagPath(fl validator.FieldLevel) bool {
+	value := fl.Field().String()
+	return path.IsAbs(value) && path.Clean(value) == value && value != "/"
+}
+
+// FlagEnv 需要注入的环境变量，不需要注入的时候返回 false
+func (c *A1Container) FlagEnv() (string, bool) {
+	if c.FlagInjection == nil {
+		return DefaultFlagEnvName, true
+	}
+	if c.FlagInjection.DisableEnv {
+		return "", false
+	}
+	if c.FlagInjection.EnvName == "" {
+		return DefaultFlagEnvName, true
+	}
+	return c.FlagInjection.EnvName, true
+}
+
+// RenderCommand 返回替换过 flag 占位符的 command
+func (c *A1Container) RenderCommand(flag string) []string {
+	if c.FlagInjection == nil || !c.FlagInjection.TemplateCommand || len(c.Command) == 0 {
+		return c.Command
+	}
+
+	command := make([]string, 0, len(c.Command))
+	for _, arg := range c.Command {
+		command = append(command, strings.ReplaceAll(arg, FlagPlaceholder, flag))
+	}
+	return command
+}
+
+// RenderExecCommand 返回替换过 flag 占位符的 ExecCommand，没有配置的时候返回 nil
+func (c *A1Container) RenderExecCommand(flag string) []string {
+	if c.FlagInjection == nil || len(c.FlagInjection.ExecCommand) == 0 {
+		return nil
+	}
+
+	command := make([]string, 0, len(c.FlagInjection.ExecCommand))
+	for _, arg := range c.FlagInjection.ExecCommand {
+		command = append(command, strings.ReplaceAll(arg, FlagPlaceholder, flag))
+	}
+	return command
+}
+
+func (c *A1Container) flagFile() (string, bool) {
+	if c.FlagInjection == nil || c.FlagInjection.FilePath == "" {
+		return "", false
+	}
+	return c.FlagInjection.FilePath, true
+}
+
+func (c *A1Container) flagFileMode() int32 {
+	if c.FlagInjection == nil || c.FlagInjection.FileMode == nil {
+		return defaultFlagFileMode
+	}
+	return *c.FlagInjection.FileMode
+}
+
+func (c *A1Container) flagFileOwner() (int64, int64, bool) {
+	if c.FlagInjection == nil || (c.FlagInjection.FileUID == nil && c.FlagInjection.FileGID == nil) {
+		return 0, 0, false
+	}
+
+	var uid, gid int64
+	if c.FlagInjection.FileUID != nil {
+		uid = *c.FlagInjection.FileUID
+	}
+	if c.FlagInjection.FileGID != nil {
+		gid = *c.FlagInjection.FileGID
+	}
+	return uid, gid, true
+}
+
+func podNeedsFlagFile(podInfo *PodInfo) bool {
+	for i := range podInfo.Containers {
+		if _, ok := podInfo.Containers[i].flagFile(); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func flagSecretName(podName string) string {
+	return podName + "-flag"
+}
+
+// 写文件的 flag 放在 Secret 里，实例重置的时候和 Pod 一起重新创建，保证是最新的 flag
+func applyK8sFlagSecret(clientset kubernetes.Interface, podInfo *PodInfo, namespace string) error {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   flagSecretName(podInfo.Name),
+			Labels: podInfo.Labels,
+		},
+		StringData: map[string]string{
+			flagSecretKey: podInfo.Flag,
+		},
+	}
+
+	_, err := clientset.CoreV1().Secrets(namespace).Create(context.Background(), secret, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		_, err = clientset.CoreV1().Secrets(namespace).Update(context.Background(), secret, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("error creating flag secret: %v", err)
+	}
+
+	return nil
+}
+
+// 给 Pod 添加 flag 文件的挂载
+//
+//   - 不需要修改所有者的直接挂载 Secret，Secret 卷的文件所有者固定是 root
+//   - 需要修改所有者的先由 init 容器复制到 emptyDir 并修改所有者和权限，再挂载 emptyDir
+func applyK8sFlagFiles(podInfo *PodInfo, podSpec *corev1.PodSpec) {
+	if !podNeedsFlagFile(podInfo) {
+		return
+	}
+
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: flagSecretVolume,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: flagSecretName(podInfo.Name),
+			},
+		},
+	})
+
+	initImage := viper.GetString("k8s.flag-init-image")
+	if initImage == "" {
+		initImage = defaultFlagInitImage
+	}
+
+	for index := range podInfo.Containers {
+		c := &podInfo.Containers[index]
+		filePath, ok := c.flagFile()
+		if !ok {
+			continue
+		}
+
+		volumeName := fmt.Sprintf("a1ctf-flag-%d", index)
+		mode := c.flagFileMode()
+
+		if uid, gid, ok := c.flagFileOwner(); ok {
+			podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+				Name: volumeName,
+				VolumeSource: corev1.VolumeSource{
+					EmptyDir: &corev1.EmptyDirVolumeSource{},
+				},
+			})
+
+			podSpec.InitContainers = append(podSpec.InitContainers, corev1.Container{
+				Name:  fmt.Sprintf("a1ctf-flag-%d", index),
+				Image: initImage,
+				Command: []string{"sh", "-c", fmt.Sprintf(
+					"cp /a1ctf-secret/%[1]s /a1ctf-flag/%[1]s && chown %[2]d:%[3]d /a1ctf-flag/%[1]s && chmod %[4]o /a1ctf-flag/%[1]s",
+					flagSecretKey, uid, gid, mode,
+				)},
+				VolumeMounts: []corev1.VolumeMount{
+					{Name: flagSecretVolume, MountPath: "/a1ctf-secret", ReadOnly: true},
+					{Name: volumeName, MountPath: "/a1ctf-flag"},
+				},
+			})
+		} else {
+			podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+				Name: volumeName,
+				VolumeSource: corev1.VolumeSource{
+					Secret: &corev1.SecretVolumeSource{
+						SecretName: flagSecretName(podInfo.Name),
+						Items: []corev1.KeyToPath{
+							{Key: flagSecretKey, Path: flagSecretKey, Mode: &mode},
+						},
+					},
+				},
+			})
+		}
+
+		for i := range podSpec.Containers {
+			if podSpec.Containers[i].Name != c.Name {
+				continue
+			}
+			podSpec.Containers[i].VolumeMounts = append(podSpec.Containers[i].VolumeMounts, corev1.VolumeMount{
+				Name:      volumeName,
+				MountPath: filePath,
+				SubPath:   flagSecretKey,
+				ReadOnly:  true,
+			})
+		}
+	}
+}
+
+// NeedsFlagInjection 实例运行之后是否还需要调用 InjectFlag
+func NeedsFlagInjection(podInfo *PodInfo) bool {
+	for i := range podInfo.Containers {
+		c := &podInfo.Containers[i]
+		if _, ok := c.flagFile(); ok && podInfo.Warm {
+			return true
+		}
+		if len(c.RenderExecCommand(podInfo.Flag)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// InjectFlag 把 flag 写进已经运行的实例，预热实例的 flag 文件在这里写入，然后执行 ExecCommand
+func InjectFlag(podInfo *PodInfo) error {
+	return Backend().InjectFlag(podInfo)
+}
+
+// 预热实例的 Pod 里没有挂载 flag Secret，通过 exec 写文件，要求镜像里有 sh
+func injectK8sFlag(podInfo *PodInfo) error {
+	clientset, err := GetClient()
+	if err != nil {
+		return err
+	}
+
+	for index := range podInfo.Containers {
+		c := &podInfo.Containers[index]
+		podName := componentPodName(podInfo.Name, c.ComponentName())
+
+		if filePath, ok := c.flagFile(); ok && podInfo.Warm {
+			script := fmt.Sprintf(`cat > "$0" && chmod %o "$0"`, c.flagFileMode())
+			if uid, gid, ok := c.flagFileOwner(); ok {
+				script += fmt.Sprintf(` && chown %d:%d "$0"`, uid, gid)
+			}
+			if err := execK8sPod(clientset, podName, c.Name, []string{"sh", "-c", script, filePath}, strings.NewReader(podInfo.Flag)); err != nil {
+				return fmt.Errorf("error writing flag file for %s: %v", c.Name, err)
+			}
+		}
+
+		if command := c.RenderExecCommand(podInfo.Flag); len(command) > 0 {
+			if err := execK8sPod(clientset, podName, c.Name, command, nil); err != nil {
+				return fmt.Errorf("error executing flag command for %s: %v", c.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func execK8sPod(clientset kubernetes.Interface, podName string, containerName string, command []string, stdin io.Reader) error {
+	req := clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(podName).
+		Namespace("a1ctf-challenges").
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: containerName,
+			Command:   command,
+			Stdin:     stdin != nil,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	executor, err := remotecommand.NewSPDYExecutor(GetClientConfig(), "POST", req.URL())
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), flagExecTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	if err := executor.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdin:  stdin,
+		Stdout: io.Discard,
+		Stderr: &stderr,
+	}); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package k8stool
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// 后端资源的类型，用于垃圾回收和监控指标
+const (
+	ResourcePod           = "pod"
+	ResourceService       = "service"
+	ResourceNetworkPolicy = "network_policy"
+	ResourceIngress       = "ingress"
+	ResourceSecret        = "secret"
+	ResourceContainer     = "container"
+	ResourceNetwork       = "network"
+)
+
+// ManagedResource 平台在后端里创建的一个资源，Instance 是它所属的实例名
+type ManagedResource struct {
+	Kind      string
+	Name      string
+	Instance  string
+	CreatedAt time.Time
+}
+
+// 旧版本创建的资源没有实例标签，只能从名字里找到实例名，
+// 队伍实例是 cl-<ingame_id>-<team_hash>，静态实例是 cs-<ingame_id>，后面可能跟着组件名和后缀
+var instanceNameRegexp = regexp.MustCompile(`^(cl-\d+-[0-9a-f]+|cs-\d+)(-[a-z0-9-]+)?$`)
+
+func resourceInstance(name string, labels map[string]string) (string, bool) {
+	if instance, ok := labels[LabelInstance]; ok && instance != "" {
+		return instance, true
+	}
+	matches := instanceNameRegexp.FindStringSubmatch(name)
+	if matches == nil {
+		return "", false
+	}
+	return matches[1], true
+}
+
+// 实例级别的资源（NetworkPolicy、Ingress）使用的标签
+func instanceLabels(podInfo *PodInfo) map[string]string {
+	labels := make(map[string]string, len(podInfo.Labels)+1)
+	for key, value := range podInfo.Labels {
+		labels[key] = value
+	}
+	labels[LabelInstance] = podInfo.Name
+	return labels
+}
+
+func ListResources() ([]ManagedResource, error) {
+	return Backend().ListResources()
+}
+
+func DeleteResource(resource ManagedResource) error {
+	return Backend().DeleteResource(resource)
+}
+
+func listK8sResources() ([]ManagedResource, error) {
+	clientset, err := GetClient()
+	if err != nil {
+		return nil, err
+	}
+	namespace := "a1ctf-challenges"
+	ctx := context.Background()
+
+	resources := make([]ManagedResource, 0)
+	add := func(kind string, meta metav1.ObjectMeta) {
+		if instance, ok := resourceInstance(meta.Name, meta.Labels); ok {
+			resources = append(resources, ManagedResource{
+				Kind:      kind,
+				Name:      meta.Name,
+				Instance:  instance,
+				CreatedAt: meta.CreationTimestamp.Time,
+			})
+		}
+	}
+
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing pods: %v", err)
+	}
+	for _, item := range pods.Items {
+		add(ResourcePod, item.ObjectMeta)
+	}
+
+	services, err := clientset.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing services: %v", err)
+	}
+	for _, item := range services.Items {
+		add(ResourceService, item.ObjectMeta)
+	}
+
+	networkPolicies, err := clientset.NetworkingV1().NetworkPolicies(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing network policies: %v", err)
+	}
+	for _, item := range networkPolicies.Items {
+		add(ResourceNetworkPolicy, item.ObjectMeta)
+	}
+
+	ingresses, err := clientset.NetworkingV1().Ingresses(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing ingresses: %v", err)
+	}
+	for _, item := range ingresses.Items {
+		add(ResourceIngress, item.ObjectMeta)
+	}
+
+	secrets, err := clientset.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing secrets: %v", err)
+	}
+	for _, item := range secrets.Items {
+		add(ResourceSecret, item.ObjectMeta)
+	}
+
+	return resources, nil
+}
+
+func deleteK8sResource(resource ManagedResource) error {
+	clientset, err := GetClient()
+	if err != nil {
+		return err
+	}
+	namespace := "a1ctf-challenges"
+	ctx := context.Background()
+
+	switch resource.Kind {
+	case ResourcePod:
+		err = clientset.CoreV1().Pods(namespace).Delete(ctx, resource.Name, metav1.DeleteOptions{
+			GracePeriodSeconds: func(i int64) *int64 { return &i }(0),
+		})
+	case ResourceService:
+		err = clientset.CoreV1().Services(namespace).Delete(ctx, resource.Name, metav1.DeleteOptions{})
+	case ResourceNetworkPolicy:
+		err = clientset.NetworkingV1().NetworkPolicies(namespace).Delete(ctx, resource.Name, metav1.DeleteOptions{})
+	case ResourceIngress:
+		err = clientset.NetworkingV1().Ingresses(namespace).Delete(ctx, resource.Name, metav1.DeleteOptions{})
+	case ResourceSecret:
+		err = clientset.CoreV1().Secrets(namespace).Delete(ctx, resource.Name, metav1.DeleteOptions{})
+	default:
+		return fmt.Errorf("unknown resource kind %s", resource.Kind)
+	}
+
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("error deleting %s %s: %v", resource.Kind, resource.Name, err)
+	}
+	return nil
+}
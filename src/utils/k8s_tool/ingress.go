@@ -0,0 +1,169 @@
+package k8stool
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// IngressModePlatform 由平台自己按 Host 转发到实例
+	IngressModePlatform = "platform"
+	// IngressModeK8s 为每个实例创建 Kubernetes Ingress，由集群里的 Ingress Controller 转发
+	IngressModeK8s = "k8s"
+
+	// StaticHostPrefix 静态容器所有队伍共用一个域名
+	StaticHostPrefix = "static"
+)
+
+func IngressEnabled() bool {
+	return viper.GetBool("container-ingress.enabled") && IngressDomain() != ""
+}
+
+func IngressMode() string {
+	mode := viper.GetString("container-ingress.mode")
+	if mode == "" {
+		return IngressModePlatform
+	}
+	return mode
+}
+
+func IngressDomain() string {
+	return strings.Trim(viper.GetString("container-ingress.domain"), ".")
+}
+
+// HTTPHostPrefix 动态容器为 <team_hash>-<ingame_id>，静态容器为 static-<ingame_id>
+func HTTPHostPrefix(teamHash string, inGameID int64) string {
+	if teamHash == "" {
+		teamHash = StaticHostPrefix
+	}
+	return fmt.Sprintf("%s-%d", teamHash, inGameID)
+}
+
+// PodHTTPHosts 返回标记为 HTTP 的端口对应的域名，key 和 Service 端口名一样是 <容器下标>-<端口名>
+//
+// 只有一个 HTTP 端口的时候域名为 <prefix>.<domain>，有多个的时候为 <prefix>-<容器下标>-<端口名>.<domain>
+func PodHTTPHosts(podInfo *PodInfo) map[string]string {
+	hosts := make(map[string]string)
+	if !IngressEnabled() || podInfo.HTTPHostPrefix == "" {
+		return hosts
+	}
+
+	portKeys := make([]string, 0)
+	for index, container := range podInfo.Containers {
+		for _, port := range container.ExposePorts {
+			if port.HTTP && !port.Internal {
+				portKeys = append(portKeys, fmt.Sprintf("%d-%s", index, port.Name))
+			}
+		}
+	}
+
+	for _, portKey := range portKeys {
+		label := podInfo.HTTPHostPrefix
+		if len(portKeys) > 1 {
+			label = fmt.Sprintf("%s-%s", label, portKey)
+		}
+		hosts[portKey] = label + "." + IngressDomain()
+	}
+
+	return hosts
+}
+
+// HTTPURL 选手访问实例使用的地址
+func HTTPURL(host string) string {
+	scheme := viper.GetString("container-ingress.scheme")
+	if scheme == "" {
+		scheme = "https"
+	}
+
+	publicPort := viper.GetInt("container-ingress.public-port")
+	if publicPort == 0 || (scheme == "https" && publicPort == 443) || (scheme == "http" && publicPort == 80) {
+		return fmt.Sprintf("%s://%s/", scheme, host)
+	}
+	return fmt.Sprintf("%s://%s:%s/", scheme, host, strconv.Itoa(publicPort))
+}
+
+func createK8sIngress(clientset kubernetes.Interface, podInfo *PodInfo, namespace string) error {
+	hosts := PodHTTPHosts(podInfo)
+	if len(hosts) == 0 || IngressMode() != IngressModeK8s {
+		return nil
+	}
+
+	pathType := networkingv1.PathTypePrefix
+	rules := make([]networkingv1.IngressRule, 0, len(hosts))
+	tlsHosts := make([]string, 0, len(hosts))
+	for portKey, host := range hosts {
+		rules = append(rules, networkingv1.IngressRule{
+			Host: host,
+			IngressRuleValue: networkingv1.IngressRuleValue{
+				HTTP: &networkingv1.HTTPIngressRuleValue{
+					Paths: []networkingv1.HTTPIngressPath{
+						{
+							Path:     "/",
+							PathType: &pathType,
+							Backend: networkingv1.IngressBackend{
+								Service: &networkingv1.IngressServiceBackend{
+									Name: exposedServiceName(podInfo, portKey),
+									Port: networkingv1.ServiceBackendPort{Name: portKey},
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+		tlsHosts = append(tlsHosts, host)
+	}
+
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   podInfo.Name,
+			Labels: instanceLabels(podInfo),
+		},
+		Spec: networkingv1.IngressSpec{
+			Rules: rules,
+		},
+	}
+
+	if ingressClass := viper.GetString("container-ingress.k8s.ingress-class"); ingressClass != "" {
+		ingress.Spec.IngressClassName = &ingressClass
+	}
+
+	// 使用泛域名证书
+	if tlsSecret := viper.GetString("container-ingress.k8s.tls-secret"); tlsSecret != "" {
+		ingress.Spec.TLS = []networkingv1.IngressTLS{
+			{
+				Hosts:      tlsHosts,
+				SecretName: tlsSecret,
+			},
+		}
+	}
+
+	_, err := clientset.NetworkingV1().Ingresses(namespace).Create(context.Background(), ingress, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("error creating ingress: %v", err)
+	}
+
+	return nil
+}
+
+// 平台代理和 Ingress Controller 在集群内部，需要单独放行，不然会被 NetworkPolicy 拦截
+func gatewayPeers() []networkingv1.NetworkPolicyPeer {
+	peers := make([]networkingv1.NetworkPolicyPeer, 0)
+	for _, namespace := range viper.GetStringSlice("k8s.gateway-namespaces") {
+		peers = append(peers, networkingv1.NetworkPolicyPeer{
+			NamespaceSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"kubernetes.io/metadata.name": namespace,
+				},
+			},
+		})
+	}
+	return peers
+}
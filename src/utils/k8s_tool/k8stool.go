@@ -7,12 +7,13 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"net"
+	"strconv"
 
 	"github.com/bytedance/sonic"
 	"github.com/go-playground/validator/v10"
 	"github.com/spf13/viper"
 	corev1 "k8s.io/api/core/v1"
-	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
@@ -23,7 +24,7 @@ import (
 	"k8s.io/client-go/tools/clientcmd"
 )
 
-var clientset *kubernetes.Clientset
+var clientset kubernetes.Interface
 var globalConfig *rest.Config
 var NodeAddressMap map[string]string = make(map[string]string)
 
@@ -42,6 +43,39 @@ func InitNodeAddressMap() {
 type PortName struct {
 	Name string `json:"name" validate:"required,portname" label:"PortName" message:"Port name must be a DNS_LABEL"`
 	Port int32  `json:"port" validate:"min=1,max=65535" label:"Port" message:"Port must be between 1 and 65535"`
+	// Web 题目的端口，开启 container-ingress 后通过域名访问
+	HTTP bool `json:"http"`
+	// 只在实例内部使用的端口，其他组件可以通过 <组件名>:<端口> 访问，不对选手暴露
+	Internal bool `json:"internal"`
+	// 端口协议，为空的时候是 TCP
+	Protocol string `json:"protocol,omitempty" validate:"omitempty,oneof=TCP UDP" label:"PortProtocol" message:"Port protocol must be TCP or UDP"`
+}
+
+const (
+	ProtocolTCP = "TCP"
+	ProtocolUDP = "UDP"
+)
+
+// PortProtocol 端口协议，旧的配置没有这个字段，默认 TCP
+func (p PortName) PortProtocol() string {
+	if p.Protocol == "" {
+		return ProtocolTCP
+	}
+	return p.Protocol
+}
+
+func (p PortName) k8sProtocol() corev1.Protocol {
+	return corev1.Protocol(p.PortProtocol())
+}
+
+// 健康检查只能用 TCP 端口
+func firstTCPPort(ports []PortName) (int32, bool) {
+	for _, port := range ports {
+		if port.PortProtocol() == ProtocolTCP {
+			return port.Port, true
+		}
+	}
+	return 0, false
 }
 
 type A1Container struct {
@@ -53,6 +87,16 @@ type A1Container struct {
 	CPULimit     int64           `json:"cpu_limit" validate:"min=0" label:"CPULimit" message:"CPU limit must be greater than 0"`
 	MemoryLimit  int64           `json:"memory_limit" validate:"min=0" label:"MemoryLimit" message:"Memory limit must be greater than 0"`
 	StorageLimit int64           `json:"storage_limit" validate:"min=0" label:"StorageLimit" message:"Storage limit must be greater than 0"`
+	// flag 的注入方式，为空的时候注入 A1CTF_FLAG 环境变量
+	FlagInjection *FlagInjection `json:"flag_injection,omitempty"`
+	// 沙箱运行时（gVisor / Kata 等），和节点选择、容忍一样是 Pod 级别的设置，会合并所有容器的配置
+	RuntimeClassName string            `json:"runtime_class_name,omitempty" validate:"omitempty,dns_subdomain" label:"RuntimeClassName" message:"Runtime class name must be a DNS subdomain"`
+	NodeSelector     map[string]string `json:"node_selector,omitempty"`
+	Tolerations      []Toleration      `json:"tolerations,omitempty" validate:"dive"`
+	// 容器的安全设置
+	Security *ContainerSecurity `json:"security,omitempty"`
+	// 容器所属的组件，同一个组件的容器放在同一个 Pod 里，为空的时候属于 main 组件
+	Component string `json:"component,omitempty" validate:"omitempty,dns_label,max=20" label:"Component" message:"Component must be a DNS_LABEL no longer than 20 characters"`
 }
 
 // 自定义验证函数 - 验证DNS标签格式
@@ -73,6 +117,12 @@ func ValidContainerConfig(containers []A1Container) error {
 	// 注册自定义验证函数
 	_ = validate.RegisterValidation("dns_label", validateDNSLabel)
 	_ = validate.RegisterValidation("portname", validatePortName)
+	_ = validate.RegisterValidation("env_name", validateEnvName)
+	_ = validate.RegisterValidation("flag_path", validateFlagPath)
+	_ = validate.RegisterValidation("label_key", validateLabelKey)
+	_ = validate.RegisterValidation("label_value", validateLabelValue)
+	_ = validate.RegisterValidation("dns_subdomain", validateDNSSubdomain)
+	_ = validate.RegisterValidation("capability", validateCapability)
 
 	for _, container := range containers {
 		err := validate.Struct(container)
@@ -91,7 +141,10 @@ func ValidContainerConfig(containers []A1Container) error {
 			}
 		}
 	}
-	return nil
+	if err := validateTopology(containers); err != nil {
+		return err
+	}
+	return validatePodPlacement(containers)
 }
 
 type A1Containers []A1Container
@@ -116,9 +169,15 @@ type PodInfo struct {
 	Flag       string
 	AllowWAN   bool
 	AllowDNS   bool
+	// 为暴露的端口添加 TCP 存活和就绪探针，共享的静态容器需要根据探针结果自动重启
+	HealthCheck bool
+	// HTTP 端口域名的前缀，见 HTTPHostPrefix
+	HTTPHostPrefix string
+	// 预热实例，创建的时候不注入 flag，领取之后由 InjectFlag 写入
+	Warm bool
 }
 
-func GetClient() (*kubernetes.Clientset, error) {
+func GetClient() (kubernetes.Interface, error) {
 
 	if clientset != nil {
 		return clientset, nil
@@ -148,7 +207,7 @@ func GetClientConfig() *rest.Config {
 	return globalConfig
 }
 
-func ListPods() (*corev1.PodList, error) {
+func listK8sPods() (*corev1.PodList, error) {
 	clientset, err := GetClient()
 	if err != nil {
 		return nil, err
@@ -163,13 +222,62 @@ func ListPods() (*corev1.PodList, error) {
 	return podList, nil
 }
 
-func CreatePod(podInfo *PodInfo) error {
+func tcpProbe(port int32) *corev1.Probe {
+	return &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			TCPSocket: &corev1.TCPSocketAction{
+				Port: intstr.FromInt(int(port)),
+			},
+		},
+		InitialDelaySeconds: 5,
+		PeriodSeconds:       10,
+		TimeoutSeconds:      3,
+		FailureThreshold:    3,
+	}
+}
+
+func createK8sPod(podInfo *PodInfo) error {
 	clientset, err := GetClient()
 	if err != nil {
 		return err
 	}
 	namespace := "a1ctf-challenges"
 
+	components := podComponents(podInfo)
+
+	// 多组件的实例需要先创建组件之间访问用的 Service
+	var hostAliases []corev1.HostAlias
+	if len(components) > 1 {
+		hostAliases, err = createK8sComponentServices(clientset, podInfo, components, namespace)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, component := range components {
+		if err := createK8sComponentPod(clientset, podInfo, component, hostAliases, namespace); err != nil {
+			return err
+		}
+	}
+
+	if err := createK8sIngress(clientset, podInfo, namespace); err != nil {
+		return err
+	}
+
+	if networkPolicy := k8sNetworkPolicy(podInfo, components); networkPolicy != nil {
+		_, err = clientset.NetworkingV1().NetworkPolicies(namespace).Create(context.Background(), networkPolicy, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("error creating network policy: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// 创建一个组件的 Pod 和对外暴露端口的 Service
+func createK8sComponentPod(clientset kubernetes.Interface, instance *PodInfo, component podComponent, hostAliases []corev1.HostAlias, namespace string) error {
+	podInfo := component.podInfo(instance)
+
 	// 构造 Pod 中的容器列表
 	var containers []corev1.Container
 	for _, c := range podInfo.Containers {
@@ -180,17 +288,19 @@ func CreatePod(podInfo *PodInfo) error {
 			Env:   []corev1.EnvVar{},
 		}
 		if len(c.Command) > 0 {
-			container.Command = c.Command
+			container.Command = c.RenderCommand(podInfo.Flag)
 		}
 		if len(c.Env) > 0 {
 			container.Env = c.Env
 		}
 
 		// add the flag env
-		container.Env = append(container.Env, corev1.EnvVar{
-			Name:  "A1CTF_FLAG",
-			Value: podInfo.Flag,
-		})
+		if envName, ok := c.FlagEnv(); ok && !podInfo.Warm {
+			container.Env = append(container.Env, corev1.EnvVar{
+				Name:  envName,
+				Value: podInfo.Flag,
+			})
+		}
 
 		if len(c.ExposePorts) > 0 {
 			var containerPorts []corev1.ContainerPort
@@ -198,9 +308,15 @@ func CreatePod(podInfo *PodInfo) error {
 				containerPorts = append(containerPorts, corev1.ContainerPort{
 					ContainerPort: port.Port,
 					Name:          port.Name,
+					Protocol:      port.k8sProtocol(),
 				})
 			}
 			container.Ports = containerPorts
+
+			if probePort, ok := firstTCPPort(c.ExposePorts); ok && podInfo.HealthCheck {
+				container.ReadinessProbe = tcpProbe(probePort)
+				container.LivenessProbe = tcpProbe(probePort)
+			}
 		}
 
 		// 只限制资源，不申请资源
@@ -222,6 +338,8 @@ func CreatePod(podInfo *PodInfo) error {
 			Requests: requests,
 		}
 
+		container.SecurityContext = c.k8sSecurityContext()
+
 		containers = append(containers, container)
 	}
 	pod := &corev1.Pod{
@@ -230,38 +348,44 @@ func CreatePod(podInfo *PodInfo) error {
 			Labels: podInfo.Labels,
 		},
 		Spec: corev1.PodSpec{
-			Containers: containers,
+			Containers:  containers,
+			HostAliases: hostAliases,
 		},
 	}
 
+	applyK8sPlacement(podInfo, &pod.Spec)
+
+	// flag 文件需要先创建 Secret
+	if podNeedsFlagFile(podInfo) && !podInfo.Warm {
+		if err := applyK8sFlagSecret(clientset, podInfo, namespace); err != nil {
+			return err
+		}
+		applyK8sFlagFiles(podInfo, &pod.Spec)
+	}
+
 	// 创建 Pod
-	_, err = clientset.CoreV1().Pods(namespace).Create(context.Background(), pod, metav1.CreateOptions{})
+	_, err := clientset.CoreV1().Pods(namespace).Create(context.Background(), pod, metav1.CreateOptions{})
 	if err != nil {
 		return fmt.Errorf("error creating pod: %v", err)
 	}
 
-	// 构造 Service 的端口配置
-	var servicePorts []corev1.ServicePort
-	for c_index, c := range podInfo.Containers {
-		if len(c.ExposePorts) > 0 {
-			for _, port := range c.ExposePorts {
-				servicePort := corev1.ServicePort{
-					Name:       fmt.Sprintf("%d-%s", c_index, port.Name), // 可根据需要自定义 ServicePort 名称
-					Port:       port.Port,
-					TargetPort: intstr.FromInt(int(port.Port)),
-				}
-				servicePorts = append(servicePorts, servicePort)
-			}
-		}
-	}
+	// 构造 Service 的端口配置，端口名使用容器在整个实例里的下标
+	servicePorts := component.exposedPorts(instance)
 
 	if len(servicePorts) > 0 {
+		// 开启平台代理后流量从平台转发到 ClusterIP，不再占用 NodePort，平台代理不能转发 UDP，有 UDP 端口的时候还是使用 NodePort
+		serviceType := corev1.ServiceTypeNodePort
+		if viper.GetBool("container-proxy.enabled") && !hasUDPPort(servicePorts) {
+			serviceType = corev1.ServiceTypeClusterIP
+		}
+
 		service := &corev1.Service{
 			ObjectMeta: metav1.ObjectMeta{
-				Name: podInfo.Name,
+				Name:   podInfo.Name,
+				Labels: podInfo.Labels,
 			},
 			Spec: corev1.ServiceSpec{
-				Type:     corev1.ServiceTypeNodePort,
+				Type:     serviceType,
 				Selector: podInfo.Labels,
 				Ports:    servicePorts,
 			},
@@ -273,95 +397,6 @@ func CreatePod(podInfo *PodInfo) error {
 		}
 	}
 
-	allowedPorts := []networkingv1.NetworkPolicyPort{}
-	for _, c := range podInfo.Containers {
-		for _, port := range c.ExposePorts {
-			allowedPorts = append(allowedPorts, networkingv1.NetworkPolicyPort{
-				// all the protocols
-				// Protocol: func() *v1.Protocol {
-				// 	p := v1.ProtocolTCP
-				// 	return &p
-				// }(),
-				Port: &intstr.IntOrString{IntVal: port.Port},
-			})
-		}
-	}
-
-	if !podInfo.AllowWAN {
-		// 创建 network-policy
-		networkPolicy := &networkingv1.NetworkPolicy{
-			ObjectMeta: metav1.ObjectMeta{
-				Name: podInfo.Name,
-			},
-			Spec: networkingv1.NetworkPolicySpec{
-				PodSelector: metav1.LabelSelector{
-					MatchLabels: podInfo.Labels,
-				},
-				PolicyTypes: []networkingv1.PolicyType{
-					networkingv1.PolicyTypeIngress,
-					networkingv1.PolicyTypeEgress,
-				},
-				Ingress: []networkingv1.NetworkPolicyIngressRule{
-					{
-						From: []networkingv1.NetworkPolicyPeer{
-							{
-								// forbid all traffic to 10.0.0.0/8
-								IPBlock: &networkingv1.IPBlock{
-									CIDR: "0.0.0.0/0",
-									Except: []string{
-										"10.0.0.0/8",
-									},
-								},
-							},
-						},
-						Ports: allowedPorts,
-					},
-				},
-				Egress: []networkingv1.NetworkPolicyEgressRule{},
-			},
-		}
-
-		if podInfo.AllowDNS {
-			networkPolicy.Spec.Egress = append(networkPolicy.Spec.Egress, networkingv1.NetworkPolicyEgressRule{
-				To: []networkingv1.NetworkPolicyPeer{
-					{
-						NamespaceSelector: &metav1.LabelSelector{
-							MatchLabels: map[string]string{
-								"kubernetes.io/metadata.name": "kube-system",
-							},
-						},
-						PodSelector: &metav1.LabelSelector{
-							MatchLabels: map[string]string{
-								"k8s-app": "kube-dns",
-							},
-						},
-					},
-				},
-				Ports: []networkingv1.NetworkPolicyPort{
-					{
-						Protocol: func() *corev1.Protocol {
-							p := corev1.ProtocolUDP
-							return &p
-						}(),
-						Port: &intstr.IntOrString{IntVal: 53},
-					},
-					{
-						Protocol: func() *corev1.Protocol {
-							p := corev1.ProtocolTCP
-							return &p
-						}(),
-						Port: &intstr.IntOrString{IntVal: 53},
-					},
-				},
-			})
-		}
-
-		_, err = clientset.NetworkingV1().NetworkPolicies(namespace).Create(context.Background(), networkPolicy, metav1.CreateOptions{})
-		if err != nil {
-			return fmt.Errorf("error creating network policy: %v", err)
-		}
-	}
-
 	return nil
 }
 
@@ -370,47 +405,78 @@ type PodPort struct {
 	Port     int32  `json:"port"`
 	NodePort int32  `json:"node_port"`
 	NodeName string `json:"node_name"`
+	// 平台自身可以访问到的地址，平台代理转发到这里
+	ClusterAddress string `json:"cluster_address"`
 }
 
 type PodPorts []PodPort
 
-func GetPodPorts(podInfo *PodInfo) (*PodPorts, error) {
+func getK8sPodPorts(podInfo *PodInfo) (*PodPorts, error) {
 	clientset, err := GetClient()
 	if err != nil {
 		return nil, err
 	}
 	namespace := "a1ctf-challenges"
 
-	// 获取 Pod，检查其所在的 Node
-	pod, err := clientset.CoreV1().Pods(namespace).Get(context.Background(), podInfo.Name, metav1.GetOptions{})
-	if err != nil {
-		return nil, fmt.Errorf("error getting pod: %v", err)
-	}
-	if pod.Spec.NodeName == "" {
-		return nil, fmt.Errorf("pod %s not scheduled on a node yet", podInfo.Name)
+	result := make(PodPorts, 0)
+	for _, component := range podComponents(podInfo) {
+		if len(component.exposedPorts(podInfo)) == 0 {
+			continue
+		}
+
+		// 获取 Pod，检查其所在的 Node
+		pod, err := clientset.CoreV1().Pods(namespace).Get(context.Background(), component.PodName, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("error getting pod: %v", err)
+		}
+		if pod.Spec.NodeName == "" {
+			return nil, fmt.Errorf("pod %s not scheduled on a node yet", component.PodName)
+		}
+		nodeName := pod.Spec.NodeName
+
+		// 获取对应 Service 信息
+		service, err := clientset.CoreV1().Services(namespace).Get(context.Background(), component.PodName, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("error getting service: %v", err)
+		}
+
+		for _, port := range service.Spec.Ports {
+			result = append(result, PodPort{
+				Name:           port.Name,
+				Port:           port.Port,
+				NodePort:       port.NodePort,
+				NodeName:       nodeName,
+				ClusterAddress: net.JoinHostPort(service.Spec.ClusterIP, strconv.Itoa(int(port.Port))),
+			})
+		}
 	}
-	nodeName := pod.Spec.NodeName
+	return &result, nil
+}
 
-	// 获取对应 Service 信息
-	service, err := clientset.CoreV1().Services(namespace).Get(context.Background(), podInfo.Name, metav1.GetOptions{})
+// 删除实例的所有组件
+func deleteK8sInstance(podInfo *PodInfo) error {
+	clientset, err := GetClient()
 	if err != nil {
-		return nil, fmt.Errorf("error getting service: %v", err)
+		return err
 	}
+	namespace := "a1ctf-challenges"
 
-	result := make(PodPorts, 0)
-	for _, port := range service.Spec.Ports {
-		result = append(result, PodPort{
-			Name:     port.Name,
-			Port:     port.Port,
-			NodePort: port.NodePort,
-			NodeName: nodeName,
-		})
+	// Ingress 和 NetworkPolicy 使用实例名，就算没有 main 组件也要删除
+	if err := forceDeletePod(podInfo.Name); err != nil {
+		return err
 	}
-	return &result, nil
-}
 
-func DeletePod(podInfo *PodInfo) error {
-	return forceDeletePod(podInfo.Name)
+	components := podComponents(podInfo)
+	for _, component := range components {
+		if component.PodName != podInfo.Name {
+			_ = forceDeletePod(component.PodName)
+		}
+		if len(components) > 1 {
+			_ = clientset.CoreV1().Services(namespace).Delete(context.Background(), component.PodName+internalServiceSuffix, metav1.DeleteOptions{})
+		}
+	}
+
+	return nil
 }
 
 func forceDeletePod(podName string) error {
@@ -420,7 +486,7 @@ func forceDeletePod(podName string) error {
 	}
 	namespace := "a1ctf-challenges"
 
-	// 忽略所有错误，删除三个组件，防止出问题
+	// 忽略所有错误，删除所有组件，防止出问题
 
 	// 删除 Pod
 	_ = clientset.CoreV1().Pods(namespace).Delete(context.Background(), podName, metav1.DeleteOptions{
@@ -438,6 +504,12 @@ func forceDeletePod(podName string) error {
 
 	// 删除 NetworkPolicy
 	_ = clientset.NetworkingV1().NetworkPolicies(namespace).Delete(context.Background(), podName, metav1.DeleteOptions{})
+
+	// 删除 Ingress
+	_ = clientset.NetworkingV1().Ingresses(namespace).Delete(context.Background(), podName, metav1.DeleteOptions{})
+
+	// 删除 flag Secret
+	_ = clientset.CoreV1().Secrets(namespace).Delete(context.Background(), flagSecretName(podName), metav1.DeleteOptions{})
 	// if err != nil {
 	// 	return fmt.Errorf("error deleting network policy: %v", err)
 	// }
@@ -445,7 +517,7 @@ func forceDeletePod(podName string) error {
 	return nil
 }
 
-func InitNamespace() error {
+func initK8sNamespace() error {
 	clientset, err := GetClient()
 	if err != nil {
 		return err
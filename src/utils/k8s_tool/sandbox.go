@@ -0,0 +1,203 @@
+package k8stool
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/go-playground/validator/v10"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	SeccompRuntimeDefault = "RuntimeDefault"
+	SeccompUnconfined     = "Unconfined"
+	SeccompLocalhost      = "Localhost"
+)
+
+var capabilityRegexp = regexp.MustCompile(`^[A-Z][A-Z_]*$`)
+
+// Toleration 和 k8s 的 Toleration 一样，用来把题目调度到带污点的专用节点
+type Toleration struct {
+	Key               string `json:"key" validate:"omitempty,label_key" label:"TolerationKey"`
+	Operator          string `json:"operator" validate:"omitempty,oneof=Exists Equal" label:"TolerationOperator"`
+	Value             string `json:"value" validate:"omitempty,label_value" label:"TolerationValue"`
+	Effect            string `json:"effect" validate:"omitempty,oneof=NoSchedule PreferNoSchedule NoExecute" label:"TolerationEffect"`
+	TolerationSeconds *int64 `json:"toleration_seconds,omitempty" validate:"omitempty,min=0" label:"TolerationSeconds"`
+}
+
+// ContainerSecurity 容器的安全设置，没有配置的时候和以前一样使用镜像默认值
+type ContainerSecurity struct {
+	RunAsUser                *int64   `json:"run_as_user,omitempty" validate:"omitempty,min=0" label:"RunAsUser"`
+	RunAsGroup               *int64   `json:"run_as_group,omitempty" validate:"omitempty,min=0" label:"RunAsGroup"`
+	ReadOnlyRootFilesystem   bool     `json:"read_only_root_filesystem"`
+	AllowPrivilegeEscalation *bool    `json:"allow_privilege_escalation,omitempty"`
+	CapabilitiesAdd          []string `json:"capabilities_add,omitempty" validate:"dive,capability" label:"CapabilitiesAdd" message:"Capability must be like NET_ADMIN"`
+	CapabilitiesDrop         []string `json:"capabilities_drop,omitempty" validate:"dive,capability" label:"CapabilitiesDrop" message:"Capability must be like NET_ADMIN or ALL"`
+	// RuntimeDefault / Unconfined / Localhost，Localhost 需要填写节点上的 profile 路径
+	SeccompProfile          string `json:"seccomp_profile,omitempty" validate:"omitempty,oneof=RuntimeDefault Unconfined Localhost" label:"SeccompProfile"`
+	SeccompLocalhostProfile string `json:"seccomp_localhost_profile,omitempty" validate:"required_if=SeccompProfile Localhost" label:"SeccompLocalhostProfile"`
+}
+
+func validateLabelKey(fl validator.FieldLevel) bool {
+	return len(validation.IsQualifiedName(fl.Field().String())) == 0
+}
+
+func validateLabelValue(fl validator.FieldLevel) bool {
+	return len(validation.IsValidLabelValue(fl.Field().String())) == 0
+}
+
+func validateDNSSubdomain(fl validator.FieldLevel) bool {
+	return len(validation.IsDNS1123Subdomain(fl.Field().String())) == 0
+}
+
+func validateCapability(fl validator.FieldLevel) bool {
+	return capabilityRegexp.MatchString(fl.Field().String())
+}
+
+// RuntimeClassName 和节点选择是 Pod 级别的设置，同一道题的容器不能互相冲突
+func validatePodPlacement(containers []A1Container) error {
+	runtimeClassName := ""
+	nodeSelector := make(map[string]string)
+
+	for _, container := range containers {
+		if container.RuntimeClassName != "" {
+			if runtimeClassName != "" && runtimeClassName != container.RuntimeClassName {
+				return fmt.Errorf("containers must use the same runtime class, got %s and %s", runtimeClassName, container.RuntimeClassName)
+			}
+			runtimeClassName = container.RuntimeClassName
+		}
+
+		for key, value := range container.NodeSelector {
+			if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+				return fmt.Errorf("invalid node selector key %s: %s", key, errs[0])
+			}
+			if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+				return fmt.Errorf("invalid node selector value %s: %s", value, errs[0])
+			}
+			if existing, ok := nodeSelector[key]; ok && existing != value {
+				return fmt.Errorf("conflicting node selector %s: %s and %s", key, existing, value)
+			}
+			nodeSelector[key] = value
+		}
+
+		for _, toleration := range container.Tolerations {
+			if toleration.Operator == "Exists" && toleration.Value != "" {
+				return fmt.Errorf("toleration %s with operator Exists must not have a value", toleration.Key)
+			}
+			if toleration.Key == "" && toleration.Operator != "Exists" {
+				return fmt.Errorf("toleration without key must use operator Exists")
+			}
+		}
+	}
+
+	return nil
+}
+
+// 合并所有容器的 Pod 级别设置
+func applyK8sPlacement(podInfo *PodInfo, podSpec *corev1.PodSpec) {
+	for _, container := range podInfo.Containers {
+		if container.RuntimeClassName != "" {
+			runtimeClassName := container.RuntimeClassName
+			podSpec.RuntimeClassName = &runtimeClassName
+		}
+
+		for key, value := range container.NodeSelector {
+			if podSpec.NodeSelector == nil {
+				podSpec.NodeSelector = make(map[string]string)
+			}
+			podSpec.NodeSelector[key] = value
+		}
+
+		for _, toleration := range container.Tolerations {
+			podSpec.Tolerations = append(podSpec.Tolerations, corev1.Toleration{
+				Key:               toleration.Key,
+				Operator:          corev1.TolerationOperator(toleration.Operator),
+				Value:             toleration.Value,
+				Effect:            corev1.TaintEffect(toleration.Effect),
+				TolerationSeconds: toleration.TolerationSeconds,
+			})
+		}
+	}
+}
+
+func (c *A1Container) k8sSecurityContext() *corev1.SecurityContext {
+	if c.Security == nil {
+		return nil
+	}
+
+	security := c.Security
+	securityContext := &corev1.SecurityContext{
+		RunAsUser:                security.RunAsUser,
+		RunAsGroup:               security.RunAsGroup,
+		AllowPrivilegeEscalation: security.AllowPrivilegeEscalation,
+	}
+
+	if security.ReadOnlyRootFilesystem {
+		readOnly := true
+		securityContext.ReadOnlyRootFilesystem = &readOnly
+	}
+
+	if len(security.CapabilitiesAdd) > 0 || len(security.CapabilitiesDrop) > 0 {
+		capabilities := &corev1.Capabilities{}
+		for _, capability := range security.CapabilitiesAdd {
+			capabilities.Add = append(capabilities.Add, corev1.Capability(capability))
+		}
+		for _, capability := range security.CapabilitiesDrop {
+			capabilities.Drop = append(capabilities.Drop, corev1.Capability(capability))
+		}
+		securityContext.Capabilities = capabilities
+	}
+
+	if security.SeccompProfile != "" {
+		securityContext.SeccompProfile = &corev1.SeccompProfile{
+			Type: corev1.SeccompProfileType(security.SeccompProfile),
+		}
+		if security.SeccompProfile == SeccompLocalhost {
+			localhostProfile := security.SeccompLocalhostProfile
+			securityContext.SeccompProfile.LocalhostProfile = &localhostProfile
+		}
+	}
+
+	return securityContext
+}
+
+// Docker 没有节点的概念，只处理运行时和容器的安全设置
+func (c *A1Container) applyDockerSecurity(config *dockerContainerConfig) error {
+	if c.RuntimeClassName != "" {
+		config.HostConfig.Runtime = c.RuntimeClassName
+	}
+
+	if c.Security == nil {
+		return nil
+	}
+
+	security := c.Security
+
+	if security.RunAsUser != nil {
+		config.User = strconv.FormatInt(*security.RunAsUser, 10)
+		if security.RunAsGroup != nil {
+			config.User += ":" + strconv.FormatInt(*security.RunAsGroup, 10)
+		}
+	} else if security.RunAsGroup != nil {
+		return fmt.Errorf("run_as_group requires run_as_user on the docker backend")
+	}
+
+	config.HostConfig.ReadonlyRootfs = security.ReadOnlyRootFilesystem
+	config.HostConfig.CapAdd = security.CapabilitiesAdd
+	config.HostConfig.CapDrop = security.CapabilitiesDrop
+
+	if security.AllowPrivilegeEscalation != nil && !*security.AllowPrivilegeEscalation {
+		config.HostConfig.SecurityOpt = append(config.HostConfig.SecurityOpt, "no-new-privileges")
+	}
+
+	switch security.SeccompProfile {
+	case SeccompUnconfined:
+		config.HostConfig.SecurityOpt = append(config.HostConfig.SecurityOpt, "seccomp=unconfined")
+	case SeccompLocalhost:
+		return fmt.Errorf("localhost seccomp profile is not supported by the docker backend")
+	}
+
+	return nil
+}
@@ -0,0 +1,345 @@
+package k8stool
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+// 一个题目实例可以由多个组件组成，每个组件是一个 Pod（Docker 后端是一个 pause 容器），
+// 同一个组件里的容器共享网络，组件之间通过组件名互相访问。
+// 没有设置组件的容器都属于 main 组件，main 组件的 Pod 名字和以前一样是实例名。
+const (
+	DefaultComponent = "main"
+
+	// 同一个实例的所有 Pod 都带有这个标签，用来把多个 Pod 合并成一个实例
+	LabelInstance  = "a1ctf-instance"
+	LabelComponent = "a1ctf-component"
+
+	internalServiceSuffix = "-int"
+)
+
+// ComponentName 容器所属的组件
+func (c *A1Container) ComponentName() string {
+	if c.Component == "" {
+		return DefaultComponent
+	}
+	return c.Component
+}
+
+type podComponent struct {
+	Name    string
+	PodName string
+	// 组件内的容器在 ContainerConfig 里的下标，端口名使用这个下标
+	Indexes []int
+}
+
+// 按照组件第一次出现的顺序返回实例的所有组件
+func podComponents(podInfo *PodInfo) []podComponent {
+	components := make([]podComponent, 0, 1)
+	positions := make(map[string]int)
+
+	for index := range podInfo.Containers {
+		name := podInfo.Containers[index].ComponentName()
+		position, ok := positions[name]
+		if !ok {
+			position = len(components)
+			positions[name] = position
+			components = append(components, podComponent{
+				Name:    name,
+				PodName: componentPodName(podInfo.Name, name),
+			})
+		}
+		components[position].Indexes = append(components[position].Indexes, index)
+	}
+
+	return components
+}
+
+func componentPodName(instanceName string, component string) string {
+	if component == DefaultComponent {
+		return instanceName
+	}
+	return instanceName + "-" + component
+}
+
+func componentLabels(podInfo *PodInfo, component string) map[string]string {
+	labels := make(map[string]string, len(podInfo.Labels)+2)
+	for key, value := range podInfo.Labels {
+		labels[key] = value
+	}
+	labels[LabelInstance] = podInfo.Name
+	labels[LabelComponent] = component
+	return labels
+}
+
+// 只包含组件自己的容器的 PodInfo，运行时、节点选择和 flag 文件都按组件处理
+func (p podComponent) podInfo(podInfo *PodInfo) *PodInfo {
+	componentInfo := *podInfo
+	componentInfo.Name = p.PodName
+	componentInfo.Labels = componentLabels(podInfo, p.Name)
+	componentInfo.Containers = make([]A1Container, 0, len(p.Indexes))
+	for _, index := range p.Indexes {
+		componentInfo.Containers = append(componentInfo.Containers, podInfo.Containers[index])
+	}
+	return &componentInfo
+}
+
+// 对外暴露的端口，internal 端口只能在实例内部访问
+func (p podComponent) exposedPorts(podInfo *PodInfo) []corev1.ServicePort {
+	ports := make([]corev1.ServicePort, 0)
+	for _, index := range p.Indexes {
+		for _, port := range podInfo.Containers[index].ExposePorts {
+			if port.Internal {
+				continue
+			}
+			ports = append(ports, servicePort(index, port))
+		}
+	}
+	return ports
+}
+
+func (p podComponent) allPorts(podInfo *PodInfo) []corev1.ServicePort {
+	ports := make([]corev1.ServicePort, 0)
+	for _, index := range p.Indexes {
+		for _, port := range podInfo.Containers[index].ExposePorts {
+			ports = append(ports, servicePort(index, port))
+		}
+	}
+	return ports
+}
+
+func servicePort(index int, port PortName) corev1.ServicePort {
+	return corev1.ServicePort{
+		Name:       fmt.Sprintf("%d-%s", index, port.Name),
+		Port:       port.Port,
+		TargetPort: intstr.FromInt(int(port.Port)),
+		Protocol:   port.k8sProtocol(),
+	}
+}
+
+func hasUDPPort(ports []corev1.ServicePort) bool {
+	for _, port := range ports {
+		if port.Protocol == corev1.ProtocolUDP {
+			return true
+		}
+	}
+	return false
+}
+
+// 端口名 <容器下标>-<端口名> 对应的外部 Service
+func exposedServiceName(podInfo *PodInfo, portKey string) string {
+	indexStr, _, _ := strings.Cut(portKey, "-")
+	index, err := strconv.Atoi(indexStr)
+	if err != nil || index < 0 || index >= len(podInfo.Containers) {
+		return podInfo.Name
+	}
+	return componentPodName(podInfo.Name, podInfo.Containers[index].ComponentName())
+}
+
+// 组件名、容器名不能重复，HTTP 端口需要对外暴露并且使用 TCP
+func validateTopology(containers []A1Container) error {
+	names := make(map[string]bool)
+	for _, container := range containers {
+		if names[container.Name] {
+			return fmt.Errorf("duplicate container name %s", container.Name)
+		}
+		names[container.Name] = true
+
+		for _, port := range container.ExposePorts {
+			if port.Internal && port.HTTP {
+				return fmt.Errorf("port %s of container %s can not be both internal and http", port.Name, container.Name)
+			}
+			if port.HTTP && port.PortProtocol() != ProtocolTCP {
+				return fmt.Errorf("http port %s of container %s must use TCP", port.Name, container.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// 先为每个组件创建 ClusterIP Service，再把组件名解析到 Service 地址写进 Pod 的 hosts，
+// 这样题目里可以直接用 db:3306 这样的地址访问其他组件
+func createK8sComponentServices(clientset kubernetes.Interface, podInfo *PodInfo, components []podComponent, namespace string) ([]corev1.HostAlias, error) {
+	hostAliases := make([]corev1.HostAlias, 0, len(components))
+
+	for _, component := range components {
+		ports := component.allPorts(podInfo)
+		if len(ports) == 0 {
+			continue
+		}
+
+		service := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   component.PodName + internalServiceSuffix,
+				Labels: componentLabels(podInfo, component.Name),
+			},
+			Spec: corev1.ServiceSpec{
+				Type:     corev1.ServiceTypeClusterIP,
+				Selector: componentLabels(podInfo, component.Name),
+				Ports:    ports,
+			},
+		}
+
+		created, err := clientset.CoreV1().Services(namespace).Create(context.Background(), service, metav1.CreateOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("error creating internal service for %s: %v", component.Name, err)
+		}
+
+		hostAliases = append(hostAliases, corev1.HostAlias{
+			IP:        created.Spec.ClusterIP,
+			Hostnames: []string{component.Name},
+		})
+	}
+
+	return hostAliases, nil
+}
+
+// 一个实例只有一个 NetworkPolicy，选中实例的所有 Pod
+//
+//   - 单组件实例和以前一样，只有不允许出网的时候才创建
+//   - 多组件实例总是创建，组件之间可以互相访问，其他队伍的实例不能访问
+func k8sNetworkPolicy(podInfo *PodInfo, components []podComponent) *networkingv1.NetworkPolicy {
+	multiComponent := len(components) > 1
+	if podInfo.AllowWAN && !multiComponent {
+		return nil
+	}
+
+	allowedPorts := []networkingv1.NetworkPolicyPort{}
+	for _, c := range podInfo.Containers {
+		for _, port := range c.ExposePorts {
+			if port.Internal {
+				continue
+			}
+			protocol := port.k8sProtocol()
+			allowedPorts = append(allowedPorts, networkingv1.NetworkPolicyPort{
+				Protocol: &protocol,
+				Port:     &intstr.IntOrString{IntVal: port.Port},
+			})
+		}
+	}
+
+	// forbid all traffic to 10.0.0.0/8
+	publicPeer := networkingv1.NetworkPolicyPeer{
+		IPBlock: &networkingv1.IPBlock{
+			CIDR: "0.0.0.0/0",
+			Except: []string{
+				"10.0.0.0/8",
+			},
+		},
+	}
+
+	networkPolicy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   podInfo.Name,
+			Labels: instanceLabels(podInfo),
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: podInfo.Labels,
+			},
+			PolicyTypes: []networkingv1.PolicyType{
+				networkingv1.PolicyTypeIngress,
+				networkingv1.PolicyTypeEgress,
+			},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{},
+			Egress:  []networkingv1.NetworkPolicyEgressRule{},
+		},
+	}
+
+	if len(allowedPorts) > 0 {
+		networkPolicy.Spec.Ingress = append(networkPolicy.Spec.Ingress, networkingv1.NetworkPolicyIngressRule{
+			From:  append([]networkingv1.NetworkPolicyPeer{publicPeer}, gatewayPeers()...),
+			Ports: allowedPorts,
+		})
+	}
+
+	if multiComponent {
+		groupPeer := networkingv1.NetworkPolicyPeer{
+			PodSelector: &metav1.LabelSelector{
+				MatchLabels: podInfo.Labels,
+			},
+		}
+		networkPolicy.Spec.Ingress = append(networkPolicy.Spec.Ingress, networkingv1.NetworkPolicyIngressRule{
+			From: []networkingv1.NetworkPolicyPeer{groupPeer},
+		})
+		networkPolicy.Spec.Egress = append(networkPolicy.Spec.Egress, networkingv1.NetworkPolicyEgressRule{
+			To: []networkingv1.NetworkPolicyPeer{groupPeer},
+		})
+		if podInfo.AllowWAN {
+			networkPolicy.Spec.Egress = append(networkPolicy.Spec.Egress, networkingv1.NetworkPolicyEgressRule{
+				To: []networkingv1.NetworkPolicyPeer{publicPeer},
+			})
+		}
+	}
+
+	if podInfo.AllowDNS {
+		protocolUDP := corev1.ProtocolUDP
+		protocolTCP := corev1.ProtocolTCP
+		networkPolicy.Spec.Egress = append(networkPolicy.Spec.Egress, networkingv1.NetworkPolicyEgressRule{
+			To: []networkingv1.NetworkPolicyPeer{
+				{
+					NamespaceSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{
+							"kubernetes.io/metadata.name": "kube-system",
+						},
+					},
+					PodSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{
+							"k8s-app": "kube-dns",
+						},
+					},
+				},
+			},
+			Ports: []networkingv1.NetworkPolicyPort{
+				{
+					Protocol: &protocolUDP,
+					Port:     &intstr.IntOrString{IntVal: 53},
+				},
+				{
+					Protocol: &protocolTCP,
+					Port:     &intstr.IntOrString{IntVal: 53},
+				},
+			},
+		})
+	}
+
+	return networkPolicy
+}
+
+// 合并实例里所有 Pod 的状态，有一个失败就算失败，全部运行才算运行
+func mergePodStatus(statuses []PodStatusDecision) PodStatusDecision {
+	var waiting *PodStatusDecision
+	for i := range statuses {
+		switch statuses[i].Status {
+		case CustomPodFailed:
+			return statuses[i]
+		case CustomPodWaiting:
+			if waiting == nil {
+				waiting = &statuses[i]
+			}
+		}
+	}
+
+	if waiting != nil {
+		return *waiting
+	}
+
+	if len(statuses) > 0 {
+		return statuses[0]
+	}
+
+	return PodStatusDecision{
+		Status:         CustomPodWaiting,
+		ShouldContinue: true,
+		ShouldReport:   false,
+		Message:        "Pod is pending, waiting for initialization",
+	}
+}
@@ -0,0 +1,94 @@
+package k8stool
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/bytedance/sonic"
+)
+
+// 预热池：比赛开始前提前为题目创建一些没有 flag 的实例，选手启动容器的时候直接领取，
+// 领取之后通过 InjectFlag 写入 flag。预热实例的名字是 cw-<ingame_id>-<pool_id>，
+// 领取之后实例名保存在容器记录里，不会改名
+const (
+	warmPodPrefix = "cw-"
+
+	// 预热实例的编号，保证 NetworkPolicy 和 Service 只选中这一个实例
+	LabelWarmPool = "a1ctf-warm-pool"
+	// 创建预热实例时的容器配置，题目配置修改之后旧的预热实例不能再领取
+	LabelWarmConfig = "a1ctf-warm-config"
+)
+
+// WarmPodName 预热实例的实例名
+func WarmPodName(inGameID int64, poolID string) string {
+	return fmt.Sprintf("%s%d-%s", warmPodPrefix, inGameID, poolID)
+}
+
+func IsWarmPod(name string) bool {
+	return strings.HasPrefix(name, warmPodPrefix)
+}
+
+// WarmPodLockName 领取和删除预热实例时使用的 redis 锁，两边拿到锁之后才能修改这个实例
+func WarmPodLockName(name string) string {
+	return "warm_pod_lock_" + name
+}
+
+// WarmPoolID 从实例名里取出预热实例的编号，HTTP 端口的域名使用这个编号代替队伍 hash
+func WarmPoolID(name string) (string, bool) {
+	if !IsWarmPod(name) {
+		return "", false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(name, warmPodPrefix), "-", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// WarmConfigHash 容器配置和网络设置一样的预热实例才能被领取
+func WarmConfigHash(containers []A1Container, allowWAN bool, allowDNS bool) string {
+	data, _ := sonic.Marshal(containers)
+	sum := sha256.Sum256(append(data, fmt.Sprintf("|%t|%t", allowWAN, allowDNS)...))
+	return hex.EncodeToString(sum[:8])
+}
+
+// ValidWarmPoolConfig 预热实例创建的时候还没有 flag，只能使用启动之后写入 flag 的注入方式
+func ValidWarmPoolConfig(containers []A1Container) error {
+	for i := range containers {
+		c := &containers[i]
+		if _, ok := c.FlagEnv(); ok {
+			return fmt.Errorf("container %s injects the flag through env, disable it to use the warm pool", c.Name)
+		}
+		if c.FlagInjection.TemplateCommand {
+			return fmt.Errorf("container %s templates the flag into the command, which can not be used with the warm pool", c.Name)
+		}
+		if _, ok := c.flagFile(); ok && c.Security != nil && c.Security.ReadOnlyRootFilesystem {
+			return fmt.Errorf("container %s writes the flag file into a read-only root filesystem, which can not be used with the warm pool", c.Name)
+		}
+	}
+	return nil
+}
+
+// NewWarmPodInfo 生成一个新的预热实例
+func NewWarmPodInfo(inGameID int64, containers []A1Container, allowWAN bool, allowDNS bool) PodInfo {
+	buf := make([]byte, 8)
+	_, _ = rand.Read(buf)
+	poolID := hex.EncodeToString(buf)
+
+	return PodInfo{
+		Name:       WarmPodName(inGameID, poolID),
+		Containers: containers,
+		Labels: map[string]string{
+			"ingame_id":     fmt.Sprintf("%d", inGameID),
+			LabelWarmPool:   poolID,
+			LabelWarmConfig: WarmConfigHash(containers, allowWAN, allowDNS),
+		},
+		AllowWAN:       allowWAN,
+		AllowDNS:       allowDNS,
+		HTTPHostPrefix: HTTPHostPrefix(poolID, inGameID),
+		Warm:           true,
+	}
+}
@@ -9,9 +9,20 @@ import (
 	"github.com/bytedance/sonic"
 	"github.com/lib/pq"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
 func InsertNotice(gameID int64, category models.NoticeCategory, values []string) {
+	notice, err := InsertNoticeWithTx(dbtool.DB(), gameID, category, values)
+	if err != nil {
+		zaphelper.Logger.Error("Failed to insert notice", zap.Error(err))
+	} else {
+		AnnounceNotice(*notice)
+	}
+}
+
+// InsertNoticeWithTx 在给定的事务中插入公告，事务提交以后需要调用方自己 AnnounceNotice
+func InsertNoticeWithTx(tx *gorm.DB, gameID int64, category models.NoticeCategory, values []string) (*models.Notice, error) {
 	notice := models.Notice{
 		GameID:         gameID,
 		CreateTime:     time.Now().UTC(),
@@ -20,11 +31,11 @@ func InsertNotice(gameID int64, category models.NoticeCategory, values []string)
 		Data:           pq.StringArray(values),
 	}
 
-	if err := dbtool.DB().Create(&notice).Error; err != nil {
-		zaphelper.Logger.Error("Failed to insert notice", zap.Error(err))
-	} else {
-		AnnounceNotice(notice)
+	if err := tx.Create(&notice).Error; err != nil {
+		return nil, err
 	}
+
+	return &notice, nil
 }
 
 func AnnounceNotice(notice models.Notice) {
@@ -43,3 +54,45 @@ func AnnounceNotice(notice models.Notice) {
 		}
 	}
 }
+
+// SendToUsers 给指定比赛中的指定用户推送消息，用于队伍申请之类只和个别用户相关的通知
+func SendToUsers(gameID int64, userIDs []string, msgType string, message interface{}) {
+	targets := make(map[string]struct{}, len(userIDs))
+	for _, userID := range userIDs {
+		targets[userID] = struct{}{}
+	}
+
+	msg, _ := sonic.Marshal(map[string]interface{}{
+		"type":    msgType,
+		"message": message,
+	})
+
+	for session, gid := range dbtool.GameSessions() {
+		if gid != gameID {
+			continue
+		}
+
+		userID, exists := session.Get("userID")
+		if !exists {
+			continue
+		}
+
+		if _, ok := targets[userID.(string)]; ok {
+			session.Write([]byte(msg))
+		}
+	}
+}
+
+// Broadcast 给指定比赛中的所有连接推送消息
+func Broadcast(gameID int64, msgType string, message interface{}) {
+	msg, _ := sonic.Marshal(map[string]interface{}{
+		"type":    msgType,
+		"message": message,
+	})
+
+	for session, gid := range dbtool.GameSessions() {
+		if gid == gameID {
+			session.Write([]byte(msg))
+		}
+	}
+}
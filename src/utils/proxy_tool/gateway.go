@@ -0,0 +1,306 @@
+package proxytool
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"a1ctf/src/db/models"
+	dbtool "a1ctf/src/utils/db_tool"
+	k8stool "a1ctf/src/utils/k8s_tool"
+	"a1ctf/src/utils/ristretto_tool"
+	"a1ctf/src/utils/zaphelper"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+const (
+	targetCacheTime  = 5 * time.Second
+	dialTimeout      = 5 * time.Second
+	tokenReadTimeout = 10 * time.Second
+	maxTokenLength   = 1024
+)
+
+var ErrTargetNotRunning = errors.New("proxy target is not running")
+
+// ResolvedTarget Token 对应的实例和平台内部可以访问到的地址
+type ResolvedTarget struct {
+	GameID      int64
+	IngameID    int64
+	ChallengeID int64
+	TeamID      int64
+	Address     string
+}
+
+// Session 一条被转发的连接
+type Session struct {
+	Target    *ProxyTarget
+	UserID    *string
+	ClientIP  string
+	Transport string
+}
+
+func findPodPort(podInfo k8stool.PodInfo, containerName string, portName string) (string, error) {
+	portKey := ""
+	for index, container := range podInfo.Containers {
+		if container.Name == containerName {
+			portKey = fmt.Sprintf("%d-%s", index, portName)
+			break
+		}
+	}
+	if portKey == "" {
+		return "", fmt.Errorf("container %s not found", containerName)
+	}
+
+	return findPodPortByKey(podInfo, portKey)
+}
+
+// portKey 和 Service 端口名一样是 <容器下标>-<端口名>
+func findPodPortByKey(podInfo k8stool.PodInfo, portKey string) (string, error) {
+	ports, err := k8stool.GetPodPorts(&podInfo)
+	if err != nil {
+		return "", err
+	}
+
+	for _, port := range *ports {
+		if port.Name == portKey {
+			return port.ClusterAddress, nil
+		}
+	}
+
+	return "", fmt.Errorf("port %s not found", portKey)
+}
+
+func resolve(target *ProxyTarget) (*ResolvedTarget, error) {
+	switch target.Kind {
+	case TargetContainer:
+		var container models.Container
+		if err := dbtool.DB().Where("container_id = ?", target.ContainerID).First(&container).Error; err != nil {
+			return nil, err
+		}
+		if container.ContainerStatus != models.ContainerRunning {
+			return nil, ErrTargetNotRunning
+		}
+
+		address, err := findPodPort(k8stool.PodInfo{
+			Name:       container.InstanceName(),
+			Containers: container.ContainerConfig,
+		}, target.ContainerName, target.PortName)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ResolvedTarget{
+			GameID:      container.GameID,
+			IngameID:    container.InGameID,
+			ChallengeID: container.ChallengeID,
+			TeamID:      container.TeamID,
+			Address:     address,
+		}, nil
+
+	case TargetStaticContainer:
+		var staticContainer models.StaticContainer
+		if err := dbtool.DB().Where("container_id = ?", target.ContainerID).First(&staticContainer).Error; err != nil {
+			return nil, err
+		}
+		if staticContainer.ContainerStatus != models.ContainerRunning || !staticContainer.Enabled {
+			return nil, ErrTargetNotRunning
+		}
+
+		address, err := findPodPort(k8stool.PodInfo{
+			Name:       fmt.Sprintf("cs-%d", staticContainer.InGameID),
+			Containers: staticContainer.ContainerConfig,
+		}, target.ContainerName, target.PortName)
+		if err != nil {
+			return nil, err
+		}
+
+		// 静态容器没有所属队伍，流量记在 Token 签发的队伍上
+		return &ResolvedTarget{
+			GameID:      staticContainer.GameID,
+			IngameID:    staticContainer.InGameID,
+			ChallengeID: staticContainer.ChallengeID,
+			TeamID:      target.TeamID,
+			Address:     address,
+		}, nil
+	}
+
+	return nil, ErrInvalidToken
+}
+
+// Resolve 查询 Token 对应的转发地址，结果短时间缓存，避免每条连接都请求后端
+func Resolve(target *ProxyTarget) (*ResolvedTarget, error) {
+	obj, err := ristretto_tool.GetOrCacheSingleFlight(fmt.Sprintf("proxy_target_%s_%d_%s_%s", target.Kind, target.TeamID, target.ContainerID, target.ContainerName+"/"+target.PortName), func() (interface{}, error) {
+		return resolve(target)
+	}, targetCacheTime, false)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := obj.(*ResolvedTarget)
+	if resolved.TeamID != target.TeamID {
+		return nil, ErrInvalidToken
+	}
+	return resolved, nil
+}
+
+type countingWriter struct {
+	writer io.Writer
+	count  *atomic.Int64
+}
+
+func (w countingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.count.Add(int64(n))
+	return n, err
+}
+
+// Forward 把客户端连接转发到实例，连接结束后记录流量
+func Forward(client io.ReadWriteCloser, session Session, resolved *ResolvedTarget) {
+	startTime := time.Now().UTC()
+
+	var bytesUp, bytesDown atomic.Int64
+	var forwardErr error
+
+	upstream, err := net.DialTimeout("tcp", resolved.Address, dialTimeout)
+	if err != nil {
+		forwardErr = err
+	} else {
+		var once sync.Once
+		closeBoth := func() {
+			once.Do(func() {
+				client.Close()
+				upstream.Close()
+			})
+		}
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, _ = io.Copy(countingWriter{writer: upstream, count: &bytesUp}, client)
+			closeBoth()
+		}()
+		go func() {
+			defer wg.Done()
+			_, _ = io.Copy(countingWriter{writer: client, count: &bytesDown}, upstream)
+			closeBoth()
+		}()
+		wg.Wait()
+	}
+
+	client.Close()
+
+	trafficLog := models.ProxyTrafficLog{
+		GameID:          resolved.GameID,
+		IngameID:        resolved.IngameID,
+		ChallengeID:     resolved.ChallengeID,
+		TeamID:          resolved.TeamID,
+		UserID:          session.UserID,
+		ContainerID:     session.Target.ContainerID,
+		StaticContainer: session.Target.Kind == TargetStaticContainer,
+		ContainerName:   session.Target.ContainerName,
+		PortName:        session.Target.PortName,
+		Transport:       session.Transport,
+		TargetAddress:   resolved.Address,
+		BytesUp:         bytesUp.Load(),
+		BytesDown:       bytesDown.Load(),
+		StartTime:       startTime,
+		EndTime:         time.Now().UTC(),
+	}
+	if session.ClientIP != "" {
+		trafficLog.ClientIP = &session.ClientIP
+	}
+	if forwardErr != nil {
+		errMsg := forwardErr.Error()
+		trafficLog.ErrorMessage = &errMsg
+	}
+
+	if err := dbtool.DB().Create(&trafficLog).Error; err != nil {
+		zaphelper.Logger.Error("Failed to save proxy traffic log", zap.Error(err), zap.Any("traffic_log", trafficLog))
+	}
+}
+
+type bufferedConn struct {
+	io.Reader
+	net.Conn
+}
+
+func (c bufferedConn) Read(p []byte) (int, error) {
+	return c.Reader.Read(p)
+}
+
+// 客户端连接后先发送一行 Token，之后的数据原样转发
+func handleGatewayConn(conn net.Conn) {
+	_ = conn.SetReadDeadline(time.Now().Add(tokenReadTimeout))
+
+	reader := bufio.NewReaderSize(conn, maxTokenLength)
+	line, err := reader.ReadSlice('\n')
+	if err != nil {
+		_, _ = conn.Write([]byte("token required\n"))
+		conn.Close()
+		return
+	}
+
+	target, err := Parse(strings.TrimSpace(string(line)))
+	if err != nil {
+		_, _ = conn.Write([]byte("invalid token\n"))
+		conn.Close()
+		return
+	}
+
+	resolved, err := Resolve(target)
+	if err != nil {
+		_, _ = conn.Write([]byte("instance is not running\n"))
+		conn.Close()
+		return
+	}
+
+	_ = conn.SetReadDeadline(time.Time{})
+
+	clientIP, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+
+	Forward(bufferedConn{Reader: reader, Conn: conn}, Session{
+		Target:    target,
+		ClientIP:  clientIP,
+		Transport: models.ProxyTransportTCP,
+	}, resolved)
+}
+
+// StartTCPGateway 启动 TCP 网关，所有实例共用一个端口，通过 Token 区分
+func StartTCPGateway() error {
+	listen := viper.GetString("container-proxy.tcp-listen")
+	if !Enabled() || listen == "" {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen proxy gateway: %w", err)
+	}
+
+	zaphelper.Logger.Info("Container proxy gateway started", zap.String("listen", listen))
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				zaphelper.Logger.Error("Proxy gateway accept error", zap.Error(err))
+				continue
+			}
+			go handleGatewayConn(conn)
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package proxytool
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"strings"
+	"time"
+
+	"a1ctf/src/db/models"
+	dbtool "a1ctf/src/utils/db_tool"
+	k8stool "a1ctf/src/utils/k8s_tool"
+	"a1ctf/src/utils/ristretto_tool"
+	"a1ctf/src/utils/zaphelper"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+var ErrUnknownHost = errors.New("unknown instance host")
+
+// 域名格式见 k8stool.PodHTTPHosts，前两段是 <team_hash|pool_id|static>-<ingame_id>
+func resolveHTTPHost(host string) (string, error) {
+	suffix := "." + k8stool.IngressDomain()
+	label, found := strings.CutSuffix(host, suffix)
+	if !found {
+		return "", ErrUnknownHost
+	}
+
+	parts := strings.SplitN(label, "-", 3)
+	if len(parts) < 2 {
+		return "", ErrUnknownHost
+	}
+
+	inGameID, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", ErrUnknownHost
+	}
+
+	var podInfo k8stool.PodInfo
+	if parts[0] == k8stool.StaticHostPrefix {
+		var staticContainer models.StaticContainer
+		if err := dbtool.DB().Where("ingame_id = ?", inGameID).First(&staticContainer).Error; err != nil {
+			return "", ErrUnknownHost
+		}
+		if staticContainer.ContainerStatus != models.ContainerRunning || !staticContainer.Enabled {
+			return "", ErrTargetNotRunning
+		}
+
+		podInfo = k8stool.PodInfo{
+			Name:           fmt.Sprintf("cs-%d", staticContainer.InGameID),
+			Containers:     staticContainer.ContainerConfig,
+			HTTPHostPrefix: k8stool.HTTPHostPrefix("", staticContainer.InGameID),
+		}
+	} else {
+		// 领取了预热实例的容器，域名里是预热实例的编号
+		var container models.Container
+		if err := dbtool.DB().Where("(team_hash = ? OR pod_name = ?) AND ingame_id = ? AND container_status = ?", parts[0], k8stool.WarmPodName(inGameID, parts[0]), inGameID, models.ContainerRunning).First(&container).Error; err != nil {
+			return "", ErrTargetNotRunning
+		}
+
+		podInfo = k8stool.PodInfo{
+			Name:           container.InstanceName(),
+			Containers:     container.ContainerConfig,
+			HTTPHostPrefix: container.HTTPHostPrefix(),
+		}
+	}
+
+	for portKey, httpHost := range k8stool.PodHTTPHosts(&podInfo) {
+		if httpHost == host {
+			return findPodPortByKey(podInfo, portKey)
+		}
+	}
+
+	return "", ErrUnknownHost
+}
+
+func cachedHTTPHost(host string) (string, error) {
+	obj, err := ristretto_tool.GetOrCacheSingleFlight(fmt.Sprintf("proxy_http_host_%s", host), func() (interface{}, error) {
+		return resolveHTTPHost(host)
+	}, targetCacheTime, false)
+	if err != nil {
+		return "", err
+	}
+	return obj.(string), nil
+}
+
+func serveHTTPInstance(w http.ResponseWriter, r *http.Request) {
+	host := strings.ToLower(r.Host)
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+
+	address, err := cachedHTTPHost(host)
+	if err != nil {
+		if errors.Is(err, ErrUnknownHost) {
+			http.Error(w, "instance not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "instance is not running", http.StatusBadGateway)
+		}
+		return
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	// 保留原始 Host，题目里的 Cookie 和跳转都以选手访问的域名为准
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = "http"
+			req.URL.Host = address
+			if req.Header.Get("X-Forwarded-Proto") == "" {
+				req.Header.Set("X-Forwarded-Proto", scheme)
+			}
+			req.Header.Set("X-Forwarded-Host", r.Host)
+		},
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			zaphelper.Logger.Debug("Instance http proxy error", zap.Error(err), zap.String("host", host))
+			http.Error(w, "instance is not reachable", http.StatusBadGateway)
+		},
+	}
+
+	proxy.ServeHTTP(w, r)
+}
+
+// StartHTTPRouter platform 模式下按 Host 把请求转发到题目实例，前面一般放一个泛域名的反向代理负责 TLS
+func StartHTTPRouter() error {
+	listen := viper.GetString("container-ingress.listen")
+	if !k8stool.IngressEnabled() || k8stool.IngressMode() != k8stool.IngressModePlatform || listen == "" {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen http router: %w", err)
+	}
+
+	server := &http.Server{
+		Handler:           http.HandlerFunc(serveHTTPInstance),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	zaphelper.Logger.Info("Container http router started", zap.String("listen", listen), zap.String("domain", k8stool.IngressDomain()))
+
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			zaphelper.Logger.Error("Container http router stopped", zap.Error(err))
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,197 @@
+package proxytool
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"a1ctf/src/db/models"
+	k8stool "a1ctf/src/utils/k8s_tool"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	TargetContainer       = "c"
+	TargetStaticContainer = "s"
+
+	tokenMacSize = 16
+)
+
+var (
+	ErrInvalidToken  = errors.New("invalid proxy token")
+	ErrSecretMissing = errors.New("container-proxy.secret is required when container-proxy is enabled")
+
+	secretOnce sync.Once
+	secretKey  []byte
+)
+
+// ProxyTarget Token 里携带的转发目标，静态容器按队伍签发不同的 Token，方便区分流量来源
+type ProxyTarget struct {
+	Kind          string
+	ContainerID   string
+	TeamID        int64
+	ContainerName string
+	PortName      string
+}
+
+func Enabled() bool {
+	return viper.GetBool("container-proxy.enabled")
+}
+
+// Token 会保存在容器记录里，secret 必须固定，开启代理的时候没有配置 secret 会拒绝启动
+func secret() []byte {
+	secretOnce.Do(func() {
+		secretKey = []byte(viper.GetString("container-proxy.secret"))
+	})
+	return secretKey
+}
+
+// CheckSecret 开启代理的时候必须配置 container-proxy.secret，随机生成的 secret 在重启或者多实例部署时
+// 会让已经写进容器记录里的 Token 全部失效
+func CheckSecret() error {
+	if Enabled() && viper.GetString("container-proxy.secret") == "" {
+		return ErrSecretMissing
+	}
+	return nil
+}
+
+func sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, secret())
+	mac.Write(payload)
+	return mac.Sum(nil)[:tokenMacSize]
+}
+
+// Sign 生成 Token，格式为 base64(payload).base64(hmac)
+func Sign(target ProxyTarget) string {
+	payload := []byte(strings.Join([]string{
+		target.Kind,
+		target.ContainerID,
+		strconv.FormatInt(target.TeamID, 10),
+		target.ContainerName,
+		target.PortName,
+	}, "|"))
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(sign(payload))
+}
+
+func Parse(token string) (*ProxyTarget, error) {
+	payloadPart, macPart, found := strings.Cut(strings.TrimSpace(token), ".")
+	if !found {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(payloadPart)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(macPart)
+	if err != nil || !hmac.Equal(mac, sign(payload)) {
+		return nil, ErrInvalidToken
+	}
+
+	fields := strings.Split(string(payload), "|")
+	if len(fields) != 5 {
+		return nil, ErrInvalidToken
+	}
+
+	teamID, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	return &ProxyTarget{
+		Kind:          fields[0],
+		ContainerID:   fields[1],
+		TeamID:        teamID,
+		ContainerName: fields[3],
+		PortName:      fields[4],
+	}, nil
+}
+
+// 对外展示的网关地址，没有配置 public-host 的时候使用 baseURL 的域名
+func publicEndpoint() (string, int32) {
+	host := viper.GetString("container-proxy.public-host")
+	if host == "" {
+		if baseURL, err := url.Parse(viper.GetString("system.baseURL")); err == nil {
+			host = baseURL.Hostname()
+		}
+	}
+
+	port := viper.GetInt32("container-proxy.public-port")
+	if port == 0 {
+		if _, listenPort, err := splitListen(viper.GetString("container-proxy.tcp-listen")); err == nil {
+			port = listenPort
+		}
+	}
+
+	return host, port
+}
+
+func splitListen(listen string) (string, int32, error) {
+	host, portStr, err := net.SplitHostPort(listen)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid listen address %s: %w", listen, err)
+	}
+	port, err := strconv.ParseInt(portStr, 10, 32)
+	if err != nil {
+		return "", 0, err
+	}
+	return host, int32(port), nil
+}
+
+func webSocketURL(token string) string {
+	baseURL := viper.GetString("system.baseURL")
+	baseURL = strings.Replace(baseURL, "https://", "wss://", 1)
+	baseURL = strings.Replace(baseURL, "http://", "ws://", 1)
+	return strings.TrimRight(baseURL, "/") + "/api/proxy/" + token
+}
+
+// ApplyEndpoints 把暴露端口替换成平台代理的地址，返回新的切片，不修改传入的数据
+func ApplyEndpoints(exposeInfos models.ContainerExposeInfos, kind string, containerID string, teamID int64) models.ContainerExposeInfos {
+	host, port := publicEndpoint()
+
+	result := make(models.ContainerExposeInfos, 0, len(exposeInfos))
+	for _, exposeInfo := range exposeInfos {
+		ports := make(models.ExposePorts, 0, len(exposeInfo.ExposePorts))
+		for _, exposePort := range exposeInfo.ExposePorts {
+			// 通过域名访问的 HTTP 端口不走 TCP 网关，UDP 端口也只能直接访问
+			if exposePort.URL != "" || exposePort.Protocol == k8stool.ProtocolUDP {
+				ports = append(ports, exposePort)
+				continue
+			}
+
+			token := Sign(ProxyTarget{
+				Kind:          kind,
+				ContainerID:   containerID,
+				TeamID:        teamID,
+				ContainerName: exposeInfo.ContainerName,
+				PortName:      exposePort.PortName,
+			})
+
+			ports = append(ports, models.ExposePort{
+				PortName: exposePort.PortName,
+				Port:     port,
+				IP:       host,
+				Token:    token,
+				ProxyURL: webSocketURL(token),
+				Protocol: exposePort.Protocol,
+			})
+		}
+
+		result = append(result, models.ContainerExposeInfo{
+			ContainerName: exposeInfo.ContainerName,
+			ExposePorts:   ports,
+		})
+	}
+
+	return result
+}
@@ -4,6 +4,8 @@ import (
 	"a1ctf/src/utils/zaphelper"
 	"time"
 
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
@@ -16,6 +18,29 @@ func LockForATime(operationName string, lockTime time.Duration) bool {
 	return set
 }
 
+// 只有锁的值还是自己的 token 时才删除，避免锁过期后删掉别人重新拿到的锁
+var unlockWithTokenScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// LockWithToken 和 LockForATime 一样加锁，额外返回一个 token，释放锁的时候用 UnlockWithToken
+func LockWithToken(operationName string, lockTime time.Duration) (string, bool) {
+	token := uuid.NewString()
+	set, err := RedisClient.SetNX(operationName, token, lockTime).Result()
+	if err != nil {
+		zaphelper.Logger.Error("LockWithToken failed", zap.Error(err), zap.String("operationName", operationName))
+		return "", false
+	}
+	return token, set
+}
+
+func UnlockWithToken(operationName string, token string) error {
+	return unlockWithTokenScript.Run(RedisClient, []string{operationName}, token).Err()
+}
+
 func SetValueForATime(key string, value string, lockTime time.Duration) bool {
 	_, err := RedisClient.Set(key, value, lockTime).Result()
 	if err != nil {
@@ -7,7 +7,6 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"math"
 	"math/rand"
 	"sort"
 	"time"
@@ -95,6 +94,11 @@ var containerStatusCacheTime = time.Duration(0)
 var teamFlagCacheTime = time.Duration(0)
 var teamSolveStatusCacheTime = time.Duration(0)
 var judgeResultCacheTime = time.Duration(0)
+var scoreboardReplayCacheTime = time.Duration(0)
+
+// 排行榜引擎增量读取记录时往前多读的时间，和没有管理员操作时也定期全量重建的间隔
+var scoreBoardEventLookback = time.Minute
+var scoreBoardFullRebuildInterval = time.Duration(0)
 
 func LoadCacheTime() {
 	userListCacheTime = viper.GetDuration("cache-time.user-list")
@@ -109,6 +113,12 @@ func LoadCacheTime() {
 	teamFlagCacheTime = viper.GetDuration("cache-time.team-flag")
 	teamSolveStatusCacheTime = viper.GetDuration("cache-time.team-solve-status")
 	judgeResultCacheTime = viper.GetDuration("cache-time.judge-result")
+	scoreboardReplayCacheTime = viper.GetDuration("cache-time.scoreboard-replay")
+
+	if lookback := viper.GetDuration("scoreboard-engine.event-lookback"); lookback > 0 {
+		scoreBoardEventLookback = lookback
+	}
+	scoreBoardFullRebuildInterval = viper.GetDuration("scoreboard-engine.full-rebuild-interval")
 }
 
 func CachedMemberSearchTeamMap(gameID int64) (map[string]models.Team, error) {
@@ -260,494 +270,131 @@ func CachedGameInfo(gameID int64) (*models.Game, error) {
 	return &game, nil
 }
 
-func filterValidSolves(solves []models.Solve) []models.Solve {
-	var filtered []models.Solve
-	for _, solve := range solves {
-		if solve.Team.TeamStatus == models.ParticipateApproved {
-			filtered = append(filtered, solve)
-		}
-	}
-	return filtered
+func CalculateGameScoreBoard(gameID int64) (*webmodels.CachedGameScoreBoardData, error) {
+	return calculateGameScoreBoard(gameID, nil, "")
 }
 
-func CalculateGameScoreBoard(gameID int64) (*webmodels.CachedGameScoreBoardData, error) {
-	var cachedData webmodels.CachedGameScoreBoardData
+// CalculateFrozenGameScoreBoard 计算封榜时的排行榜，只统计封榜之前的解题、分数修正和提示解锁
+func CalculateFrozenGameScoreBoard(gameID int64, freezeTime time.Time) (*webmodels.CachedGameScoreBoardData, error) {
+	return calculateGameScoreBoard(gameID, &freezeTime, "")
+}
 
+// CalculateStageGameScoreBoard 计算单个阶段的排行榜，只统计这个阶段的题目，
+// 阶段有晋级队伍的时候只有晋级的队伍参与排名。freezeTime 不为 nil 的时候计算封榜时的排行榜
+func CalculateStageGameScoreBoard(gameID int64, stageName string, freezeTime *time.Time) (*webmodels.CachedGameScoreBoardData, error) {
+	return calculateGameScoreBoard(gameID, freezeTime, stageName)
+}
+
+// calculateGameScoreBoard 从数据库读取全部数据计算排行榜，stageName 为空的时候计算整场比赛的排行榜。
+// 定时刷新走排行榜引擎，这里只给需要立即拿到准确结果的管理员操作使用
+func calculateGameScoreBoard(gameID int64, freezeTime *time.Time, stageName string) (*webmodels.CachedGameScoreBoardData, error) {
 	// 获取用户信息
 	users, err := CachedMemberMap()
 	if err != nil {
 		return nil, err
 	}
 
-	var game models.Game
-	if err := dbtool.DB().Where("game_id = ?", gameID).First(&game).Error; err != nil {
-		return nil, errors.New("failed to load game")
-	}
-
-	var finalScoreBoardMap map[int64]webmodels.TeamScoreItem = make(map[int64]webmodels.TeamScoreItem)
-	var timeLines []webmodels.TimeLineItem = make([]webmodels.TimeLineItem, 0)
-
-	// 获取所有队伍，排除掉 Admin 队伍
-	var teams []models.Team
-	if err := dbtool.DB().Where("game_id = ? AND team_status = ? AND team_type = ?", gameID, models.ParticipateApproved, models.TeamTypePlayer).Preload("Group").Find(&teams).Error; err != nil {
-		return nil, errors.New("failed to load teams")
-	}
-
-	// 获取所有解题记录, 仅在比赛时间内
-	var solves []models.Solve
-	if err := dbtool.DB().Where(`game_id = ? 
-	AND solve_time >= ? 
-	AND solve_time <= ?`, gameID, game.StartTime, game.EndTime).
-		Preload("GameChallenge").
-		Preload("Solver").
-		Preload("Challenge").
-		Preload("Game").
-		Preload("Team").
-		Order("solve_time ASC").
-		Find(&solves).Error; err != nil {
-		return nil, errors.New("failed to load solves")
-	}
-
-	solves = filterValidSolves(solves)
-
-	// 计算每道题的首杀时间
-	firstSolveTime := make(map[int64]time.Time) // challengeID -> 首杀时间
-	for _, solve := range solves {
-		if _, exists := firstSolveTime[solve.ChallengeID]; !exists {
-			firstSolveTime[solve.ChallengeID] = solve.SolveTime
-		}
-	}
-
-	// 计算每个队伍的总分和罚时
-	teamDataMap := make(map[int64]webmodels.TeamScoreItem)
-
-	// 初始化队伍数据
-	for _, team := range teams {
-
-		// 获取成员信息
-		teamMemberDetail := make([]webmodels.TeamMemberInfo, 0)
-
-		for idx, teamMember := range team.TeamMembers {
-			if member, exists := users[teamMember]; exists {
-				// 第一个是队长
-				teamMemberDetail = append(teamMemberDetail, webmodels.TeamMemberInfo{
-					Avatar:   member.Avatar,
-					UserName: member.Username,
-					UserID:   member.UserID,
-					Captain:  idx == 0,
-				})
-			}
-		}
-
-		teamDataMap[team.TeamID] = webmodels.TeamScoreItem{
-			TeamID:           team.TeamID,
-			TeamName:         team.TeamName,
-			TeamAvatar:       team.TeamAvatar,
-			Members:          teamMemberDetail,
-			TeamSlogan:       team.TeamSlogan,
-			TeamDescription:  team.TeamDescription,
-			GroupID:          team.GroupID,
-			GroupName:        team.GroupName,
-			Score:            0,
-			Penalty:          0,
-			SolvedChallenges: make([]webmodels.TeamSolveItem, 0),
-			ScoreAdjustments: make([]webmodels.TeamScoreAdjustmentItem, 0),
-			LastSolveTime:    0,
-		}
-	}
-
-	// 计算每个队伍的分数和罚时
-	for _, solve := range solves {
-		if !solve.GameChallenge.Visible {
-			continue
-		}
-
-		if teamData, exists := teamDataMap[solve.TeamID]; exists {
-			// 计算罚时（解题时间 - 首杀时间，单位：秒）
-			penalty := int64(0)
-			if firstTime, ok := firstSolveTime[solve.ChallengeID]; ok {
-				penalty = int64(solve.SolveTime.Sub(firstTime).Seconds())
-			}
-
-			challengeScore := solve.GameChallenge.CurScore
-			rewardScore := 0.0
-
-			// 这里计算分数了，处理一下三血
-			if solve.GameChallenge.BloodRewardEnabled && solve.Rank <= 3 {
-
-				var rewardReason string
-				// 三血对于的奖励分数比例是否开启
-				var rankRewardEnabled bool = false
-
-				switch solve.Rank {
-				case 3:
-					rewardScore = float64(solve.Game.ThirdBloodReward) * solve.GameChallenge.CurScore / 100
-					rewardReason = "Third Blood Reward"
-					if solve.Game.ThirdBloodReward != 0 {
-						rankRewardEnabled = true
-					}
-				case 2:
-					rewardScore = float64(solve.Game.SecondBloodReward) * solve.GameChallenge.CurScore / 100
-					rewardReason = "Second Blood Reward"
-					if solve.Game.SecondBloodReward != 0 {
-						rankRewardEnabled = true
-					}
-				case 1:
-					rewardScore = float64(solve.Game.FirstBloodReward) * solve.GameChallenge.CurScore / 100
-					rewardReason = "First Blood Reward"
-					if solve.Game.FirstBloodReward != 0 {
-						rankRewardEnabled = true
-					}
-				}
-
-				if rankRewardEnabled {
-					rewardScore = math.Max(math.Floor(rewardScore), 1)
-
-					rewardReason = fmt.Sprintf("%s for %s", rewardReason, solve.Challenge.Name)
-
-					adjustment := webmodels.TeamScoreAdjustmentItem{
-						AdjustmentID:   -1,
-						AdjustmentType: string(models.AdjustmentTypeReward),
-						ScoreChange:    rewardScore,
-						Reason:         rewardReason,
-						CreatedAt:      solve.SolveTime,
-					}
-
-					challengeScore += rewardScore
-
-					// 往前端添加三血的加分记录
-					teamData.ScoreAdjustments = append(teamData.ScoreAdjustments, adjustment)
-				}
-			}
-
-			teamData.Score += challengeScore
-			teamData.Penalty += penalty
-
-			// 插入解题记录
-			teamData.SolvedChallenges = append(teamData.SolvedChallenges, webmodels.TeamSolveItem{
-				ChallengeID:   solve.ChallengeID,
-				Score:         challengeScore,
-				Solver:        solve.Solver.Username,
-				Rank:          int64(solve.Rank),
-				SolveTime:     solve.SolveTime,
-				BloodReward:   rewardScore,
-				ChallengeName: solve.Challenge.Name,
-			})
-
-			// 更新最后解题时间
-			if teamData.LastSolveTime < solve.SolveTime.UnixMilli() {
-				teamData.LastSolveTime = solve.SolveTime.UnixMilli()
-			}
-
-			teamDataMap[solve.TeamID] = teamData
-		}
-	}
-
-	// 获取并应用分数修正
-	var adjustments []models.ScoreAdjustment
-	if err := dbtool.DB().Where("game_id = ?", gameID).Find(&adjustments).Error; err != nil {
-		return nil, errors.New("failed to load score adjustments")
-	}
-
-	// 应用分数修正到队伍数据
-	for _, adjustment := range adjustments {
-		if teamData, exists := teamDataMap[adjustment.TeamID]; exists {
-			// 应用修正
-			teamData.Score += adjustment.ScoreChange
-
-			// 添加分数修正到队伍的分数修正列表
-			if teamData.ScoreAdjustments == nil {
-				teamData.ScoreAdjustments = make([]webmodels.TeamScoreAdjustmentItem, 0)
-			}
-			teamData.ScoreAdjustments = append(teamData.ScoreAdjustments, webmodels.TeamScoreAdjustmentItem{
-				AdjustmentID:   adjustment.AdjustmentID,
-				AdjustmentType: string(adjustment.AdjustmentType),
-				ScoreChange:    adjustment.ScoreChange,
-				Reason:         adjustment.Reason,
-				CreatedAt:      adjustment.CreatedAt,
-			})
-			teamDataMap[adjustment.TeamID] = teamData
-		}
-	}
-
-	// 转换为切片并排序
-	teamRankings := make([]webmodels.TeamScoreItem, 0, len(teamDataMap))
-	for _, teamData := range teamDataMap {
-		teamRankings = append(teamRankings, teamData)
+	state, err := loadScoreBoardState(gameID)
+	if err != nil {
+		return nil, err
 	}
 
-	// 使用 sort.Slice 进行多条件排序：
-	// 1. 总分降序（分数高的排前面）
-	// 2. 总分相同时，罚时升序（罚时少的排前面）
-	// 3. 罚时相同时，最后解题时间升序（解题时间早的排前面）
-	// 4. 最后比较队伍名称（升序，字典序小的排前面）... 这个应该不会出现
-	sort.Slice(teamRankings, func(i, j int) bool {
-		teamI, teamJ := teamRankings[i], teamRankings[j]
-
-		// 先比较总分（降序）
-		if teamI.Score != teamJ.Score {
-			return teamI.Score > teamJ.Score
-		}
-
-		// 总分相同时比较罚时（升序，罚时少的排前面）
-		if teamI.Penalty != teamJ.Penalty {
-			return teamI.Penalty < teamJ.Penalty
-		}
-
-		// 罚时相同时比较最后解题时间（升序，解题时间早的排前面）
-		if teamI.LastSolveTime != teamJ.LastSolveTime {
-			return teamI.LastSolveTime < teamJ.LastSolveTime
-		}
+	return buildGameScoreBoard(state, users, freezeTime, stageName)
+}
 
-		// 比较队伍 ID。。。
-		return teamI.TeamID < teamJ.TeamID
+// 根据解题记录生成队伍的得分时间线，阶段排行榜没有快照可以用
+func solveTimeLine(team webmodels.TeamScoreItem) webmodels.TimeLineItem {
+	solves := make([]webmodels.TeamSolveItem, len(team.SolvedChallenges))
+	copy(solves, team.SolvedChallenges)
+	sort.Slice(solves, func(i, j int) bool {
+		return solves[i].SolveTime.Before(solves[j].SolveTime)
 	})
 
-	processedTeamRankings := make([]webmodels.TeamScoreItem, 0, len(teamDataMap))
-
-	// 设置排名
-	for i, teamData := range teamRankings {
-		teamData.Rank = int64(i + 1)
-		tmp := webmodels.TeamScoreItem{
-			TeamID:           teamData.TeamID,
-			TeamName:         teamData.TeamName,
-			TeamAvatar:       teamData.TeamAvatar,
-			TeamSlogan:       teamData.TeamSlogan,
-			TeamDescription:  teamData.TeamDescription,
-			Rank:             teamData.Rank,
-			Score:            teamData.Score,
-			Members:          teamData.Members,
-			Penalty:          teamData.Penalty,
-			SolvedChallenges: teamData.SolvedChallenges,
-			ScoreAdjustments: teamData.ScoreAdjustments,
-			GroupID:          teamData.GroupID,
-			GroupName:        teamData.GroupName,
-		}
-		finalScoreBoardMap[teamData.TeamID] = tmp
-		processedTeamRankings = append(processedTeamRankings, tmp)
+	timeLine := webmodels.TimeLineItem{
+		TeamID:    team.TeamID,
+		TeamName:  team.TeamName,
+		GroupName: team.GroupName,
+		Scores:    make([]webmodels.TimeLineScoreItem, 0, len(solves)),
 	}
 
-	cachedData.TeamRankings = processedTeamRankings
-
-	// 获取 TOP10
-	idx := 0
-	top10Teams := make([]webmodels.TeamScoreItem, 0, min(10, len(teamRankings)))
-	for _, teamData := range teamRankings {
-		top10Teams = append(top10Teams, webmodels.TeamScoreItem{
-			TeamID:           teamData.TeamID,
-			TeamName:         teamData.TeamName,
-			TeamAvatar:       teamData.TeamAvatar,
-			TeamSlogan:       teamData.TeamSlogan,
-			TeamDescription:  teamData.TeamDescription,
-			Rank:             teamData.Rank,
-			Score:            teamData.Score,
-			Members:          teamData.Members,
-			Penalty:          teamData.Penalty,
-			SolvedChallenges: teamData.SolvedChallenges,
-			ScoreAdjustments: teamData.ScoreAdjustments,
-			GroupID:          teamData.GroupID,
-			GroupName:        teamData.GroupName,
+	score := 0.0
+	for _, solve := range solves {
+		score += solve.Score
+		timeLine.Scores = append(timeLine.Scores, webmodels.TimeLineScoreItem{
+			RecordTime: solve.SolveTime.UnixMilli(),
+			Score:      score,
 		})
-		// 防止队伍数量少于 10报错
-		idx += 1
-		if idx == 10 {
-			break
-		}
 	}
 
-	// 构建时间线数据（基于原有的 scoreboard 数据）
-	// 初始化 团队 ID 列表
-	var participatedTeamIDs []int64
-	for _, team := range teams {
-		participatedTeamIDs = append(participatedTeamIDs, team.TeamID)
-	}
+	return timeLine
+}
 
-	// 获取上述队伍的积分榜
-	var teamGameScoreborad []models.ScoreBoard = make([]models.ScoreBoard, 0)
-	var teamGameScoreboardMap map[int64]models.ScoreBoard = make(map[int64]models.ScoreBoard)
-	if err := dbtool.DB().Model(&models.ScoreBoard{}).Where("game_id = ? AND team_id IN ?", gameID, participatedTeamIDs).Find(&teamGameScoreborad).Error; err != nil {
-		return nil, errors.New("failed to load gameScoreBoard for game")
+func scoreBoardCacheKey(gameID int64, stageName string, frozen bool) string {
+	cacheKey := fmt.Sprintf("game_scoreboard_%d", gameID)
+	if frozen {
+		cacheKey = fmt.Sprintf("game_scoreboard_frozen_%d", gameID)
 	}
-
-	for _, scoreboard := range teamGameScoreborad {
-		// 顺便根据记录时间排序好
-		sort.Slice(scoreboard.Data, func(i, j int) bool {
-			return scoreboard.Data[i].RecordTime.Before(scoreboard.Data[j].RecordTime)
-		})
-
-		// 过滤掉超出比赛时间的积分榜
-		// filteredScoreboard := make(models.ScoreBoardDatas, 0)
-		// for _, record := range scoreboard.Data {
-		// 	if record.RecordTime.After(game.StartTime) && record.RecordTime.Before(game.EndTime) {
-		// 		filteredScoreboard = append(filteredScoreboard, record)
-		// 	}
-		// }
-
-		// scoreboard.Data = filteredScoreboard
-
-		teamGameScoreboardMap[scoreboard.TeamID] = scoreboard
+	if stageName != "" {
+		cacheKey = fmt.Sprintf("%s_stage_%s", cacheKey, stageName)
 	}
+	return cacheKey
+}
 
-	if len(teamGameScoreborad) == 0 {
-		// 没有积分榜数据就初始化个新的
-		timeLines = make([]webmodels.TimeLineItem, 0)
-		cachedData.AllTimeLines = make([]webmodels.TimeLineItem, 0)
-	} else {
-		// 构建 TOP10 的时间线
-		timeLineMap := make(map[int64]webmodels.TimeLineItem)
-		prevScoreMap := make(map[int64]float64)
-
-		for _, team := range top10Teams {
-			teamID := team.TeamID
-
-			tmpTimeLine := webmodels.TimeLineItem{
-				TeamID:    teamID,
-				TeamName:  team.TeamName,
-				Scores:    make([]webmodels.TimeLineScoreItem, 0),
-				GroupName: team.GroupName,
-			}
-
-			scoreboard, exists := teamGameScoreboardMap[teamID]
-			if !exists {
-				timeLineMap[teamID] = tmpTimeLine
-				continue
-			}
-
-			for _, record := range scoreboard.Data {
-				lastScore, valid := prevScoreMap[teamID]
-				if !valid || lastScore != record.Score {
-					tmpTimeLine.Scores = append(tmpTimeLine.Scores, webmodels.TimeLineScoreItem{
-						RecordTime: record.RecordTime.UnixMilli(),
-						Score:      record.Score,
-					})
-					prevScoreMap[teamID] = record.Score
-				}
-			}
-
-			timeLineMap[teamID] = tmpTimeLine
-		}
-
-		// 构建所有队伍的时间线
-		allTimeLineMap := make(map[int64]webmodels.TimeLineItem)
-		allPrevScoreMap := make(map[int64]float64)
-
-		// 初始化所有队伍的时间线
-		for _, team := range teams {
-			teamID := team.TeamID
-
-			if teamData, ok := teamDataMap[team.TeamID]; ok {
-				tmpTimeLine := webmodels.TimeLineItem{
-					TeamID:    team.TeamID,
-					TeamName:  teamData.TeamName,
-					Scores:    make([]webmodels.TimeLineScoreItem, 0),
-					GroupName: teamData.GroupName,
-				}
-
-				scoreboard, exists := teamGameScoreboardMap[teamID]
-				if !exists {
-					allTimeLineMap[team.TeamID] = tmpTimeLine
-					continue
-				}
-
-				for _, record := range scoreboard.Data {
-					lastScore, valid := allPrevScoreMap[teamID]
-					if !valid || lastScore != record.Score {
-						tmpTimeLine.Scores = append(tmpTimeLine.Scores, webmodels.TimeLineScoreItem{
-							RecordTime: record.RecordTime.UnixMilli(),
-							Score:      record.Score,
-						})
-						allPrevScoreMap[teamID] = record.Score
-					}
-				}
-
-				allTimeLineMap[team.TeamID] = tmpTimeLine
-			}
-		}
-
-		// 转换 TOP10 时间线数据
-		timeLines = make([]webmodels.TimeLineItem, 0, len(timeLineMap))
-		for _, item := range timeLineMap {
-			timeLines = append(timeLines, item)
-		}
-
-		// 按照最终排名排序时间线
-		sort.Slice(timeLines, func(i, j int) bool {
-			// 找到对应队伍的排名
-			rankI, rankJ := 999999, 999999
-			teamI, ok := finalScoreBoardMap[timeLines[i].TeamID]
-			if ok {
-				rankI = int(teamI.Rank)
-			}
-			teamJ, ok := finalScoreBoardMap[timeLines[j].TeamID]
-			if ok {
-				rankJ = int(teamJ.Rank)
-			}
-			return rankI < rankJ
-		})
-
-		// 转换所有队伍的时间线数据
-		allTimeLines := make([]webmodels.TimeLineItem, 0, len(allTimeLineMap))
-		for _, item := range allTimeLineMap {
-			allTimeLines = append(allTimeLines, item)
-		}
-
-		// 按照最终排名排序所有队伍的时间线
-		sort.Slice(allTimeLines, func(i, j int) bool {
-			// 找到对应队伍的排名
-			rankI, rankJ := 999999, 999999
-			teamI, ok := finalScoreBoardMap[allTimeLines[i].TeamID]
-			if ok {
-				rankI = int(teamI.Rank)
-			}
-			teamJ, ok := finalScoreBoardMap[allTimeLines[j].TeamID]
-			if ok {
-				rankJ = int(teamJ.Rank)
-			}
-			return rankI < rankJ
-		})
-
-		// 将所有队伍的时间线数据存储到结构体中
-		cachedData.AllTimeLines = allTimeLines
+func emptyGameScoreBoard() *webmodels.CachedGameScoreBoardData {
+	return &webmodels.CachedGameScoreBoardData{
+		TeamRankings:       make([]webmodels.TeamScoreItem, 0),
+		AllTimeLines:       make([]webmodels.TimeLineItem, 0),
+		Top10TimeLines:     make([]webmodels.TimeLineItem, 0),
+		Top10Teams:         make([]webmodels.TeamScoreItem, 0),
+		FinalScoreBoardMap: make(map[int64]webmodels.TeamScoreItem),
+		ChallengeStats:     make(map[int64]webmodels.ScoreBoardChallengeStat),
 	}
+}
 
-	cachedData.FinalScoreBoardMap = finalScoreBoardMap
-	cachedData.Top10TimeLines = timeLines
-	cachedData.Top10Teams = top10Teams
-
-	return &cachedData, nil
+func CachedGameScoreBoard(gameID int64) (*webmodels.CachedGameScoreBoardData, error) {
+	return CachedStageGameScoreBoard(gameID, "", false)
 }
 
-func MakeGameScoreBoardCache(gameID int64) error {
-	cacheKey := fmt.Sprintf("game_scoreboard_%d", gameID)
+// CachedFrozenGameScoreBoard 封榜时的排行榜，由 MakeGameScoreBoardCache 在封榜期间生成
+func CachedFrozenGameScoreBoard(gameID int64) (*webmodels.CachedGameScoreBoardData, error) {
+	return CachedStageGameScoreBoard(gameID, "", true)
+}
 
-	cachedData, err := CalculateGameScoreBoard(gameID)
-	if err != nil {
-		return err
+// CachedStageGameScoreBoard 阶段排行榜，stageName 为空的时候是整场比赛的排行榜，都由 MakeGameScoreBoardCache 生成
+func CachedStageGameScoreBoard(gameID int64, stageName string, frozen bool) (*webmodels.CachedGameScoreBoardData, error) {
+	value, found := cachePool.Get(scoreBoardCacheKey(gameID, stageName, frozen))
+	if found {
+		return value.(*webmodels.CachedGameScoreBoardData), nil
 	}
 
-	cachePool.Set(cacheKey, cachedData, 1)
-	return nil
+	return emptyGameScoreBoard(), nil
 }
 
-func CachedGameScoreBoard(gameID int64) (*webmodels.CachedGameScoreBoardData, error) {
-	cacheKey := fmt.Sprintf("game_scoreboard_%d", gameID)
+// CachedVisibleGameScoreBoard 选手在封榜期间看到封榜时的排行榜，liveView 为 true 的时候总是返回实时排行榜
+func CachedVisibleGameScoreBoard(game *models.Game, liveView bool) (*webmodels.CachedGameScoreBoardData, bool, error) {
+	return CachedVisibleStageGameScoreBoard(game, "", liveView)
+}
 
-	value, found := cachePool.Get(cacheKey)
-	if found {
-		return value.(*webmodels.CachedGameScoreBoardData), nil
-	}
+// CachedVisibleStageGameScoreBoard 和 CachedVisibleGameScoreBoard 一样，stageName 不为空的时候返回阶段排行榜
+func CachedVisibleStageGameScoreBoard(game *models.Game, stageName string, liveView bool) (*webmodels.CachedGameScoreBoardData, bool, error) {
+	frozen := !liveView && game.ScoreBoardFrozen(time.Now().UTC())
+	scoreBoard, err := CachedStageGameScoreBoard(game.GameID, stageName, frozen)
+	return scoreBoard, frozen, err
+}
 
-	// zaphelper.Logger.Error("Get scoreboard from cache failed", zap.String("cache_key", cacheKey))
+// FrozenGameSimpleChallenges 用封榜时的分数和解题人数替换题目列表里的实时数据
+func FrozenGameSimpleChallenges(scoreBoard *webmodels.CachedGameScoreBoardData, challenges []webmodels.UserSimpleGameChallenge) []webmodels.UserSimpleGameChallenge {
+	result := make([]webmodels.UserSimpleGameChallenge, len(challenges))
+	copy(result, challenges)
 
-	obj := webmodels.CachedGameScoreBoardData{
-		TeamRankings:       make([]webmodels.TeamScoreItem, 0),
-		AllTimeLines:       make([]webmodels.TimeLineItem, 0),
-		Top10TimeLines:     make([]webmodels.TimeLineItem, 0),
-		Top10Teams:         make([]webmodels.TeamScoreItem, 0),
-		FinalScoreBoardMap: make(map[int64]webmodels.TeamScoreItem),
+	for i := range result {
+		if stat, ok := scoreBoard.ChallengeStats[result[i].ChallengeID]; ok {
+			result[i].CurScore = stat.CurScore
+			result[i].SolveCount = stat.SolveCount
+		}
 	}
 
-	return &obj, nil
+	return result
 }
 
 func CachedGameGroups(gameID int64) (map[int64]models.GameGroup, error) {
@@ -782,6 +429,47 @@ func CachedGameGroups(gameID int64) (map[int64]models.GameGroup, error) {
 	return gameGroupsMap, nil
 }
 
+// CachedGameStageTeams 每个阶段晋级的队伍，stage_name -> team_id，没有晋级记录的阶段所有队伍都能参加
+func CachedGameStageTeams(gameID int64) (map[string]map[int64]bool, error) {
+	obj, err := GetOrCacheSingleFlight(fmt.Sprintf("game_stage_teams_%d", gameID), func() (interface{}, error) {
+		var stageTeams []models.GameStageTeam
+		if err := dbtool.DB().Where("game_id = ?", gameID).Find(&stageTeams).Error; err != nil {
+			return nil, errors.New("failed to load stage teams")
+		}
+
+		stageTeamMap := make(map[string]map[int64]bool)
+		for _, stageTeam := range stageTeams {
+			if _, ok := stageTeamMap[stageTeam.StageName]; !ok {
+				stageTeamMap[stageTeam.StageName] = make(map[int64]bool)
+			}
+			stageTeamMap[stageTeam.StageName][stageTeam.TeamID] = true
+		}
+
+		return stageTeamMap, nil
+	}, allTeamsForGameCacheTime, true)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return obj.(map[string]map[int64]bool), nil
+}
+
+// TeamQualifiedForStage 队伍能不能参加题目所属的阶段，不属于任何阶段的题目所有队伍都能参加
+func TeamQualifiedForStage(gameID int64, teamID int64, belongStage *string) (bool, error) {
+	if belongStage == nil {
+		return true, nil
+	}
+
+	stageTeams, err := CachedGameStageTeams(gameID)
+	if err != nil {
+		return false, err
+	}
+
+	teams, restricted := stageTeams[*belongStage]
+	return !restricted || teams[teamID], nil
+}
+
 func CachedGameSimpleChallenges(gameID int64) ([]webmodels.UserSimpleGameChallenge, error) {
 
 	var simpleGameChallenges []webmodels.UserSimpleGameChallenge = make([]webmodels.UserSimpleGameChallenge, 0)
@@ -916,8 +604,9 @@ type CachedFilteredGameScoreBoardData struct {
 	TotalCount           int64
 }
 
-// CachedFilteredGameScoreBoard 缓存按分组过滤的排行榜数据
-func CachedFilteredGameScoreBoard(gameID int64, groupID *int64) (*CachedFilteredGameScoreBoardData, error) {
+// CachedFilteredGameScoreBoard 缓存按分组过滤的排行榜数据，frozen 为 true 的时候过滤封榜时的排行榜，
+// stageName 不为空的时候过滤阶段排行榜
+func CachedFilteredGameScoreBoard(gameID int64, stageName string, groupID *int64, frozen bool) (*CachedFilteredGameScoreBoardData, error) {
 	var cachedFilteredData CachedFilteredGameScoreBoardData
 
 	// 构建缓存键
@@ -927,10 +616,16 @@ func CachedFilteredGameScoreBoard(gameID int64, groupID *int64) (*CachedFiltered
 	} else {
 		cacheKey = fmt.Sprintf("filtered_game_scoreboard_%d_all", gameID)
 	}
+	if frozen {
+		cacheKey += "_frozen"
+	}
+	if stageName != "" {
+		cacheKey = fmt.Sprintf("%s_stage_%s", cacheKey, stageName)
+	}
 
 	obj, err := GetOrCacheSingleFlight(cacheKey, func() (interface{}, error) {
 		// 获取完整的排行榜数据
-		scoreBoard, err := CachedGameScoreBoard(gameID)
+		scoreBoard, err := CachedStageGameScoreBoard(gameID, stageName, frozen)
 		if err != nil {
 			return nil, err
 		}
@@ -1146,6 +841,28 @@ func CachedContainerStatus(gameID int64, challengeID int64, teamID int64) ([]mod
 	return containers, nil
 }
 
+// CachedStaticContainer 获取题目共享的静态容器实例，没有实例时返回 nil
+func CachedStaticContainer(inGameID int64) (*models.StaticContainer, error) {
+	obj, err := GetOrCacheSingleFlight(fmt.Sprintf("static_container_%d", inGameID), func() (interface{}, error) {
+		var staticContainers []models.StaticContainer
+		if err := dbtool.DB().Where("ingame_id = ?", inGameID).Limit(1).Find(&staticContainers).Error; err != nil {
+			return nil, errors.New("failed to load static container")
+		}
+
+		if len(staticContainers) == 0 {
+			return (*models.StaticContainer)(nil), nil
+		}
+
+		return &staticContainers[0], nil
+	}, containerStatusCacheTime, true)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return obj.(*models.StaticContainer), nil
+}
+
 // 缓存所有队伍的Flag信息，解决高并发查询team_flags表的性能问题
 func CachedAllTeamFlags(gameID int64, challengeID int64) (map[int64]*models.TeamFlag, error) {
 	var teamFlagsMap map[int64]*models.TeamFlag
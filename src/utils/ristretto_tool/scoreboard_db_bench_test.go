@@ -0,0 +1,314 @@
+package ristretto_tool
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"a1ctf/src/db/models"
+	dbtool "a1ctf/src/utils/db_tool"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+)
+
+// 读库的排行榜基准测试，A1CTF_BENCH_CONFIG 指向一个 config.yaml，里面的数据库已经执行过迁移，没有设置的时候跳过。
+// 两个基准测试使用同一份写入数据库的数据（和 newScoreBoardFixture 一样），结束之后删除：
+//   - DBLegacy 每次执行改成排行榜引擎之前定时任务每一轮做的事情：updateActiveGameScores 读取全部解题记录，再用 CalculateGameScoreBoard 全量计算排行榜
+//   - DBEngine 只在开始时 loadScoreBoardState 一次，每次执行 applyNewEvents 增量读取新记录并重新计算排行榜，对应引擎每一轮刷新（按状态有变化计算）
+//
+// 运行方式：A1CTF_BENCH_CONFIG=/path/to/config.yaml go test -run '^$' -bench ScoreBoardDB ./src/utils/ristretto_tool/
+
+func initBenchDB(b *testing.B) {
+	b.Helper()
+
+	configPath := os.Getenv("A1CTF_BENCH_CONFIG")
+	if configPath == "" {
+		b.Skip("A1CTF_BENCH_CONFIG is not set")
+	}
+
+	viper.SetConfigFile(configPath)
+	if err := viper.ReadInConfig(); err != nil {
+		b.Fatalf("read config: %v", err)
+	}
+
+	if dbtool.DB() == nil {
+		dbtool.Init()
+	}
+	if cachePool == nil {
+		InitCachePool()
+	}
+	LoadCacheTime()
+}
+
+// 把 fixture 写入数据库，返回比赛 ID。fixture 里的队伍、题目和用户 ID 换成数据库生成的 ID
+func seedScoreBoardFixture(b *testing.B, f *scoreBoardFixture) int64 {
+	b.Helper()
+
+	db := dbtool.DB()
+	now := time.Now().UTC()
+	suffix := uuid.NewString()[:8]
+
+	game := f.game
+	game.GameID = 0
+	game.Name = "scoreboard-bench-" + suffix
+	game.WpExpireTime = game.EndTime
+	game.Stages = &models.GameStages{}
+	game.TeamPolicy = models.TeamPolicyAuto
+	game.FirstBloodReward = 5
+	game.SecondBloodReward = 3
+	game.ThirdBloodReward = 1
+	if err := db.Create(&game).Error; err != nil {
+		b.Fatalf("create game: %v", err)
+	}
+	gameID := game.GameID
+
+	b.Cleanup(func() { cleanupScoreBoardFixture(b, gameID, game.Name) })
+
+	userIDs := make(map[string]string, len(f.users))
+	users := make([]models.User, 0, len(f.users))
+	for fixtureID := range f.users {
+		userID := uuid.NewString()
+		userIDs[fixtureID] = userID
+		users = append(users, models.User{
+			UserID:       userID,
+			Username:     fmt.Sprintf("%s-%s", game.Name, fixtureID),
+			Password:     "-",
+			Salt:         "-",
+			Role:         models.UserRoleUser,
+			RegisterTime: now,
+		})
+	}
+	if err := db.CreateInBatches(&users, 500).Error; err != nil {
+		b.Fatalf("create users: %v", err)
+	}
+
+	challengeIDs := make(map[int64]int64, len(f.challenges))
+	ingameIDs := make(map[int64]int64, len(f.challenges))
+	for _, gc := range f.challenges {
+		challenge := models.Challenge{
+			Name:          fmt.Sprintf("%s-%s", game.Name, gc.Challenge.Name),
+			Category:      models.CategoryMISC,
+			Attachments:   models.AttachmentConfigs{},
+			ContainerType: models.NO_CONTAINER,
+			CreateTime:    now,
+			FlagType:      models.FlagTypeStatic,
+		}
+		if err := db.Create(&challenge).Error; err != nil {
+			b.Fatalf("create challenge: %v", err)
+		}
+
+		fixtureIngameID := gc.IngameID
+		gc.IngameID = 0
+		gc.GameID = gameID
+		gc.ChallengeID = *challenge.ChallengeID
+		gc.Challenge = models.Challenge{}
+		gc.CurScore = gc.TotalScore
+		if err := db.Create(&gc).Error; err != nil {
+			b.Fatalf("create game challenge: %v", err)
+		}
+
+		challengeIDs[fixtureIngameID] = gc.ChallengeID
+		ingameIDs[fixtureIngameID] = gc.IngameID
+	}
+
+	teamIDs := make(map[int64]int64, len(f.teams))
+	for _, fixtureTeam := range f.teams {
+		team := fixtureTeam
+		team.TeamID = 0
+		team.GameID = gameID
+		team.TeamHash = uuid.NewString()
+		team.TeamStatus = models.ParticipateApproved
+		team.TeamType = models.TeamTypePlayer
+		team.TeamMembers = make([]string, 0, len(fixtureTeam.TeamMembers))
+		for _, member := range fixtureTeam.TeamMembers {
+			team.TeamMembers = append(team.TeamMembers, userIDs[member])
+		}
+		if err := db.Create(&team).Error; err != nil {
+			b.Fatalf("create team: %v", err)
+		}
+		teamIDs[fixtureTeam.TeamID] = team.TeamID
+	}
+
+	judges := make([]models.Judge, 0, len(f.solves))
+	solves := make([]models.Solve, 0, len(f.solves))
+	for _, solve := range f.solves {
+		judgeID := uuid.NewString()
+		judges = append(judges, models.Judge{
+			IngameID:     ingameIDs[solve.IngameID],
+			GameID:       gameID,
+			ChallengeID:  challengeIDs[solve.IngameID],
+			TeamID:       teamIDs[solve.TeamID],
+			JudgeType:    models.JudgeTypeDynamic,
+			JudgeStatus:  models.JudgeAC,
+			SubmiterID:   userIDs[solve.SolverID],
+			JudgeID:      judgeID,
+			JudgeTime:    solve.SolveTime,
+			JudgeContent: "flag{benchmark}",
+		})
+		solves = append(solves, models.Solve{
+			JudgeID:     judgeID,
+			SolveID:     uuid.NewString(),
+			IngameID:    ingameIDs[solve.IngameID],
+			ChallengeID: challengeIDs[solve.IngameID],
+			TeamID:      teamIDs[solve.TeamID],
+			GameID:      gameID,
+			SolveStatus: models.SolveCorrect,
+			SolverID:    userIDs[solve.SolverID],
+			SolveTime:   solve.SolveTime,
+			Rank:        solve.Rank,
+		})
+	}
+	if err := db.CreateInBatches(&judges, 500).Error; err != nil {
+		b.Fatalf("create judges: %v", err)
+	}
+	if err := db.CreateInBatches(&solves, 500).Error; err != nil {
+		b.Fatalf("create solves: %v", err)
+	}
+
+	adjustments := make([]models.ScoreAdjustment, 0, len(f.adjustments))
+	for _, adjustment := range f.adjustments {
+		adjustment.AdjustmentID = 0
+		adjustment.GameID = gameID
+		adjustment.TeamID = teamIDs[adjustment.TeamID]
+		adjustment.Reason = "benchmark"
+		adjustment.CreatedBy = uuid.MustParse(users[0].UserID)
+		adjustment.UpdatedAt = adjustment.CreatedAt
+		adjustments = append(adjustments, adjustment)
+	}
+	if err := db.CreateInBatches(&adjustments, 500).Error; err != nil {
+		b.Fatalf("create score adjustments: %v", err)
+	}
+
+	hintUnlocks := make([]models.HintUnlock, 0, len(f.hintUnlocks))
+	for _, unlock := range f.hintUnlocks {
+		unlock.UnlockID = 0
+		unlock.GameID = gameID
+		unlock.ChallengeID = challengeIDs[unlock.IngameID]
+		unlock.IngameID = ingameIDs[unlock.IngameID]
+		unlock.TeamID = teamIDs[unlock.TeamID]
+		unlock.HintID = "hint-0"
+		unlock.UnlockerID = users[0].UserID
+		hintUnlocks = append(hintUnlocks, unlock)
+	}
+	if err := db.CreateInBatches(&hintUnlocks, 500).Error; err != nil {
+		b.Fatalf("create hint unlocks: %v", err)
+	}
+
+	scoreboards := make([]models.ScoreBoard, 0, len(f.snapshots))
+	for _, scoreboard := range f.snapshots {
+		scoreboard.GameID = gameID
+		scoreboard.TeamID = teamIDs[scoreboard.TeamID]
+		scoreboard.GenerateTime = now
+		scoreboard.LastUpdateTime = now
+		scoreboards = append(scoreboards, scoreboard)
+	}
+	if err := db.CreateInBatches(&scoreboards, 500).Error; err != nil {
+		b.Fatalf("create scoreboards: %v", err)
+	}
+
+	return gameID
+}
+
+// 比赛相关的数据按照外键的顺序删除，题目和用户不属于比赛，按照名字前缀删除
+func cleanupScoreBoardFixture(b *testing.B, gameID int64, prefix string) {
+	db := dbtool.DB()
+	for _, model := range []interface{}{
+		&models.Solve{}, &models.Judge{}, &models.HintUnlock{}, &models.ScoreAdjustment{},
+		&models.ScoreBoard{}, &models.GameChallenge{}, &models.Team{}, &models.Game{},
+	} {
+		if err := db.Where("game_id = ?", gameID).Delete(model).Error; err != nil {
+			b.Errorf("cleanup %T: %v", model, err)
+		}
+	}
+	if err := db.Where("name LIKE ?", prefix+"-%").Delete(&models.Challenge{}).Error; err != nil {
+		b.Errorf("cleanup challenges: %v", err)
+	}
+	if err := db.Where("username LIKE ?", prefix+"-%").Delete(&models.User{}).Error; err != nil {
+		b.Errorf("cleanup users: %v", err)
+	}
+}
+
+// 改成排行榜引擎之前 updateActiveGameScores 每一轮的读库部分，分数没有变化的时候不会写库
+func legacyActiveGameScoreReads(gameID int64) error {
+	var gameChallenges []models.GameChallenge
+	if err := dbtool.DB().Where("game_id IN ?", []int64{gameID}).Find(&gameChallenges).Error; err != nil {
+		return err
+	}
+
+	var solves []models.Solve
+	if err := dbtool.DB().Where("game_id IN ? AND solve_status = ?", []int64{gameID}, models.SolveCorrect).Preload("Game").Preload("Team").Find(&solves).Error; err != nil {
+		return err
+	}
+
+	var games []models.Game
+	if err := dbtool.DB().Where("game_id IN ?", []int64{gameID}).Find(&games).Error; err != nil {
+		return err
+	}
+
+	var adjustments []models.ScoreAdjustment
+	if err := dbtool.DB().Where("game_id IN ?", []int64{gameID}).Find(&adjustments).Error; err != nil {
+		return err
+	}
+
+	var hintUnlocks []models.HintUnlock
+	if err := dbtool.DB().Where("game_id IN ?", []int64{gameID}).Find(&hintUnlocks).Error; err != nil {
+		return err
+	}
+
+	teamIDs := make([]int64, 0)
+	seen := make(map[int64]bool)
+	for _, solve := range solves {
+		if solve.Team.TeamStatus == models.ParticipateApproved && !seen[solve.TeamID] {
+			seen[solve.TeamID] = true
+			teamIDs = append(teamIDs, solve.TeamID)
+		}
+	}
+
+	var currentTeams []models.Team
+	return dbtool.DB().Where("team_id IN ? AND game_id IN ?", teamIDs, []int64{gameID}).Find(&currentTeams).Error
+}
+
+func BenchmarkScoreBoardDBLegacy(b *testing.B) {
+	initBenchDB(b)
+	gameID := seedScoreBoardFixture(b, newScoreBoardFixture())
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := legacyActiveGameScoreReads(gameID); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := CalculateGameScoreBoard(gameID); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkScoreBoardDBEngine(b *testing.B) {
+	initBenchDB(b)
+	gameID := seedScoreBoardFixture(b, newScoreBoardFixture())
+
+	state, err := loadScoreBoardState(gameID)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := state.applyNewEvents(); err != nil {
+			b.Fatal(err)
+		}
+
+		// 按照每一轮都有新的记录计算，是引擎刷新的上限
+		users, err := CachedMemberMap()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := buildGameScoreBoard(state, users, nil, ""); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,419 @@
+package ristretto_tool
+
+import (
+	"a1ctf/src/db/models"
+	redistool "a1ctf/src/utils/redis_tool"
+	scoretool "a1ctf/src/utils/score_tool"
+	"a1ctf/src/utils/zaphelper"
+	"a1ctf/src/webmodels"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"go.uber.org/zap"
+)
+
+// 排行榜引擎在内存里保存每场比赛的 scoreBoardState，每次刷新只增量读取新的解题、分数修正和提示解锁，
+// 题目分数的变化根据内存里的解题人数计算，状态没有变化的时候不重新计算排行榜。
+// 管理员修改比赛、题目、队伍等数据之后调用 MarkGameScoreBoardRebuild，下一次刷新时全量重建。
+// 重建版本号保存在 redis 里，多个实例都能收到重建通知。
+// 结束了一段时间并且没有变化的比赛会从引擎里移除，只记录重建版本号和排行榜缓存的 key，
+// 缓存被淘汰或者收到重建通知的时候再重新读取
+
+type scoreBoardEngineGame struct {
+	mu    sync.Mutex
+	state *scoreBoardState
+	// 状态每次变化加一，排行榜和分数汇总根据版本号判断是否需要重新计算
+	version int64
+	// 已经处理过的 redis 重建版本号
+	rebuildVersion int64
+	// 本实例标记的重建，不用等 redis
+	dirty    bool
+	loadedAt time.Time
+	// 最后一次版本号变化的时间
+	changedAt time.Time
+
+	builtVersion int64
+	builtFrozen  bool
+	liveBoard    *webmodels.CachedGameScoreBoardData
+	summary      *GameScoreSummary
+}
+
+// 比赛结束并且排行榜没有变化超过这么久之后从引擎里移除
+const scoreBoardEndedGameRetention = 10 * time.Minute
+
+// 已经移除的比赛，排行榜只保存在缓存里
+type archivedScoreBoardGame struct {
+	// 重新加入引擎的时候版本号接着移除时的继续增加，定时任务用版本号判断分数有没有变化
+	version        int64
+	rebuildVersion int64
+	cacheKeys      []string
+}
+
+var scoreBoardEngineLock sync.Mutex
+var scoreBoardEngineGames = make(map[int64]*scoreBoardEngineGame)
+var archivedScoreBoardGames = make(map[int64]archivedScoreBoardGame)
+
+func scoreBoardEngineGameOf(gameID int64) *scoreBoardEngineGame {
+	scoreBoardEngineLock.Lock()
+	defer scoreBoardEngineLock.Unlock()
+
+	engineGame, ok := scoreBoardEngineGames[gameID]
+	if !ok {
+		engineGame = &scoreBoardEngineGame{
+			version: archivedScoreBoardGames[gameID].version,
+		}
+		scoreBoardEngineGames[gameID] = engineGame
+		delete(archivedScoreBoardGames, gameID)
+	}
+	return engineGame
+}
+
+// ScoreBoardGameArchived 比赛已经从引擎里移除，并且排行榜缓存还在、没有收到重建通知，定时任务可以跳过这场比赛
+func ScoreBoardGameArchived(gameID int64) bool {
+	scoreBoardEngineLock.Lock()
+	archived, ok := archivedScoreBoardGames[gameID]
+	scoreBoardEngineLock.Unlock()
+	if !ok {
+		return false
+	}
+
+	if remoteVersion, remoteOK := remoteScoreBoardRebuildVersion(gameID); remoteOK && remoteVersion != archived.rebuildVersion {
+		return false
+	}
+
+	for _, key := range archived.cacheKeys {
+		if _, found := cachePool.Get(key); !found {
+			return false
+		}
+	}
+	return true
+}
+
+// 比赛结束并且一段时间没有变化之后从引擎里移除，释放解题记录和分数快照，需要持有 mu
+func (g *scoreBoardEngineGame) evictIfEnded(gameID int64) {
+	now := time.Now()
+	if g.state == nil || g.dirty ||
+		now.Sub(g.state.game.EndTime) < scoreBoardEndedGameRetention ||
+		now.Sub(g.changedAt) < scoreBoardEndedGameRetention {
+		return
+	}
+
+	archived := archivedScoreBoardGame{
+		version:        g.version,
+		rebuildVersion: g.rebuildVersion,
+		cacheKeys:      g.cacheKeys(gameID, g.builtFrozen),
+	}
+
+	scoreBoardEngineLock.Lock()
+	defer scoreBoardEngineLock.Unlock()
+
+	if scoreBoardEngineGames[gameID] != g {
+		return
+	}
+	delete(scoreBoardEngineGames, gameID)
+	archivedScoreBoardGames[gameID] = archived
+}
+
+func scoreBoardRebuildKey(gameID int64) string {
+	return fmt.Sprintf("scoreboard_rebuild_version_%d", gameID)
+}
+
+// redis 读取失败的时候返回 false，不能因为 redis 不可用就每次都全量重建
+func remoteScoreBoardRebuildVersion(gameID int64) (int64, bool) {
+	version, err := redistool.RedisClient.Get(scoreBoardRebuildKey(gameID)).Int64()
+	if err == redis.Nil {
+		return 0, true
+	}
+	if err != nil {
+		zaphelper.Logger.Error("Failed to get scoreboard rebuild version", zap.Error(err), zap.Int64("game_id", gameID))
+		return 0, false
+	}
+	return version, true
+}
+
+// MarkGameScoreBoardRebuild 修改或者删除了会影响排行榜的数据之后调用，下一次刷新排行榜时重新读取全部数据
+func MarkGameScoreBoardRebuild(gameID int64) {
+	engineGame := scoreBoardEngineGameOf(gameID)
+	engineGame.mu.Lock()
+	engineGame.dirty = true
+	engineGame.mu.Unlock()
+
+	if err := redistool.RedisClient.Incr(scoreBoardRebuildKey(gameID)).Err(); err != nil {
+		zaphelper.Logger.Error("Failed to mark scoreboard rebuild", zap.Error(err), zap.Int64("game_id", gameID))
+	}
+}
+
+// 需要持有 mu
+func (g *scoreBoardEngineGame) sync(gameID int64) error {
+	remoteVersion, remoteOK := remoteScoreBoardRebuildVersion(gameID)
+
+	notified := g.state == nil || g.dirty || (remoteOK && remoteVersion != g.rebuildVersion)
+	rebuild := notified || (scoreBoardFullRebuildInterval > 0 && time.Since(g.loadedAt) >= scoreBoardFullRebuildInterval)
+
+	if rebuild {
+		state, err := loadScoreBoardState(gameID)
+		if err != nil {
+			return err
+		}
+
+		g.state = state
+		g.dirty = false
+		if remoteOK {
+			g.rebuildVersion = remoteVersion
+		}
+		g.loadedAt = time.Now()
+		// 定时的全量重建不影响结束的比赛被移除
+		if notified {
+			g.changedAt = g.loadedAt
+		}
+		g.version++
+		return nil
+	}
+
+	changed, err := g.state.applyNewEvents()
+	if err != nil {
+		return err
+	}
+	if changed {
+		g.changedAt = time.Now()
+		g.version++
+	}
+
+	return nil
+}
+
+// 排行榜引擎生成的所有排行榜缓存的 key
+func (g *scoreBoardEngineGame) cacheKeys(gameID int64, frozen bool) []string {
+	keys := []string{scoreBoardCacheKey(gameID, "", false)}
+	if frozen {
+		keys = append(keys, scoreBoardCacheKey(gameID, "", true))
+	}
+	if g.state.game.Stages != nil {
+		for _, stage := range *g.state.game.Stages {
+			keys = append(keys, scoreBoardCacheKey(gameID, stage.StageName, false))
+			if frozen {
+				keys = append(keys, scoreBoardCacheKey(gameID, stage.StageName, true))
+			}
+		}
+	}
+	return keys
+}
+
+func (g *scoreBoardEngineGame) boardsCached(gameID int64, frozen bool) bool {
+	for _, key := range g.cacheKeys(gameID, frozen) {
+		if _, found := cachePool.Get(key); !found {
+			return false
+		}
+	}
+	return true
+}
+
+// 状态有变化、封榜状态变化或者缓存被淘汰的时候重新计算排行榜，需要持有 mu
+func (g *scoreBoardEngineGame) buildBoards(gameID int64) error {
+	game := &g.state.game
+	frozen := game.ScoreBoardFrozen(time.Now().UTC())
+
+	if g.liveBoard != nil && g.builtVersion == g.version && g.builtFrozen == frozen && g.boardsCached(gameID, frozen) {
+		return nil
+	}
+
+	users, err := CachedMemberMap()
+	if err != nil {
+		return err
+	}
+
+	liveBoard, err := buildGameScoreBoard(g.state, users, nil, "")
+	if err != nil {
+		return err
+	}
+
+	cachePool.Set(scoreBoardCacheKey(gameID, "", false), liveBoard, 1)
+
+	// 封榜期间同时维护一份封榜时的排行榜给选手看
+	if frozen {
+		frozenData, err := buildGameScoreBoard(g.state, users, game.FreezeTime, "")
+		if err != nil {
+			return err
+		}
+
+		cachePool.Set(scoreBoardCacheKey(gameID, "", true), frozenData, 1)
+	}
+
+	// 每个阶段单独的排行榜
+	if game.Stages != nil {
+		for _, stage := range *game.Stages {
+			stageData, err := buildGameScoreBoard(g.state, users, nil, stage.StageName)
+			if err != nil {
+				return err
+			}
+
+			cachePool.Set(scoreBoardCacheKey(gameID, stage.StageName, false), stageData, 1)
+
+			if frozen {
+				frozenStageData, err := buildGameScoreBoard(g.state, users, game.FreezeTime, stage.StageName)
+				if err != nil {
+					return err
+				}
+
+				cachePool.Set(scoreBoardCacheKey(gameID, stage.StageName, true), frozenStageData, 1)
+			}
+		}
+	}
+
+	g.liveBoard = liveBoard
+	g.builtVersion = g.version
+	g.builtFrozen = frozen
+
+	return nil
+}
+
+// MakeGameScoreBoardCache 同步排行榜引擎的状态，有变化的时候重新生成整场比赛、封榜和每个阶段的排行榜缓存。
+// 已经移除的比赛缓存还在的时候直接跳过
+func MakeGameScoreBoardCache(gameID int64) error {
+	if ScoreBoardGameArchived(gameID) {
+		return nil
+	}
+
+	engineGame := scoreBoardEngineGameOf(gameID)
+	engineGame.mu.Lock()
+	defer engineGame.mu.Unlock()
+
+	if err := engineGame.sync(gameID); err != nil {
+		return err
+	}
+
+	if err := engineGame.buildBoards(gameID); err != nil {
+		return err
+	}
+
+	engineGame.evictIfEnded(gameID)
+	return nil
+}
+
+// ChallengeScoreSummary 根据解题记录计算的题目解题人数和当前分数
+type ChallengeScoreSummary struct {
+	SolveCount int32
+	CurScore   float64
+}
+
+// TeamScoreSummary 队伍的实时总分和计入分数的解题记录
+type TeamScoreSummary struct {
+	TeamName string
+	Score    float64
+	SolveIDs []string
+}
+
+// GameScoreSummary 给定时任务回写 game_challenges、teams 和 scoreboard 表用的分数汇总
+type GameScoreSummary struct {
+	// 版本号不变说明分数没有变化
+	Version int64
+	// ingame_id -> 题目分数
+	Challenges map[int64]ChallengeScoreSummary
+	// 只包含有解题、分数修正或者提示解锁记录的队伍
+	Teams map[int64]TeamScoreSummary
+}
+
+func (g *scoreBoardEngineGame) scoreSummary() *GameScoreSummary {
+	summary := &GameScoreSummary{
+		Version:    g.version,
+		Challenges: make(map[int64]ChallengeScoreSummary, len(g.state.challenges)),
+		Teams:      make(map[int64]TeamScoreSummary),
+	}
+
+	solves := g.state.validSolves(g.state.game.EndTime)
+
+	solveCountMap := make(map[int64]int32)
+	teamSolveIDs := make(map[int64][]string)
+	for _, solve := range solves {
+		solveCountMap[solve.IngameID]++
+		if gc, ok := g.state.challenges[solve.IngameID]; ok && gc.Visible {
+			teamSolveIDs[solve.TeamID] = append(teamSolveIDs[solve.TeamID], solve.SolveID)
+		}
+	}
+
+	for _, gc := range g.state.challenges {
+		solveCount := solveCountMap[gc.IngameID]
+		summary.Challenges[gc.IngameID] = ChallengeScoreSummary{
+			SolveCount: solveCount,
+			CurScore:   scoretool.CalculateChallengeScore(&gc, solveCount),
+		}
+	}
+
+	for _, team := range g.liveBoard.TeamRankings {
+		if len(team.SolvedChallenges) == 0 && len(team.ScoreAdjustments) == 0 {
+			continue
+		}
+
+		solveIDs := teamSolveIDs[team.TeamID]
+		if solveIDs == nil {
+			solveIDs = make([]string, 0)
+		}
+
+		summary.Teams[team.TeamID] = TeamScoreSummary{
+			TeamName: team.TeamName,
+			Score:    team.Score,
+			SolveIDs: solveIDs,
+		}
+	}
+
+	return summary
+}
+
+// CurrentGameScoreSummary 同步排行榜引擎的状态并返回当前的分数汇总，状态没有变化的时候返回同一个结果
+func CurrentGameScoreSummary(gameID int64) (*GameScoreSummary, error) {
+	engineGame := scoreBoardEngineGameOf(gameID)
+	engineGame.mu.Lock()
+	defer engineGame.mu.Unlock()
+
+	if err := engineGame.sync(gameID); err != nil {
+		return nil, err
+	}
+
+	if err := engineGame.buildBoards(gameID); err != nil {
+		return nil, err
+	}
+
+	if engineGame.summary == nil || engineGame.summary.Version != engineGame.version {
+		engineGame.summary = engineGame.scoreSummary()
+	}
+
+	return engineGame.summary, nil
+}
+
+// GameScoreBoardSnapshots 引擎里保存的每个队伍的分数快照，返回的是副本
+func GameScoreBoardSnapshots(gameID int64) (map[int64]models.ScoreBoard, error) {
+	engineGame := scoreBoardEngineGameOf(gameID)
+	engineGame.mu.Lock()
+	defer engineGame.mu.Unlock()
+
+	if err := engineGame.sync(gameID); err != nil {
+		return nil, err
+	}
+
+	snapshots := make(map[int64]models.ScoreBoard, len(engineGame.state.snapshots))
+	for teamID, scoreboard := range engineGame.state.snapshots {
+		data := make(models.ScoreBoardDatas, len(scoreboard.Data))
+		copy(data, scoreboard.Data)
+		scoreboard.Data = data
+		snapshots[teamID] = scoreboard
+	}
+
+	return snapshots, nil
+}
+
+// ApplyGameScoreBoardSnapshots 快照写入数据库之后同步到引擎，时间线不用重新读取快照
+func ApplyGameScoreBoardSnapshots(gameID int64, scoreboards []models.ScoreBoard) {
+	engineGame := scoreBoardEngineGameOf(gameID)
+	engineGame.mu.Lock()
+	defer engineGame.mu.Unlock()
+
+	if engineGame.state == nil || len(scoreboards) == 0 {
+		return
+	}
+
+	engineGame.state.setSnapshots(scoreboards)
+	engineGame.changedAt = time.Now()
+	engineGame.version++
+}
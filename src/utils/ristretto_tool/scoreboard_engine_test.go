@@ -0,0 +1,288 @@
+package ristretto_tool
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"a1ctf/src/db/models"
+)
+
+// 排行榜引擎的基准测试，数据全部在内存里生成，不访问数据库：
+//   - FullRebuild 每次新建 scoreBoardState 并放入全部记录再计算排行榜，对应 CalculateGameScoreBoard 去掉读库之后的开销
+//   - Incremental 在已有的状态上合并新的解题记录再计算排行榜，对应引擎每次刷新时 applyNewEvents 之后的开销
+//   - Unchanged 合并已经有的记录，状态没有变化，引擎不会重新计算排行榜
+//
+// 包含读库开销的对比在 scoreboard_db_bench_test.go，需要数据库
+
+const (
+	benchTeams      = 500
+	benchChallenges = 40
+	benchSolves     = 5000
+	benchSnapshots  = 20
+)
+
+type scoreBoardFixture struct {
+	game        models.Game
+	teams       []models.Team
+	challenges  []models.GameChallenge
+	solves      []scoreBoardSolve
+	adjustments []models.ScoreAdjustment
+	hintUnlocks []models.HintUnlock
+	snapshots   []models.ScoreBoard
+	users       map[string]models.User
+}
+
+func newScoreBoardFixture() *scoreBoardFixture {
+	startTime := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := &scoreBoardFixture{
+		game: models.Game{
+			GameID:    1,
+			StartTime: startTime,
+			EndTime:   startTime.Add(48 * time.Hour),
+		},
+		users: make(map[string]models.User),
+	}
+
+	for i := 0; i < benchTeams; i++ {
+		userID := fmt.Sprintf("user-%d", i)
+		f.users[userID] = models.User{UserID: userID, Username: userID}
+		f.teams = append(f.teams, models.Team{
+			TeamID:      int64(i + 1),
+			GameID:      f.game.GameID,
+			TeamName:    fmt.Sprintf("team-%d", i),
+			TeamMembers: []string{userID},
+		})
+	}
+
+	for i := 0; i < benchChallenges; i++ {
+		f.challenges = append(f.challenges, models.GameChallenge{
+			IngameID:           int64(i + 1),
+			GameID:             f.game.GameID,
+			ChallengeID:        int64(i + 1),
+			Challenge:          models.Challenge{Name: fmt.Sprintf("challenge-%d", i)},
+			TotalScore:         1000,
+			MinimalScore:       100,
+			Difficulty:         5,
+			Visible:            true,
+			BloodRewardEnabled: true,
+		})
+	}
+
+	rank := make(map[int64]int32)
+	for i := 0; i < benchSolves; i++ {
+		f.solves = append(f.solves, f.newSolve(i, rank))
+	}
+
+	for i := 0; i < benchTeams/10; i++ {
+		f.adjustments = append(f.adjustments, models.ScoreAdjustment{
+			AdjustmentID:   int64(i + 1),
+			TeamID:         int64(i*10 + 1),
+			GameID:         f.game.GameID,
+			AdjustmentType: models.AdjustmentTypeReward,
+			ScoreChange:    50,
+			CreatedAt:      startTime.Add(time.Duration(i) * time.Minute),
+		})
+		f.hintUnlocks = append(f.hintUnlocks, models.HintUnlock{
+			UnlockID:   int64(i + 1),
+			GameID:     f.game.GameID,
+			IngameID:   int64(i%benchChallenges + 1),
+			TeamID:     int64(i*10 + 2),
+			Cost:       20,
+			UnlockTime: startTime.Add(time.Duration(i) * time.Minute),
+		})
+	}
+
+	for _, team := range f.teams {
+		data := make(models.ScoreBoardDatas, 0, benchSnapshots)
+		for i := 0; i < benchSnapshots; i++ {
+			data = append(data, models.ScoreBoardData{
+				TeamName:   team.TeamName,
+				Score:      float64(i * 100),
+				RecordTime: startTime.Add(time.Duration(i) * time.Hour),
+			})
+		}
+		f.snapshots = append(f.snapshots, models.ScoreBoard{
+			GameID: f.game.GameID,
+			TeamID: team.TeamID,
+			Data:   data,
+		})
+	}
+
+	return f
+}
+
+// 第 i 条解题记录，队伍和题目按照 i 轮流分配，rank 记录每道题已经有几个解。
+// 前 benchTeams*benchChallenges 条记录里同一个队伍不会重复解同一道题，可以直接写入数据库
+func (f *scoreBoardFixture) newSolve(i int, rank map[int64]int32) scoreBoardSolve {
+	ingameID := int64((i*7+i/benchTeams)%benchChallenges + 1)
+	rank[ingameID]++
+	return scoreBoardSolve{
+		SolveID:     fmt.Sprintf("solve-%d", i),
+		IngameID:    ingameID,
+		ChallengeID: ingameID,
+		TeamID:      int64(i%benchTeams + 1),
+		SolverID:    fmt.Sprintf("user-%d", i%benchTeams),
+		SolveTime:   f.game.StartTime.Add(time.Duration(i) * time.Second),
+		Rank:        rank[ingameID],
+	}
+}
+
+// 和 loadScoreBoardState 一样组装状态，数据来自 fixture
+func (f *scoreBoardFixture) newState(solves []scoreBoardSolve) *scoreBoardState {
+	state := newScoreBoardState()
+	state.game = f.game
+	for _, team := range f.teams {
+		state.teams[team.TeamID] = team
+	}
+	for _, gc := range f.challenges {
+		state.challenges[gc.IngameID] = gc
+	}
+	state.applyEvents(solves, f.adjustments, f.hintUnlocks)
+	state.setSnapshots(f.snapshots)
+	return state
+}
+
+func TestIncrementalScoreBoardMatchesFullRebuild(t *testing.T) {
+	f := newScoreBoardFixture()
+
+	full, err := buildGameScoreBoard(f.newState(f.solves), f.users, nil, "")
+	if err != nil {
+		t.Fatalf("full rebuild: %v", err)
+	}
+
+	half := len(f.solves) / 2
+	state := f.newState(f.solves[:half])
+	if !state.applyEvents(f.solves[half-100:], nil, nil) {
+		t.Fatalf("applyEvents reported no change for new solves")
+	}
+	if state.applyEvents(f.solves[:half], nil, nil) {
+		t.Fatalf("applyEvents reported a change for existing solves")
+	}
+
+	incremental, err := buildGameScoreBoard(state, f.users, nil, "")
+	if err != nil {
+		t.Fatalf("incremental build: %v", err)
+	}
+
+	if len(full.TeamRankings) != len(incremental.TeamRankings) {
+		t.Fatalf("team count: full %d, incremental %d", len(full.TeamRankings), len(incremental.TeamRankings))
+	}
+	for teamID, want := range full.FinalScoreBoardMap {
+		got, ok := incremental.FinalScoreBoardMap[teamID]
+		if !ok {
+			t.Fatalf("team %d missing from incremental scoreboard", teamID)
+		}
+		if got.Rank != want.Rank || got.Score != want.Score || got.Penalty != want.Penalty || len(got.SolvedChallenges) != len(want.SolvedChallenges) {
+			t.Fatalf("team %d: full rank %d score %v penalty %d solves %d, incremental rank %d score %v penalty %d solves %d",
+				teamID, want.Rank, want.Score, want.Penalty, len(want.SolvedChallenges),
+				got.Rank, got.Score, got.Penalty, len(got.SolvedChallenges))
+		}
+	}
+}
+
+// 封榜时的题目分数分成展示用的原始分数和乘上阶段倍率的得分，得分要和排行榜里的解题得分一致
+func TestFrozenChallengeStatsApplyStageMultiplier(t *testing.T) {
+	f := newScoreBoardFixture()
+
+	stageName := "final"
+	f.game.Stages = &models.GameStages{{
+		StageName:       stageName,
+		StartTime:       f.game.StartTime,
+		EndTime:         f.game.EndTime,
+		ScoreMultiplier: 2,
+	}}
+	for i := range f.challenges {
+		if i%2 == 0 {
+			f.challenges[i].BelongStage = &stageName
+		}
+	}
+
+	freezeTime := f.game.StartTime.Add(time.Hour)
+	frozen, err := buildGameScoreBoard(f.newState(f.solves), f.users, &freezeTime, "")
+	if err != nil {
+		t.Fatalf("build frozen scoreboard: %v", err)
+	}
+
+	for _, gc := range f.challenges {
+		stat, ok := frozen.ChallengeStats[gc.ChallengeID]
+		if !ok {
+			t.Fatalf("challenge %d missing from frozen stats", gc.ChallengeID)
+		}
+
+		multiplier := 1.0
+		if gc.BelongStage != nil {
+			multiplier = 2
+		}
+		if stat.SolveScore != stat.CurScore*multiplier {
+			t.Fatalf("challenge %d: solve score %v, cur score %v, multiplier %v", gc.ChallengeID, stat.SolveScore, stat.CurScore, multiplier)
+		}
+	}
+
+	// 封榜前没有三血奖励的解题，得分和 SolveScore 相同
+	for _, team := range frozen.TeamRankings {
+		for _, solve := range team.SolvedChallenges {
+			if solve.BloodReward != 0 {
+				continue
+			}
+			if want := frozen.ChallengeStats[solve.ChallengeID].SolveScore; solve.Score != want {
+				t.Fatalf("team %d challenge %d: score %v, want %v", team.TeamID, solve.ChallengeID, solve.Score, want)
+			}
+		}
+	}
+}
+
+func BenchmarkScoreBoardFullRebuild(b *testing.B) {
+	f := newScoreBoardFixture()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := buildGameScoreBoard(f.newState(f.solves), f.users, nil, ""); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkScoreBoardIncremental(b *testing.B) {
+	f := newScoreBoardFixture()
+	state := f.newState(f.solves)
+
+	rank := make(map[int64]int32)
+	for _, solve := range f.solves {
+		rank[solve.IngameID] = solve.Rank
+	}
+
+	// 每次刷新多一条解题记录，新的记录需要提前生成，不计入耗时
+	newSolves := make([][]scoreBoardSolve, b.N)
+	for i := range newSolves {
+		newSolves[i] = []scoreBoardSolve{f.newSolve(benchSolves+i, rank)}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !state.applyEvents(newSolves[i], nil, nil) {
+			b.Fatal("new solve was not applied")
+		}
+		if _, err := buildGameScoreBoard(state, f.users, nil, ""); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkScoreBoardUnchanged(b *testing.B) {
+	f := newScoreBoardFixture()
+	state := f.newState(f.solves)
+
+	// 增量读取会读到回看窗口里已经处理过的记录
+	lookback := f.solves[len(f.solves)-100:]
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if state.applyEvents(lookback, nil, nil) {
+			b.Fatal("existing solves changed the state")
+		}
+	}
+}
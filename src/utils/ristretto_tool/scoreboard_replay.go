@@ -0,0 +1,283 @@
+package ristretto_tool
+
+import (
+	"a1ctf/src/db/models"
+	dbtool "a1ctf/src/utils/db_tool"
+	"a1ctf/src/webmodels"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// 排行榜回放只使用 scoreboard 表里 UpdateActiveGameScoreBoard 写入的分数快照，
+// 不需要重新从 solves 计算，比赛结束之后也可以回放。
+// 快照里没有罚时，同分的队伍按照达到这个分数的时间排序，再按队伍 ID 排序
+
+type replayScoreChange struct {
+	RecordTime  time.Time
+	Score       float64
+	SolvedCount int
+}
+
+type replayTeam struct {
+	TeamID    int64
+	TeamName  string
+	GroupID   *int64
+	GroupName string
+	// 按时间排序，只保留分数有变化的快照
+	Changes []replayScoreChange
+}
+
+// GameScoreBoardReplay 一场比赛所有正式参赛队伍的分数变化记录
+type GameScoreBoardReplay struct {
+	GameID int64
+	teams  []replayTeam
+}
+
+func loadGameScoreBoardReplay(gameID int64) (*GameScoreBoardReplay, error) {
+	var teams []models.Team
+	if err := dbtool.DB().Where("game_id = ? AND team_status = ? AND team_type = ?", gameID, models.ParticipateApproved, models.TeamTypePlayer).Find(&teams).Error; err != nil {
+		return nil, errors.New("failed to load teams")
+	}
+
+	var scoreboards []models.ScoreBoard
+	if err := dbtool.DB().Where("game_id = ?", gameID).Find(&scoreboards).Error; err != nil {
+		return nil, errors.New("failed to load scoreboard for game")
+	}
+
+	scoreboardMap := make(map[int64]models.ScoreBoard, len(scoreboards))
+	for _, scoreboard := range scoreboards {
+		scoreboardMap[scoreboard.TeamID] = scoreboard
+	}
+
+	replay := &GameScoreBoardReplay{
+		GameID: gameID,
+		teams:  make([]replayTeam, 0, len(teams)),
+	}
+
+	for _, team := range teams {
+		item := replayTeam{
+			TeamID:    team.TeamID,
+			TeamName:  team.TeamName,
+			GroupID:   team.GroupID,
+			GroupName: team.GroupName,
+			Changes:   make([]replayScoreChange, 0),
+		}
+
+		if scoreboard, ok := scoreboardMap[team.TeamID]; ok {
+			data := scoreboard.Data
+			sort.SliceStable(data, func(i, j int) bool {
+				return data[i].RecordTime.Before(data[j].RecordTime)
+			})
+
+			lastScore := 0.0
+			for _, record := range data {
+				if record.Score == lastScore {
+					continue
+				}
+				item.Changes = append(item.Changes, replayScoreChange{
+					RecordTime:  record.RecordTime,
+					Score:       record.Score,
+					SolvedCount: len(record.SolvedChallenges),
+				})
+				lastScore = record.Score
+			}
+		}
+
+		replay.teams = append(replay.teams, item)
+	}
+
+	sort.Slice(replay.teams, func(i, j int) bool {
+		return replay.teams[i].TeamID < replay.teams[j].TeamID
+	})
+
+	return replay, nil
+}
+
+// CachedGameScoreBoardReplay 缓存比赛的分数变化记录
+func CachedGameScoreBoardReplay(gameID int64) (*GameScoreBoardReplay, error) {
+	obj, err := GetOrCacheSingleFlight(fmt.Sprintf("game_scoreboard_replay_%d", gameID), func() (interface{}, error) {
+		return loadGameScoreBoardReplay(gameID)
+	}, scoreboardReplayCacheTime, true)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return obj.(*GameScoreBoardReplay), nil
+}
+
+func (r *GameScoreBoardReplay) filteredTeams(groupID *int64) []*replayTeam {
+	teams := make([]*replayTeam, 0, len(r.teams))
+	for i := range r.teams {
+		team := &r.teams[i]
+		if groupID != nil && (team.GroupID == nil || *team.GroupID != *groupID) {
+			continue
+		}
+		teams = append(teams, team)
+	}
+	return teams
+}
+
+// 回放过程中一支队伍的状态
+type replayState struct {
+	team        *replayTeam
+	score       float64
+	solvedCount int
+	// 达到当前分数的时间，还没有得分的是 nil
+	scoreTime *time.Time
+}
+
+// 分数降序，同分时先达到的排前面，还没有得分的排在最后，最后按队伍 ID
+func replayStateLess(a *replayState, b *replayState) bool {
+	if a.score != b.score {
+		return a.score > b.score
+	}
+	if (a.scoreTime == nil) != (b.scoreTime == nil) {
+		return a.scoreTime != nil
+	}
+	if a.scoreTime != nil && !a.scoreTime.Equal(*b.scoreTime) {
+		return a.scoreTime.Before(*b.scoreTime)
+	}
+	return a.team.TeamID < b.team.TeamID
+}
+
+// RankingAt 重建 recordTime 时的排行榜，指定了分组的时候只在组内排名
+func (r *GameScoreBoardReplay) RankingAt(recordTime time.Time, groupID *int64) []webmodels.ScoreBoardReplayRankItem {
+	teams := r.filteredTeams(groupID)
+
+	states := make([]*replayState, 0, len(teams))
+	for _, team := range teams {
+		state := &replayState{team: team}
+
+		// 最后一条不晚于 recordTime 的快照
+		idx := sort.Search(len(team.Changes), func(i int) bool {
+			return team.Changes[i].RecordTime.After(recordTime)
+		}) - 1
+		if idx >= 0 {
+			change := team.Changes[idx]
+			state.score = change.Score
+			state.solvedCount = change.SolvedCount
+			state.scoreTime = &change.RecordTime
+		}
+
+		states = append(states, state)
+	}
+
+	sort.Slice(states, func(i, j int) bool {
+		return replayStateLess(states[i], states[j])
+	})
+
+	rankings := make([]webmodels.ScoreBoardReplayRankItem, 0, len(states))
+	for i, state := range states {
+		item := webmodels.ScoreBoardReplayRankItem{
+			Rank:        int64(i + 1),
+			TeamID:      state.team.TeamID,
+			TeamName:    state.team.TeamName,
+			GroupID:     state.team.GroupID,
+			GroupName:   state.team.GroupName,
+			Score:       state.score,
+			SolvedCount: state.solvedCount,
+		}
+		if state.scoreTime != nil {
+			scoreTime := state.scoreTime.UnixMilli()
+			item.LastScoreTime = &scoreTime
+		}
+		rankings = append(rankings, item)
+	}
+
+	return rankings
+}
+
+// RankChangeEvents 按时间顺序回放所有分数变化，每次变化生成一条排名变化事件。
+// 只记录分数变化的队伍，被超过的队伍的排名可以通过 RankingAt 得到
+func (r *GameScoreBoardReplay) RankChangeEvents(groupID *int64) []webmodels.ScoreBoardRankChangeEvent {
+	teams := r.filteredTeams(groupID)
+
+	type pendingChange struct {
+		state  *replayState
+		change replayScoreChange
+	}
+
+	order := make([]*replayState, 0, len(teams))
+	changes := make([]pendingChange, 0)
+	for _, team := range teams {
+		state := &replayState{team: team}
+		order = append(order, state)
+		for _, change := range team.Changes {
+			changes = append(changes, pendingChange{state: state, change: change})
+		}
+	}
+
+	// 初始都是 0 分，按队伍 ID 排序
+	sort.Slice(order, func(i, j int) bool {
+		return replayStateLess(order[i], order[j])
+	})
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		if !changes[i].change.RecordTime.Equal(changes[j].change.RecordTime) {
+			return changes[i].change.RecordTime.Before(changes[j].change.RecordTime)
+		}
+		return changes[i].state.team.TeamID < changes[j].state.team.TeamID
+	})
+
+	events := make([]webmodels.ScoreBoardRankChangeEvent, 0, len(changes))
+	for _, pending := range changes {
+		state := pending.state
+
+		oldRank := sort.Search(len(order), func(i int) bool {
+			return !replayStateLess(order[i], state)
+		})
+		oldScore := state.score
+
+		order = append(order[:oldRank], order[oldRank+1:]...)
+
+		recordTime := pending.change.RecordTime
+		state.score = pending.change.Score
+		state.solvedCount = pending.change.SolvedCount
+		state.scoreTime = &recordTime
+
+		newRank := sort.Search(len(order), func(i int) bool {
+			return !replayStateLess(order[i], state)
+		})
+		order = append(order, nil)
+		copy(order[newRank+1:], order[newRank:])
+		order[newRank] = state
+
+		events = append(events, webmodels.ScoreBoardRankChangeEvent{
+			RecordTime: recordTime.UnixMilli(),
+			TeamID:     state.team.TeamID,
+			TeamName:   state.team.TeamName,
+			GroupName:  state.team.GroupName,
+			OldRank:    int64(oldRank + 1),
+			NewRank:    int64(newRank + 1),
+			OldScore:   oldScore,
+			NewScore:   state.score,
+		})
+	}
+
+	return events
+}
+
+// CachedGameScoreBoardRankChangeEvents 缓存比赛的排名变化事件
+func CachedGameScoreBoardRankChangeEvents(gameID int64, groupID *int64) ([]webmodels.ScoreBoardRankChangeEvent, error) {
+	cacheKey := fmt.Sprintf("game_scoreboard_replay_events_%d_all", gameID)
+	if groupID != nil {
+		cacheKey = fmt.Sprintf("game_scoreboard_replay_events_%d_group_%d", gameID, *groupID)
+	}
+
+	obj, err := GetOrCacheSingleFlight(cacheKey, func() (interface{}, error) {
+		replay, err := CachedGameScoreBoardReplay(gameID)
+		if err != nil {
+			return nil, err
+		}
+		return replay.RankChangeEvents(groupID), nil
+	}, scoreboardReplayCacheTime, true)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return obj.([]webmodels.ScoreBoardRankChangeEvent), nil
+}
@@ -0,0 +1,772 @@
+package ristretto_tool
+
+import (
+	"a1ctf/src/db/models"
+	dbtool "a1ctf/src/utils/db_tool"
+	scoretool "a1ctf/src/utils/score_tool"
+	"a1ctf/src/webmodels"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// 排行榜的计算分成两步：loadScoreBoardState 从数据库读出一场比赛算分需要的全部数据，
+// buildGameScoreBoard 只在内存里计算排行榜。排行榜引擎保存读出来的数据，之后只增量读取新的记录
+
+// 算分只需要解题记录里的这些字段，不再 Preload 题目、队伍和解题人
+type scoreBoardSolve struct {
+	SolveID     string
+	IngameID    int64
+	ChallengeID int64
+	TeamID      int64
+	SolverID    string
+	SolveTime   time.Time
+	Rank        int32
+}
+
+type scoreBoardState struct {
+	game models.Game
+	// 正式参赛的选手队伍，排除掉 Admin 队伍
+	teams map[int64]models.Team
+	// ingame_id -> 题目，Preload 了 Challenge
+	challenges map[int64]models.GameChallenge
+	// 按解题时间排序
+	solves []scoreBoardSolve
+	// 按 ID 排序
+	adjustments []models.ScoreAdjustment
+	hintUnlocks []models.HintUnlock
+	// stage_name -> 晋级的队伍
+	stageTeams map[string]map[int64]bool
+	// team_id -> 分数快照，Data 按记录时间排序
+	snapshots map[int64]models.ScoreBoard
+
+	solveIDs      map[string]bool
+	adjustmentIDs map[int64]bool
+	hintUnlockIDs map[int64]bool
+	// 上一次读取数据库的时间
+	syncedAt time.Time
+}
+
+func newScoreBoardState() *scoreBoardState {
+	return &scoreBoardState{
+		teams:         make(map[int64]models.Team),
+		challenges:    make(map[int64]models.GameChallenge),
+		solves:        make([]scoreBoardSolve, 0),
+		adjustments:   make([]models.ScoreAdjustment, 0),
+		hintUnlocks:   make([]models.HintUnlock, 0),
+		stageTeams:    make(map[string]map[int64]bool),
+		snapshots:     make(map[int64]models.ScoreBoard),
+		solveIDs:      make(map[string]bool),
+		adjustmentIDs: make(map[int64]bool),
+		hintUnlockIDs: make(map[int64]bool),
+		syncedAt:      time.Now().UTC(),
+	}
+}
+
+func loadScoreBoardState(gameID int64) (*scoreBoardState, error) {
+	state := newScoreBoardState()
+
+	if err := dbtool.DB().Where("game_id = ?", gameID).First(&state.game).Error; err != nil {
+		return nil, errors.New("failed to load game")
+	}
+
+	var teams []models.Team
+	if err := dbtool.DB().Where("game_id = ? AND team_status = ? AND team_type = ?", gameID, models.ParticipateApproved, models.TeamTypePlayer).Find(&teams).Error; err != nil {
+		return nil, errors.New("failed to load teams")
+	}
+	for _, team := range teams {
+		state.teams[team.TeamID] = team
+	}
+
+	var gameChallenges []models.GameChallenge
+	if err := dbtool.DB().Preload("Challenge").Where("game_id = ?", gameID).Find(&gameChallenges).Error; err != nil {
+		return nil, errors.New("failed to load game challenges")
+	}
+	for _, gc := range gameChallenges {
+		state.challenges[gc.IngameID] = gc
+	}
+
+	var solves []scoreBoardSolve
+	if err := dbtool.DB().Model(&models.Solve{}).
+		Select("solve_id", "ingame_id", "challenge_id", "team_id", "solver_id", "solve_time", "rank").
+		Where("game_id = ?", gameID).
+		Order("solve_time ASC").
+		Scan(&solves).Error; err != nil {
+		return nil, errors.New("failed to load solves")
+	}
+	state.addSolves(solves)
+
+	var adjustments []models.ScoreAdjustment
+	if err := dbtool.DB().Where("game_id = ?", gameID).Order("adjustment_id ASC").Find(&adjustments).Error; err != nil {
+		return nil, errors.New("failed to load score adjustments")
+	}
+	state.addAdjustments(adjustments)
+
+	var hintUnlocks []models.HintUnlock
+	if err := dbtool.DB().Where("game_id = ?", gameID).Order("unlock_id ASC").Find(&hintUnlocks).Error; err != nil {
+		return nil, errors.New("failed to load hint unlocks")
+	}
+	state.addHintUnlocks(hintUnlocks)
+
+	var stageTeams []models.GameStageTeam
+	if err := dbtool.DB().Where("game_id = ?", gameID).Find(&stageTeams).Error; err != nil {
+		return nil, errors.New("failed to load stage teams")
+	}
+	for _, stageTeam := range stageTeams {
+		if _, ok := state.stageTeams[stageTeam.StageName]; !ok {
+			state.stageTeams[stageTeam.StageName] = make(map[int64]bool)
+		}
+		state.stageTeams[stageTeam.StageName][stageTeam.TeamID] = true
+	}
+
+	var scoreboards []models.ScoreBoard
+	if err := dbtool.DB().Where("game_id = ?", gameID).Find(&scoreboards).Error; err != nil {
+		return nil, errors.New("failed to load gameScoreBoard for game")
+	}
+	state.setSnapshots(scoreboards)
+
+	return state, nil
+}
+
+// 下面几个方法跳过已经有的记录，返回是否有新的记录
+
+func (s *scoreBoardState) addSolves(solves []scoreBoardSolve) bool {
+	added := false
+	for _, solve := range solves {
+		if s.solveIDs[solve.SolveID] {
+			continue
+		}
+		s.solveIDs[solve.SolveID] = true
+		s.solves = append(s.solves, solve)
+		added = true
+	}
+
+	if added {
+		sort.SliceStable(s.solves, func(i, j int) bool {
+			return s.solves[i].SolveTime.Before(s.solves[j].SolveTime)
+		})
+	}
+
+	return added
+}
+
+func (s *scoreBoardState) addAdjustments(adjustments []models.ScoreAdjustment) bool {
+	added := false
+	for _, adjustment := range adjustments {
+		if s.adjustmentIDs[adjustment.AdjustmentID] {
+			continue
+		}
+		s.adjustmentIDs[adjustment.AdjustmentID] = true
+		s.adjustments = append(s.adjustments, adjustment)
+		added = true
+	}
+
+	if added {
+		sort.Slice(s.adjustments, func(i, j int) bool {
+			return s.adjustments[i].AdjustmentID < s.adjustments[j].AdjustmentID
+		})
+	}
+
+	return added
+}
+
+func (s *scoreBoardState) addHintUnlocks(hintUnlocks []models.HintUnlock) bool {
+	added := false
+	for _, unlock := range hintUnlocks {
+		if s.hintUnlockIDs[unlock.UnlockID] {
+			continue
+		}
+		s.hintUnlockIDs[unlock.UnlockID] = true
+		s.hintUnlocks = append(s.hintUnlocks, unlock)
+		added = true
+	}
+
+	if added {
+		sort.Slice(s.hintUnlocks, func(i, j int) bool {
+			return s.hintUnlocks[i].UnlockID < s.hintUnlocks[j].UnlockID
+		})
+	}
+
+	return added
+}
+
+func (s *scoreBoardState) setSnapshots(scoreboards []models.ScoreBoard) {
+	for _, scoreboard := range scoreboards {
+		data := make(models.ScoreBoardDatas, len(scoreboard.Data))
+		copy(data, scoreboard.Data)
+		sort.SliceStable(data, func(i, j int) bool {
+			return data[i].RecordTime.Before(data[j].RecordTime)
+		})
+		scoreboard.Data = data
+		s.snapshots[scoreboard.TeamID] = scoreboard
+	}
+}
+
+// applyNewEvents 增量读取上次同步之后新增的解题、分数修正和提示解锁，返回是否有新的记录。
+// 记录的时间在事务提交之前就确定了，所以从上次同步的时间往前 scoreBoardEventLookback 开始读，
+// 已经有的记录会被跳过。修改和删除记录只会发生在管理员操作里，由全量重建处理
+func (s *scoreBoardState) applyNewEvents() (bool, error) {
+	syncedAt := time.Now().UTC()
+	since := s.syncedAt.Add(-scoreBoardEventLookback)
+	gameID := s.game.GameID
+
+	var solves []scoreBoardSolve
+	if err := dbtool.DB().Model(&models.Solve{}).
+		Select("solve_id", "ingame_id", "challenge_id", "team_id", "solver_id", "solve_time", "rank").
+		Where("game_id = ? AND solve_time >= ?", gameID, since).
+		Scan(&solves).Error; err != nil {
+		return false, errors.New("failed to load solves")
+	}
+
+	var adjustments []models.ScoreAdjustment
+	if err := dbtool.DB().Where("game_id = ? AND created_at >= ?", gameID, since).Find(&adjustments).Error; err != nil {
+		return false, errors.New("failed to load score adjustments")
+	}
+
+	var hintUnlocks []models.HintUnlock
+	if err := dbtool.DB().Where("game_id = ? AND unlock_time >= ?", gameID, since).Find(&hintUnlocks).Error; err != nil {
+		return false, errors.New("failed to load hint unlocks")
+	}
+
+	s.syncedAt = syncedAt
+
+	return s.applyEvents(solves, adjustments, hintUnlocks), nil
+}
+
+// 把读出来的记录合并到内存里，返回是否有新的记录
+func (s *scoreBoardState) applyEvents(solves []scoreBoardSolve, adjustments []models.ScoreAdjustment, hintUnlocks []models.HintUnlock) bool {
+	solvesAdded := s.addSolves(solves)
+	adjustmentsAdded := s.addAdjustments(adjustments)
+	hintUnlocksAdded := s.addHintUnlocks(hintUnlocks)
+
+	return solvesAdded || adjustmentsAdded || hintUnlocksAdded
+}
+
+// 比赛时间内正式参赛队伍的解题记录，按解题时间排序
+func (s *scoreBoardState) validSolves(solveEndTime time.Time) []scoreBoardSolve {
+	solves := make([]scoreBoardSolve, 0, len(s.solves))
+	for _, solve := range s.solves {
+		if solve.SolveTime.Before(s.game.StartTime) || solve.SolveTime.After(solveEndTime) {
+			continue
+		}
+		if _, ok := s.teams[solve.TeamID]; !ok {
+			continue
+		}
+		solves = append(solves, solve)
+	}
+	return solves
+}
+
+// buildGameScoreBoard 根据内存里的数据计算排行榜，stageName 为空的时候计算整场比赛的排行榜
+func buildGameScoreBoard(state *scoreBoardState, users map[string]models.User, freezeTime *time.Time, stageName string) (*webmodels.CachedGameScoreBoardData, error) {
+	var cachedData webmodels.CachedGameScoreBoardData
+
+	game := &state.game
+
+	if stageName != "" && game.FindStage(stageName) == nil {
+		return nil, errors.New("stage not found")
+	}
+
+	var finalScoreBoardMap map[int64]webmodels.TeamScoreItem = make(map[int64]webmodels.TeamScoreItem)
+	var timeLines []webmodels.TimeLineItem = make([]webmodels.TimeLineItem, 0)
+
+	teams := make([]models.Team, 0, len(state.teams))
+	for _, team := range state.teams {
+		teams = append(teams, team)
+	}
+
+	// 阶段排行榜只统计这个阶段的题目，有晋级记录的阶段只有晋级的队伍参与排名
+	stageIngameIDs := make(map[int64]bool)
+	if stageName != "" {
+		for _, gc := range state.challenges {
+			if gc.BelongStage != nil && *gc.BelongStage == stageName {
+				stageIngameIDs[gc.IngameID] = true
+			}
+		}
+
+		if qualified := state.stageTeams[stageName]; len(qualified) > 0 {
+			qualifiedTeams := make([]models.Team, 0, len(qualified))
+			for _, team := range teams {
+				if qualified[team.TeamID] {
+					qualifiedTeams = append(qualifiedTeams, team)
+				}
+			}
+			teams = qualifiedTeams
+		}
+	}
+
+	// 获取所有解题记录, 仅在比赛时间内，封榜的时候截止到封榜时间
+	solveEndTime := game.EndTime
+	if freezeTime != nil && freezeTime.Before(solveEndTime) {
+		solveEndTime = *freezeTime
+	}
+
+	solves := state.validSolves(solveEndTime)
+
+	// 统计每道题的解题人数，和 updateActiveGameScores 使用同一个计分策略计算题目分数
+	solveCountMap := make(map[int64]int32) // ingame_id -> solve_count
+	for _, solve := range solves {
+		solveCountMap[solve.IngameID]++
+	}
+
+	// 计算每道题的首杀时间
+	firstSolveTime := make(map[int64]time.Time) // challengeID -> 首杀时间
+	for _, solve := range solves {
+		if _, exists := firstSolveTime[solve.ChallengeID]; !exists {
+			firstSolveTime[solve.ChallengeID] = solve.SolveTime
+		}
+	}
+
+	// 计算每个队伍的总分和罚时
+	teamDataMap := make(map[int64]webmodels.TeamScoreItem)
+
+	// 初始化队伍数据
+	for _, team := range teams {
+
+		// 获取成员信息
+		teamMemberDetail := make([]webmodels.TeamMemberInfo, 0)
+
+		for idx, teamMember := range team.TeamMembers {
+			if member, exists := users[teamMember]; exists {
+				// 第一个是队长
+				teamMemberDetail = append(teamMemberDetail, webmodels.TeamMemberInfo{
+					Avatar:   member.Avatar,
+					UserName: member.Username,
+					UserID:   member.UserID,
+					Captain:  idx == 0,
+				})
+			}
+		}
+
+		teamDataMap[team.TeamID] = webmodels.TeamScoreItem{
+			TeamID:           team.TeamID,
+			TeamName:         team.TeamName,
+			TeamAvatar:       team.TeamAvatar,
+			Members:          teamMemberDetail,
+			TeamSlogan:       team.TeamSlogan,
+			TeamDescription:  team.TeamDescription,
+			GroupID:          team.GroupID,
+			GroupName:        team.GroupName,
+			Score:            0,
+			Penalty:          0,
+			SolvedChallenges: make([]webmodels.TeamSolveItem, 0),
+			ScoreAdjustments: make([]webmodels.TeamScoreAdjustmentItem, 0),
+			LastSolveTime:    0,
+		}
+	}
+
+	// 计算每个队伍的分数和罚时
+	for _, solve := range solves {
+		gc, ok := state.challenges[solve.IngameID]
+		if !ok || !gc.Visible {
+			continue
+		}
+
+		if stageName != "" && !stageIngameIDs[solve.IngameID] {
+			continue
+		}
+
+		if teamData, exists := teamDataMap[solve.TeamID]; exists {
+			// 计算罚时（解题时间 - 首杀时间，单位：秒）
+			penalty := int64(0)
+			if firstTime, ok := firstSolveTime[solve.ChallengeID]; ok {
+				penalty = int64(solve.SolveTime.Sub(firstTime).Seconds())
+			}
+
+			// 阶段倍率同时作用在题目分数和三血奖励上
+			curScore := scoretool.CalculateChallengeScore(&gc, solveCountMap[solve.IngameID]) * game.StageMultiplier(gc.BelongStage)
+			challengeScore := curScore
+			rewardScore := 0.0
+
+			challengeName := gc.Challenge.Name
+
+			// 这里计算分数了，处理一下三血
+			if gc.BloodRewardEnabled && solve.Rank <= 3 {
+
+				var rewardReason string
+				// 三血对于的奖励分数比例是否开启
+				var rankRewardEnabled bool = false
+
+				switch solve.Rank {
+				case 3:
+					rewardScore = float64(game.ThirdBloodReward) * curScore / 100
+					rewardReason = "Third Blood Reward"
+					if game.ThirdBloodReward != 0 {
+						rankRewardEnabled = true
+					}
+				case 2:
+					rewardScore = float64(game.SecondBloodReward) * curScore / 100
+					rewardReason = "Second Blood Reward"
+					if game.SecondBloodReward != 0 {
+						rankRewardEnabled = true
+					}
+				case 1:
+					rewardScore = float64(game.FirstBloodReward) * curScore / 100
+					rewardReason = "First Blood Reward"
+					if game.FirstBloodReward != 0 {
+						rankRewardEnabled = true
+					}
+				}
+
+				if rankRewardEnabled {
+					rewardScore = math.Max(math.Floor(rewardScore), 1)
+
+					rewardReason = fmt.Sprintf("%s for %s", rewardReason, challengeName)
+
+					adjustment := webmodels.TeamScoreAdjustmentItem{
+						AdjustmentID:   -1,
+						AdjustmentType: string(models.AdjustmentTypeReward),
+						ScoreChange:    rewardScore,
+						Reason:         rewardReason,
+						CreatedAt:      solve.SolveTime,
+					}
+
+					challengeScore += rewardScore
+
+					// 往前端添加三血的加分记录
+					teamData.ScoreAdjustments = append(teamData.ScoreAdjustments, adjustment)
+				}
+			}
+
+			teamData.Score += challengeScore
+			teamData.Penalty += penalty
+
+			// 插入解题记录
+			teamData.SolvedChallenges = append(teamData.SolvedChallenges, webmodels.TeamSolveItem{
+				ChallengeID:   solve.ChallengeID,
+				Score:         challengeScore,
+				Solver:        users[solve.SolverID].Username,
+				Rank:          int64(solve.Rank),
+				SolveTime:     solve.SolveTime,
+				BloodReward:   rewardScore,
+				ChallengeName: challengeName,
+			})
+
+			// 更新最后解题时间
+			if teamData.LastSolveTime < solve.SolveTime.UnixMilli() {
+				teamData.LastSolveTime = solve.SolveTime.UnixMilli()
+			}
+
+			teamDataMap[solve.TeamID] = teamData
+		}
+	}
+
+	// 应用分数修正，分数修正不属于任何阶段，只计入整场比赛的排行榜
+	if stageName == "" {
+		for _, adjustment := range state.adjustments {
+			if freezeTime != nil && adjustment.CreatedAt.After(*freezeTime) {
+				continue
+			}
+
+			if teamData, exists := teamDataMap[adjustment.TeamID]; exists {
+				// 应用修正
+				teamData.Score += adjustment.ScoreChange
+
+				// 添加分数修正到队伍的分数修正列表
+				teamData.ScoreAdjustments = append(teamData.ScoreAdjustments, webmodels.TeamScoreAdjustmentItem{
+					AdjustmentID:   adjustment.AdjustmentID,
+					AdjustmentType: string(adjustment.AdjustmentType),
+					ScoreChange:    adjustment.ScoreChange,
+					Reason:         adjustment.Reason,
+					CreatedAt:      adjustment.CreatedAt,
+				})
+				teamDataMap[adjustment.TeamID] = teamData
+			}
+		}
+	}
+
+	// 解锁付费提示花费的分数，作为一条提示类型的分数修正展示
+	for _, unlock := range state.hintUnlocks {
+		if freezeTime != nil && unlock.UnlockTime.After(*freezeTime) {
+			continue
+		}
+
+		if stageName != "" && !stageIngameIDs[unlock.IngameID] {
+			continue
+		}
+
+		if teamData, exists := teamDataMap[unlock.TeamID]; exists {
+			teamData.Score -= unlock.Cost
+
+			challengeName := ""
+			if gc, ok := state.challenges[unlock.IngameID]; ok {
+				challengeName = gc.Challenge.Name
+			}
+
+			teamData.ScoreAdjustments = append(teamData.ScoreAdjustments, webmodels.TeamScoreAdjustmentItem{
+				AdjustmentID:   -1,
+				AdjustmentType: string(models.AdjustmentTypeHint),
+				ScoreChange:    -unlock.Cost,
+				Reason:         fmt.Sprintf("Unlock hint for %s", challengeName),
+				CreatedAt:      unlock.UnlockTime,
+			})
+			teamDataMap[unlock.TeamID] = teamData
+		}
+	}
+
+	// 转换为切片并排序
+	teamRankings := make([]webmodels.TeamScoreItem, 0, len(teamDataMap))
+	for _, teamData := range teamDataMap {
+		teamRankings = append(teamRankings, teamData)
+	}
+
+	// 使用 sort.Slice 进行多条件排序：
+	// 1. 总分降序（分数高的排前面）
+	// 2. 总分相同时，罚时升序（罚时少的排前面）
+	// 3. 罚时相同时，最后解题时间升序（解题时间早的排前面）
+	// 4. 最后比较队伍名称（升序，字典序小的排前面）... 这个应该不会出现
+	sort.Slice(teamRankings, func(i, j int) bool {
+		teamI, teamJ := teamRankings[i], teamRankings[j]
+
+		// 先比较总分（降序）
+		if teamI.Score != teamJ.Score {
+			return teamI.Score > teamJ.Score
+		}
+
+		// 总分相同时比较罚时（升序，罚时少的排前面）
+		if teamI.Penalty != teamJ.Penalty {
+			return teamI.Penalty < teamJ.Penalty
+		}
+
+		// 罚时相同时比较最后解题时间（升序，解题时间早的排前面）
+		if teamI.LastSolveTime != teamJ.LastSolveTime {
+			return teamI.LastSolveTime < teamJ.LastSolveTime
+		}
+
+		// 比较队伍 ID。。。
+		return teamI.TeamID < teamJ.TeamID
+	})
+
+	processedTeamRankings := make([]webmodels.TeamScoreItem, 0, len(teamDataMap))
+
+	// 设置排名
+	for i, teamData := range teamRankings {
+		teamData.Rank = int64(i + 1)
+		tmp := webmodels.TeamScoreItem{
+			TeamID:           teamData.TeamID,
+			TeamName:         teamData.TeamName,
+			TeamAvatar:       teamData.TeamAvatar,
+			TeamSlogan:       teamData.TeamSlogan,
+			TeamDescription:  teamData.TeamDescription,
+			Rank:             teamData.Rank,
+			Score:            teamData.Score,
+			Members:          teamData.Members,
+			Penalty:          teamData.Penalty,
+			SolvedChallenges: teamData.SolvedChallenges,
+			ScoreAdjustments: teamData.ScoreAdjustments,
+			GroupID:          teamData.GroupID,
+			GroupName:        teamData.GroupName,
+		}
+		finalScoreBoardMap[teamData.TeamID] = tmp
+		processedTeamRankings = append(processedTeamRankings, tmp)
+	}
+
+	cachedData.TeamRankings = processedTeamRankings
+
+	// 获取 TOP10
+	idx := 0
+	top10Teams := make([]webmodels.TeamScoreItem, 0, min(10, len(teamRankings)))
+	for _, teamData := range teamRankings {
+		top10Teams = append(top10Teams, webmodels.TeamScoreItem{
+			TeamID:           teamData.TeamID,
+			TeamName:         teamData.TeamName,
+			TeamAvatar:       teamData.TeamAvatar,
+			TeamSlogan:       teamData.TeamSlogan,
+			TeamDescription:  teamData.TeamDescription,
+			Rank:             teamData.Rank,
+			Score:            teamData.Score,
+			Members:          teamData.Members,
+			Penalty:          teamData.Penalty,
+			SolvedChallenges: teamData.SolvedChallenges,
+			ScoreAdjustments: teamData.ScoreAdjustments,
+			GroupID:          teamData.GroupID,
+			GroupName:        teamData.GroupName,
+		})
+		// 防止队伍数量少于 10报错
+		idx += 1
+		if idx == 10 {
+			break
+		}
+	}
+
+	// 构建时间线数据（基于原有的 scoreboard 数据）
+	// 快照记录的是整场比赛的分数，阶段排行榜的时间线在后面根据解题记录生成
+	var teamGameScoreboardMap map[int64]models.ScoreBoard = make(map[int64]models.ScoreBoard)
+	if stageName == "" {
+		for _, team := range teams {
+			scoreboard, ok := state.snapshots[team.TeamID]
+			if !ok {
+				continue
+			}
+
+			// 封榜之后的记录不能出现在时间线里
+			if freezeTime != nil {
+				frozenData := make(models.ScoreBoardDatas, 0, len(scoreboard.Data))
+				for _, record := range scoreboard.Data {
+					if !record.RecordTime.After(*freezeTime) {
+						frozenData = append(frozenData, record)
+					}
+				}
+				scoreboard.Data = frozenData
+			}
+
+			teamGameScoreboardMap[scoreboard.TeamID] = scoreboard
+		}
+	}
+
+	if len(teamGameScoreboardMap) == 0 {
+		// 没有积分榜数据就初始化个新的
+		timeLines = make([]webmodels.TimeLineItem, 0)
+		cachedData.AllTimeLines = make([]webmodels.TimeLineItem, 0)
+	} else {
+		// 构建 TOP10 的时间线
+		timeLineMap := make(map[int64]webmodels.TimeLineItem)
+		prevScoreMap := make(map[int64]float64)
+
+		for _, team := range top10Teams {
+			teamID := team.TeamID
+
+			tmpTimeLine := webmodels.TimeLineItem{
+				TeamID:    teamID,
+				TeamName:  team.TeamName,
+				Scores:    make([]webmodels.TimeLineScoreItem, 0),
+				GroupName: team.GroupName,
+			}
+
+			scoreboard, exists := teamGameScoreboardMap[teamID]
+			if !exists {
+				timeLineMap[teamID] = tmpTimeLine
+				continue
+			}
+
+			for _, record := range scoreboard.Data {
+				lastScore, valid := prevScoreMap[teamID]
+				if !valid || lastScore != record.Score {
+					tmpTimeLine.Scores = append(tmpTimeLine.Scores, webmodels.TimeLineScoreItem{
+						RecordTime: record.RecordTime.UnixMilli(),
+						Score:      record.Score,
+					})
+					prevScoreMap[teamID] = record.Score
+				}
+			}
+
+			timeLineMap[teamID] = tmpTimeLine
+		}
+
+		// 构建所有队伍的时间线
+		allTimeLineMap := make(map[int64]webmodels.TimeLineItem)
+		allPrevScoreMap := make(map[int64]float64)
+
+		// 初始化所有队伍的时间线
+		for _, team := range teams {
+			teamID := team.TeamID
+
+			if teamData, ok := teamDataMap[team.TeamID]; ok {
+				tmpTimeLine := webmodels.TimeLineItem{
+					TeamID:    team.TeamID,
+					TeamName:  teamData.TeamName,
+					Scores:    make([]webmodels.TimeLineScoreItem, 0),
+					GroupName: teamData.GroupName,
+				}
+
+				scoreboard, exists := teamGameScoreboardMap[teamID]
+				if !exists {
+					allTimeLineMap[team.TeamID] = tmpTimeLine
+					continue
+				}
+
+				for _, record := range scoreboard.Data {
+					lastScore, valid := allPrevScoreMap[teamID]
+					if !valid || lastScore != record.Score {
+						tmpTimeLine.Scores = append(tmpTimeLine.Scores, webmodels.TimeLineScoreItem{
+							RecordTime: record.RecordTime.UnixMilli(),
+							Score:      record.Score,
+						})
+						allPrevScoreMap[teamID] = record.Score
+					}
+				}
+
+				allTimeLineMap[team.TeamID] = tmpTimeLine
+			}
+		}
+
+		// 转换 TOP10 时间线数据
+		timeLines = make([]webmodels.TimeLineItem, 0, len(timeLineMap))
+		for _, item := range timeLineMap {
+			timeLines = append(timeLines, item)
+		}
+
+		// 按照最终排名排序时间线
+		sort.Slice(timeLines, func(i, j int) bool {
+			// 找到对应队伍的排名
+			rankI, rankJ := 999999, 999999
+			teamI, ok := finalScoreBoardMap[timeLines[i].TeamID]
+			if ok {
+				rankI = int(teamI.Rank)
+			}
+			teamJ, ok := finalScoreBoardMap[timeLines[j].TeamID]
+			if ok {
+				rankJ = int(teamJ.Rank)
+			}
+			return rankI < rankJ
+		})
+
+		// 转换所有队伍的时间线数据
+		allTimeLines := make([]webmodels.TimeLineItem, 0, len(allTimeLineMap))
+		for _, item := range allTimeLineMap {
+			allTimeLines = append(allTimeLines, item)
+		}
+
+		// 按照最终排名排序所有队伍的时间线
+		sort.Slice(allTimeLines, func(i, j int) bool {
+			// 找到对应队伍的排名
+			rankI, rankJ := 999999, 999999
+			teamI, ok := finalScoreBoardMap[allTimeLines[i].TeamID]
+			if ok {
+				rankI = int(teamI.Rank)
+			}
+			teamJ, ok := finalScoreBoardMap[allTimeLines[j].TeamID]
+			if ok {
+				rankJ = int(teamJ.Rank)
+			}
+			return rankI < rankJ
+		})
+
+		// 将所有队伍的时间线数据存储到结构体中
+		cachedData.AllTimeLines = allTimeLines
+	}
+
+	if stageName != "" {
+		cachedData.AllTimeLines = make([]webmodels.TimeLineItem, 0, len(processedTeamRankings))
+		for _, team := range processedTeamRankings {
+			cachedData.AllTimeLines = append(cachedData.AllTimeLines, solveTimeLine(team))
+		}
+
+		timeLines = make([]webmodels.TimeLineItem, 0, len(top10Teams))
+		for _, team := range top10Teams {
+			timeLines = append(timeLines, solveTimeLine(team))
+		}
+	}
+
+	cachedData.FinalScoreBoardMap = finalScoreBoardMap
+	cachedData.Top10TimeLines = timeLines
+	cachedData.Top10Teams = top10Teams
+
+	// 封榜的时候题目的分数和解题人数也要停在封榜时
+	if freezeTime != nil {
+		cachedData.ChallengeStats = make(map[int64]webmodels.ScoreBoardChallengeStat, len(state.challenges))
+		for _, gc := range state.challenges {
+			solveCount := solveCountMap[gc.IngameID]
+			curScore := scoretool.CalculateChallengeScore(&gc, solveCount)
+			cachedData.ChallengeStats[gc.ChallengeID] = webmodels.ScoreBoardChallengeStat{
+				CurScore:   curScore,
+				SolveScore: curScore * game.StageMultiplier(gc.BelongStage),
+				SolveCount: solveCount,
+			}
+		}
+	}
+
+	return &cachedData, nil
+}
@@ -0,0 +1,63 @@
+package scoretool
+
+import (
+	"a1ctf/src/db/models"
+	"errors"
+	"math"
+)
+
+// CalculateChallengeScore 根据题目的计分策略计算有 solveCount 个队伍解出时的当前分数
+func CalculateChallengeScore(gc *models.GameChallenge, solveCount int32) float64 {
+	if solveCount <= 0 {
+		return gc.TotalScore
+	}
+
+	switch gc.ScoringStrategy {
+	case models.ScoringStrategyStatic:
+		return gc.TotalScore
+	case models.ScoringStrategyLinear:
+		// 第一个解出的队伍拿满分，之后每多一个解线性减少，ScoringDecay 个解之后保持最低分
+		if gc.ScoringDecay <= 0 || solveCount-1 >= gc.ScoringDecay {
+			return gc.MinimalScore
+		}
+		step := (gc.TotalScore - gc.MinimalScore) / float64(gc.ScoringDecay)
+		return math.Max(math.Floor(gc.TotalScore-step*float64(solveCount-1)), gc.MinimalScore)
+	case models.ScoringStrategyLogarithmic:
+		// 和 CTFd 一致: value = (minimum - initial) / decay^2 * (solves - 1)^2 + initial
+		if gc.ScoringDecay <= 0 {
+			return gc.MinimalScore
+		}
+		decay := float64(gc.ScoringDecay)
+		solves := float64(solveCount - 1)
+		value := (gc.MinimalScore-gc.TotalScore)/(decay*decay)*(solves*solves) + gc.TotalScore
+		return math.Max(math.Ceil(value), gc.MinimalScore)
+	default:
+		// 动态分数计算公式
+		minRatio := gc.MinimalScore / gc.TotalScore
+		dynamicRatio := (1 - minRatio) * math.Exp((1-float64(solveCount))/gc.Difficulty)
+		return math.Floor(gc.TotalScore * (minRatio + dynamicRatio))
+	}
+}
+
+// ValidScoringConfig 检查计分策略相关的参数是否合法
+func ValidScoringConfig(gc *models.GameChallenge) error {
+	if gc.MinimalScore > gc.TotalScore {
+		return errors.New("minimal score can't be greater than total score")
+	}
+
+	switch gc.ScoringStrategy {
+	case "", models.ScoringStrategyExponential:
+		if gc.Difficulty <= 0 {
+			return errors.New("difficulty must be greater than 0")
+		}
+	case models.ScoringStrategyLinear, models.ScoringStrategyLogarithmic:
+		if gc.ScoringDecay <= 0 {
+			return errors.New("scoring decay must be greater than 0")
+		}
+	case models.ScoringStrategyStatic:
+	default:
+		return errors.New("unknown scoring strategy")
+	}
+
+	return nil
+}
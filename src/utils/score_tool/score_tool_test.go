@@ -0,0 +1,88 @@
+package scoretool
+
+import (
+	"testing"
+
+	"a1ctf/src/db/models"
+)
+
+func TestCalculateChallengeScore(t *testing.T) {
+	exponential := models.GameChallenge{TotalScore: 1000, MinimalScore: 100, Difficulty: 5, ScoringStrategy: models.ScoringStrategyExponential}
+	legacy := models.GameChallenge{TotalScore: 1000, MinimalScore: 100, Difficulty: 5}
+	linear := models.GameChallenge{TotalScore: 1000, MinimalScore: 100, ScoringDecay: 10, ScoringStrategy: models.ScoringStrategyLinear}
+	logarithmic := models.GameChallenge{TotalScore: 1000, MinimalScore: 100, ScoringDecay: 10, ScoringStrategy: models.ScoringStrategyLogarithmic}
+	static := models.GameChallenge{TotalScore: 500, MinimalScore: 100, ScoringStrategy: models.ScoringStrategyStatic}
+
+	tests := []struct {
+		name       string
+		gc         models.GameChallenge
+		solveCount int32
+		want       float64
+	}{
+		// 指数衰减: floor(total * (min/total + (1 - min/total) * e^((1-n)/difficulty)))
+		{"exponential no solve", exponential, 0, 1000},
+		{"exponential first solve", exponential, 1, 1000},
+		{"exponential decay point", exponential, 6, 431},
+		{"exponential many solves", exponential, 1000, 100},
+		{"empty strategy is exponential", legacy, 5, 504},
+
+		// 线性衰减: 每多一个解减少 (total - min) / decay，decay 个解之后保持最低分
+		{"linear no solve", linear, 0, 1000},
+		{"linear first solve", linear, 1, 1000},
+		{"linear before decay point", linear, 10, 190},
+		{"linear decay point", linear, 11, 100},
+		{"linear many solves", linear, 1000, 100},
+		{"linear zero decay", models.GameChallenge{TotalScore: 1000, MinimalScore: 100, ScoringStrategy: models.ScoringStrategyLinear}, 2, 100},
+		// 向下取整之后低于最低分的时候使用最低分
+		{"linear floor clamped to min", models.GameChallenge{TotalScore: 100, MinimalScore: 99.5, ScoringDecay: 2, ScoringStrategy: models.ScoringStrategyLinear}, 2, 99.5},
+
+		// CTFd logarithmic: ceil((min - total) / decay^2 * (n-1)^2 + total)
+		{"logarithmic no solve", logarithmic, 0, 1000},
+		{"logarithmic first solve", logarithmic, 1, 1000},
+		{"logarithmic decay point", logarithmic, 10, 271},
+		{"logarithmic after decay point", logarithmic, 11, 100},
+		{"logarithmic many solves", logarithmic, 1000, 100},
+		{"logarithmic zero decay", models.GameChallenge{TotalScore: 1000, MinimalScore: 100, ScoringStrategy: models.ScoringStrategyLogarithmic}, 2, 100},
+
+		{"static no solve", static, 0, 500},
+		{"static first solve", static, 1, 500},
+		{"static many solves", static, 1000, 500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CalculateChallengeScore(&tt.gc, tt.solveCount); got != tt.want {
+				t.Fatalf("CalculateChallengeScore(%d) = %v, want %v", tt.solveCount, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidScoringConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		gc      models.GameChallenge
+		wantErr bool
+	}{
+		{"exponential", models.GameChallenge{TotalScore: 1000, MinimalScore: 100, Difficulty: 5, ScoringStrategy: models.ScoringStrategyExponential}, false},
+		{"empty strategy", models.GameChallenge{TotalScore: 1000, MinimalScore: 100, Difficulty: 5}, false},
+		{"exponential zero difficulty", models.GameChallenge{TotalScore: 1000, MinimalScore: 100, ScoringStrategy: models.ScoringStrategyExponential}, true},
+		{"linear", models.GameChallenge{TotalScore: 1000, MinimalScore: 100, ScoringDecay: 10, ScoringStrategy: models.ScoringStrategyLinear}, false},
+		{"linear zero decay", models.GameChallenge{TotalScore: 1000, MinimalScore: 100, ScoringStrategy: models.ScoringStrategyLinear}, true},
+		{"logarithmic", models.GameChallenge{TotalScore: 1000, MinimalScore: 100, ScoringDecay: 10, ScoringStrategy: models.ScoringStrategyLogarithmic}, false},
+		{"logarithmic negative decay", models.GameChallenge{TotalScore: 1000, MinimalScore: 100, ScoringDecay: -1, ScoringStrategy: models.ScoringStrategyLogarithmic}, true},
+		{"static", models.GameChallenge{TotalScore: 1000, MinimalScore: 100, ScoringStrategy: models.ScoringStrategyStatic}, false},
+		{"minimal score equals total", models.GameChallenge{TotalScore: 1000, MinimalScore: 1000, ScoringStrategy: models.ScoringStrategyStatic}, false},
+		{"minimal score greater than total", models.GameChallenge{TotalScore: 100, MinimalScore: 1000, ScoringStrategy: models.ScoringStrategyStatic}, true},
+		{"unknown strategy", models.GameChallenge{TotalScore: 1000, MinimalScore: 100, ScoringStrategy: "unknown"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidScoringConfig(&tt.gc)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidScoringConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package solvetool
+
+import (
+	"a1ctf/src/db/models"
+	dbtool "a1ctf/src/utils/db_tool"
+	noticetool "a1ctf/src/utils/notice_tool"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// advisory lock 的命名空间，避免和其他地方的 advisory lock 冲突
+const solveRankLockClass = "solve_rank"
+
+var ErrAlreadySolved = errors.New("team has already solved this challenge")
+
+// 两个 int4 参数的形式放不下 BIGSERIAL 的 ingame_id，用命名空间加 ingame_id 的 64 位哈希作为锁的 key
+func lockIngameChallenge(tx *gorm.DB, ingameID int64) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(hashtextextended(?, 0))", fmt.Sprintf("%s:%d", solveRankLockClass, ingameID)).Error
+}
+
+// 封榜期间的三血公告会泄露解题情况
+func scoreBoardFrozen(gameID int64) bool {
+	var game models.Game
+	if err := dbtool.DB().Select("freeze_time", "unfreeze_time").Where("game_id = ?", gameID).First(&game).Error; err != nil {
+		return false
+	}
+	return game.ScoreBoardFrozen(time.Now().UTC())
+}
+
+// CreateSolve 在一个事务里完成解题记录插入、排名计算和三血公告插入
+// 同一道题的并发判题通过 ingame_id 上的 advisory lock 串行化，保证不会出现两个一血
+func CreateSolve(solve *models.Solve, teamName string, challengeName string) error {
+	var bloodNotice *models.Notice
+
+	err := dbtool.DB().Transaction(func(tx *gorm.DB) error {
+		if err := lockIngameChallenge(tx, solve.IngameID); err != nil {
+			return fmt.Errorf("failed to lock ingame challenge: %w", err)
+		}
+
+		var solvedCount int64
+		if err := tx.Model(&models.Solve{}).Where("ingame_id = ? AND team_id = ?", solve.IngameID, solve.TeamID).Count(&solvedCount).Error; err != nil {
+			return err
+		}
+
+		if solvedCount > 0 {
+			return ErrAlreadySolved
+		}
+
+		var totalCount int64
+		if err := tx.Model(&models.Solve{}).Where("ingame_id = ?", solve.IngameID).Count(&totalCount).Error; err != nil {
+			return err
+		}
+
+		solve.Rank = int32(totalCount + 1)
+
+		if err := tx.Create(solve).Error; err != nil {
+			return err
+		}
+
+		if solve.Rank <= 3 {
+			var noticeCate models.NoticeCategory
+
+			// 现在由算分逻辑计算三血分数，不使用 score-adjustment
+
+			if solve.Rank == 1 {
+				noticeCate = models.NoticeFirstBlood
+			} else if solve.Rank == 2 {
+				noticeCate = models.NoticeSecondBlood
+			} else {
+				noticeCate = models.NoticeThirdBlood
+			}
+
+			notice, err := noticetool.InsertNoticeWithTx(tx, solve.GameID, noticeCate, []string{teamName, challengeName})
+			if err != nil {
+				return err
+			}
+			bloodNotice = notice
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// 事务提交之后再广播，防止广播了回滚掉的公告，封榜期间不广播
+	if bloodNotice != nil && !scoreBoardFrozen(solve.GameID) {
+		go noticetool.AnnounceNotice(*bloodNotice)
+	}
+
+	return nil
+}
+
+// RecalculateSolveRanks 按照 solve_time 重新计算一场比赛所有题目的解题排名，返回被修正的记录数
+func RecalculateSolveRanks(gameID int64) (int64, error) {
+	var affected int64
+
+	err := dbtool.DB().Transaction(func(tx *gorm.DB) error {
+		var ingameIDs []int64
+		if err := tx.Model(&models.GameChallenge{}).Where("game_id = ?", gameID).Order("ingame_id ASC").Pluck("ingame_id", &ingameIDs).Error; err != nil {
+			return err
+		}
+
+		// 按顺序加锁，防止修复过程中有新的解题记录插入
+		for _, ingameID := range ingameIDs {
+			if err := lockIngameChallenge(tx, ingameID); err != nil {
+				return fmt.Errorf("failed to lock ingame challenge: %w", err)
+			}
+		}
+
+		result := tx.Exec(`UPDATE solves SET rank = ranked.new_rank
+FROM (
+	SELECT solve_id, ROW_NUMBER() OVER (PARTITION BY ingame_id ORDER BY solve_time ASC, solve_id ASC) AS new_rank
+	FROM solves WHERE game_id = ?
+) AS ranked
+WHERE solves.solve_id = ranked.solve_id AND solves.rank IS DISTINCT FROM ranked.new_rank`, gameID)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		affected = result.RowsAffected
+		return nil
+	})
+
+	return affected, err
+}
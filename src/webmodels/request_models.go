@@ -45,6 +45,15 @@ type AdminUpdateGameChallengePayload struct {
 	models.GameChallenge
 }
 
+type AdminScorePreviewPayload struct {
+	MaxSolves       int32                   `json:"max_solves" binding:"required,min=1,max=1000"`
+	ScoringStrategy *models.ScoringStrategy `json:"scoring_strategy"`
+	TotalScore      *float64                `json:"total_score"`
+	MinimalScore    *float64                `json:"minimal_score"`
+	Difficulty      *float64                `json:"difficulty"`
+	ScoringDecay    *int32                  `json:"scoring_decay"`
+}
+
 type AdminListGamePayload struct {
 	Size   int `json:"size" binding:"min=0"`
 	Offset int `json:"offset"`
@@ -73,6 +82,14 @@ type AdminTeamOperationPayload struct {
 	GameID int64 `json:"game_id"`
 }
 
+// 判题脚本测试的负载
+type AdminTestJudgeScriptPayload struct {
+	JudgeScript string `json:"judge_script" binding:"required"`
+	Submission  string `json:"submission"`
+	TeamHash    string `json:"team_hash"`
+	GameID      int64  `json:"game_id"`
+}
+
 // Admin Container payloads
 
 // AdminUpdateUserPayload 用户管理的负载
@@ -113,6 +130,12 @@ type AdminExtendContainerPayload struct {
 	ContainerID string `json:"container_id" binding:"required"`
 }
 
+// 静态容器按照比赛里的题目定位，一道题只有一个共享实例
+type AdminStaticContainerPayload struct {
+	GameID      int64 `json:"game_id" binding:"required"`
+	ChallengeID int64 `json:"challenge_id" binding:"required"`
+}
+
 // Team management payloads
 
 type TeamJoinPayload struct {
@@ -219,3 +242,34 @@ type ForgetPasswordWithVerifyCodePayload struct {
 type ForgetPasswordSendMailPayload struct {
 	Email string `json:"email" binding:"email"`
 }
+
+type AdminListWriteupsPayload struct {
+	Size   int `json:"size" binding:"min=0"`
+	Offset int `json:"offset"`
+	// submitted / unsubmitted，为空时返回全部队伍
+	Submission   string  `json:"submission" binding:"omitempty,oneof=submitted unsubmitted"`
+	ReviewStatus *string `json:"review_status" binding:"omitempty,oneof=Pending Approved Rejected"`
+	TeamName     string  `json:"team_name"`
+}
+
+type AdminReviewWriteupPayload struct {
+	ReviewStatus  models.WriteupReviewStatus `json:"review_status" binding:"required,oneof=Pending Approved Rejected"`
+	ReviewComment *string                    `json:"review_comment"`
+}
+
+type AdminPromoteStageTeamsPayload struct {
+	FromStage string `json:"from_stage" binding:"required"`
+	ToStage   string `json:"to_stage" binding:"required"`
+	// 晋级的队伍数量，不传的时候使用上一阶段设置的 promote_top_n
+	TopN *int64 `json:"top_n" binding:"omitempty,min=1"`
+	// 只在这个分组里取前 N 名
+	GroupID *int64 `json:"group_id"`
+	// 清空下一阶段已有的晋级名单
+	Replace bool `json:"replace"`
+}
+
+type AdminDeleteStageTeamsPayload struct {
+	StageName string `json:"stage_name" binding:"required"`
+	// 为空的时候清空整个晋级名单，所有队伍都能参加这个阶段
+	TeamIDs []int64 `json:"team_ids"`
+}
@@ -72,7 +72,7 @@ type UserDetailGameChallenge struct {
 	Description         string                        `json:"description"`
 	TotalScore          float64                       `json:"total_score"`
 	CurScore            float64                       `json:"cur_score"`
-	Hints               models.Hints                  `json:"hints"`
+	Hints               []UserHintInfo                `json:"hints"`
 	BelongStage         *string                       `json:"belong_stage"`
 	SolveCount          int32                         `json:"solve_count"`
 	Category            models.ChallengeCategory      `json:"category"`
@@ -84,6 +84,16 @@ type UserDetailGameChallenge struct {
 	Visible             bool                          `json:"visible"`
 }
 
+// 付费提示在队伍解锁之前不返回内容
+type UserHintInfo struct {
+	HintID     string    `json:"hint_id"`
+	Content    string    `json:"content"`
+	CreateTime time.Time `json:"create_time"`
+	Visible    bool      `json:"visible"`
+	Cost       float64   `json:"cost"`
+	Locked     bool      `json:"locked"`
+}
+
 type GameNotice struct {
 	NoticeID       int64                 `json:"notice_id"`
 	NoticeCategory models.NoticeCategory `json:"notice_category"`
@@ -102,6 +112,21 @@ type GameScoreboardData struct {
 	Groups               []GameGroupSimple         `json:"groups"`
 	CurrentGroup         *GameGroupSimple          `json:"current_group"`
 	Pagination           *PaginationInfo           `json:"pagination"`
+	Frozen               bool                      `json:"frozen"`
+	FreezeTime           *time.Time                `json:"freeze_time"`
+	Stages               []ScoreBoardStageInfo     `json:"stages"`
+	CurrentStage         *string                   `json:"current_stage"`
+}
+
+// 排行榜可以选择的阶段
+type ScoreBoardStageInfo struct {
+	StageName       string    `json:"stage_name"`
+	StartTime       time.Time `json:"start_time"`
+	EndTime         time.Time `json:"end_time"`
+	ScoreMultiplier float64   `json:"score_multiplier"`
+	PromoteTopN     int64     `json:"promote_top_n"`
+	// 晋级到这个阶段的队伍数量，0 表示所有队伍都能参加
+	QualifiedTeamCount int64 `json:"qualified_team_count"`
 }
 
 // Admin User Controller
@@ -194,12 +219,96 @@ type TeamScoreItem struct {
 	LastSolveTime    int64                     `json:"last_solve_time"`
 }
 
+// 计分策略预览
+type ScorePreviewItem struct {
+	SolveCount int32   `json:"solve_count"`
+	Score      float64 `json:"score"`
+}
+
+// Writeup 相关的响应模型
+type UserWriteupInfo struct {
+	RequireWp     bool                       `json:"require_wp"`
+	WpExpireTime  time.Time                  `json:"wp_expire_time"`
+	Submitted     bool                       `json:"submitted"`
+	FileName      string                     `json:"file_name"`
+	FileSize      int64                      `json:"file_size"`
+	SubmitTime    *time.Time                 `json:"submit_time"`
+	ReviewStatus  models.WriteupReviewStatus `json:"review_status"`
+	ReviewComment *string                    `json:"review_comment"`
+}
+
+type AdminWriteupItem struct {
+	TeamID        int64                       `json:"team_id"`
+	TeamName      string                      `json:"team_name"`
+	GroupName     string                      `json:"group_name"`
+	Submitted     bool                        `json:"submitted"`
+	WriteupID     *int64                      `json:"writeup_id"`
+	FileName      *string                     `json:"file_name"`
+	FileSize      *int64                      `json:"file_size"`
+	FileType      *string                     `json:"file_type"`
+	SubmiterName  *string                     `json:"submiter_name"`
+	SubmitTime    *time.Time                  `json:"submit_time"`
+	ReviewStatus  *models.WriteupReviewStatus `json:"review_status"`
+	ReviewComment *string                     `json:"review_comment"`
+	ReviewTime    *time.Time                  `json:"review_time"`
+	DownloadURL   *string                     `json:"download_url"`
+}
+
 type CachedGameScoreBoardData struct {
 	FinalScoreBoardMap map[int64]TeamScoreItem
 	Top10TimeLines     []TimeLineItem
 	Top10Teams         []TeamScoreItem
 	AllTimeLines       []TimeLineItem
 	TeamRankings       []TeamScoreItem
+	// 只有封榜时的排行榜会统计，challenge_id -> 封榜时的分数和解题人数
+	ChallengeStats map[int64]ScoreBoardChallengeStat
+}
+
+type ScoreBoardChallengeStat struct {
+	// 题目列表里展示的分数，不含阶段倍率
+	CurScore float64
+	// 解出这道题实际得到的分数，乘上了阶段倍率，和排行榜的计分一致
+	SolveScore float64
+	SolveCount int32
+}
+
+// 排行榜回放，根据 scoreboard 表里的分数快照重建
+type ScoreBoardReplayRankItem struct {
+	Rank        int64   `json:"rank"`
+	TeamID      int64   `json:"team_id"`
+	TeamName    string  `json:"team_name"`
+	GroupID     *int64  `json:"group_id"`
+	GroupName   string  `json:"group_name"`
+	Score       float64 `json:"score"`
+	SolvedCount int     `json:"solved_count"`
+	// 达到当前分数的时间（毫秒），没有得分过是 null
+	LastScoreTime *int64 `json:"last_score_time"`
+}
+
+type ScoreBoardReplayData struct {
+	GameID     int64                      `json:"game_id"`
+	RecordTime int64                      `json:"record_time"`
+	Frozen     bool                       `json:"frozen"`
+	Rankings   []ScoreBoardReplayRankItem `json:"rankings"`
+}
+
+// 一支队伍分数变化时的排名变化
+type ScoreBoardRankChangeEvent struct {
+	RecordTime int64   `json:"record_time"`
+	TeamID     int64   `json:"team_id"`
+	TeamName   string  `json:"team_name"`
+	GroupName  string  `json:"group_name"`
+	OldRank    int64   `json:"old_rank"`
+	NewRank    int64   `json:"new_rank"`
+	OldScore   float64 `json:"old_score"`
+	NewScore   float64 `json:"new_score"`
+}
+
+type ScoreBoardRankChangeEvents struct {
+	GameID     int64                       `json:"game_id"`
+	Frozen     bool                        `json:"frozen"`
+	Events     []ScoreBoardRankChangeEvent `json:"events"`
+	Pagination *PaginationInfo             `json:"pagination"`
 }
 
 // Team management responses